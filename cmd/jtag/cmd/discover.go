@@ -16,6 +16,7 @@ var (
 	adapterSerial string
 	adapterSpeed  int
 	simIDCodes    []string // For simulator: list of IDCODEs to return
+	packageSpecs  []string // Package overrides: NAME or INDEX=NAME
 )
 
 var discoverCmd = &cobra.Command{
@@ -54,8 +55,10 @@ func init() {
 		"expected number of devices in chain")
 	discoverCmd.Flags().StringVarP(&bsdlDir, "bsdl", "b", "testdata",
 		"directory containing BSDL files")
+	discoverCmd.Flags().StringSliceVar(&packageSpecs, "package", nil,
+		"package variant override: NAME or INDEX=NAME (repeatable)")
 	discoverCmd.Flags().StringVarP(&adapterSerial, "serial", "s", "",
-		"adapter serial number (if multiple adapters)")
+		"adapter serial number or USB bus:port (if multiple adapters)")
 	discoverCmd.Flags().IntVar(&adapterSpeed, "speed", 1000000,
 		"TCK speed in Hz (default 1MHz)")
 	discoverCmd.Flags().StringSliceVar(&simIDCodes, "sim-ids", nil,
@@ -134,6 +137,9 @@ func runDiscover(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("chain discovery failed: %w", err)
 	}
+	if err := jtagChain.SetPackages(packageSpecs); err != nil {
+		return err
+	}
 
 	// Display discovered devices
 	devices := jtagChain.Devices()
@@ -147,7 +153,7 @@ func runDiscover(cmd *cobra.Command, args []string) error {
 		fmt.Printf("┌─ Device %d (Position %d) ─────────────────────────────────────┐\n", i+1, device.Position)
 		fmt.Printf("│ IDCODE: 0x%08X                                          │\n", device.IDCode)
 
-		if device.Info != nil {
+		if device.HasBSDL() {
 			fmt.Printf("│ Name:   %s\n", device.Name())
 			fmt.Printf("│                                                              │\n")
 			fmt.Printf("│ Device Information:                                          │\n")
@@ -203,7 +209,8 @@ func runDiscover(cmd *cobra.Command, args []string) error {
 				}
 			}
 		} else {
-			fmt.Printf("│ Name:   UNKNOWN (no matching BSDL file)                     │\n")
+			fmt.Printf("│ Name:   %s (no BSDL, held in BYPASS)\n", device.Name())
+			fmt.Printf("│   IR Length:       %d bits                                  │\n", device.Info.InstructionLength)
 		}
 
 		fmt.Printf("└──────────────────────────────────────────────────────────────┘\n\n")
@@ -273,8 +280,8 @@ func createAdapter(adapterType, serial string) (jtag.Adapter, error) {
 			fmt.Println("Opening CMSIS-DAP probe...")
 		}
 
-		// Create CMSIS-DAP adapter (default Raspberry Pi Pico VID/PID)
-		adapter, err := jtag.NewCMSISDAPAdapter(jtag.VendorIDRaspberryPi, jtag.ProductIDCMSISDAP)
+		// Open the first known CMSIS-DAP probe (debugprobe, DAPLink, J-Link)
+		adapter, err := jtag.OpenCMSISDAPAdapter(jtag.ParseProbeSelector(serial))
 		if err != nil {
 			return nil, fmt.Errorf("failed to open CMSIS-DAP probe: %w", err)
 		}
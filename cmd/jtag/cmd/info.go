@@ -28,10 +28,12 @@ type DeviceInfo struct {
 	Position       int              `json:"position"`
 	IDCode         string           `json:"idcode"`
 	Name           string           `json:"name"`
+	HasBSDL        bool             `json:"has_bsdl"`
 	Manufacturer   string           `json:"manufacturer,omitempty"`
 	IRLength       int              `json:"ir_length"`
 	BoundaryLength int              `json:"boundary_length"`
 	Package        string           `json:"package,omitempty"`
+	PinMapPackage  string           `json:"pin_map_package,omitempty"`
 	Instructions   []InstructionInfo `json:"instructions"`
 	Pins           []PinInfo        `json:"pins,omitempty"`
 	TAPConfig      *TAPInfo         `json:"tap_config,omitempty"`
@@ -96,6 +98,8 @@ func init() {
 		"simulator: IDCODEs to return")
 	infoCmd.Flags().StringVarP(&bsdlDir, "bsdl", "b", "testdata",
 		"directory containing BSDL files")
+	infoCmd.Flags().StringSliceVar(&packageSpecs, "package", nil,
+		"package variant override: NAME or INDEX=NAME (repeatable)")
 	infoCmd.Flags().StringVarP(&adapterType, "adapter", "a", "simulator",
 		"JTAG adapter type")
 
@@ -128,6 +132,9 @@ func runInfo(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("chain discovery failed: %w", err)
 	}
+	if err := jtagChain.SetPackages(packageSpecs); err != nil {
+		return err
+	}
 
 	// Build chain info
 	chainInfo := buildChainInfo(jtagChain)
@@ -152,6 +159,7 @@ func buildChainInfo(jtagChain *chain.Chain) *ChainInfo {
 			Position: dev.Position,
 			IDCode:   fmt.Sprintf("0x%08X", dev.IDCode),
 			Name:     dev.Name(),
+			HasBSDL:  dev.HasBSDL(),
 		}
 
 		if dev.Info != nil {
@@ -167,6 +175,7 @@ func buildChainInfo(jtagChain *chain.Chain) *ChainInfo {
 
 		// Extract package from name
 		devInfo.Package = extractPackage(dev.Name())
+		devInfo.PinMapPackage = dev.PackageName()
 
 		// Instructions
 		instructions := dev.Instructions()
@@ -182,7 +191,7 @@ func buildChainInfo(jtagChain *chain.Chain) *ChainInfo {
 
 		// Pin mappings
 		if dev.File != nil && dev.File.Entity != nil {
-			pinMap := dev.File.Entity.GetPinMap()
+			pinMap := dev.PinMap()
 			if len(pinMap) > 0 {
 				devInfo.Pins = make([]PinInfo, 0, len(pinMap))
 				for signal, pin := range pinMap {
@@ -230,7 +239,11 @@ func outputHumanFormat(info *ChainInfo) error {
 	fmt.Printf("╚════════════════════════════════════════════════════════════════╝\n\n")
 
 	for i, dev := range info.Devices {
-		fmt.Printf("Device %d: %s\n", i+1, dev.Name)
+		if dev.HasBSDL {
+			fmt.Printf("Device %d: %s\n", i+1, dev.Name)
+		} else {
+			fmt.Printf("Device %d: %s (no BSDL, held in BYPASS)\n", i+1, dev.Name)
+		}
 		fmt.Printf("  Position:     %d\n", dev.Position)
 		fmt.Printf("  IDCODE:       %s\n", dev.IDCode)
 		if dev.Manufacturer != "" {
@@ -239,6 +252,9 @@ func outputHumanFormat(info *ChainInfo) error {
 		if dev.Package != "" {
 			fmt.Printf("  Package:      %s\n", dev.Package)
 		}
+		if dev.PinMapPackage != "" {
+			fmt.Printf("  Pin Map:      %s\n", dev.PinMapPackage)
+		}
 		fmt.Printf("  IR Length:    %d bits\n", dev.IRLength)
 		fmt.Printf("  Boundary:     %d bits\n", dev.BoundaryLength)
 		fmt.Printf("  Instructions: %d total\n", len(dev.Instructions))
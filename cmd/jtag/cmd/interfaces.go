@@ -39,6 +39,12 @@ func runInterfaces(cmd *cobra.Command, args []string) error {
 	fmt.Println("Detected JTAG interfaces:")
 	for _, iface := range infos {
 		fmt.Printf("  - %s [%s] (VID:PID %04X:%04X)\n", iface.Label(), iface.Kind, iface.VendorID, iface.ProductID)
+		if iface.Serial != "" {
+			fmt.Printf("      Serial: %s\n", iface.Serial)
+		}
+		if iface.Path != "" {
+			fmt.Printf("      USB path: %s\n", iface.Path)
+		}
 	}
 
 	return nil
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
 	"github.com/spf13/cobra"
@@ -11,6 +12,7 @@ var (
 	showInstructions bool
 	showBoundary     bool
 	showPins         bool
+	pinPackage       string
 )
 
 var parseCmd = &cobra.Command{
@@ -36,6 +38,8 @@ func init() {
 		"show boundary scan cells")
 	parseCmd.Flags().BoolVarP(&showPins, "pins", "p", false,
 		"show pin mappings")
+	parseCmd.Flags().StringVar(&pinPackage, "package", "",
+		"package variant for pin mappings (default: PHYSICAL_PIN_MAP)")
 }
 
 func runParse(cmd *cobra.Command, args []string) error {
@@ -229,6 +233,17 @@ func runParse(cmd *cobra.Command, args []string) error {
 	// Pin mappings
 	if showPins {
 		pinMap := entity.GetPinMap()
+		pkgName := entity.DefaultPackage()
+		if pinPackage != "" {
+			pinMap, err = entity.GetPinMapForPackage(pinPackage)
+			if err != nil {
+				return err
+			}
+			pkgName = pinPackage
+		}
+		if packages := entity.PackageNames(); len(packages) > 1 {
+			fmt.Printf("Packages: %s (showing %s)\n", strings.Join(packages, ", "), pkgName)
+		}
 		if len(pinMap) > 0 {
 			fmt.Printf("Pin Mappings: %d signals\n", len(pinMap))
 
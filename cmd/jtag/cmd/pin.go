@@ -53,6 +53,8 @@ func init() {
 		"simulator: IDCODEs to return")
 	pinCmd.Flags().StringVarP(&bsdlDir, "bsdl", "b", "testdata",
 		"directory containing BSDL files")
+	pinCmd.Flags().StringSliceVar(&packageSpecs, "package", nil,
+		"package variant override: NAME or INDEX=NAME (repeatable)")
 	pinCmd.Flags().StringVarP(&adapterType, "adapter", "a", "simulator",
 		"JTAG adapter type")
 
@@ -108,6 +110,9 @@ func runPin(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("chain discovery failed: %w", err)
 	}
+	if err := jtagChain.SetPackages(packageSpecs); err != nil {
+		return err
+	}
 
 	devices := jtagChain.Devices()
 	if verbose {
@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"time"
 
+	appui "github.com/OpenTraceLab/OpenTraceJTAG/internal/ui"
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/chain"
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/kicad/schematic"
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/reveng"
 	"github.com/spf13/cobra"
 )
@@ -19,12 +22,24 @@ var (
 	// Flags for reveng command
 	revengOutputJSON  string
 	revengOutputKiCad string
+	revengOutputSch   string
 	revengRepeats     int
+	revengSymmetric   bool
+	revengMinVotes    int
+	revengPulls       bool
+	revengCheckpoint  string
+	revengResume      bool
+	revengSeed        string
+	revengComponents  []string
+	revengFootprints  []string
 	revengSkipJTAG    bool
 	revengSkipPower   bool
 	revengOnlyDevices []string
 	revengOnlyPins    string
 	revengTimeout     int // timeout in seconds
+	revengGuard       string
+	revengAlgorithm   string
+	revengChains      []string
 )
 
 var revengCmd = &cobra.Command{
@@ -43,25 +58,105 @@ The algorithm:
      - Drive pin LOW again and capture all inputs
      - Detect pins that toggled (electrically connected)
   3. Build netlist from detected connections
-  4. Export to JSON and/or KiCad format
+  4. Export to JSON, a KiCad netlist and/or a KiCad schematic
 
 Examples:
   # Basic usage with simulator
   jtag reveng --adapter simulator --count 2 --bsdl testdata --output netlist.json
 
   # Real hardware with CMSIS-DAP
+  jtag reveng --adapter cmsisdap --count 2 --bsdl testdata \
+    --chain cmsisdap:1:0002 --serial 0001 --output netlist.json
+
   jtag reveng --adapter cmsisdap --count 2 --bsdl /path/to/bsdl \
-    --output netlist.json --output-kicad netlist.net
+    --output netlist.json --output-kicad netlist.net \
+    --output-schematic board.kicad_sch
 
   # Filter specific devices or pins
   jtag reveng --adapter cmsisdap --count 3 --bsdl testdata \
     --only-devices "STM32,FLASH" --only-pins "P[AB][0-9]+" \
     --output result.json
 
+  # Never drive a regulator enable or a pin that could short a rail
+  jtag reveng --adapter cmsisdap --count 2 --bsdl testdata \
+    --guard board-guard.json --output netlist.json
+
   # Skip JTAG and power pins (recommended)
   jtag reveng --adapter cmsisdap --count 2 --bsdl testdata \
     --skip-jtag --skip-power --output netlist.json
 
+Noisy boards:
+  --repeats N runs N toggle cycles per pin and counts how many each
+  connection shows up in; --min-votes drops connections seen fewer times.
+  --symmetric adds a 1→0→1 cycle to every repeat, rejecting pins that only
+  follow one edge (e.g. a weak pull fighting the driver). Each net reports
+  a confidence: its weakest connection's votes divided by the repeats.
+
+Interrupted runs:
+  Progress is saved to --checkpoint (reveng.checkpoint by default) as the
+  scan goes. On Ctrl-C, --timeout or an adapter error the connections found
+  so far are still printed and exported. Run again with --resume to skip
+  the pins already scanned; the checkpoint must come from the same chain.
+
+Re-verifying a board:
+  --seed takes the JSON or KiCad (.net) netlist of an earlier run. Only one
+  pin of each known net is driven and the rest are checked as receivers, so
+  a repeat run over a known board takes seconds. Pins that no longer follow their
+  net, or known nets that turn out connected, are reported as
+  contradictions; the output always reflects what was measured.
+
+Net names:
+  Nets are named from the BSDL port names of their pins. GPIO-style names
+  (PA5, P1_12, IO_B7) give way to a named pin on the other end, and bus
+  roles get their bus: MCU PA5 + flash SCK is SPI_SCK, SDA is I2C_SDA, TXD
+  is UART_TX, A12/D3 are ADDR12/DATA3. Nets without a descriptive port are
+  named after their first pin, e.g. Net-(U1-PA5). Names are saved in both
+  output formats; a seed keeps the names given by hand.
+
+Several chains:
+  Boards with more than one JTAG header are scanned as one: --chain
+  ADAPTER:COUNT[:SERIAL] (repeatable) adds a chain on its own adapter next
+  to the one given by --adapter, --count and --serial. Every pin is driven
+  on its own chain and listened for on all of them, so nets crossing
+  between headers are found. --bsdl and --speed apply to every chain,
+  --package to the first one only. --guard covers every chain: name pins
+  on further chains CHAIN.DEVICE.PIN, e.g. 1.EPM240.K3; known nets must
+  stay within one chain.
+
+Board parts:
+  The KiCad netlist names each device U1, U2, ... in chain order, with its
+  BSDL package in the jtag_package property; devices on the second chain
+  are U101, U102, ..., on the third U201 and so on. Footprints come from
+  the package: the "footprints" table of the application config file
+  (~/.config/opentracejtag/config.json) maps BSDL package names to KiCad
+  footprints, e.g. {"footprints": {"LQFP64":
+  "Package_QFP:LQFP-64_10x10mm_P0.5mm"}}, and --footprint PACKAGE=FOOTPRINT
+  (repeatable) adds to or overrides it for one run. Devices whose package
+  is in neither get no footprint.
+  --component INDEX=REF[,FOOTPRINT]
+  (repeatable) sets the reference and footprint of the device at that chain
+  index, e.g. --component 0=U3,Package_QFP:LQFP-48_7x7mm_P0.5mm; use
+  CHAIN.INDEX for devices on further chains. Pins carry their package number
+  and BSDL port name either way.
+
+  --output-schematic draws one symbol per device, pins named after the BSDL
+  ports: inputs and bidirectional pins on the left, outputs and linkage/power
+  pins on the right. Every discovered net becomes a global label on its
+  pins, so the sheet is connected without wires; floating pins get a
+  no-connect flag.
+
+Pin classification:
+  --classify-pins reads every pin idle, driven and just released before the
+  scan and reports it as stuck_low/stuck_high (tied to GND/VCC), pull_up,
+  pull_down, floating, weak_driver or unknown. The classes are saved in
+  both output formats.
+
+Large boards:
+  --algorithm coded drives all pins at once with binary codes, needing
+  about 2*log2(n) scans instead of 3 per pin, and re-checks nets with
+  several drivers one pin at a time. Pins on a shared net briefly drive
+  against each other, so use --guard to protect sensitive nets.
+
 Performance:
   - Time complexity: O(n²) where n = number of pins
   - Typical speed: 10-50 pins/second
@@ -79,8 +174,10 @@ func init() {
 		"expected number of devices in chain")
 	revengCmd.Flags().StringVarP(&bsdlDir, "bsdl", "b", "testdata",
 		"directory containing BSDL files")
+	revengCmd.Flags().StringSliceVar(&packageSpecs, "package", nil,
+		"package variant override: NAME or INDEX=NAME (repeatable)")
 	revengCmd.Flags().StringVarP(&adapterSerial, "serial", "s", "",
-		"adapter serial number (if multiple adapters)")
+		"adapter serial number or USB bus:port (if multiple adapters)")
 	revengCmd.Flags().IntVar(&adapterSpeed, "speed", 1000000,
 		"TCK speed in Hz (default 1MHz)")
 
@@ -89,8 +186,16 @@ func init() {
 		"output JSON file path (e.g., netlist.json)")
 	revengCmd.Flags().StringVar(&revengOutputKiCad, "output-kicad", "",
 		"output KiCad netlist file path (e.g., netlist.net)")
+	revengCmd.Flags().StringVar(&revengOutputSch, "output-schematic", "",
+		"output KiCad schematic file path (e.g., board.kicad_sch)")
 	revengCmd.Flags().IntVar(&revengRepeats, "repeats", 1,
 		"number of toggle cycles per pin (default: 1)")
+	revengCmd.Flags().BoolVar(&revengSymmetric, "symmetric", false,
+		"also run a 1→0→1 cycle per repeat and require both to toggle")
+	revengCmd.Flags().IntVar(&revengMinVotes, "min-votes", 1,
+		"repeats a connection must toggle in to be kept (at most --repeats)")
+	revengCmd.Flags().BoolVar(&revengPulls, "classify-pins", false,
+		"classify pins as floating, pulled up/down or stuck before scanning")
 	revengCmd.Flags().BoolVar(&revengSkipJTAG, "skip-jtag", true,
 		"skip JTAG control pins (TCK, TMS, TDI, TDO)")
 	revengCmd.Flags().BoolVar(&revengSkipPower, "skip-power", true,
@@ -101,6 +206,22 @@ func init() {
 		"only scan pins matching this regex pattern")
 	revengCmd.Flags().IntVar(&revengTimeout, "timeout", 0,
 		"timeout in seconds (0 = no timeout)")
+	revengCmd.Flags().StringVar(&revengAlgorithm, "algorithm", string(reveng.AlgorithmSequential),
+		"drive strategy: sequential (one pin at a time) or coded (all pins at once)")
+	revengCmd.Flags().StringVar(&revengCheckpoint, "checkpoint", "reveng.checkpoint",
+		"file to save progress to while scanning (empty to disable)")
+	revengCmd.Flags().BoolVar(&revengResume, "resume", false,
+		"continue the run saved in --checkpoint, with its settings")
+	revengCmd.Flags().StringVar(&revengSeed, "seed", "",
+		"JSON or KiCad netlist of known nets (e.g. an earlier --output) to verify instead of rediscover")
+	revengCmd.Flags().StringArrayVar(&revengComponents, "component", nil,
+		"board part of a chain device as [CHAIN.]INDEX=REF[,FOOTPRINT] (repeatable)")
+	revengCmd.Flags().StringArrayVar(&revengFootprints, "footprint", nil,
+		"KiCad footprint of a BSDL package as PACKAGE=FOOTPRINT, over the config file (repeatable)")
+	revengCmd.Flags().StringArrayVar(&revengChains, "chain", nil,
+		"another chain on its own adapter as ADAPTER:COUNT[:SERIAL] (repeatable)")
+	revengCmd.Flags().StringVar(&revengGuard, "guard", "",
+		"JSON file with do-not-drive pins, forced levels and known nets")
 
 	revengCmd.MarkFlagRequired("count")
 }
@@ -108,31 +229,9 @@ func init() {
 func runReveng(cmd *cobra.Command, args []string) error {
 	startTime := time.Now()
 
-	// Create adapter
-	if verbose {
-		fmt.Printf("Creating %s adapter...\n", adapterType)
-	}
-
-	adapter, err := createAdapter(adapterType, adapterSerial)
+	specs, err := parseChainSpecs(revengChains)
 	if err != nil {
-		return fmt.Errorf("failed to create adapter: %w", err)
-	}
-
-	// Set speed
-	if err := adapter.SetSpeed(adapterSpeed); err != nil && err != jtag.ErrNotImplemented {
-		return fmt.Errorf("failed to set speed: %w", err)
-	}
-
-	// Show adapter info
-	if verbose {
-		info, err := adapter.Info()
-		if err == nil {
-			fmt.Printf("\nAdapter: %s\n", info.Name)
-			if info.SerialNumber != "" {
-				fmt.Printf("Serial: %s\n", info.SerialNumber)
-			}
-			fmt.Println()
-		}
+		return err
 	}
 
 	// Create repository and load BSDL files
@@ -149,52 +248,111 @@ func runReveng(cmd *cobra.Command, args []string) error {
 		fmt.Println("BSDL files loaded successfully")
 	}
 
-	// Discover chain
-	fmt.Printf("Discovering JTAG chain (expecting %d device(s))...\n", deviceCount)
+	var ctls []*bsr.Controller
+	for i, spec := range specs {
+		if len(specs) > 1 {
+			fmt.Printf("Chain %d: ", i)
+		}
+		jtagChain, err := openRevengChain(spec, repo)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			if err := jtagChain.SetPackages(packageSpecs); err != nil {
+				return err
+			}
+		}
 
-	chainCtrl := chain.NewController(adapter, repo)
-	jtagChain, err := chainCtrl.Discover(deviceCount)
-	if err != nil {
-		return fmt.Errorf("chain discovery failed: %w", err)
-	}
+		devices := jtagChain.Devices()
+		fmt.Printf("✓ Found %d device(s)\n", len(devices))
 
-	devices := jtagChain.Devices()
-	fmt.Printf("✓ Found %d device(s)\n", len(devices))
+		// Display device summary
+		for j, device := range devices {
+			fmt.Printf("  [%d] %s (IDCODE: 0x%08X)\n", j, device.Name(), device.IDCode)
+		}
+		fmt.Println()
 
-	// Display device summary
-	for i, device := range devices {
-		fmt.Printf("  [%d] %s (IDCODE: 0x%08X)\n", i, device.Name(), device.IDCode)
-	}
-	fmt.Println()
+		// Create BSR controller
+		if verbose {
+			fmt.Println("Initializing boundary-scan runtime...")
+		}
 
-	// Create BSR controller
-	if verbose {
-		fmt.Println("Initializing boundary-scan runtime...")
+		bsrCtrl, err := bsr.NewController(jtagChain)
+		if err != nil {
+			return fmt.Errorf("failed to create BSR controller: %w", err)
+		}
+		ctls = append(ctls, bsrCtrl)
 	}
-
-	bsrCtrl, err := bsr.NewController(jtagChain)
+	sess, err := bsr.NewSession(ctls...)
 	if err != nil {
-		return fmt.Errorf("failed to create BSR controller: %w", err)
+		return err
+	}
+	if revengGuard != "" {
+		guard, err := bsr.LoadGuard(revengGuard)
+		if err != nil {
+			return err
+		}
+		if err := sess.SetGuard(guard); err != nil {
+			return err
+		}
+		fmt.Printf("Guard: %d do-not-drive, %d forced, %d known net(s)\n",
+			len(guard.DoNotDrive), len(guard.Force), len(guard.Nets))
 	}
 
 	// Count total pins
-	totalPins := len(bsrCtrl.AllPins())
+	totalPins := len(sess.AllPins())
 	fmt.Printf("Total IO pins: %d\n\n", totalPins)
 
 	// Configure reverse engineering
 	cfg := reveng.DefaultConfig()
+	cfg.Algorithm = reveng.Algorithm(revengAlgorithm)
 	cfg.RepeatsPerPin = revengRepeats
+	cfg.RequireSymmetricToggle = revengSymmetric
+	cfg.MinToggleStrength = revengMinVotes
+	cfg.DetectPullResistors = revengPulls
 	cfg.SkipKnownJTAGPins = revengSkipJTAG
 	cfg.SkipPowerPins = revengSkipPower
 	cfg.OnlyDevices = revengOnlyDevices
 	cfg.OnlyPinPattern = revengOnlyPins
 
+	if revengResume {
+		if revengCheckpoint == "" {
+			return fmt.Errorf("--resume needs a --checkpoint file")
+		}
+		cp, err := reveng.LoadCheckpoint(revengCheckpoint)
+		if err != nil {
+			return err
+		}
+		resumed := cp.Config
+		cfg = &resumed
+		cfg.Resume = cp
+		fmt.Printf("Resuming run from %s (saved %s, %d driver(s) done)\n",
+			revengCheckpoint, cp.Saved.Format(time.RFC3339), len(cp.Done))
+	}
+	cfg.CheckpointFile = revengCheckpoint
+	if revengSeed != "" {
+		seed, err := loadSeed(revengSeed)
+		if err != nil {
+			return err
+		}
+		cfg.Seed = seed
+		fmt.Printf("Seed: %d known net(s) from %s\n", len(seed.Nets), revengSeed)
+	}
+
+	components, err := parseComponents(revengComponents, sess)
+	if err != nil {
+		return err
+	}
+	if cfg.Footprints, err = footprintTable(revengFootprints); err != nil {
+		return err
+	}
+
 	if err := cfg.Validate(); err != nil {
 		return fmt.Errorf("invalid configuration: %w", err)
 	}
 
 	// Count candidate pins after filtering
-	candidateCount := countCandidates(bsrCtrl, cfg)
+	candidateCount := countCandidates(sess, cfg)
 	fmt.Printf("Candidate pins (after filtering): %d\n", candidateCount)
 
 	if cfg.SkipKnownJTAGPins {
@@ -223,8 +381,10 @@ func runReveng(cmd *cobra.Command, args []string) error {
 	progressCh := make(chan reveng.Progress, 10)
 	go displayProgress(progressCh)
 
-	// Set up context with optional timeout
-	ctx := context.Background()
+	// Set up context with optional timeout; Ctrl-C stops the scan cleanly so
+	// the checkpoint and partial results are kept
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 	if revengTimeout > 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, time.Duration(revengTimeout)*time.Second)
@@ -237,12 +397,21 @@ func runReveng(cmd *cobra.Command, args []string) error {
 	fmt.Println("╚════════════════════════════════════════════════════════════════╝")
 	fmt.Println()
 
-	netlist, err := reveng.DiscoverNetlist(ctx, bsrCtrl, cfg, progressCh)
+	netlist, err := reveng.DiscoverSession(ctx, sess, cfg, progressCh)
 	close(progressCh)
 
-	if err != nil {
+	if err != nil && netlist == nil {
 		return fmt.Errorf("reverse engineering failed: %w", err)
 	}
+	if err != nil {
+		fmt.Printf("\nScan stopped: %v\n", err)
+		fmt.Println("Saving the connections found so far.")
+		if cfg.CheckpointFile != "" {
+			fmt.Printf("Continue later with --resume (checkpoint: %s)\n", cfg.CheckpointFile)
+		}
+	}
+	scanErr := err
+	applyComponents(netlist, components)
 
 	elapsed := time.Since(startTime)
 
@@ -265,8 +434,27 @@ func runReveng(cmd *cobra.Command, args []string) error {
 		fmt.Printf("✓ KiCad netlist saved to: %s\n", revengOutputKiCad)
 	}
 
-	if revengOutputJSON == "" && revengOutputKiCad == "" {
-		fmt.Println("\n⚠ No output files specified. Use --output or --output-kicad to save results.")
+	if revengOutputSch != "" {
+		if err := exportSchematic(netlist, sess, revengOutputSch); err != nil {
+			return err
+		}
+		fmt.Printf("✓ KiCad schematic saved to: %s\n", revengOutputSch)
+	}
+
+	saved := revengOutputJSON != "" || revengOutputKiCad != "" || revengOutputSch != ""
+	if !saved {
+		fmt.Println("\n⚠ No output files specified. Use --output, --output-kicad or --output-schematic to save results.")
+	}
+
+	if scanErr != nil {
+		return fmt.Errorf("reverse engineering stopped: %w", scanErr)
+	}
+
+	// The results are saved, so the checkpoint has served its purpose
+	if cfg.CheckpointFile != "" && saved {
+		if err := os.Remove(cfg.CheckpointFile); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("⚠ Could not remove checkpoint %s: %v\n", cfg.CheckpointFile, err)
+		}
 	}
 
 	return nil
@@ -275,6 +463,7 @@ func runReveng(cmd *cobra.Command, args []string) error {
 // displayProgress shows real-time progress updates
 func displayProgress(progressCh <-chan reveng.Progress) {
 	lastPercent := -1
+	lastPhase := ""
 
 	for p := range progressCh {
 		if p.Phase == "init" {
@@ -282,13 +471,26 @@ func displayProgress(progressCh <-chan reveng.Progress) {
 			continue
 		}
 
+		if p.Phase == "classifying" {
+			fmt.Printf("Classifying %d pins...\n", p.Total)
+			continue
+		}
+
 		if p.Phase == "finalizing" {
 			fmt.Printf("\r%-80s\r", "") // Clear line
 			fmt.Println("Finalizing netlist...")
 			continue
 		}
 
-		// Scanning phase
+		// Scanning phase; coded discovery follows its patterns with a
+		// "confirming" pass over the pins that shared a net
+		if p.Phase != lastPhase {
+			if lastPhase != "" {
+				fmt.Println()
+			}
+			lastPhase = p.Phase
+			lastPercent = -1
+		}
 		percent := 0
 		if p.Total > 0 {
 			percent = (p.Index * 100) / p.Total
@@ -304,8 +506,13 @@ func displayProgress(progressCh <-chan reveng.Progress) {
 			filled := (percent * barWidth) / 100
 			bar := strings.Repeat("█", filled) + strings.Repeat("░", barWidth-filled)
 
-			fmt.Printf("\r[%s] %3d%% | Pin %d/%d | %s.%s | Nets: %d",
-				bar, percent, p.Index, p.Total, device, pin, p.NetsFound)
+			if pin == "" {
+				fmt.Printf("\r[%s] %3d%% | Pattern %d/%d",
+					bar, percent, p.Index, p.Total)
+			} else {
+				fmt.Printf("\r[%s] %3d%% | Pin %d/%d | %s.%s | Nets: %d",
+					bar, percent, p.Index, p.Total, device, pin, p.NetsFound)
+			}
 
 			lastPercent = percent
 		}
@@ -328,6 +535,29 @@ func printNetlistSummary(nl *reveng.Netlist, elapsed time.Duration, scannedPins
 	fmt.Printf("Time elapsed:          %s\n", elapsed.Round(time.Second))
 	fmt.Printf("Average speed:         %.1f pins/second\n", float64(scannedPins)/elapsed.Seconds())
 
+	if len(nl.Pins) > 0 {
+		classes := make(map[reveng.PinClass]int)
+		for _, attr := range nl.Pins {
+			classes[attr.Class]++
+		}
+		fmt.Println("\nPin classes:")
+		for _, class := range []reveng.PinClass{
+			reveng.PinStuckLow, reveng.PinStuckHigh, reveng.PinPullUp, reveng.PinPullDown,
+			reveng.PinFloating, reveng.PinWeakDriver, reveng.PinUnknown,
+		} {
+			if classes[class] > 0 {
+				fmt.Printf("  %-12s %d\n", class+":", classes[class])
+			}
+		}
+	}
+
+	if len(nl.Contradictions) > 0 {
+		fmt.Printf("\n⚠ %d contradiction(s) with the seed:\n", len(nl.Contradictions))
+		for _, c := range nl.Contradictions {
+			fmt.Printf("  • %s: %s\n", c.Kind, c.Detail)
+		}
+	}
+
 	// Show multi-pin nets if there aren't too many
 	if nl.MultiPinNetCount() > 0 && nl.MultiPinNetCount() <= 20 {
 		fmt.Println("\nDiscovered connections:")
@@ -336,7 +566,11 @@ func printNetlistSummary(nl *reveng.Netlist, elapsed time.Duration, scannedPins
 				continue
 			}
 
-			fmt.Printf("\n  Net %d (%d pins):\n", net.ID, len(net.Pins))
+			if net.Confidence > 0 && net.Confidence < 1 {
+				fmt.Printf("\n  Net %d %s (%d pins, confidence %.0f%%):\n", net.ID, nl.NetName(net), len(net.Pins), net.Confidence*100)
+			} else {
+				fmt.Printf("\n  Net %d %s (%d pins):\n", net.ID, nl.NetName(net), len(net.Pins))
+			}
 			for _, pin := range net.Pins {
 				fmt.Printf("    • %s.%s\n", pin.DeviceName, pin.PinName)
 			}
@@ -346,6 +580,162 @@ func printNetlistSummary(nl *reveng.Netlist, elapsed time.Duration, scannedPins
 	}
 }
 
+// loadSeed reads a netlist written by --output or --output-kicad; files
+// ending in .net are read as KiCad netlists.
+func loadSeed(path string) (*reveng.Netlist, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed: %w", err)
+	}
+	var seed *reveng.Netlist
+	if strings.EqualFold(filepath.Ext(path), ".net") {
+		seed, err = reveng.ImportKiCad(data)
+	} else {
+		seed, err = reveng.ImportJSON(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load seed %s: %w", path, err)
+	}
+	return seed, nil
+}
+
+// revengChain is one chain to scan: its adapter and expected device count.
+type revengChain struct {
+	adapter string
+	count   int
+	serial  string
+}
+
+// parseChainSpecs returns the chain of --adapter, --count and --serial
+// followed by the --chain values, given as ADAPTER:COUNT[:SERIAL].
+func parseChainSpecs(specs []string) ([]revengChain, error) {
+	chains := []revengChain{{adapter: adapterType, count: deviceCount, serial: adapterSerial}}
+	for _, spec := range specs {
+		// The serial may be a USB bus:port, so it takes the rest
+		parts := strings.SplitN(spec, ":", 3)
+		var count int
+		if len(parts) < 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid --chain %q (want ADAPTER:COUNT[:SERIAL])", spec)
+		}
+		if _, err := fmt.Sscanf(parts[1], "%d", &count); err != nil || count < 1 {
+			return nil, fmt.Errorf("invalid --chain %q: bad device count %q", spec, parts[1])
+		}
+		c := revengChain{adapter: parts[0], count: count}
+		if len(parts) == 3 {
+			c.serial = parts[2]
+		}
+		chains = append(chains, c)
+	}
+	return chains, nil
+}
+
+// openRevengChain opens the adapter of a chain and discovers its devices.
+func openRevengChain(spec revengChain, repo *chain.MemoryRepository) (*chain.Chain, error) {
+	if verbose {
+		fmt.Printf("Creating %s adapter...\n", spec.adapter)
+	}
+
+	adapter, err := createAdapter(spec.adapter, spec.serial)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create adapter: %w", err)
+	}
+
+	// Set speed
+	if err := adapter.SetSpeed(adapterSpeed); err != nil && err != jtag.ErrNotImplemented {
+		return nil, fmt.Errorf("failed to set speed: %w", err)
+	}
+
+	// Show adapter info
+	if verbose {
+		info, err := adapter.Info()
+		if err == nil {
+			fmt.Printf("\nAdapter: %s\n", info.Name)
+			if info.SerialNumber != "" {
+				fmt.Printf("Serial: %s\n", info.SerialNumber)
+			}
+			fmt.Println()
+		}
+	}
+
+	// Discover chain
+	fmt.Printf("Discovering JTAG chain (expecting %d device(s))...\n", spec.count)
+
+	jtagChain, err := chain.NewController(adapter, repo).Discover(spec.count)
+	if err != nil {
+		return nil, fmt.Errorf("chain discovery failed: %w", err)
+	}
+	return jtagChain, nil
+}
+
+// parseComponents parses --component values of the form
+// [CHAIN.]INDEX=REF[,FOOTPRINT].
+func parseComponents(specs []string, sess *bsr.Session) ([]reveng.Component, error) {
+	var out []reveng.Component
+	for _, spec := range specs {
+		index, rest, ok := strings.Cut(spec, "=")
+		ref, footprint, _ := strings.Cut(rest, ",")
+		var ch, idx int
+		if strings.Contains(index, ".") {
+			index = strings.Replace(index, ".", " ", 1)
+			if _, err := fmt.Sscanf(index, "%d %d", &ch, &idx); err != nil {
+				ok = false
+			}
+		} else if _, err := fmt.Sscanf(index, "%d", &idx); err != nil {
+			ok = false
+		}
+		if !ok || ref == "" {
+			return nil, fmt.Errorf("invalid --component %q (want [CHAIN.]INDEX=REF[,FOOTPRINT])", spec)
+		}
+		ctl := sess.Controller(ch)
+		if ctl == nil {
+			return nil, fmt.Errorf("--component %q: there is no chain %d", spec, ch)
+		}
+		if idx < 0 || idx >= len(ctl.Devices) {
+			return nil, fmt.Errorf("--component %q: chain has no device %d", spec, idx)
+		}
+		out = append(out, reveng.Component{Chain: ch, ChainIndex: idx, Ref: ref, Footprint: footprint})
+	}
+	return out, nil
+}
+
+// footprintTable returns the package footprints of the config file with the
+// --footprint PACKAGE=FOOTPRINT values on top.
+func footprintTable(specs []string) (map[string]string, error) {
+	footprints := make(map[string]string)
+	if config, err := appui.LoadConfig(); err == nil {
+		for pkg, fp := range config.Footprints {
+			footprints[pkg] = fp
+		}
+	}
+	for _, spec := range specs {
+		pkg, fp, ok := strings.Cut(spec, "=")
+		if !ok || pkg == "" || fp == "" {
+			return nil, fmt.Errorf("invalid --footprint %q (want PACKAGE=FOOTPRINT)", spec)
+		}
+		footprints[pkg] = fp
+	}
+	return footprints, nil
+}
+
+// applyComponents sets the --component references and footprints on the
+// parts DiscoverNetlist recorded.
+func applyComponents(nl *reveng.Netlist, components []reveng.Component) {
+	type partID struct{ chain, index int }
+	known := make(map[partID]reveng.Component)
+	for _, c := range nl.Components() {
+		known[partID{c.Chain, c.ChainIndex}] = c
+	}
+	for _, c := range components {
+		part := known[partID{c.Chain, c.ChainIndex}]
+		part.Chain, part.ChainIndex = c.Chain, c.ChainIndex
+		part.Ref = c.Ref
+		if c.Footprint != "" {
+			part.Footprint = c.Footprint
+		}
+		nl.SetComponent(part)
+	}
+}
+
 // exportJSON saves the netlist to a JSON file
 func exportJSON(nl *reveng.Netlist, path string) error {
 	data, err := nl.ExportJSON()
@@ -390,15 +780,47 @@ func exportKiCad(nl *reveng.Netlist, path string) error {
 	return nil
 }
 
+// exportSchematic draws the netlist as a KiCad schematic, one symbol per
+// chain device
+func exportSchematic(nl *reveng.Netlist, sess *bsr.Session, path string) error {
+	sch, err := nl.ExportSchematic(nl.SessionParts(sess))
+	if err != nil {
+		return fmt.Errorf("failed to export schematic: %w", err)
+	}
+
+	// Create directory if needed
+	dir := filepath.Dir(path)
+	if dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+
+	if err := schematic.WriteFile(path, sch); err != nil {
+		return fmt.Errorf("failed to write schematic file: %w", err)
+	}
+
+	return nil
+}
+
 // countCandidates estimates how many pins will be scanned
-func countCandidates(ctl *bsr.Controller, cfg *reveng.Config) int {
+func countCandidates(sess *bsr.Session, cfg *reveng.Config) int {
+	count := 0
+	for _, ctl := range sess.Controllers {
+		count += countChainCandidates(ctl, cfg)
+	}
+	return count
+}
+
+// countChainCandidates counts the candidates on one chain
+func countChainCandidates(ctl *bsr.Controller, cfg *reveng.Config) int {
 	count := 0
 	for _, dev := range ctl.Devices {
 		if !cfg.ShouldScanDevice(dev.ChainDev.Name()) {
 			continue
 		}
 
-		for pinName := range dev.Pins {
+		for pinName, ps := range dev.Pins {
 			if !cfg.ShouldScanPin(pinName) {
 				continue
 			}
@@ -408,6 +830,9 @@ func countCandidates(ctl *bsr.Controller, cfg *reveng.Config) int {
 			if cfg.SkipPowerPins && isPowerPin(pinName) {
 				continue
 			}
+			if ctl.CheckDrive(ps.Ref) != nil {
+				continue
+			}
 			count++
 		}
 	}
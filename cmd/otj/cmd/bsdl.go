@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/chain"
+	"github.com/spf13/cobra"
+)
+
+var jtagBSDLCmd = &cobra.Command{
+	Use:   "bsdl",
+	Short: "Manage the BSDL library",
+	Long:  `Commands for managing the BSDL library used to identify devices in the JTAG chain`,
+}
+
+// BSDL index command
+var (
+	indexCachePath string
+	indexRebuild   bool
+	indexList      bool
+	indexLookup    []string
+)
+
+var jtagBSDLIndexCmd = &cobra.Command{
+	Use:   "index <bsdl-dir>",
+	Short: "Build and inspect the precompiled BSDL index",
+	Long: `Build (or refresh) the on-disk index of a BSDL library and show its contents.
+
+The index maps IDCODE value/mask pairs to BSDL files and stores the extracted
+device information and boundary cells, so discovery only parses the files it
+actually needs. Files are re-parsed when their modification time and content
+hash change.
+
+Examples:
+  # Build or refresh the index for a library
+  otj jtag bsdl index testdata
+
+  # Force a full rebuild and list all entries
+  otj jtag bsdl index --rebuild --list testdata
+
+  # Check which file an IDCODE resolves to
+  otj jtag bsdl index --lookup 0x06438041 testdata`,
+	Args: cobra.ExactArgs(1),
+	RunE: runJTAGBSDLIndex,
+}
+
+func init() {
+	jtagCmd.AddCommand(jtagBSDLCmd)
+	jtagBSDLCmd.AddCommand(jtagBSDLIndexCmd)
+
+	jtagBSDLIndexCmd.Flags().StringVar(&indexCachePath, "cache", "",
+		"index file path (default: per-user cache directory)")
+	jtagBSDLIndexCmd.Flags().BoolVar(&indexRebuild, "rebuild", false,
+		"ignore the existing index and re-parse every file")
+	jtagBSDLIndexCmd.Flags().BoolVarP(&indexList, "list", "l", false,
+		"list all indexed entries")
+	jtagBSDLIndexCmd.Flags().StringSliceVar(&indexLookup, "lookup", nil,
+		"IDCODEs to resolve against the index (hex)")
+}
+
+func runJTAGBSDLIndex(cmd *cobra.Command, args []string) error {
+	root := args[0]
+
+	cachePath, err := bsdlIndexPath(root)
+	if err != nil {
+		return fmt.Errorf("failed to resolve index path: %w", err)
+	}
+
+	var prev *chain.BSDLIndex
+	if !indexRebuild {
+		prev, _ = chain.LoadIndex(cachePath)
+	}
+
+	idx, stats, err := chain.BuildIndex(root, prev)
+	if err != nil {
+		return fmt.Errorf("failed to build index: %w", err)
+	}
+	if err := idx.Save(cachePath); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+
+	fmt.Printf("BSDL index: %s\n", cachePath)
+	fmt.Printf("  Library:  %s\n", idx.Root)
+	fmt.Printf("  Files:    %d\n", stats.Files)
+	fmt.Printf("  Reused:   %d\n", stats.Reused)
+	fmt.Printf("  Parsed:   %d\n", stats.Reparsed)
+	if stats.Touched > 0 {
+		fmt.Printf("  Touched:  %d (mtime changed, content unchanged)\n", stats.Touched)
+	}
+	if stats.Removed > 0 {
+		fmt.Printf("  Removed:  %d\n", stats.Removed)
+	}
+	fmt.Printf("  Failed:   %d\n", stats.Failed)
+
+	if verbose && stats.Failed > 0 {
+		fmt.Printf("\nFailed files:\n")
+		for _, entry := range idx.Entries {
+			if entry.Error != "" {
+				fmt.Printf("  %s: %s\n", relPath(idx.Root, entry.Path), entry.Error)
+			}
+		}
+	}
+
+	if indexList {
+		fmt.Printf("\n%-10s  %-10s  %-5s  %-6s  %-24s  %s\n", "IDCODE", "MASK", "IR", "BSR", "ENTITY", "FILE")
+		for _, entry := range idx.Entries {
+			if entry.Error != "" {
+				continue
+			}
+			irLen, bsrLen := 0, 0
+			if entry.Info != nil {
+				irLen = entry.Info.InstructionLength
+				bsrLen = entry.Info.BoundaryLength
+			}
+			fmt.Printf("0x%08X  0x%08X  %-5d  %-6d  %-24s  %s\n",
+				entry.IDValue, entry.IDMask, irLen, bsrLen, entry.Entity, relPath(idx.Root, entry.Path))
+		}
+	}
+
+	if len(indexLookup) > 0 {
+		ids, err := parseIDCodes(indexLookup)
+		if err != nil {
+			return err
+		}
+		fmt.Println()
+		for _, id := range ids {
+			entry := idx.Lookup(id)
+			if entry == nil {
+				fmt.Printf("0x%08X: no match\n", id)
+				continue
+			}
+			fmt.Printf("0x%08X: %s (%s)\n", id, entry.Entity, relPath(idx.Root, entry.Path))
+		}
+	}
+
+	return nil
+}
+
+// bsdlIndexPath returns where the index of the library at dir is kept:
+// --index-cache (--cache for 'bsdl index') or the per-user cache directory.
+func bsdlIndexPath(dir string) (string, error) {
+	if indexCachePath != "" {
+		return indexCachePath, nil
+	}
+	return chain.DefaultIndexPath(dir)
+}
+
+// openBSDLRepository returns the repository used by discovery: the indexed
+// repository backed by the index cache, or a fully parsed in-memory one
+// when useIndex is false or the cache cannot be used.
+func openBSDLRepository(dir string, useIndex bool) (chain.Repository, error) {
+	if useIndex {
+		repo, err := openIndexedRepository(dir)
+		if err == nil {
+			return repo, nil
+		}
+		fmt.Printf("Warning: BSDL index unavailable (%v); parsing every file\n", err)
+	}
+
+	repo := chain.NewMemoryRepository()
+	if err := repo.LoadDir(dir); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func openIndexedRepository(dir string) (*chain.IndexedRepository, error) {
+	cachePath, err := bsdlIndexPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	repo, stats, err := chain.OpenIndexedRepository(dir, cachePath)
+	if err != nil {
+		return nil, err
+	}
+	if verbose {
+		fmt.Printf("BSDL index %s: %d files, %d parsed, %d reused\n",
+			cachePath, stats.Files, stats.Reparsed, stats.Reused)
+	}
+	return repo, nil
+}
+
+func relPath(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/chain"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
+	"github.com/spf13/cobra"
+)
+
+// JTAG diagnose command
+var (
+	diagSpeeds     []int
+	diagMaxDevices int
+	diagPasses     int
+)
+
+var jtagDiagnoseCmd = &cobra.Command{
+	Use:   "diagnose",
+	Short: "Check JTAG chain integrity on a new or misbehaving board",
+	Long: `Run a chain self-test that does not depend on knowing the devices:
+
+  1. Check TDO is not stuck high or low
+  2. Measure the total IR length and the number of devices via BYPASS
+  3. Shift random patterns through the chain and check they survive
+  4. Read IDCODEs and compare each device's IR capture with its BSDL
+  5. Sweep TCK speeds to find the fastest reliable one
+
+Only BYPASS and IDCODE are used, so no pins are driven. Run this first when
+'otj jtag discover' fails or reports unknown IDCODEs.
+
+Examples:
+  otj jtag diagnose --adapter cmsisdap --bsdl ./bsdl
+  otj jtag diagnose --adapter cmsisdap --speeds 500000,1000000,4000000,10000000`,
+	RunE: runJTAGDiagnose,
+}
+
+func init() {
+	jtagCmd.AddCommand(jtagDiagnoseCmd)
+
+	f := jtagDiagnoseCmd.Flags()
+	f.StringVarP(&adapterType, "adapter", "a", "simulator",
+		"JTAG adapter type (simulator, cmsisdap, pico, buspirate)")
+	f.StringVarP(&adapterSerial, "serial", "s", "",
+		"adapter serial number or USB bus:port (default: the probe saved by 'otj jtag interfaces --select')")
+	f.IntVar(&adapterSpeed, "speed", 1000000,
+		"TCK speed in Hz for the checks, restored after the sweep")
+	f.StringVarP(&bsdlDir, "bsdl", "b", "testdata",
+		"directory containing BSDL files, for IR capture checks")
+	f.BoolVar(&noBSDLIndex, "no-index", false,
+		"parse every BSDL file instead of using the cached index")
+	f.StringVar(&indexCachePath, "index-cache", "",
+		"BSDL index file, as written by 'otj jtag bsdl index --cache' (default: per-user cache directory)")
+	f.BoolVar(&holdReset, "hold-reset", false,
+		"hold the target in nRESET while the command runs")
+	f.IntSliceVar(&diagSpeeds, "speeds",
+		[]int{100000, 500000, 1000000, 2000000, 5000000, 10000000, 20000000},
+		"TCK frequencies to sweep in Hz (empty to skip)")
+	f.IntVar(&diagMaxDevices, "max-devices", 32,
+		"longest chain the length measurement can detect")
+	f.IntVar(&diagPasses, "passes", 8,
+		"random patterns shifted through per speed")
+}
+
+func runJTAGDiagnose(cmd *cobra.Command, args []string) error {
+	adapter, err := createJTAGAdapter(adapterType, adapterSerial)
+	if err != nil {
+		return fmt.Errorf("failed to create adapter: %w", err)
+	}
+	if closer, ok := adapter.(interface{ Close() error }); ok {
+		defer closer.Close()
+	}
+	if err := adapter.SetSpeed(adapterSpeed); err != nil && err != jtag.ErrNotImplemented {
+		return fmt.Errorf("failed to set speed: %w", err)
+	}
+	if holdReset {
+		if err := holdTargetReset(adapter); err != nil {
+			return err
+		}
+	}
+
+	// IR capture checks need BSDLs, but the rest of the diagnosis does not
+	repo, err := openBSDLRepository(bsdlDir, !noBSDLIndex)
+	if err != nil {
+		fmt.Printf("Warning: no BSDL files loaded (%v); skipping IR capture checks\n", err)
+		repo = nil
+	}
+
+	// Keep only sweep speeds the adapter claims to reach
+	speeds := diagSpeeds
+	if info, err := adapter.Info(); err == nil && info.MaxFrequency > 0 {
+		speeds = nil
+		for _, hz := range diagSpeeds {
+			if hz <= info.MaxFrequency {
+				speeds = append(speeds, hz)
+			}
+		}
+	}
+
+	fmt.Println("Diagnosing JTAG chain...")
+	report, err := chain.NewController(adapter, repo).Diagnose(chain.DiagnoseOptions{
+		MaxDevices: diagMaxDevices,
+		Speeds:     speeds,
+		Passes:     diagPasses,
+		RestoreHz:  adapterSpeed,
+	})
+	if err != nil {
+		return fmt.Errorf("diagnosis failed: %w", err)
+	}
+
+	printDiagnosis(report)
+	if !report.OK() {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("chain has %d problem(s)", len(report.Problems))
+	}
+	return nil
+}
+
+func printDiagnosis(r *chain.Diagnosis) {
+	fmt.Printf("\nTDO:          %s\n", r.TDO)
+	if r.TDO != chain.TDOActive {
+		printProblems(r.Problems)
+		return
+	}
+	fmt.Printf("Devices:      %d (BYPASS shift-through)\n", r.DeviceCount)
+	fmt.Printf("IR length:    %d bits total\n", r.IRLength)
+	fmt.Printf("Pattern test: %s\n", passFail(r.PatternOK))
+
+	if len(r.IDCodes) > 0 {
+		fmt.Println("\nIDCODEs (device 0 nearest TDO):")
+		for i, id := range r.IDCodes {
+			if id == 0 {
+				fmt.Printf("  %d: none (device has no IDCODE register)\n", i)
+				continue
+			}
+			fmt.Printf("  %d: 0x%08X  %s\n", i, id, jtag.DecodeIDCode(id).ManufName)
+		}
+	}
+
+	if len(r.IRCapture) > 0 {
+		fmt.Println("\nIR capture:")
+		for _, c := range r.IRCapture {
+			fmt.Printf("  %d: %-20s captured %s, expected %s  %s\n",
+				c.Position, c.Device, c.Captured, c.Expected, passFail(c.OK))
+		}
+	}
+
+	if len(r.Speeds) > 0 {
+		fmt.Println("\nTCK sweep:")
+		for _, s := range r.Speeds {
+			fmt.Printf("  %10d Hz  %d/%d patterns ok\n", s.Hz, s.Passes-s.Errors, s.Passes)
+		}
+		if r.MaxSpeedHz > 0 {
+			fmt.Printf("Fastest reliable speed: %d Hz\n", r.MaxSpeedHz)
+		}
+	}
+
+	printProblems(r.Problems)
+}
+
+func printProblems(problems []string) {
+	if len(problems) == 0 {
+		fmt.Println("\nNo problems found.")
+		return
+	}
+	fmt.Println("\nProblems:")
+	for _, p := range problems {
+		fmt.Printf("  - %s\n", strings.TrimSpace(p))
+	}
+}
+
+func passFail(ok bool) string {
+	if ok {
+		return "pass"
+	}
+	return "FAIL"
+}
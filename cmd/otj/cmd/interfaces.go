@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	appui "github.com/OpenTraceLab/OpenTraceJTAG/internal/ui"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
+	"github.com/spf13/cobra"
+)
+
+// JTAG interfaces command
+var (
+	interfacesSelect string
+	interfacesClear  bool
+)
+
+var jtagInterfacesCmd = &cobra.Command{
+	Use:   "interfaces",
+	Short: "List connected JTAG probes and choose the default one",
+	Long: `List the JTAG probes connected to this host with their serial numbers and
+USB paths (bus:port), so one of several identical probes can be addressed.
+
+--select saves a probe, by list number, serial number or USB path, as the
+default for later commands; --serial on a command still overrides it. A
+number that is also the serial of a connected probe selects that probe;
+write #N to mean list number N regardless.
+
+Examples:
+  # Show probes; the saved default is marked with *
+  otj jtag interfaces
+
+  # Always use the probe in slot 2 of the listing
+  otj jtag interfaces --select 2
+
+  # Pin the probe plugged into bus 1, hub port 4
+  otj jtag interfaces --select 1:4`,
+	RunE: runJTAGInterfaces,
+}
+
+func init() {
+	jtagCmd.AddCommand(jtagInterfacesCmd)
+
+	jtagInterfacesCmd.Flags().StringVar(&interfacesSelect, "select", "",
+		"save the default probe: list number (N or #N), serial number or USB bus:port")
+	jtagInterfacesCmd.Flags().BoolVar(&interfacesClear, "clear", false,
+		"forget the saved default probe")
+}
+
+func runJTAGInterfaces(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	infos, err := jtag.DiscoverInterfaces(ctx)
+	if err != nil {
+		return fmt.Errorf("discover interfaces: %w", err)
+	}
+
+	config, err := appui.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if interfacesClear || interfacesSelect != "" {
+		config.Probe = jtag.ProbeSelector{}
+		if interfacesSelect != "" {
+			if config.Probe, err = resolveProbeSpec(interfacesSelect, infos); err != nil {
+				return err
+			}
+		}
+		if err := appui.SaveConfig(config); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+		if config.Probe.IsZero() {
+			fmt.Println("Cleared the default probe")
+		} else {
+			fmt.Printf("Default probe: %s\n", config.Probe)
+		}
+		return nil
+	}
+
+	fmt.Println("Detected JTAG interfaces:")
+	for i, iface := range infos {
+		mark := " "
+		if iface.Kind != jtag.InterfaceKindSim && !config.Probe.IsZero() &&
+			config.Probe.Matches(iface.Serial, iface.Path) {
+			mark = "*"
+		}
+		fmt.Printf(" %s %d. %s [%s]", mark, i+1, iface.Label(), iface.Kind)
+		if iface.Kind != jtag.InterfaceKindSim {
+			fmt.Printf(" (VID:PID %04X:%04X)", iface.VendorID, iface.ProductID)
+		}
+		fmt.Println()
+		if iface.Serial != "" {
+			fmt.Printf("      Serial: %s\n", iface.Serial)
+		}
+		if iface.Path != "" {
+			fmt.Printf("      USB path: %s\n", iface.Path)
+		}
+	}
+	if !config.Probe.IsZero() {
+		fmt.Printf("\nDefault probe: %s\n", config.Probe)
+	}
+	return nil
+}
+
+// resolveProbeSpec turns a --select value into a selector. The serial
+// number or USB path of a connected probe wins, since serials are often all
+// digits; otherwise a list number, optionally written #N, picks that
+// interface, preferring its serial. Anything else is kept as a serial number
+// or USB path for a probe that is not plugged in yet.
+func resolveProbeSpec(spec string, infos []jtag.InterfaceInfo) (jtag.ProbeSelector, error) {
+	sel := jtag.ParseProbeSelector(spec)
+	index, isIndex := strings.CutPrefix(strings.TrimSpace(spec), "#")
+	if !isIndex {
+		for _, iface := range infos {
+			if iface.Kind != jtag.InterfaceKindSim && sel.Matches(iface.Serial, iface.Path) {
+				return sel, nil
+			}
+		}
+	}
+	n, err := strconv.Atoi(index)
+	if err != nil {
+		if isIndex {
+			return jtag.ProbeSelector{}, fmt.Errorf("invalid probe number %q", spec)
+		}
+		return sel, nil
+	}
+	if n < 1 || n > len(infos) || infos[n-1].Kind == jtag.InterfaceKindSim {
+		return jtag.ProbeSelector{}, fmt.Errorf("no probe numbered %d", n)
+	}
+	return infos[n-1].Selector(), nil
+}
+
+// probeSelection returns the probe chosen with --serial, or else the default
+// saved by 'otj jtag interfaces --select'.
+func probeSelection(spec string) jtag.ProbeSelector {
+	if spec != "" {
+		return jtag.ParseProbeSelector(spec)
+	}
+	if config, err := appui.LoadConfig(); err == nil {
+		return config.Probe
+	}
+	return jtag.ProbeSelector{}
+}
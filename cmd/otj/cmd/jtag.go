@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/chain"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/idcode/deviceinfo"
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
 	"github.com/spf13/cobra"
 )
@@ -23,6 +26,10 @@ var (
 	adapterSerial string
 	adapterSpeed  int
 	simIDCodes    []string
+	noBSDLIndex   bool
+	packageSpecs  []string
+	holdReset     bool
+	irLengthSpecs []string
 )
 
 var jtagDiscoverCmd = &cobra.Command{
@@ -54,6 +61,7 @@ var (
 	showInstructions bool
 	showBoundary     bool
 	showPins         bool
+	pinPackage       string
 )
 
 var jtagParseCmd = &cobra.Command{
@@ -76,18 +84,7 @@ func init() {
 	jtagCmd.AddCommand(jtagParseCmd)
 
 	// Discover flags
-	jtagDiscoverCmd.Flags().StringVarP(&adapterType, "adapter", "a", "simulator",
-		"JTAG adapter type (simulator, cmsisdap, pico, buspirate)")
-	jtagDiscoverCmd.Flags().IntVarP(&deviceCount, "count", "c", 1,
-		"expected number of devices in chain")
-	jtagDiscoverCmd.Flags().StringVarP(&bsdlDir, "bsdl", "b", "testdata",
-		"directory containing BSDL files")
-	jtagDiscoverCmd.Flags().StringVarP(&adapterSerial, "serial", "s", "",
-		"adapter serial number (if multiple adapters)")
-	jtagDiscoverCmd.Flags().IntVar(&adapterSpeed, "speed", 1000000,
-		"TCK speed in Hz (default 1MHz)")
-	jtagDiscoverCmd.Flags().StringSliceVar(&simIDCodes, "sim-ids", nil,
-		"simulator: IDCODEs to return (hex, e.g., 0x06438041,0x41111043)")
+	addChainFlags(jtagDiscoverCmd)
 	jtagDiscoverCmd.MarkFlagRequired("count")
 
 	// Parse flags
@@ -97,77 +94,41 @@ func init() {
 		"show boundary scan cells")
 	jtagParseCmd.Flags().BoolVarP(&showPins, "pins", "p", false,
 		"show pin mappings")
+	jtagParseCmd.Flags().StringVar(&pinPackage, "package", "",
+		"package variant for pin mappings (default: PHYSICAL_PIN_MAP)")
 }
 
-func runJTAGDiscover(cmd *cobra.Command, args []string) error {
-	// Validate sim-ids if using simulator
-	if adapterType == "simulator" || adapterType == "sim" {
-		if len(simIDCodes) > 0 && len(simIDCodes) != deviceCount {
-			return fmt.Errorf("--sim-ids count (%d) must match --count (%d)", len(simIDCodes), deviceCount)
-		}
-	}
-
-	// Create adapter
-	if verbose {
-		fmt.Printf("Creating %s adapter...\n", adapterType)
-	}
-
-	adapter, err := createJTAGAdapter(adapterType, adapterSerial)
-	if err != nil {
-		return fmt.Errorf("failed to create adapter: %w", err)
-	}
-
-	// Set speed
-	if err := adapter.SetSpeed(adapterSpeed); err != nil && err != jtag.ErrNotImplemented {
-		return fmt.Errorf("failed to set speed: %w", err)
-	}
-
-	// Show adapter info
-	info, err := adapter.Info()
-	if err != nil && err != jtag.ErrNotImplemented {
-		return fmt.Errorf("failed to get adapter info: %w", err)
-	}
-
-	if verbose {
-		fmt.Printf("\nAdapter Information:\n")
-		fmt.Printf("  Name: %s\n", info.Name)
-		fmt.Printf("  Vendor: %s\n", info.Vendor)
-		fmt.Printf("  Model: %s\n", info.Model)
-		if info.SerialNumber != "" {
-			fmt.Printf("  Serial: %s\n", info.SerialNumber)
-		}
-		if info.Firmware != "" {
-			fmt.Printf("  Firmware: %s\n", info.Firmware)
-		}
-		if info.MaxFrequency > 0 {
-			fmt.Printf("  Max Speed: %d Hz\n", info.MaxFrequency)
-		}
-		fmt.Println()
-	}
-
-	// Create repository and load BSDL files
-	if verbose {
-		fmt.Printf("Loading BSDL files from: %s\n", bsdlDir)
-	}
-
-	repo := chain.NewMemoryRepository()
-	if err := repo.LoadDir(bsdlDir); err != nil {
-		return fmt.Errorf("failed to load BSDL files: %w", err)
-	}
-
-	if verbose {
-		fmt.Println("BSDL files loaded successfully")
-	}
-
-	// Create controller
-	ctrl := chain.NewController(adapter, repo)
-
-	// Discover chain
-	fmt.Printf("\nDiscovering JTAG chain (expecting %d device(s))...\n", deviceCount)
+// addChainFlags registers the adapter and BSDL flags consumed by
+// connectJTAGChain on a command that talks to a live chain.
+func addChainFlags(c *cobra.Command) {
+	c.Flags().StringVarP(&adapterType, "adapter", "a", "simulator",
+		"JTAG adapter type (simulator, cmsisdap, pico, buspirate)")
+	c.Flags().IntVarP(&deviceCount, "count", "c", 1,
+		"expected number of devices in chain")
+	c.Flags().StringVarP(&bsdlDir, "bsdl", "b", "testdata",
+		"directory containing BSDL files")
+	c.Flags().StringVarP(&adapterSerial, "serial", "s", "",
+		"adapter serial number or USB bus:port (default: the probe saved by 'otj jtag interfaces --select')")
+	c.Flags().IntVar(&adapterSpeed, "speed", 1000000,
+		"TCK speed in Hz (default 1MHz)")
+	c.Flags().StringSliceVar(&simIDCodes, "sim-ids", nil,
+		"simulator: IDCODEs to return (hex, e.g., 0x06438041,0x41111043)")
+	c.Flags().StringSliceVar(&packageSpecs, "package", nil,
+		"package variant override: NAME or INDEX=NAME (repeatable)")
+	c.Flags().BoolVar(&noBSDLIndex, "no-index", false,
+		"parse every BSDL file instead of using the cached index")
+	c.Flags().StringVar(&indexCachePath, "index-cache", "",
+		"BSDL index file, as written by 'otj jtag bsdl index --cache' (default: per-user cache directory)")
+	c.Flags().StringSliceVar(&irLengthSpecs, "ir-length", nil,
+		"IR length of a device without BSDL: INDEX=BITS (repeatable)")
+	c.Flags().BoolVar(&holdReset, "hold-reset", false,
+		"hold the target in nRESET while the command runs, so firmware cannot fight the boundary scan")
+}
 
-	jtagChain, err := ctrl.Discover(deviceCount)
+func runJTAGDiscover(cmd *cobra.Command, args []string) error {
+	jtagChain, err := connectJTAGChain()
 	if err != nil {
-		return fmt.Errorf("chain discovery failed: %w", err)
+		return err
 	}
 
 	// Display discovered devices
@@ -182,12 +143,15 @@ func runJTAGDiscover(cmd *cobra.Command, args []string) error {
 		fmt.Printf("┌─ Device %d (Position %d) ─────────────────────────────────────┐\n", i+1, device.Position)
 		fmt.Printf("│ IDCODE: 0x%08X                                          │\n", device.IDCode)
 
-		if device.Info != nil {
+		if device.HasBSDL() {
 			fmt.Printf("│ Name:   %s\n", device.Name())
 			fmt.Printf("│                                                              │\n")
 			fmt.Printf("│ Device Information:                                          │\n")
 			fmt.Printf("│   IR Length:       %d bits                                  │\n", device.Info.InstructionLength)
 			fmt.Printf("│   Boundary Length: %d bits                                  │\n", device.Info.BoundaryLength)
+			if pkg := device.PackageName(); pkg != "" {
+				fmt.Printf("│   Package:         %s\n", pkg)
+			}
 
 			if device.Info.IDCode != "" {
 				// Parse IDCODE to show if it has wildcards
@@ -238,7 +202,11 @@ func runJTAGDiscover(cmd *cobra.Command, args []string) error {
 				}
 			}
 		} else {
-			fmt.Printf("│ Name:   UNKNOWN (no matching BSDL file)                     │\n")
+			fmt.Printf("│ Name:   %s (no BSDL, held in BYPASS)\n", device.Name())
+			if known := deviceinfo.Lookup(device.IDCode); known.Name != "Unknown device" {
+				fmt.Printf("│ Device: %s\n", known.Name)
+			}
+			fmt.Printf("│   IR Length:       %d bits                                  │\n", device.Info.InstructionLength)
 		}
 
 		fmt.Printf("└──────────────────────────────────────────────────────────────┘\n\n")
@@ -260,6 +228,116 @@ func runJTAGDiscover(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// parseIRLengths parses INDEX=BITS IR length overrides.
+func parseIRLengths(specs []string) (map[int]int, error) {
+	out := make(map[int]int, len(specs))
+	for _, spec := range specs {
+		idxStr, bitsStr, ok := strings.Cut(spec, "=")
+		idx, err1 := strconv.Atoi(strings.TrimSpace(idxStr))
+		bits, err2 := strconv.Atoi(strings.TrimSpace(bitsStr))
+		if !ok || err1 != nil || err2 != nil || idx < 0 || bits < 2 {
+			return nil, fmt.Errorf("invalid --ir-length %q (want INDEX=BITS, e.g. 1=8)", spec)
+		}
+		out[idx] = bits
+	}
+	return out, nil
+}
+
+// connectJTAGChain opens the adapter selected by the shared adapter flags,
+// loads the BSDL library and discovers the chain.
+func connectJTAGChain() (*chain.Chain, error) {
+	// Validate sim-ids if using simulator
+	if adapterType == "simulator" || adapterType == "sim" {
+		if len(simIDCodes) > 0 && len(simIDCodes) != deviceCount {
+			return nil, fmt.Errorf("--sim-ids count (%d) must match --count (%d)", len(simIDCodes), deviceCount)
+		}
+	}
+
+	// Create adapter
+	if verbose {
+		fmt.Printf("Creating %s adapter...\n", adapterType)
+	}
+
+	adapter, err := createJTAGAdapter(adapterType, adapterSerial)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create adapter: %w", err)
+	}
+
+	// Set speed
+	if err := adapter.SetSpeed(adapterSpeed); err != nil && err != jtag.ErrNotImplemented {
+		return nil, fmt.Errorf("failed to set speed: %w", err)
+	}
+
+	if holdReset {
+		if err := holdTargetReset(adapter); err != nil {
+			return nil, err
+		}
+	}
+
+	// Show adapter info
+	info, err := adapter.Info()
+	if err != nil && err != jtag.ErrNotImplemented {
+		return nil, fmt.Errorf("failed to get adapter info: %w", err)
+	}
+
+	if verbose {
+		fmt.Printf("\nAdapter Information:\n")
+		fmt.Printf("  Name: %s\n", info.Name)
+		fmt.Printf("  Vendor: %s\n", info.Vendor)
+		fmt.Printf("  Model: %s\n", info.Model)
+		if info.SerialNumber != "" {
+			fmt.Printf("  Serial: %s\n", info.SerialNumber)
+		}
+		if info.Firmware != "" {
+			fmt.Printf("  Firmware: %s\n", info.Firmware)
+		}
+		if info.MaxFrequency > 0 {
+			fmt.Printf("  Max Speed: %d Hz\n", info.MaxFrequency)
+		}
+		fmt.Println()
+	}
+
+	// Create repository and load BSDL files
+	if verbose {
+		fmt.Printf("Loading BSDL files from: %s\n", bsdlDir)
+	}
+
+	repo, err := openBSDLRepository(bsdlDir, !noBSDLIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load BSDL files: %w", err)
+	}
+
+	if verbose {
+		fmt.Println("BSDL files loaded successfully")
+	}
+
+	// Create controller
+	ctrl := chain.NewController(adapter, repo)
+	irLengths, err := parseIRLengths(irLengthSpecs)
+	if err != nil {
+		return nil, err
+	}
+	for index, bits := range irLengths {
+		ctrl.SetIRLength(index, bits)
+	}
+
+	// Discover chain
+	fmt.Printf("\nDiscovering JTAG chain (expecting %d device(s))...\n", deviceCount)
+
+	jtagChain, err := ctrl.Discover(deviceCount)
+	if err != nil {
+		return nil, fmt.Errorf("chain discovery failed: %w (run 'otj jtag diagnose' to check the chain)", err)
+	}
+	if err := jtagChain.SetPackages(packageSpecs); err != nil {
+		return nil, err
+	}
+
+	return jtagChain, nil
+}
+
+// openCMSISDAPAdapter is jtag.OpenCMSISDAPAdapter, replaced in tests.
+var openCMSISDAPAdapter = jtag.OpenCMSISDAPAdapter
+
 func createJTAGAdapter(adapterType, serial string) (jtag.Adapter, error) {
 	switch adapterType {
 	case "simulator", "sim":
@@ -273,6 +351,9 @@ func createJTAGAdapter(adapterType, serial string) (jtag.Adapter, error) {
 			Firmware:     "v0.9.0",
 			MinFrequency: 100,
 			MaxFrequency: 10000000, // 10 MHz
+			SupportsSRST: true,
+			SupportsTRST: true,
+			SupportsJTAG: true,
 		}
 		sim := jtag.NewSimAdapter(info)
 
@@ -307,8 +388,12 @@ func createJTAGAdapter(adapterType, serial string) (jtag.Adapter, error) {
 			fmt.Println("Opening CMSIS-DAP probe...")
 		}
 
-		// Create CMSIS-DAP adapter (default Raspberry Pi Pico VID/PID)
-		adapter, err := jtag.NewCMSISDAPAdapter(jtag.VendorIDRaspberryPi, jtag.ProductIDCMSISDAP)
+		// Open the first known CMSIS-DAP probe (debugprobe, DAPLink, J-Link)
+		sel := probeSelection(serial)
+		if verbose && !sel.IsZero() {
+			fmt.Printf("Selecting probe by %s\n", sel)
+		}
+		adapter, err := openCMSISDAPAdapter(sel)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open CMSIS-DAP probe: %w", err)
 		}
@@ -554,6 +639,17 @@ func runJTAGParse(cmd *cobra.Command, args []string) error {
 	// Pin mappings
 	if showPins {
 		pinMap := entity.GetPinMap()
+		pkgName := entity.DefaultPackage()
+		if pinPackage != "" {
+			pinMap, err = entity.GetPinMapForPackage(pinPackage)
+			if err != nil {
+				return err
+			}
+			pkgName = pinPackage
+		}
+		if packages := entity.PackageNames(); len(packages) > 1 {
+			fmt.Printf("Packages: %s (showing %s)\n", strings.Join(packages, ", "), pkgName)
+		}
 		if len(pinMap) > 0 {
 			fmt.Printf("Pin Mappings: %d signals\n", len(pinMap))
 
@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
+	"github.com/spf13/cobra"
+)
+
+// JTAG monitor command
+var (
+	monitorInterval time.Duration
+	monitorDuration time.Duration
+	monitorMode     string
+	monitorPins     []string
+	monitorCSV      string
+	monitorVCD      string
+	monitorQuiet    bool
+)
+
+var jtagMonitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Watch pin levels live via repeated boundary scans",
+	Long: `Repeatedly capture the boundary-scan inputs of the chain and report every
+pin that changes, like a slow logic analyzer on pins that cannot be probed.
+
+In the default sample mode the devices are placed in SAMPLE and keep running
+normally. In extest mode the chain is put in EXTEST with all pins tri-stated
+first. Pulses shorter than the scan period are not seen.
+
+Pins are selected as PIN (any device) or INDEX:PIN (one chain position),
+using either the package pin or the BSDL port name.
+
+Examples:
+  # Print every edge on the chain until Ctrl-C
+  otj jtag monitor --adapter cmsisdap --count 1 --bsdl testdata
+
+  # Watch two pins at 1 kHz for 10 seconds and log a waveform
+  otj jtag monitor -c 1 --pins PA5,PA6 --interval 1ms --duration 10s --vcd pins.vcd`,
+	RunE: runJTAGMonitor,
+}
+
+func init() {
+	jtagCmd.AddCommand(jtagMonitorCmd)
+
+	addChainFlags(jtagMonitorCmd)
+	jtagMonitorCmd.Flags().DurationVar(&monitorInterval, "interval", 10*time.Millisecond,
+		"delay between scans (0 scans as fast as the adapter allows)")
+	jtagMonitorCmd.Flags().DurationVar(&monitorDuration, "duration", 0,
+		"stop after this long (default: until interrupted)")
+	jtagMonitorCmd.Flags().StringVar(&monitorMode, "mode", "sample",
+		"capture mode: sample (device keeps running) or extest")
+	jtagMonitorCmd.Flags().StringSliceVar(&monitorPins, "pins", nil,
+		"pins to watch: PIN or INDEX:PIN (default: all)")
+	jtagMonitorCmd.Flags().StringVar(&monitorCSV, "csv", "",
+		"log events to a CSV file")
+	jtagMonitorCmd.Flags().StringVar(&monitorVCD, "vcd", "",
+		"log events to a VCD waveform file")
+	jtagMonitorCmd.Flags().BoolVarP(&monitorQuiet, "quiet", "q", false,
+		"do not print edges to the terminal")
+}
+
+func runJTAGMonitor(cmd *cobra.Command, args []string) error {
+	var mode bsr.MonitorMode
+	switch strings.ToLower(monitorMode) {
+	case "sample":
+		mode = bsr.MonitorSample
+	case "extest":
+		mode = bsr.MonitorCapture
+	default:
+		return fmt.Errorf("invalid --mode %q (want sample or extest)", monitorMode)
+	}
+
+	jtagChain, err := connectJTAGChain()
+	if err != nil {
+		return err
+	}
+	ctl, err := bsr.NewController(jtagChain)
+	if err != nil {
+		return fmt.Errorf("failed to create boundary-scan controller: %w", err)
+	}
+
+	pins, err := selectMonitorPins(ctl, monitorPins)
+	if err != nil {
+		return err
+	}
+
+	if mode == bsr.MonitorCapture {
+		if err := ctl.EnterExtest(); err != nil {
+			return err
+		}
+		if err := ctl.SetAllPinsHiZ(); err != nil {
+			return err
+		}
+	}
+
+	var csvLog *bsr.CSVWriter
+	if monitorCSV != "" {
+		f, err := os.Create(monitorCSV)
+		if err != nil {
+			return fmt.Errorf("failed to create CSV log: %w", err)
+		}
+		defer f.Close()
+		if csvLog, err = bsr.NewCSVWriter(f); err != nil {
+			return fmt.Errorf("failed to write CSV log: %w", err)
+		}
+		defer csvLog.Flush()
+	}
+
+	var vcdLog *bsr.VCDWriter
+	if monitorVCD != "" {
+		f, err := os.Create(monitorVCD)
+		if err != nil {
+			return fmt.Errorf("failed to create VCD log: %w", err)
+		}
+		defer f.Close()
+		vcdPins := pins
+		if len(vcdPins) == 0 {
+			vcdPins = ctl.AllPins()
+		}
+		vcdLog = bsr.NewVCDWriter(f, vcdPins)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if monitorDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, monitorDuration)
+		defer cancel()
+	}
+
+	mon := bsr.NewMonitor(ctl, bsr.MonitorConfig{
+		Interval: monitorInterval,
+		Mode:     mode,
+		Pins:     pins,
+	})
+	events, _ := mon.Subscribe(1024)
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- mon.Run(ctx) }()
+
+	fmt.Printf("Monitoring %s pins every %s (Ctrl-C to stop)...\n", describePinCount(pins), monitorInterval)
+
+	var start time.Time
+	for ev := range events {
+		if start.IsZero() {
+			start = ev.Time
+		}
+		if !monitorQuiet {
+			printPinEvent(ev, ev.Time.Sub(start))
+		}
+		if csvLog != nil {
+			if err := csvLog.WriteEvent(ev); err != nil {
+				return fmt.Errorf("failed to write CSV log: %w", err)
+			}
+		}
+		if vcdLog != nil {
+			if err := vcdLog.WriteEvent(ev); err != nil {
+				return fmt.Errorf("failed to write VCD log: %w", err)
+			}
+		}
+	}
+
+	if err := <-runErr; err != nil {
+		return err
+	}
+
+	scans, dropped := mon.Stats()
+	fmt.Printf("\n%d scans", scans)
+	if dropped > 0 {
+		fmt.Printf(", %d events dropped (output too slow)", dropped)
+	}
+	fmt.Println()
+	return nil
+}
+
+// selectMonitorPins resolves PIN and INDEX:PIN specs, by package pin or BSDL
+// port name, against the controller. An empty spec list selects every pin and
+// returns nil.
+func selectMonitorPins(ctl *bsr.Controller, specs []string) ([]bsr.PinRef, error) {
+	var pins []bsr.PinRef
+	for _, spec := range specs {
+		index := -1
+		name := spec
+		if i := strings.Index(spec, ":"); i >= 0 {
+			n, err := strconv.Atoi(spec[:i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid pin %q: bad chain index", spec)
+			}
+			index, name = n, spec[i+1:]
+		}
+
+		found := false
+		for i, dev := range ctl.Devices {
+			if index >= 0 && i != index {
+				continue
+			}
+			// Accept the BSDL port name as well as the package pin name
+			pinName := name
+			for port, pin := range dev.ChainDev.PinMap() {
+				if strings.EqualFold(port, name) {
+					pinName = pin
+					break
+				}
+			}
+			for pin, ps := range dev.Pins {
+				if strings.EqualFold(pin, pinName) {
+					pins = append(pins, ps.Ref)
+					found = true
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("pin %q not found in chain", spec)
+		}
+	}
+	return pins, nil
+}
+
+func describePinCount(pins []bsr.PinRef) string {
+	if len(pins) == 0 {
+		return "all"
+	}
+	return strconv.Itoa(len(pins))
+}
+
+func printPinEvent(ev bsr.PinEvent, offset time.Duration) {
+	level := "0"
+	if ev.Value {
+		level = "1"
+	}
+	edge := "initial"
+	if !ev.Initial {
+		edge = "fall"
+		if ev.Value {
+			edge = "rise"
+		}
+	}
+	fmt.Printf("%12.6fs  %d:%s.%s  %s  %s\n",
+		offset.Seconds(), ev.Ref.ChainIndex, ev.Ref.DeviceName, ev.Ref.PinName, level, edge)
+}
@@ -0,0 +1,362 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/reveng"
+	"github.com/spf13/cobra"
+)
+
+var jtagNetlistCmd = &cobra.Command{
+	Use:   "netlist",
+	Short: "Inspect and edit reverse-engineered netlists",
+	Long: `Commands for netlists saved by reveng (JSON, or KiCad .net) and the GUI net
+editor. Edits go through the same API as the GUI and are recorded in the
+netlist's change log.
+
+Nets are given by ID, as listed by "show", or by name. Pins are given as
+REF.PIN or DEVICE.PIN, e.g. U1.23 or STM32F405.PA5; PIN is the package pin.
+
+Edit commands write the result back to the input file unless --output is
+given. The format follows the file extension: .net for a KiCad netlist,
+anything else JSON. Only JSON keeps the change log and net notes.`,
+}
+
+var netlistOutput string
+
+var jtagNetlistShowCmd = &cobra.Command{
+	Use:   "show <netlist> [net...]",
+	Short: "List the nets of a netlist",
+	Long: `List every net with its ID, name, confidence and pins, or only the given
+nets.
+
+Examples:
+  otj jtag netlist show netlist.json
+  otj jtag netlist show netlist.json SPI_SCK 4
+  otj jtag netlist show --changes netlist.json`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runNetlistShow,
+}
+
+var netlistShowChanges bool
+
+var jtagNetlistMergeCmd = &cobra.Command{
+	Use:   "merge <netlist> <net> <net>...",
+	Short: "Merge nets into one",
+	Long: `Merge two or more nets into the one with the lowest ID.
+
+Example:
+  otj jtag netlist merge netlist.json 3 SPI_SCK`,
+	Args: cobra.MinimumNArgs(3),
+	RunE: runNetlistMerge,
+}
+
+var jtagNetlistSplitCmd = &cobra.Command{
+	Use:   "split <netlist> <net> <pin>...",
+	Short: "Move pins of a net into a new net",
+	Long: `Move the given pins off a net into a new net of their own.
+
+Example:
+  otj jtag netlist split netlist.json 5 U2.A3 U2.A4`,
+	Args: cobra.MinimumNArgs(3),
+	RunE: runNetlistSplit,
+}
+
+var jtagNetlistRenameCmd = &cobra.Command{
+	Use:   "rename <netlist> <net> <name>",
+	Short: "Name a net by hand",
+	Long: `Give a net a name that replaces the derived one and is kept by later edits.
+An empty name ("") goes back to the derived name.
+
+Example:
+  otj jtag netlist rename netlist.json 7 FLASH_CLK`,
+	Args: cobra.ExactArgs(3),
+	RunE: runNetlistRename,
+}
+
+var jtagNetlistExportCmd = &cobra.Command{
+	Use:   "export <netlist>",
+	Short: "Convert a netlist to JSON or KiCad",
+	Long: `Write the netlist in the format of the --output file extension: .net for a
+KiCad netlist, anything else JSON.
+
+Example:
+  otj jtag netlist export netlist.json -o board.net`,
+	Args: cobra.ExactArgs(1),
+	RunE: runNetlistExport,
+}
+
+func init() {
+	jtagCmd.AddCommand(jtagNetlistCmd)
+	jtagNetlistCmd.AddCommand(jtagNetlistShowCmd)
+	jtagNetlistCmd.AddCommand(jtagNetlistMergeCmd)
+	jtagNetlistCmd.AddCommand(jtagNetlistSplitCmd)
+	jtagNetlistCmd.AddCommand(jtagNetlistRenameCmd)
+	jtagNetlistCmd.AddCommand(jtagNetlistExportCmd)
+
+	jtagNetlistShowCmd.Flags().BoolVar(&netlistShowChanges, "changes", false,
+		"also list the change log")
+	for _, c := range []*cobra.Command{jtagNetlistMergeCmd, jtagNetlistSplitCmd, jtagNetlistRenameCmd} {
+		c.Flags().StringVarP(&netlistOutput, "output", "o", "",
+			"write the edited netlist here instead of over the input")
+	}
+	jtagNetlistExportCmd.Flags().StringVarP(&netlistOutput, "output", "o", "",
+		"output file (.json or .net)")
+	jtagNetlistExportCmd.MarkFlagRequired("output")
+}
+
+func runNetlistShow(cmd *cobra.Command, args []string) error {
+	nl, err := loadNetlist(args[0])
+	if err != nil {
+		return err
+	}
+
+	nets := nl.Nets
+	if len(args) > 1 {
+		nets = nil
+		for _, ref := range args[1:] {
+			net, err := findNet(nl, ref)
+			if err != nil {
+				return err
+			}
+			nets = append(nets, net)
+		}
+	} else {
+		fmt.Printf("%s: %d nets\n", args[0], len(nl.Nets))
+	}
+
+	for _, net := range nets {
+		fmt.Printf("\nNet %d  %s", net.ID, nl.NetName(net))
+		if net.Renamed {
+			fmt.Print(" (renamed)")
+		}
+		if net.Confidence > 0 && net.Confidence < 1 {
+			fmt.Printf("  confidence %.0f%%", net.Confidence*100)
+		}
+		fmt.Println()
+		if net.Note != "" {
+			fmt.Printf("  Note: %s\n", net.Note)
+		}
+		for _, pin := range net.Pins {
+			line := fmt.Sprintf("  %s.%s", nl.Part(pin.Chain, pin.ChainIndex, pin.DeviceName).Ref, pin.PinName)
+			if port, ok := nl.PortName(pin); ok {
+				line += " (" + port + ")"
+			}
+			if verbose {
+				line += fmt.Sprintf("  [%s, chain %d device %d]", pin.DeviceName, pin.Chain, pin.ChainIndex)
+			}
+			fmt.Println(line)
+		}
+	}
+
+	if netlistShowChanges {
+		fmt.Printf("\nChanges (%d):\n", len(nl.Changes))
+		for _, c := range nl.Changes {
+			fmt.Printf("  %s  %-10s  %s\n", c.Time.Format("2006-01-02 15:04:05"), c.Op, c.Detail)
+		}
+	}
+	return nil
+}
+
+func runNetlistMerge(cmd *cobra.Command, args []string) error {
+	return editNetlist(args[0], func(ed *reveng.Editor) error {
+		var ids []int
+		for _, ref := range args[1:] {
+			net, err := findNet(ed.Netlist(), ref)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, net.ID)
+		}
+		_, err := ed.Merge(ids...)
+		return err
+	})
+}
+
+func runNetlistSplit(cmd *cobra.Command, args []string) error {
+	return editNetlist(args[0], func(ed *reveng.Editor) error {
+		net, err := findNet(ed.Netlist(), args[1])
+		if err != nil {
+			return err
+		}
+		var pins []bsr.PinRef
+		for _, spec := range args[2:] {
+			pin, err := findPin(ed.Netlist(), spec)
+			if err != nil {
+				return err
+			}
+			pins = append(pins, pin)
+		}
+		_, err = ed.Split(net.ID, pins...)
+		return err
+	})
+}
+
+func runNetlistRename(cmd *cobra.Command, args []string) error {
+	return editNetlist(args[0], func(ed *reveng.Editor) error {
+		net, err := findNet(ed.Netlist(), args[1])
+		if err != nil {
+			return err
+		}
+		return ed.Rename(net.ID, args[2])
+	})
+}
+
+func runNetlistExport(cmd *cobra.Command, args []string) error {
+	nl, err := loadNetlist(args[0])
+	if err != nil {
+		return err
+	}
+	if err := saveNetlist(nl, netlistOutput); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s (%d nets)\n", netlistOutput, len(nl.Nets))
+	return nil
+}
+
+// editNetlist loads a netlist, applies one edit and saves the result to
+// --output or back to path.
+func editNetlist(path string, edit func(ed *reveng.Editor) error) error {
+	nl, err := loadNetlist(path)
+	if err != nil {
+		return err
+	}
+	ed := reveng.NewEditor(nl)
+	if err := edit(ed); err != nil {
+		return err
+	}
+
+	out := netlistOutput
+	if out == "" {
+		out = path
+	}
+	if err := saveNetlist(nl, out); err != nil {
+		return err
+	}
+	if n := len(nl.Changes); n > 0 {
+		fmt.Printf("%s\n", nl.Changes[n-1].Detail)
+	}
+	fmt.Printf("Saved %s\n", out)
+	return nil
+}
+
+// loadNetlist reads a JSON netlist, or a KiCad one for .net files.
+func loadNetlist(path string) (*reveng.Netlist, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read netlist: %w", err)
+	}
+	if isKiCadNetlist(path) {
+		return reveng.ImportKiCad(data)
+	}
+	return reveng.ImportJSON(data)
+}
+
+// saveNetlist writes a netlist in the format its extension asks for.
+func saveNetlist(nl *reveng.Netlist, path string) error {
+	var data []byte
+	if isKiCadNetlist(path) {
+		text, err := nl.ExportKiCad()
+		if err != nil {
+			return err
+		}
+		data = []byte(text)
+	} else {
+		var err error
+		if data, err = nl.ExportJSON(); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write netlist: %w", err)
+	}
+	return nil
+}
+
+func isKiCadNetlist(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".net")
+}
+
+// findNet resolves a net by ID or name; names match case-insensitively
+// when there is no exact match.
+func findNet(nl *reveng.Netlist, ref string) (*reveng.Net, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		for _, net := range nl.Nets {
+			if net.ID == id {
+				return net, nil
+			}
+		}
+	}
+	var fold *reveng.Net
+	for _, net := range nl.Nets {
+		name := nl.NetName(net)
+		if name == ref {
+			return net, nil
+		}
+		if fold == nil && strings.EqualFold(name, ref) {
+			fold = net
+		}
+	}
+	if fold != nil {
+		return fold, nil
+	}
+	return nil, fmt.Errorf("no net %q (see 'otj jtag netlist show')", ref)
+}
+
+// findPin resolves REF.PIN or DEVICE.PIN against the netlist's parts. A
+// reference designator wins over a device name, and a device name shared
+// by several parts is refused.
+func findPin(nl *reveng.Netlist, spec string) (bsr.PinRef, error) {
+	part, pin, ok := strings.Cut(spec, ".")
+	if !ok || part == "" || pin == "" {
+		return bsr.PinRef{}, fmt.Errorf("invalid pin %q (want REF.PIN, e.g. U1.23)", spec)
+	}
+	var matches []reveng.Component
+	for _, c := range netlistParts(nl) {
+		if c.Ref == part {
+			return c.PinRef(pin), nil
+		}
+		if c.Device == part {
+			matches = append(matches, c)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return bsr.PinRef{}, fmt.Errorf("no part %q in the netlist", part)
+	case 1:
+		return matches[0].PinRef(pin), nil
+	}
+	refs := make([]string, len(matches))
+	for i, c := range matches {
+		refs[i] = c.Ref
+	}
+	sort.Strings(refs)
+	return bsr.PinRef{}, fmt.Errorf("device %q is ambiguous (%s); use the reference designator", part, strings.Join(refs, ", "))
+}
+
+// netlistParts returns the parts of the netlist, including devices only
+// seen in nets, named as the exports name them (see reveng.Netlist.Part).
+func netlistParts(nl *reveng.Netlist) []reveng.Component {
+	devices := make(map[[2]int]string)
+	for _, c := range nl.Components() {
+		devices[[2]int{c.Chain, c.ChainIndex}] = c.Device
+	}
+	for _, net := range nl.Nets {
+		for _, pin := range net.Pins {
+			if id := [2]int{pin.Chain, pin.ChainIndex}; devices[id] == "" {
+				devices[id] = pin.DeviceName
+			}
+		}
+	}
+	parts := make([]reveng.Component, 0, len(devices))
+	for id, device := range devices {
+		parts = append(parts, nl.Part(id[0], id[1], device))
+	}
+	return parts
+}
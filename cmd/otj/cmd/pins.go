@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
+	"github.com/spf13/cobra"
+)
+
+// JTAG pins command
+var (
+	pinsReset      string
+	pinsTRST       string
+	pinsPulseWidth time.Duration
+	pinsVoltageID  uint8
+)
+
+var jtagPinsCmd = &cobra.Command{
+	Use:   "pins",
+	Short: "Show and drive the probe's reset lines",
+	Long: `Report which control lines the adapter can drive, their current levels and
+the target supply voltage, and optionally assert, release or pulse nRESET and
+nTRST. Both resets are active low: "assert" drives the line low.
+
+CMSIS-DAP has no standard DAP_Info ID for the target voltage, so firmware that
+senses it reports millivolts under a vendor ID. Pass that ID with
+--voltage-info-id; without it, or when the probe answers with no data, the
+voltage shows as n/a.
+
+An asserted line is held until the command is interrupted with Ctrl-C, then
+released: closing the probe tri-states its pins. To keep an MCU's firmware
+off its pins during boundary scan, give the commands that talk to the chain
+--hold-reset, which asserts nRESET for the duration of that one command.
+
+Examples:
+  # Show pin levels
+  otj jtag pins --adapter cmsisdap
+
+  # Reset the target with a 50ms pulse
+  otj jtag pins --adapter cmsisdap --reset pulse --pulse-width 50ms
+
+  # Read the target voltage from firmware reporting it under DAP_Info ID 0x80
+  otj jtag pins --adapter cmsisdap --voltage-info-id 0x80
+
+  # Keep the MCU in reset until Ctrl-C
+  otj jtag pins --adapter cmsisdap --reset assert`,
+	RunE: runJTAGPins,
+}
+
+func init() {
+	jtagCmd.AddCommand(jtagPinsCmd)
+
+	jtagPinsCmd.Flags().StringVarP(&adapterType, "adapter", "a", "simulator",
+		"JTAG adapter type (simulator, cmsisdap, pico, buspirate)")
+	jtagPinsCmd.Flags().StringVarP(&adapterSerial, "serial", "s", "",
+		"adapter serial number or USB bus:port (default: the probe saved by 'otj jtag interfaces --select')")
+	jtagPinsCmd.Flags().StringVar(&pinsReset, "reset", "",
+		"nRESET action: assert, release or pulse")
+	jtagPinsCmd.Flags().StringVar(&pinsTRST, "trst", "",
+		"nTRST action: assert, release or pulse")
+	jtagPinsCmd.Flags().DurationVar(&pinsPulseWidth, "pulse-width", 100*time.Millisecond,
+		"how long a pulse holds the line low")
+	jtagPinsCmd.Flags().Uint8Var(&pinsVoltageID, "voltage-info-id", 0,
+		"vendor DAP_Info ID under which a CMSIS-DAP probe reports the target voltage (0: none)")
+}
+
+func runJTAGPins(cmd *cobra.Command, args []string) error {
+	adapter, err := createJTAGAdapter(adapterType, adapterSerial)
+	if err != nil {
+		return fmt.Errorf("failed to create adapter: %w", err)
+	}
+	if closer, ok := adapter.(interface{ Close() error }); ok {
+		defer closer.Close()
+	}
+	if dap, ok := adapter.(*jtag.CMSISDAPAdapter); ok {
+		dap.VoltageInfoID = pinsVoltageID
+	}
+
+	info, err := adapter.Info()
+	if err != nil && err != jtag.ErrNotImplemented {
+		return fmt.Errorf("failed to get adapter info: %w", err)
+	}
+	pc, ok := adapter.(jtag.PinController)
+	if !ok {
+		return fmt.Errorf("adapter %s does not support pin control", adapterType)
+	}
+
+	fmt.Printf("Adapter: %s\n", info.Name)
+	fmt.Printf("  Protocols: %s\n", describeProtocols(info))
+	fmt.Printf("  nRESET: %s\n", supportedString(info.SupportsSRST))
+	fmt.Printf("  nTRST:  %s\n", supportedString(info.SupportsTRST))
+
+	var held jtag.AdapterPin
+	for _, action := range []struct {
+		pin    jtag.AdapterPin
+		action string
+	}{
+		{jtag.PinNRESET, pinsReset},
+		{jtag.PinNTRST, pinsTRST},
+	} {
+		if action.action == "" {
+			continue
+		}
+		if err := applyResetAction(pc, action.pin, action.action, pinsPulseWidth); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", action.pin, action.action)
+		if action.action == "assert" {
+			held |= action.pin
+		}
+	}
+
+	levels, err := pc.ReadPins()
+	if err != nil {
+		return fmt.Errorf("failed to read pins: %w", err)
+	}
+	fmt.Println("\nPin levels:")
+	for _, pin := range []jtag.AdapterPin{
+		jtag.PinTCK, jtag.PinTMS, jtag.PinTDI, jtag.PinTDO, jtag.PinNTRST, jtag.PinNRESET,
+	} {
+		level := "low"
+		if levels&pin != 0 {
+			level = "high"
+		}
+		fmt.Printf("  %-7s %s\n", pin, level)
+	}
+
+	volts, err := pc.TargetVoltage()
+	switch {
+	case errors.Is(err, jtag.ErrNotImplemented):
+		fmt.Println("\nTarget voltage: n/a")
+	case err != nil:
+		return fmt.Errorf("failed to read target voltage: %w", err)
+	default:
+		fmt.Printf("\nTarget voltage: %.2f V\n", volts)
+	}
+
+	if held != 0 {
+		// The probe releases its pins when closed, so stay open until told
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		fmt.Printf("\nHolding %s low; press Ctrl-C to release\n", held)
+		<-ctx.Done()
+		if err := jtag.AssertReset(pc, held, false); err != nil {
+			return fmt.Errorf("%s release failed: %w", held, err)
+		}
+		fmt.Printf("%s: release\n", held)
+	}
+	return nil
+}
+
+func applyResetAction(pc jtag.PinController, pin jtag.AdapterPin, action string, width time.Duration) error {
+	var err error
+	switch action {
+	case "assert":
+		err = jtag.AssertReset(pc, pin, true)
+	case "release":
+		err = jtag.AssertReset(pc, pin, false)
+	case "pulse":
+		err = jtag.PulseReset(pc, pin, width)
+	default:
+		return fmt.Errorf("invalid %s action %q (use assert, release or pulse)", pin, action)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", pin, action, err)
+	}
+	return nil
+}
+
+func describeProtocols(info jtag.AdapterInfo) string {
+	switch {
+	case info.SupportsJTAG && info.SupportsSWD:
+		return "JTAG, SWD"
+	case info.SupportsSWD:
+		return "SWD"
+	case info.SupportsJTAG:
+		return "JTAG"
+	}
+	return "not reported"
+}
+
+func supportedString(ok bool) string {
+	if ok {
+		return "supported"
+	}
+	return "not reported"
+}
+
+// resetHolder is the adapter whose nRESET --hold-reset asserted, released
+// by Execute once the command has finished.
+var resetHolder jtag.PinController
+
+// holdTargetReset asserts nRESET for the rest of the command.
+func holdTargetReset(adapter jtag.Adapter) error {
+	pc, ok := adapter.(jtag.PinController)
+	if !ok {
+		return fmt.Errorf("--hold-reset: adapter %s does not support pin control", adapterType)
+	}
+	if err := jtag.AssertReset(pc, jtag.PinNRESET, true); err != nil {
+		return fmt.Errorf("--hold-reset: %w", err)
+	}
+	if verbose {
+		fmt.Println("Holding target in reset")
+	}
+	resetHolder = pc
+	return nil
+}
+
+// releaseTargetReset undoes holdTargetReset, if it was used.
+func releaseTargetReset() {
+	if resetHolder == nil {
+		return
+	}
+	if err := jtag.AssertReset(resetHolder, jtag.PinNRESET, false); err != nil {
+		fmt.Printf("Warning: failed to release target reset: %v\n", err)
+	}
+	resetHolder = nil
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
+)
+
+// TestPinsTargetVoltage runs 'otj jtag pins' against a fake CMSIS-DAP probe
+// that reports its target voltage under a vendor DAP_Info ID.
+func TestPinsTargetVoltage(t *testing.T) {
+	old := openCMSISDAPAdapter
+	defer func() { openCMSISDAPAdapter = old }()
+	openCMSISDAPAdapter = func(jtag.ProbeSelector) (*jtag.CMSISDAPAdapter, error) {
+		fake := jtag.NewFakeDAPTransport()
+		fake.VoltageInfoID = 0x80
+		fake.TargetMillivolts = 3300
+		return jtag.NewCMSISDAPAdapterWithTransport(fake)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"with ID", []string{"--voltage-info-id", "0x80"}, "Target voltage: 3.30 V"},
+		{"without ID", nil, "Target voltage: n/a"},
+		{"wrong ID", []string{"--voltage-info-id", "0x81"}, "Target voltage: n/a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pinsVoltageID = 0
+			pinsReset, pinsTRST = "", ""
+			adapterSerial = ""
+
+			output, err := runCapturingStdout(append([]string{"jtag", "pins", "--adapter", "cmsisdap"}, tt.args...))
+			if err != nil {
+				t.Fatalf("jtag pins: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(output, tt.want) {
+				t.Errorf("output missing %q:\n%s", tt.want, output)
+			}
+		})
+	}
+}
+
+// runCapturingStdout executes the root command with args and returns what
+// it printed.
+func runCapturingStdout(args []string) (string, error) {
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		buf.ReadFrom(r)
+		close(done)
+	}()
+
+	rootCmd.SetArgs(args)
+	err := rootCmd.Execute()
+
+	w.Close()
+	os.Stdout = old
+	<-done
+	return buf.String(), err
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
+	"github.com/spf13/cobra"
+)
+
+var swdCmd = &cobra.Command{
+	Use:   "swd",
+	Short: "Serial Wire Debug operations",
+	Long:  `Commands for talking to ARM targets over SWD, for boards that only bring out SWD.`,
+}
+
+// SWD info command
+var swdAPCount int
+
+var swdInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Identify the MCU behind an SWD port",
+	Long: `Switch the target from JTAG to SWD, read the debug port DPIDR, power up the
+debug domain and list the access ports. When AP 0 is a memory AP, the Cortex-M
+CPUID register is read to name the core.
+
+Examples:
+  # Simulated Cortex-M4
+  otj swd info
+
+  # CMSIS-DAP probe, choosing one of several by serial number
+  otj swd info --adapter cmsisdap --serial E6614C311B4A8D2B`,
+	RunE: runSWDInfo,
+}
+
+func init() {
+	rootCmd.AddCommand(swdCmd)
+	swdCmd.AddCommand(swdInfoCmd)
+
+	swdInfoCmd.Flags().StringVarP(&adapterType, "adapter", "a", "simulator",
+		"adapter type (simulator, cmsisdap)")
+	swdInfoCmd.Flags().StringVarP(&adapterSerial, "serial", "s", "",
+		"adapter serial number or USB bus:port (default: the probe saved by 'otj jtag interfaces --select')")
+	swdInfoCmd.Flags().IntVar(&adapterSpeed, "speed", 1000000,
+		"SWCLK speed in Hz (default 1MHz)")
+	swdInfoCmd.Flags().IntVar(&swdAPCount, "aps", 4,
+		"number of access ports to probe")
+}
+
+func runSWDInfo(cmd *cobra.Command, args []string) error {
+	var adapter jtag.SWDAdapter
+	switch adapterType {
+	case "simulator", "sim":
+		adapter = jtag.NewSimSWDTarget()
+	default:
+		a, err := createJTAGAdapter(adapterType, adapterSerial)
+		if err != nil {
+			return fmt.Errorf("failed to create adapter: %w", err)
+		}
+		if closer, ok := a.(interface{ Close() error }); ok {
+			defer closer.Close()
+		}
+		if err := a.SetSpeed(adapterSpeed); err != nil && err != jtag.ErrNotImplemented {
+			return fmt.Errorf("failed to set speed: %w", err)
+		}
+		swd, ok := a.(jtag.SWDAdapter)
+		if !ok {
+			return fmt.Errorf("adapter %s does not support SWD", adapterType)
+		}
+		adapter = swd
+	}
+
+	port := jtag.NewSWDPort(adapter)
+	dpidr, err := port.Connect()
+	if err != nil {
+		return fmt.Errorf("SWD connect failed: %w", err)
+	}
+	fmt.Printf("DPIDR: %s\n", jtag.DecodeDPIDR(dpidr))
+
+	if err := port.PowerUp(); err != nil {
+		return err
+	}
+
+	for ap := 0; ap < swdAPCount; ap++ {
+		idr, err := port.ReadAP(uint8(ap), jtag.MemAPRegIDR)
+		if err != nil {
+			fmt.Printf("AP %d: %v\n", ap, err)
+			continue
+		}
+		if idr == 0 {
+			continue
+		}
+		fmt.Printf("AP %d: IDR 0x%08X (%s)\n", ap, idr, describeAPIDR(idr))
+
+		if ap == 0 && isMemAP(idr) {
+			cpuid, err := port.ReadMem32(0, 0xE000ED00)
+			if err != nil {
+				fmt.Printf("  CPUID: %v\n", err)
+				continue
+			}
+			fmt.Printf("  CPUID: 0x%08X (%s)\n", cpuid, describeCPUID(cpuid))
+		}
+	}
+	return nil
+}
+
+func isMemAP(idr uint32) bool {
+	return (idr>>13)&0xF == 0x8
+}
+
+// describeAPIDR names the AP class and, for MEM-APs, the bus type.
+func describeAPIDR(idr uint32) string {
+	if !isMemAP(idr) {
+		if (idr>>13)&0xF == 0 && idr&0xF == 0 {
+			return "JTAG-AP"
+		}
+		return "unknown AP class"
+	}
+	buses := map[uint32]string{
+		0x1: "AHB3", 0x2: "APB2/APB3", 0x4: "AXI3/AXI4",
+		0x5: "AHB5", 0x6: "APB4/APB5", 0x7: "AXI5",
+	}
+	if bus, ok := buses[idr&0xF]; ok {
+		return "MEM-AP, " + bus
+	}
+	return "MEM-AP"
+}
+
+// describeCPUID names Arm Cortex-M cores from the CPUID register.
+func describeCPUID(cpuid uint32) string {
+	implementer := cpuid >> 24
+	partNo := (cpuid >> 4) & 0xFFF
+	variant := (cpuid >> 20) & 0xF
+	revision := cpuid & 0xF
+
+	if implementer != 0x41 {
+		return fmt.Sprintf("implementer 0x%02X, part 0x%03X", implementer, partNo)
+	}
+	cores := map[uint32]string{
+		0xC20: "Cortex-M0", 0xC60: "Cortex-M0+", 0xC21: "Cortex-M1",
+		0xC23: "Cortex-M3", 0xC24: "Cortex-M4", 0xC27: "Cortex-M7",
+		0xD20: "Cortex-M23", 0xD21: "Cortex-M33", 0xD22: "Cortex-M55",
+		0xD23: "Cortex-M85",
+	}
+	name, ok := cores[partNo]
+	if !ok {
+		name = fmt.Sprintf("part 0x%03X", partNo)
+	}
+	return fmt.Sprintf("Arm %s r%dp%d", name, variant, revision)
+}
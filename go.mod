@@ -6,6 +6,7 @@ toolchain go1.24.10
 
 require (
 	gioui.org v0.9.0
+	gioui.org/x v0.9.0
 	github.com/alecthomas/participle/v2 v2.1.4
 	github.com/chewxy/sexp v0.0.0-20181223234510-461851156c0f
 	github.com/google/gousb v1.1.2
@@ -16,7 +17,6 @@ require (
 
 require (
 	gioui.org/shader v1.0.8 // indirect
-	gioui.org/x v0.9.0 // indirect
 	git.wow.st/gmp/jni v0.0.0-20210610011705-34026c7e22d0 // indirect
 	github.com/go-text/typesetting v0.3.0 // indirect
 	github.com/godbus/dbus/v5 v5.0.6 // indirect
@@ -293,6 +293,7 @@ func New(w *app.Window) *App {
 	if config, err := LoadConfig(); err == nil {
 		app.boardColorTheme = kicadrenderer.ColorTheme(config.BoardColorTheme)
 		kicadrenderer.SetTheme(app.boardColorTheme)
+		app.reverseView.SetProbe(config.Probe)
 	}
 	app.logSelectable.WrapPolicy = text.WrapGraphemes
 	app.logList.Axis = layout.Vertical
@@ -1458,10 +1459,12 @@ func (a *App) layoutBoardThemeSelector(gtx layout.Context) layout.Dimensions {
 				a.boardColorTheme = theme
 				kicadrenderer.SetTheme(theme)
 				
-				// Save config
-				config := &AppConfig{
-					BoardColorTheme: int(theme),
+				// Save config, keeping the other settings
+				config, err := LoadConfig()
+				if err != nil {
+					config = &AppConfig{}
 				}
+				config.BoardColorTheme = int(theme)
 				if err := SaveConfig(config); err != nil {
 					a.Logf("[ERROR] Failed to save config: %v", err)
 				}
@@ -1573,10 +1576,15 @@ func (a *App) layoutFootprints(gtx layout.Context) layout.Dimensions {
 
 func (a *App) layoutNetlist(gtx layout.Context) layout.Dimensions {
 	if a.discoveredNetlist == nil || a.discoveredNetlist.NetCount() == 0 {
+		if a.netEditor.importBtn.Clicked(gtx) {
+			a.openNetlistFilePicker()
+		}
 		return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
 			layout.Rigid(material.Body1(a.gvTheme.Theme, "No netlist available.").Layout),
 			layout.Rigid(layout.Spacer{Height: unit.Dp(8)}.Layout),
-			layout.Rigid(material.Body2(a.gvTheme.Theme, "Run reverse engineering to discover nets.").Layout),
+			layout.Rigid(material.Body2(a.gvTheme.Theme, "Run reverse engineering to discover nets, or import a saved netlist.").Layout),
+			layout.Rigid(layout.Spacer{Height: unit.Dp(8)}.Layout),
+			layout.Rigid(material.Button(a.gvTheme.Theme, &a.netEditor.importBtn, "Import Netlist").Layout),
 		)
 	}
 	return a.netEditor.LayoutWorkspace(gtx, a.gvTheme.Theme, a)
@@ -5,12 +5,20 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/kicad/renderer"
 )
 
 // AppConfig stores persistent application settings
 type AppConfig struct {
 	BoardColorTheme int `json:"board_color_theme"` // Store as int for JSON compatibility
+
+	// Probe selects which of several identical CMSIS-DAP probes to open
+	Probe jtag.ProbeSelector `json:"probe,omitempty"`
+
+	// Footprints maps BSDL package names to the KiCad footprints that
+	// reverse-engineered netlists give parts in them
+	Footprints map[string]string `json:"footprints,omitempty"`
 }
 
 // getConfigPath returns the path to the config file
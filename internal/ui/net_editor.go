@@ -21,10 +21,18 @@ import (
 type NetEditor struct {
 	list          widget.List
 	exportBtn     widget.Clickable
+	schematicBtn  widget.Clickable
+	importBtn     widget.Clickable
 	addNetBtn     widget.Clickable
+	undoBtn       widget.Clickable
+	redoBtn       widget.Clickable
+	
+	// Edits go through edit, which keeps the change log and undo history
+	edit *reveng.Editor
 	
 	netDeleteBtn  map[int]*widget.Clickable
 	netAddPinBtn  map[int]*widget.Clickable
+	netNameEditor map[int]*widget.Editor
 	pinDeleteBtn  map[string]*widget.Clickable
 	
 	// Pin selection dialog
@@ -40,6 +48,7 @@ func NewNetEditor() *NetEditor {
 	ne := &NetEditor{
 		netDeleteBtn:  make(map[int]*widget.Clickable),
 		netAddPinBtn:  make(map[int]*widget.Clickable),
+		netNameEditor: make(map[int]*widget.Editor),
 		pinDeleteBtn:  make(map[string]*widget.Clickable),
 		pinSelectBtns: make(map[string]*widget.Clickable),
 	}
@@ -49,6 +58,9 @@ func NewNetEditor() *NetEditor {
 }
 
 func (ne *NetEditor) Open(netlist *reveng.Netlist) {
+	// Net IDs are reused across netlists, so start the names afresh
+	ne.netNameEditor = make(map[int]*widget.Editor)
+	ne.edit = reveng.NewEditor(netlist)
 	for _, net := range netlist.Nets {
 		if _, ok := ne.netDeleteBtn[net.ID]; !ok {
 			ne.netDeleteBtn[net.ID] = &widget.Clickable{}
@@ -56,9 +68,10 @@ func (ne *NetEditor) Open(netlist *reveng.Netlist) {
 		if _, ok := ne.netAddPinBtn[net.ID]; !ok {
 			ne.netAddPinBtn[net.ID] = &widget.Clickable{}
 		}
+		ne.ensureNameEditor(net)
 		
 		for _, pin := range net.Pins {
-			key := fmt.Sprintf("%d:%d:%s", net.ID, pin.ChainIndex, pin.PinName)
+			key := netPinKey(net.ID, pin)
 			if _, ok := ne.pinDeleteBtn[key]; !ok {
 				ne.pinDeleteBtn[key] = &widget.Clickable{}
 			}
@@ -75,9 +88,10 @@ func (ne *NetEditor) LayoutWorkspace(gtx layout.Context, th *material.Theme, app
 		if _, ok := ne.netAddPinBtn[net.ID]; !ok {
 			ne.netAddPinBtn[net.ID] = &widget.Clickable{}
 		}
+		ne.ensureNameEditor(net)
 		
 		for _, pin := range net.Pins {
-			key := fmt.Sprintf("%d:%d:%s", net.ID, pin.ChainIndex, pin.PinName)
+			key := netPinKey(net.ID, pin)
 			if _, ok := ne.pinDeleteBtn[key]; !ok {
 				ne.pinDeleteBtn[key] = &widget.Clickable{}
 			}
@@ -88,6 +102,34 @@ func (ne *NetEditor) LayoutWorkspace(gtx layout.Context, th *material.Theme, app
 		app.exportNetlistKiCad()
 	}
 	
+	if ne.schematicBtn.Clicked(gtx) {
+		app.exportNetlistSchematic()
+	}
+	
+	if ne.importBtn.Clicked(gtx) {
+		app.openNetlistFilePicker()
+	}
+	
+	for netID, ed := range ne.netNameEditor {
+		for {
+			ev, ok := ed.Update(gtx)
+			if !ok {
+				break
+			}
+			if _, ok := ev.(widget.SubmitEvent); ok {
+				ne.renameNet(netID, ed.Text(), app)
+			}
+		}
+	}
+	
+	if ne.undoBtn.Clicked(gtx) {
+		ne.undo(app)
+	}
+	
+	if ne.redoBtn.Clicked(gtx) {
+		ne.redo(app)
+	}
+	
 	if ne.addNetBtn.Clicked(gtx) {
 		ne.addNewNet(app)
 		app.buildRatsnest()
@@ -123,17 +165,43 @@ func (ne *NetEditor) LayoutWorkspace(gtx layout.Context, th *material.Theme, app
 				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
 					return material.H6(th, fmt.Sprintf("Netlist (%d nets)", app.discoveredNetlist.NetCount())).Layout(gtx)
 				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					btn := material.Button(th, &ne.undoBtn, "Undo")
+					if !ne.editor(app).CanUndo() {
+						btn.Background = color.NRGBA{R: 158, G: 158, B: 158, A: 255}
+					}
+					return btn.Layout(gtx)
+				}),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(8)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					btn := material.Button(th, &ne.redoBtn, "Redo")
+					if !ne.editor(app).CanRedo() {
+						btn.Background = color.NRGBA{R: 158, G: 158, B: 158, A: 255}
+					}
+					return btn.Layout(gtx)
+				}),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(8)}.Layout),
 				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 					btn := material.Button(th, &ne.addNetBtn, "+ Add Net")
 					btn.Background = color.NRGBA{R: 76, G: 175, B: 80, A: 255}
 					return btn.Layout(gtx)
 				}),
 				layout.Rigid(layout.Spacer{Width: unit.Dp(8)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.Button(th, &ne.importBtn, "Import").Layout(gtx)
+				}),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(8)}.Layout),
 				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 					btn := material.Button(th, &ne.exportBtn, "Export KiCad")
 					btn.Background = color.NRGBA{R: 33, G: 150, B: 243, A: 255}
 					return btn.Layout(gtx)
 				}),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(8)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					btn := material.Button(th, &ne.schematicBtn, "Export Schematic")
+					btn.Background = color.NRGBA{R: 33, G: 150, B: 243, A: 255}
+					return btn.Layout(gtx)
+				}),
 			)
 		}),
 		layout.Rigid(layout.Spacer{Height: unit.Dp(16)}.Layout),
@@ -153,11 +221,21 @@ func (ne *NetEditor) layoutNet(gtx layout.Context, th *material.Theme, app *App,
 			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
 				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
-						layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
-							label := material.Body1(th, fmt.Sprintf("Net %d (%d pins)", net.ID, len(net.Pins)))
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							label := material.Body1(th, fmt.Sprintf("Net %d", net.ID))
 							label.Font.Weight = font.Bold
 							return label.Layout(gtx)
 						}),
+						layout.Rigid(layout.Spacer{Width: unit.Dp(12)}.Layout),
+						layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+							// Empty unless renamed; the hint shows the derived name
+							ed := material.Editor(th, ne.netNameEditor[net.ID], app.discoveredNetlist.NetName(net))
+							return ed.Layout(gtx)
+						}),
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							return layout.Inset{Left: unit.Dp(8), Right: unit.Dp(8)}.Layout(gtx,
+								material.Body2(th, fmt.Sprintf("(%d pins)", len(net.Pins))).Layout)
+						}),
 						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 							btn := material.Button(th, ne.netDeleteBtn[net.ID], "Delete")
 							btn.Background = color.NRGBA{R: 200, G: 50, B: 50, A: 255}
@@ -199,7 +277,7 @@ func (ne *NetEditor) layoutNet(gtx layout.Context, th *material.Theme, app *App,
 }
 
 func (ne *NetEditor) layoutPin(gtx layout.Context, th *material.Theme, netID int, pin bsr.PinRef, app *App) layout.Dimensions {
-	key := fmt.Sprintf("%d:%d:%s", netID, pin.ChainIndex, pin.PinName)
+	key := netPinKey(netID, pin)
 	
 	// Get pin number from device
 	pinNum := 0
@@ -223,60 +301,98 @@ func (ne *NetEditor) layoutPin(gtx layout.Context, th *material.Theme, netID int
 	})
 }
 
-func (ne *NetEditor) addNewNet(app *App) {
-	maxID := 0
+// ensureNameEditor creates the name field of a net, holding its name if the
+// user gave it one
+func (ne *NetEditor) ensureNameEditor(net *reveng.Net) {
+	if _, ok := ne.netNameEditor[net.ID]; ok {
+		return
+	}
+	ed := &widget.Editor{SingleLine: true, Submit: true}
+	if net.Renamed {
+		ed.SetText(net.Name)
+	}
+	ne.netNameEditor[net.ID] = ed
+}
+
+// editor returns the editor for the netlist on screen, starting a new
+// history when the netlist was replaced, e.g. by a new discovery run
+func (ne *NetEditor) editor(app *App) *reveng.Editor {
+	if ne.edit == nil || ne.edit.Netlist() != app.discoveredNetlist {
+		ne.edit = reveng.NewEditor(app.discoveredNetlist)
+	}
+	return ne.edit
+}
+
+// renameNet applies the name typed for a net; an empty name goes back to
+// the derived one
+func (ne *NetEditor) renameNet(netID int, name string, app *App) {
+	if err := ne.editor(app).Rename(netID, name); err != nil {
+		app.Logf("[REVENG] Rename failed: %v", err)
+		return
+	}
 	for _, net := range app.discoveredNetlist.Nets {
-		if net.ID > maxID {
-			maxID = net.ID
+		if net.ID == netID {
+			app.Logf("[REVENG] Net %d is now %s", netID, app.discoveredNetlist.NetName(net))
 		}
 	}
-	
-	newNet := &reveng.Net{
-		ID:   maxID + 1,
-		Pins: []bsr.PinRef{},
+}
+
+func (ne *NetEditor) addNewNet(app *App) {
+	if _, err := ne.editor(app).AddNet(); err != nil {
+		app.Logf("[REVENG] Add net failed: %v", err)
 	}
-	
-	app.discoveredNetlist.Nets = append(app.discoveredNetlist.Nets, newNet)
-	ne.netDeleteBtn[newNet.ID] = &widget.Clickable{}
-	ne.netAddPinBtn[newNet.ID] = &widget.Clickable{}
 }
 
 func (ne *NetEditor) deleteNet(netID int, app *App) {
-	filtered := make([]*reveng.Net, 0, len(app.discoveredNetlist.Nets))
-	for _, net := range app.discoveredNetlist.Nets {
-		if net.ID != netID {
-			filtered = append(filtered, net)
-		}
+	if err := ne.editor(app).DeleteNet(netID); err != nil {
+		app.Logf("[REVENG] Delete net failed: %v", err)
 	}
-	app.discoveredNetlist.Nets = filtered
 }
 
 func (ne *NetEditor) deletePinByKey(key string, app *App) {
-	var netID, chainIdx int
-	var pinName string
-	fmt.Sscanf(key, "%d:%d:%s", &netID, &chainIdx, &pinName)
-	
 	for _, net := range app.discoveredNetlist.Nets {
-		if net.ID == netID {
-			filtered := make([]bsr.PinRef, 0, len(net.Pins))
-			for _, pin := range net.Pins {
-				if !(pin.ChainIndex == chainIdx && pin.PinName == pinName) {
-					filtered = append(filtered, pin)
+		for _, pin := range net.Pins {
+			if netPinKey(net.ID, pin) == key {
+				if err := ne.editor(app).RemovePin(net.ID, pin); err != nil {
+					app.Logf("[REVENG] Remove pin failed: %v", err)
 				}
+				return
 			}
-			net.Pins = filtered
-			break
 		}
 	}
 }
 
+func (ne *NetEditor) undo(app *App) {
+	if err := ne.editor(app).Undo(); err != nil {
+		app.Logf("[REVENG] %v", err)
+		return
+	}
+	ne.resetNames()
+	app.buildRatsnest()
+}
+
+func (ne *NetEditor) redo(app *App) {
+	if err := ne.editor(app).Redo(); err != nil {
+		app.Logf("[REVENG] %v", err)
+		return
+	}
+	ne.resetNames()
+	app.buildRatsnest()
+}
+
+// resetNames drops the name fields so they pick up the names of the
+// restored nets
+func (ne *NetEditor) resetNames() {
+	ne.netNameEditor = make(map[int]*widget.Editor)
+}
+
 func (ne *NetEditor) openPinSelector(netID int, app *App) {
 	ne.pinSelectVisible = true
 	ne.pinSelectNetID = netID
 	ne.availablePins = ne.collectAvailablePins(app)
 	
 	for _, pin := range ne.availablePins {
-		key := fmt.Sprintf("%d:%s", pin.ChainIndex, pin.PinName)
+		key := pinSelectKey(pin)
 		if _, ok := ne.pinSelectBtns[key]; !ok {
 			ne.pinSelectBtns[key] = &widget.Clickable{}
 		}
@@ -293,8 +409,7 @@ func (ne *NetEditor) collectAvailablePins(app *App) []bsr.PinRef {
 	usedPins := make(map[string]bool)
 	for _, net := range app.discoveredNetlist.Nets {
 		for _, pin := range net.Pins {
-			key := fmt.Sprintf("%d:%s", pin.ChainIndex, pin.PinName)
-			usedPins[key] = true
+			usedPins[pinSelectKey(pin)] = true
 		}
 	}
 	
@@ -303,16 +418,16 @@ func (ne *NetEditor) collectAvailablePins(app *App) []bsr.PinRef {
 			continue
 		}
 		for _, pinName := range device.PinMapping.BSRIndexToPin {
-			key := fmt.Sprintf("%d:%s", devIdx, pinName)
-			if !usedPins[key] {
+			pin := bsr.PinRef{
+				ChainIndex: devIdx,
+				PinName:    pinName,
+				DeviceName: device.Name,
+			}
+			if !usedPins[pinSelectKey(pin)] {
 				// Only include pins that have valid pin numbers
 				pinNum := app.findPinNumber(&device, pinName)
 				if pinNum > 0 {
-					pins = append(pins, bsr.PinRef{
-						ChainIndex: devIdx,
-						PinName:    pinName,
-						DeviceName: device.Name,
-					})
+					pins = append(pins, pin)
 				}
 			}
 		}
@@ -363,7 +478,7 @@ func (ne *NetEditor) layoutPinSelector(gtx layout.Context, th *material.Theme, a
 							layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
 								return material.List(th, &ne.pinSelectList).Layout(gtx, len(ne.availablePins), func(gtx layout.Context, i int) layout.Dimensions {
 									pin := ne.availablePins[i]
-									key := fmt.Sprintf("%d:%s", pin.ChainIndex, pin.PinName)
+									key := pinSelectKey(pin)
 									
 									// Get pin number
 									pinNum := 0
@@ -396,23 +511,24 @@ func (ne *NetEditor) layoutPinSelector(gtx layout.Context, th *material.Theme, a
 	)
 }
 
-func (ne *NetEditor) addPinToNet(pinKey string, app *App) {
-	var chainIdx int
-	var pinName string
-	fmt.Sscanf(pinKey, "%d:%s", &chainIdx, &pinName)
-	
+func (ne *NetEditor) addPinToNet(key string, app *App) {
 	for _, pin := range ne.availablePins {
-		if pin.ChainIndex == chainIdx && pin.PinName == pinName {
-			for _, net := range app.discoveredNetlist.Nets {
-				if net.ID == ne.pinSelectNetID {
-					net.Pins = append(net.Pins, pin)
-					
-					key := fmt.Sprintf("%d:%d:%s", net.ID, pin.ChainIndex, pin.PinName)
-					ne.pinDeleteBtn[key] = &widget.Clickable{}
-					break
-				}
+		if pinSelectKey(pin) == key {
+			if err := ne.editor(app).AddPin(ne.pinSelectNetID, pin); err != nil {
+				app.Logf("[REVENG] Add pin failed: %v", err)
 			}
 			break
 		}
 	}
 }
+
+// pinSelectKey names a pin's widgets. It includes the chain, since the same
+// device index and pin name can appear on several chains.
+func pinSelectKey(pin bsr.PinRef) string {
+	return fmt.Sprintf("%d:%d:%s", pin.Chain, pin.ChainIndex, pin.PinName)
+}
+
+// netPinKey names the delete button of a pin within a net.
+func netPinKey(netID int, pin bsr.PinRef) string {
+	return fmt.Sprintf("%d:%s", netID, pinSelectKey(pin))
+}
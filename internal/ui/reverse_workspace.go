@@ -5,15 +5,20 @@ import (
 	"fmt"
 	"image/color"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"gioui.org/layout"
+	"gioui.org/x/explorer"
 	"gioui.org/unit"
 	"gioui.org/widget/material"
 	"github.com/OpenTraceLab/OpenTraceJTAG/internal/ui/components"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/chain"
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/kicad/schematic"
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/reveng"
 )
 
@@ -206,6 +211,11 @@ func (a *App) startReverseEngineering() {
 		return
 	}
 	a.chainDiscovered = ch
+	for _, dev := range ch.Devices() {
+		if !dev.HasBSDL() {
+			a.Logf("[REVENG] Device %d (0x%08X) has no BSDL; keeping it in BYPASS", dev.Position, dev.IDCode)
+		}
+	}
 
 	// Create BSR controller
 	ctl, err := bsr.NewController(a.chainDiscovered)
@@ -221,6 +231,9 @@ func (a *App) startReverseEngineering() {
 	cfg := reveng.DefaultConfig()
 	cfg.SkipKnownJTAGPins = true
 	cfg.SkipPowerPins = true
+	if config, err := LoadConfig(); err == nil {
+		cfg.Footprints = config.Footprints
+	}
 
 	// Create progress channel
 	progressCh := make(chan reveng.Progress, 10)
@@ -359,7 +372,7 @@ func (a *App) findPinNumber(device *ChainDevice, pinName string) int {
 		return 0
 	}
 	
-	pinMap := device.BSDLFile.Entity.GetPinMap()
+	pinMap := device.PinMap()
 	for name, pinStr := range pinMap {
 		if name == pinName {
 			fmt.Sscanf(pinStr, "%d", &pinNum)
@@ -466,7 +479,9 @@ func (a *App) exportNetlistKiCad() {
 	
 	a.Logf("[REVENG] Exporting netlist to %s...", filename)
 	
-	// Export to KiCad format
+	// Export to KiCad format, naming parts after the chain panel's
+	// component refs and footprints
+	a.applyChainComponents(a.discoveredNetlist)
 	kicadData, err := a.discoveredNetlist.ExportKiCad()
 	if err != nil {
 		a.Logf("[REVENG] Export failed: %v", err)
@@ -484,6 +499,123 @@ func (a *App) exportNetlistKiCad() {
 		filename, a.discoveredNetlist.NetCount(), a.discoveredNetlist.MultiPinNetCount())
 }
 
+// exportNetlistSchematic draws the discovered netlist as a KiCad schematic,
+// one symbol per chain device with pins named from its BSDL ports
+func (a *App) exportNetlistSchematic() {
+	if a.discoveredNetlist == nil {
+		a.Logf("[REVENG] No netlist to export")
+		return
+	}
+
+	timestamp := time.Now().Format("20060102_150405")
+	filename := fmt.Sprintf("netlist_%s.kicad_sch", timestamp)
+
+	a.Logf("[REVENG] Exporting schematic to %s...", filename)
+
+	a.applyChainComponents(a.discoveredNetlist)
+	components := make(map[int]reveng.Component)
+	for _, c := range a.discoveredNetlist.Components() {
+		components[c.ChainIndex] = c
+	}
+	parts := make([]reveng.SchematicPart, 0, len(a.chainDevices))
+	for i := range a.chainDevices {
+		device := &a.chainDevices[i]
+		var entity *bsdl.Entity
+		if device.BSDLFile != nil {
+			entity = device.BSDLFile.Entity
+		}
+		parts = append(parts, reveng.PartFromBSDL(components[i], entity, device.PinMap()))
+	}
+
+	sch, err := a.discoveredNetlist.ExportSchematic(parts)
+	if err != nil {
+		a.Logf("[REVENG] Export failed: %v", err)
+		return
+	}
+	if err := schematic.WriteFile(filename, sch); err != nil {
+		a.Logf("[REVENG] Failed to write file: %v", err)
+		return
+	}
+
+	a.Logf("[REVENG] ✓ Schematic exported to %s (%d symbols, %d labels)",
+		filename, len(sch.Symbols), len(sch.GlobalLabels))
+}
+
+// applyChainComponents records the component ref and KiCad footprint
+// assigned to each chain device, keeping the netlist's own values for unset
+// fields
+func (a *App) applyChainComponents(nl *reveng.Netlist) {
+	known := make(map[int]reveng.Component)
+	for _, c := range nl.Components() {
+		known[c.ChainIndex] = c
+	}
+	for i := range a.chainDevices {
+		device := &a.chainDevices[i]
+		c, ok := known[i]
+		if !ok {
+			c = reveng.Component{ChainIndex: i, Device: device.Name}
+		}
+		if device.ComponentRef != "" {
+			c.Ref = device.ComponentRef
+		}
+		// Package styles such as "QFP" are not KiCad footprints; only a
+		// Library:Footprint id is exported as one
+		if strings.Contains(device.FootprintType, ":") {
+			c.Footprint = device.FootprintType
+		}
+		nl.SetComponent(c)
+	}
+}
+
+// openNetlistFilePicker loads a saved JSON or KiCad netlist into the net
+// editor
+func (a *App) openNetlistFilePicker() {
+	go func() {
+		file, err := a.boardExplorer.ChooseFile("json", "net")
+		if err != nil {
+			if err != explorer.ErrUserDecline {
+				a.Logf("[ERROR] File picker failed: %v", err)
+			}
+			return
+		}
+		defer file.Close()
+
+		f, ok := file.(*os.File)
+		if !ok {
+			a.Logf("[ERROR] Unable to get file path from picker")
+			return
+		}
+		a.loadNetlistFile(f.Name())
+	}()
+}
+
+// loadNetlistFile reads a netlist written by ExportJSON or ExportKiCad
+func (a *App) loadNetlistFile(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		a.Logf("[REVENG] Failed to read netlist: %v", err)
+		return
+	}
+
+	var netlist *reveng.Netlist
+	if strings.EqualFold(filepath.Ext(path), ".net") {
+		netlist, err = reveng.ImportKiCad(data)
+	} else {
+		netlist, err = reveng.ImportJSON(data)
+	}
+	if err != nil {
+		a.Logf("[REVENG] Failed to import %s: %v", path, err)
+		return
+	}
+
+	a.discoveredNetlist = netlist
+	a.netEditor.Open(netlist)
+	a.buildRatsnest()
+	a.Logf("[REVENG] Imported %s: %d nets, %d multi-pin", 
+		path, netlist.NetCount(), netlist.MultiPinNetCount())
+	a.invalidate()
+}
+
 
 // layoutDeviceFootprint renders a single device footprint
 func (a *App) layoutDeviceFootprint(gtx layout.Context, deviceIndex int) layout.Dimensions {
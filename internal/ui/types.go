@@ -24,6 +24,7 @@ type ChainDevice struct {
 	BSDLPath       string
 	BSDLFile       *bsdl.BSDLFile
 	PinMapping     *bsdl.PinMapping
+	Package        string  // PIN_MAP package override ("" = PHYSICAL_PIN_MAP default)
 	FootprintType  string
 	PinCount       int     // Number of pins/balls
 	PackageWidth   float32 // Package width in mm (for TSOP/QFP/QFN)
@@ -67,7 +68,7 @@ func (d *ChainDevice) GetPinName(pinNumber int) string {
 	}
 	
 	// Get pin map from BSDL (signal name → pin number/coordinate)
-	pinMap := d.BSDLFile.Entity.GetPinMap()
+	pinMap := d.PinMap()
 	
 	// Reverse lookup: find signal name for this pin number
 	pinStr := fmt.Sprintf("%d", pinNumber)
@@ -80,6 +81,19 @@ func (d *ChainDevice) GetPinName(pinNumber int) string {
 	return ""
 }
 
+// PinMap returns the signal → pin mapping for the selected package variant.
+func (d *ChainDevice) PinMap() map[string]string {
+	if d.BSDLFile == nil || d.BSDLFile.Entity == nil {
+		return nil
+	}
+	if d.Package != "" {
+		if pinMap, err := d.BSDLFile.Entity.GetPinMapForPackage(d.Package); err == nil {
+			return pinMap
+		}
+	}
+	return d.BSDLFile.Entity.GetPinMap()
+}
+
 // SetPinState sets the state of a pin (thread-safe)
 func (d *ChainDevice) SetPinState(pinNumber int, state string) {
 	d.pinStatesMu.Lock()
@@ -33,6 +33,7 @@ type chainDeviceInfo struct {
 	IDCode   uint32
 	IRLength int
 	BRLength int
+	NoBSDL   bool // Placeholder held in BYPASS
 }
 
 // App hosts the Gio reverse-engineering window/workspace.
@@ -44,6 +45,7 @@ type App struct {
 
 	adapterTypes []string
 	adapterIndex int
+	probe        jtag.ProbeSelector
 
 	deviceCount widget.Editor
 	bsdlPath    widget.Editor
@@ -79,6 +81,12 @@ type App struct {
 	scanRunning bool
 }
 
+// SetProbe chooses which CMSIS-DAP probe discovery opens when several are
+// connected.
+func (a *App) SetProbe(sel jtag.ProbeSelector) {
+	a.probe = sel
+}
+
 // NewApp builds a ready-to-run reverse engineering window.
 func NewApp() *App {
 	return NewAppWithWindow(new(app.Window))
@@ -202,9 +210,13 @@ func (a *App) layoutRightPanel(gtx layout.Context) layout.Dimensions {
 									return layout.Dimensions{}
 								}
 								dev := a.discovered[idx]
+								title := fmt.Sprintf("[%d] %s", dev.Position, dev.Name)
+								if dev.NoBSDL {
+									title += " (no BSDL)"
+								}
 								return layout.UniformInset(unit.Dp(3)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
 									return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
-										layout.Rigid(material.Body1(a.theme, fmt.Sprintf("[%d] %s", dev.Position, dev.Name)).Layout),
+										layout.Rigid(material.Body1(a.theme, title).Layout),
 										layout.Rigid(material.Caption(a.theme, fmt.Sprintf("IDCODE: 0x%08X", dev.IDCode)).Layout),
 										layout.Rigid(material.Caption(a.theme, fmt.Sprintf("IR: %d bits, BR: %d bits", dev.IRLength, dev.BRLength)).Layout),
 									)
@@ -351,7 +363,7 @@ func (a *App) discoverChain() {
 	case "simulator":
 		a.adapter = jtag.NewSimAdapter(jtag.AdapterInfo{Name: "Simulator"})
 	case "cmsisdap":
-		adapter, err := jtag.NewCMSISDAPAdapter(0, 0)
+		adapter, err := jtag.OpenCMSISDAPAdapter(a.probe)
 		if err != nil {
 			a.status = fmt.Sprintf("Adapter error: %v", err)
 			a.invalidate()
@@ -384,6 +396,7 @@ func (a *App) discoverChain() {
 			IDCode:   dev.IDCode,
 			IRLength: dev.Info.InstructionLength,
 			BRLength: dev.Info.BoundaryLength,
+			NoBSDL:   !dev.HasBSDL(),
 		}
 	}
 	a.chainInfo = fmt.Sprintf("Found %d device(s)", len(devs))
@@ -455,12 +468,8 @@ func (a *App) runScan(ctx context.Context, cfg *reveng.Config, progressCh chan<-
 
 	start := time.Now()
 	netlist, err := reveng.DiscoverNetlist(ctx, a.bsrCtrl, cfg, progressCh)
-	if err != nil {
-		if err == context.Canceled {
-			a.status = "Scan cancelled"
-		} else {
-			a.status = fmt.Sprintf("Scan failed: %v", err)
-		}
+	if err != nil && netlist == nil {
+		a.status = fmt.Sprintf("Scan failed: %v", err)
 		a.scanRunning = false
 		a.invalidate()
 		return
@@ -473,11 +482,18 @@ func (a *App) runScan(ctx context.Context, cfg *reveng.Config, progressCh chan<-
 		if len(net.Pins) < 2 {
 			continue
 		}
-		summary := fmt.Sprintf("Net %d (%d pins)", net.ID, len(net.Pins))
+		summary := fmt.Sprintf("Net %d %s (%d pins)", net.ID, netlist.NetName(net), len(net.Pins))
 		a.netLines = append(a.netLines, summary)
 	}
 	a.scanRunning = false
-	a.status = "Scan complete"
+	switch {
+	case err == context.Canceled:
+		a.status = "Scan cancelled (partial netlist)"
+	case err != nil:
+		a.status = fmt.Sprintf("Scan failed: %v (partial netlist)", err)
+	default:
+		a.status = "Scan complete"
+	}
 	a.invalidate()
 }
 
@@ -516,7 +532,7 @@ func (a *App) exportKiCad() {
 	if a.netlist == nil {
 		return
 	}
-	path := filepath.Join(os.TempDir(), "netlist.kicad")
+	path := filepath.Join(os.TempDir(), "netlist.net")
 	data, err := a.netlist.ExportKiCad()
 	if err != nil {
 		a.status = fmt.Sprintf("Export failed: %v", err)
@@ -1,6 +1,8 @@
 package bsdl
 
 import (
+	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -214,44 +216,187 @@ func (e *Entity) GetTAPConfig() *TAPConfig {
 	return config
 }
 
-// GetPinMap extracts the physical pin mapping from PIN_MAP_STRING constant
-// Returns a map of signal name to pin number
+// GetPinMap returns the signal -> pin mapping for the package selected by the
+// PHYSICAL_PIN_MAP generic's default value. If the generic is missing or names
+// an unknown package, a single PIN_MAP_STRING constant is used as-is and
+// multiple constants are merged as a last resort.
 func (e *Entity) GetPinMap() map[string]string {
-	pinMap := make(map[string]string)
+	maps := e.GetPinMaps()
+	if pinMap, ok := lookupPackage(maps, e.DefaultPackage()); ok {
+		return pinMap
+	}
+	if len(maps) == 1 {
+		for _, pinMap := range maps {
+			return pinMap
+		}
+	}
 
-	attrs := e.GetAttributes()
-	for _, attr := range attrs {
-		if attr.Constant == nil {
+	merged := make(map[string]string)
+	for _, name := range sortedPackageNames(maps) {
+		for signal, pin := range maps[name] {
+			merged[signal] = pin
+		}
+	}
+	return merged
+}
+
+// GetPinMapForPackage returns the signal -> pin mapping of the named package
+// (case-insensitive).
+func (e *Entity) GetPinMapForPackage(name string) (map[string]string, error) {
+	maps := e.GetPinMaps()
+	if pinMap, ok := lookupPackage(maps, name); ok {
+		return pinMap, nil
+	}
+	return nil, fmt.Errorf("bsdl: package %q not found (available: %s)",
+		name, strings.Join(sortedPackageNames(maps), ", "))
+}
+
+// GetPinMaps returns every PIN_MAP_STRING constant keyed by package name.
+func (e *Entity) GetPinMaps() map[string]map[string]string {
+	maps := make(map[string]map[string]string)
+	vectors := e.vectorIndices()
+
+	for _, attr := range e.GetAttributes() {
+		if attr.Constant == nil || attr.Constant.Value == nil {
 			continue
 		}
+		if !strings.EqualFold(attr.Constant.Type, "PIN_MAP_STRING") {
+			continue
+		}
+		maps[attr.Constant.Name] = parsePinMapString(attr.Constant.Value.GetConcatenatedString(), vectors)
+	}
 
-		// Look for PIN_MAP_STRING constants
-		if attr.Constant.Type == "PIN_MAP_STRING" {
-			// Parse the concatenated string
-			str := attr.Constant.Value.GetConcatenatedString()
-
-			// Format: "SIGNAL_NAME : PIN_NUMBER ,"
-			lines := strings.Split(str, ",")
-			for _, line := range lines {
-				line = strings.TrimSpace(line)
-				if line == "" {
-					continue
-				}
+	return maps
+}
+
+// PackageNames lists the packages defined by PIN_MAP_STRING constants, sorted.
+func (e *Entity) PackageNames() []string {
+	return sortedPackageNames(e.GetPinMaps())
+}
+
+// DefaultPackage returns the default value of the PHYSICAL_PIN_MAP generic,
+// or "" when the entity does not declare one.
+func (e *Entity) DefaultPackage() string {
+	if e.Generic == nil {
+		return ""
+	}
+	for _, gen := range e.Generic.Generics {
+		if strings.EqualFold(gen.Name, "PHYSICAL_PIN_MAP") && gen.DefaultValue != nil {
+			return strings.TrimSpace(gen.DefaultValue.GetValue())
+		}
+	}
+	return ""
+}
 
-				// Split by colon
-				parts := strings.Split(line, ":")
-				if len(parts) == 2 {
-					signal := strings.TrimSpace(parts[0])
-					pin := strings.TrimSpace(parts[1])
-					pinMap[signal] = pin
+// parsePinMapString parses "SIGNAL : PIN, SIGNAL : (PIN, PIN), ..." entries.
+// A pin list belongs to a bit_vector port and names its pins in the order of
+// the port's declared range, so each pin is keyed SIGNAL(i) like the port's
+// boundary cells; vectors holds those indices by upper-case port name. A list
+// for a port not declared as a vector keeps only its first pin, under SIGNAL.
+func parsePinMapString(str string, vectors map[string][]int) map[string]string {
+	pinMap := make(map[string]string)
+
+	for _, entry := range splitTopLevel(str) {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		signal := strings.TrimSpace(parts[0])
+		if signal == "" {
+			continue
+		}
+		pins := strings.Split(strings.Trim(strings.TrimSpace(parts[1]), "()"), ",")
+		if indices, ok := vectors[strings.ToUpper(signal)]; ok {
+			for i, pin := range pins {
+				if pin = strings.TrimSpace(pin); pin != "" && i < len(indices) {
+					pinMap[fmt.Sprintf("%s(%d)", signal, indices[i])] = pin
 				}
 			}
+			continue
+		}
+		if pin := strings.TrimSpace(pins[0]); pin != "" {
+			pinMap[signal] = pin
 		}
 	}
 
 	return pinMap
 }
 
+// vectorIndices returns the element indices of each bit_vector port in
+// declaration order, keyed by upper-case port name: (1 to 3) gives 1, 2, 3
+// and (3 downto 0) gives 3, 2, 1, 0.
+func (e *Entity) vectorIndices() map[string][]int {
+	vectors := make(map[string][]int)
+	if e.Port == nil {
+		return vectors
+	}
+	for _, port := range e.Port.Ports {
+		if port.Type == nil || port.Type.Range == nil {
+			continue
+		}
+		r := port.Type.Range
+		step := 1
+		if r.Start > r.End {
+			step = -1
+		}
+		var indices []int
+		for i := r.Start; ; i += step {
+			indices = append(indices, i)
+			if i == r.End {
+				break
+			}
+		}
+		vectors[strings.ToUpper(port.Name)] = indices
+	}
+	return vectors
+}
+
+// splitTopLevel splits on commas that are not inside parentheses.
+func splitTopLevel(s string) []string {
+	var out []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				if part := strings.TrimSpace(s[start:i]); part != "" {
+					out = append(out, part)
+				}
+				start = i + 1
+			}
+		}
+	}
+	if part := strings.TrimSpace(s[start:]); part != "" {
+		out = append(out, part)
+	}
+	return out
+}
+
+func lookupPackage(maps map[string]map[string]string, name string) (map[string]string, bool) {
+	if name == "" {
+		return nil, false
+	}
+	for pkg, pinMap := range maps {
+		if strings.EqualFold(pkg, name) {
+			return pinMap, true
+		}
+	}
+	return nil, false
+}
+
+func sortedPackageNames(maps map[string]map[string]string) []string {
+	names := make([]string, 0, len(maps))
+	for name := range maps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // OpcodeToUint converts a binary opcode string to uint
 func OpcodeToUint(opcode string) (uint, error) {
 	val, err := strconv.ParseUint(opcode, 2, 32)
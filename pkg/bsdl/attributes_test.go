@@ -516,3 +516,55 @@ func TestAllFilesDeviceInfo(t *testing.T) {
 		})
 	}
 }
+
+const vectorPinMapBSDL = `
+entity VEC is
+	generic (PHYSICAL_PIN_MAP : string := "BGA");
+	port (
+		D   : inout bit_vector(1 to 3);
+		A   : in bit_vector(1 downto 0);
+		CLK : in bit;
+		VCC : linkage bit_vector(0 to 1)
+	);
+	attribute PIN_MAP of VEC : entity is PHYSICAL_PIN_MAP;
+	constant BGA : PIN_MAP_STRING :=
+		"D : (A1, A2, A3)," &
+		"A : (B1, B2)," &
+		"CLK : C1," &
+		"VCC : (C2, C3)";
+end VEC;
+`
+
+// TestGetPinMapVectors tests that every element of a bit_vector port gets
+// its own pin, in the order of the port's declared range.
+func TestGetPinMapVectors(t *testing.T) {
+	parser, err := NewParser()
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+
+	file, err := parser.ParseString(vectorPinMapBSDL)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	pinMap := file.Entity.GetPinMap()
+	want := map[string]string{
+		"D(1)":   "A1",
+		"D(2)":   "A2",
+		"D(3)":   "A3",
+		"A(1)":   "B1",
+		"A(0)":   "B2",
+		"CLK":    "C1",
+		"VCC(0)": "C2",
+		"VCC(1)": "C3",
+	}
+	for signal, pin := range want {
+		if got := pinMap[signal]; got != pin {
+			t.Errorf("pin of %s = %q, want %q", signal, got, pin)
+		}
+	}
+	if len(pinMap) != len(want) {
+		t.Errorf("pin map has %d entries, want %d: %v", len(pinMap), len(want), pinMap)
+	}
+}
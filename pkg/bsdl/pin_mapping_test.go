@@ -42,3 +42,59 @@ func TestPinMappingReturnsInputCell(t *testing.T) {
 		}
 	}
 }
+
+const multiPackageBSDL = `
+entity MULTI is
+	generic (PHYSICAL_PIN_MAP : string := "PKG_B");
+	attribute PIN_MAP of MULTI : entity is PHYSICAL_PIN_MAP;
+	constant PKG_A : PIN_MAP_STRING :=
+		"IO0 : 1," &
+		"VCC : (2, 3)," &
+		"IO1 : 4";
+	constant PKG_B : PIN_MAP_STRING :=
+		"IO0 : A7," &
+		"VCC : (B1, B2)," &
+		"IO1 : C3";
+end MULTI;
+`
+
+func TestGetPinMapSelectsPackage(t *testing.T) {
+	parser, err := NewParser()
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+
+	file, err := parser.ParseString(multiPackageBSDL)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	entity := file.Entity
+
+	if got := entity.DefaultPackage(); got != "PKG_B" {
+		t.Fatalf("DefaultPackage = %q, want PKG_B", got)
+	}
+	if names := entity.PackageNames(); len(names) != 2 || names[0] != "PKG_A" || names[1] != "PKG_B" {
+		t.Fatalf("PackageNames = %v", names)
+	}
+
+	// The default package must win instead of a merge of both constants
+	pinMap := entity.GetPinMap()
+	if pinMap["IO0"] != "A7" || pinMap["IO1"] != "C3" {
+		t.Errorf("GetPinMap used wrong package: %v", pinMap)
+	}
+	if pinMap["VCC"] != "B1" {
+		t.Errorf("multi-pin signal should map to first pin, got %q", pinMap["VCC"])
+	}
+
+	pkgA, err := entity.GetPinMapForPackage("pkg_a")
+	if err != nil {
+		t.Fatalf("GetPinMapForPackage failed: %v", err)
+	}
+	if pkgA["IO0"] != "1" || pkgA["IO1"] != "4" {
+		t.Errorf("PKG_A pin map wrong: %v", pkgA)
+	}
+
+	if _, err := entity.GetPinMapForPackage("BGA"); err == nil {
+		t.Errorf("expected error for unknown package")
+	}
+}
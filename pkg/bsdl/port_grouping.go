@@ -0,0 +1,82 @@
+package bsdl
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Differential group types defined by IEEE 1149.1 for the PORT_GROUPING attribute.
+const (
+	DifferentialVoltage = "DIFFERENTIAL_VOLTAGE"
+	DifferentialCurrent = "DIFFERENTIAL_CURRENT"
+)
+
+// DifferentialPair is a twin group from the PORT_GROUPING attribute. The
+// representative (positive) port carries the logical signal value; the
+// associated (negative) port carries its complement.
+type DifferentialPair struct {
+	Kind     string // DifferentialVoltage or DifferentialCurrent
+	Positive string // Representative port name, e.g., "PB11A"
+	Negative string // Associated port name, e.g., "PB11B"
+}
+
+var (
+	portGroupTypeRegexp = regexp.MustCompile(`(?i)(DIFFERENTIAL_VOLTAGE|DIFFERENTIAL_CURRENT)\s*\(`)
+	twinGroupRegexp     = regexp.MustCompile(`\(\s*([^,()\s]+)\s*,\s*([^,()\s]+)\s*\)`)
+)
+
+// GetDifferentialPairs parses the PORT_GROUPING attribute and returns all
+// differential twin groups. A device without PORT_GROUPING yields no pairs
+// and no error.
+func (e *Entity) GetDifferentialPairs() ([]DifferentialPair, error) {
+	attr := e.getAttributeSpec("PORT_GROUPING")
+	if attr == nil || attr.Is == nil {
+		return nil, nil
+	}
+
+	raw := attr.Is.GetConcatenatedString()
+	locs := portGroupTypeRegexp.FindAllStringSubmatchIndex(raw, -1)
+	if len(locs) == 0 {
+		return nil, fmt.Errorf("bsdl: PORT_GROUPING parse failure")
+	}
+
+	var pairs []DifferentialPair
+	for _, loc := range locs {
+		kind := strings.ToUpper(raw[loc[2]:loc[3]])
+
+		// loc[1] points just past the opening parenthesis of the group list.
+		body, ok := balancedBody(raw[loc[1]:])
+		if !ok {
+			return nil, fmt.Errorf("bsdl: unbalanced %s group in PORT_GROUPING", kind)
+		}
+
+		for _, m := range twinGroupRegexp.FindAllStringSubmatch(body, -1) {
+			pairs = append(pairs, DifferentialPair{
+				Kind:     kind,
+				Positive: m[1],
+				Negative: m[2],
+			})
+		}
+	}
+
+	return pairs, nil
+}
+
+// balancedBody returns the text up to the parenthesis that closes an already
+// opened group.
+func balancedBody(s string) (string, bool) {
+	depth := 1
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return s[:i], true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,62 @@
+package bsdl
+
+import "testing"
+
+func TestGetDifferentialPairs(t *testing.T) {
+	input := `
+	entity TEST_CHIP is
+		attribute PORT_GROUPING of TEST_CHIP : entity is
+			"DIFFERENTIAL_VOLTAGE ((LVDS_P, LVDS_N), (CLK_P, CLK_N))," &
+			"DIFFERENTIAL_CURRENT ( (PB11A, PB11B) )";
+	end TEST_CHIP;
+	`
+
+	parser, err := NewParser()
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+
+	bsdl, err := parser.ParseString(input)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	pairs, err := bsdl.Entity.GetDifferentialPairs()
+	if err != nil {
+		t.Fatalf("GetDifferentialPairs returned error: %v", err)
+	}
+
+	expected := []DifferentialPair{
+		{Kind: DifferentialVoltage, Positive: "LVDS_P", Negative: "LVDS_N"},
+		{Kind: DifferentialVoltage, Positive: "CLK_P", Negative: "CLK_N"},
+		{Kind: DifferentialCurrent, Positive: "PB11A", Negative: "PB11B"},
+	}
+	if len(pairs) != len(expected) {
+		t.Fatalf("Expected %d pairs, got %d: %+v", len(expected), len(pairs), pairs)
+	}
+	for i, want := range expected {
+		if pairs[i] != want {
+			t.Errorf("Pair %d: expected %+v, got %+v", i, want, pairs[i])
+		}
+	}
+}
+
+func TestGetDifferentialPairsMissing(t *testing.T) {
+	parser, err := NewParser()
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+
+	bsdl, err := parser.ParseFile("../../testdata/STM32F303_F334_LQFP64.bsd")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	pairs, err := bsdl.Entity.GetDifferentialPairs()
+	if err != nil {
+		t.Fatalf("Expected no error without PORT_GROUPING, got %v", err)
+	}
+	if len(pairs) != 0 {
+		t.Errorf("Expected no pairs, got %d", len(pairs))
+	}
+}
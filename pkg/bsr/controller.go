@@ -11,12 +11,23 @@ import (
 // the translation between pin operations and low-level DR shifts.
 type Controller struct {
 	chain   *chain.Chain
+	chainID int // Chain number in a Session, see PinRef.Chain
 	Devices []*DeviceRuntime
 	Layout  *DRLayout
 
 	// Cached DR state to minimize USB traffic.
-	// This is updated on each SetAllPinsHiZ or DrivePin operation.
+	// This is updated on each SetAllPinsHiZ, Apply or Preload operation.
 	currentDR []bool
+
+	// Pin changes staged by SetPin/ReleasePin for the next Apply.
+	// A nil value floats the pin.
+	pending map[*PinState]*bool
+
+	// Optional debug sink, see SetLogger
+	logger func(format string, args ...any)
+
+	// Board-specific restrictions, see SetGuard
+	guard *guardState
 }
 
 // NewController builds a boundary-scan runtime controller from a discovered chain.
@@ -44,16 +55,42 @@ func NewController(ch *chain.Chain) (*Controller, error) {
 	// Build global DR layout
 	layout := buildDRLayout(devices)
 
+	// Start from the BSDL safe values with every output disabled, so the
+	// first scan never enables drivers with whatever an all-zero vector holds
+	var safeDR []bool
+	for devIdx := len(devices) - 1; devIdx >= 0; devIdx-- {
+		segment, err := setAllPinsHiZ(devices[devIdx])
+		if err != nil {
+			return nil, fmt.Errorf("bsr: failed to build safe state for device %s: %w", devices[devIdx].ChainDev.Name(), err)
+		}
+		safeDR = append(safeDR, segment...)
+	}
+
 	return &Controller{
 		chain:     ch,
 		Devices:   devices,
 		Layout:    layout,
-		currentDR: make([]bool, layout.TotalBits), // Start with all zeros
+		currentDR: safeDR,
 	}, nil
 }
 
 // newDeviceRuntime creates a DeviceRuntime from a chain.Device.
 func newDeviceRuntime(dev *chain.Device) (*DeviceRuntime, error) {
+	// Without BSDL the device has no pins to offer and stays in BYPASS
+	if !dev.HasBSDL() {
+		bypassOpcode, err := dev.BypassOpcode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get BYPASS opcode: %w", err)
+		}
+		return &DeviceRuntime{
+			ChainDev:     dev,
+			Pins:         map[string]*PinState{},
+			pairs:        map[string]*DiffPair{},
+			instruction:  InstrBypass,
+			bypassOpcode: bypassOpcode,
+		}, nil
+	}
+
 	// Get boundary length
 	cells, err := dev.BoundaryCells()
 	if err != nil {
@@ -90,9 +127,19 @@ func newDeviceRuntime(dev *chain.Device) (*DeviceRuntime, error) {
 		return nil, fmt.Errorf("failed to get IO pins: %w", err)
 	}
 
-	// Initialize PinState for each IO pin
+	pairs, err := buildDiffPairs(dev, ioPins)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get differential pairs: %w", err)
+	}
+
+	// Initialize PinState for each IO pin. A differential pair becomes a
+	// single entry under its positive leg.
 	pins := make(map[string]*PinState)
 	for _, pinName := range ioPins {
+		pair := pairs[pinName]
+		if pair != nil && pair.Negative == pinName {
+			continue
+		}
 		pins[pinName] = &PinState{
 			Ref: PinRef{
 				ChainIndex: dev.Position,
@@ -102,18 +149,32 @@ func newDeviceRuntime(dev *chain.Device) (*DeviceRuntime, error) {
 			Mode:      PinHiZ,
 			DrivenVal: nil,
 			LastRead:  nil,
+			Pair:      pair,
 		}
 	}
 
 	return &DeviceRuntime{
 		ChainDev:       dev,
 		Pins:           pins,
+		pairs:          pairs,
 		boundaryLength: boundaryLength,
 		extestOpcode:   extestOpcode,
 		bypassOpcode:   bypassOpcode,
 	}, nil
 }
 
+// SetLogger installs a function that receives a line for every pin change
+// the controller shifts out. Pass nil to silence it again.
+func (c *Controller) SetLogger(logf func(format string, args ...any)) {
+	c.logger = logf
+}
+
+func (c *Controller) logf(format string, args ...any) {
+	if c.logger != nil {
+		c.logger(format, args...)
+	}
+}
+
 // GetPinState returns the current runtime state for a specific pin.
 // Returns nil if the pin is not found.
 func (c *Controller) GetPinState(ref PinRef) *PinState {
@@ -122,7 +183,45 @@ func (c *Controller) GetPinState(ref PinRef) *PinState {
 	}
 
 	dev := c.Devices[ref.ChainIndex]
-	return dev.Pins[ref.PinName]
+	name, _ := dev.resolvePin(ref.PinName, false)
+	return dev.Pins[name]
+}
+
+// CanDrive reports whether the pin has an output cell, so DrivePin and
+// SetPin accept it. It does not consult the guard; see CheckDrive.
+func (c *Controller) CanDrive(ref PinRef) bool {
+	if ref.ChainIndex < 0 || ref.ChainIndex >= len(c.Devices) {
+		return false
+	}
+	dev := c.Devices[ref.ChainIndex]
+	name, _ := dev.resolvePin(ref.PinName, false)
+	if _, ok := dev.Pins[name]; !ok {
+		return false
+	}
+	return hasOutputCell(dev.ChainDev, name)
+}
+
+// CanRead reports whether the pin has an input cell, so CaptureAll and
+// Sample report its level.
+func (c *Controller) CanRead(ref PinRef) bool {
+	if ref.ChainIndex < 0 || ref.ChainIndex >= len(c.Devices) {
+		return false
+	}
+	dev := c.Devices[ref.ChainIndex]
+	name, _ := dev.resolvePin(ref.PinName, false)
+	if _, ok := dev.Pins[name]; !ok {
+		return false
+	}
+	return hasCell(dev.ChainDev, name, "INPUT")
+}
+
+// DiffPair returns the differential pair that either leg of ref belongs to,
+// or nil for single-ended pins.
+func (c *Controller) DiffPair(ref PinRef) *DiffPair {
+	if ref.ChainIndex < 0 || ref.ChainIndex >= len(c.Devices) {
+		return nil
+	}
+	return c.Devices[ref.ChainIndex].pairs[ref.PinName]
 }
 
 // AllPins returns a list of all pin references in the chain.
@@ -136,6 +235,22 @@ func (c *Controller) AllPins() []PinRef {
 	return pins
 }
 
+// ChainID returns the chain number the controller's pins carry in
+// PinRef.Chain: its position in the Session it belongs to, or 0.
+func (c *Controller) ChainID() int {
+	return c.chainID
+}
+
+// setChainID numbers the controller's chain within a Session.
+func (c *Controller) setChainID(id int) {
+	c.chainID = id
+	for _, dev := range c.Devices {
+		for _, ps := range dev.Pins {
+			ps.Ref.Chain = id
+		}
+	}
+}
+
 // Chain returns the underlying chain.Chain for access to transport operations.
 func (c *Controller) Chain() *chain.Chain {
 	return c.chain
@@ -0,0 +1,140 @@
+package bsr
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/chain"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
+)
+
+// createDiffPairBSDL builds a device with one LVDS pair and one single-ended pin.
+func createDiffPairBSDL(name string, id uint32) string {
+	return fmt.Sprintf(`
+entity %s is
+	attribute INSTRUCTION_LENGTH of %s : entity is 5;
+	attribute BOUNDARY_LENGTH of %s : entity is 9;
+	attribute INSTRUCTION_OPCODE of %s : entity is
+		"BYPASS (11111)," &
+		"EXTEST (00000)," &
+		"SAMPLE (10101)";
+	attribute IDCODE_REGISTER of %s : entity is "%s";
+	attribute PORT_GROUPING of %s : entity is
+		"DIFFERENTIAL_VOLTAGE ((LVDS_P, LVDS_N))";
+	attribute BOUNDARY_REGISTER of %s : entity is
+		"8 (BC_1, *, CONTROL, 1)," &
+		"7 (BC_1, LVDS_P, OUTPUT3, X, 8, 1, Z)," &
+		"6 (BC_1, LVDS_P, INPUT, X)," &
+		"5 (BC_1, *, CONTROL, 1)," &
+		"4 (BC_1, LVDS_N, OUTPUT3, X, 5, 1, Z)," &
+		"3 (BC_1, LVDS_N, INPUT, X)," &
+		"2 (BC_1, *, CONTROL, 1)," &
+		"1 (BC_1, PB0, OUTPUT3, X, 2, 1, Z)," &
+		"0 (BC_1, PB0, INPUT, X)";
+end %s;
+`, name, name, name, name, name, idToBinary(id), name, name, name)
+}
+
+func TestDiffPairDriveAndCapture(t *testing.T) {
+	parser, err := bsdl.NewParser()
+	if err != nil {
+		t.Fatalf("parser init failed: %v", err)
+	}
+
+	repo := chain.NewMemoryRepository()
+	id := uint32(0x12345678)
+	file, err := parser.ParseString(createDiffPairBSDL("DEV0", id))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if _, _, err := repo.AddFile(file); err != nil {
+		t.Fatalf("AddFile failed: %v", err)
+	}
+
+	sim := jtag.NewSimAdapter(jtag.AdapterInfo{Name: "sim"})
+	var lastDR []bool
+	idBytes := encodeIDCodes([]uint32{id})
+	sim.OnShift = func(region jtag.ShiftRegion, tms, tdi []byte, bits int) ([]byte, error) {
+		if region == jtag.ShiftRegionDR {
+			if bits == 32 {
+				return append([]byte(nil), idBytes...), nil
+			}
+			if bits == 9 {
+				lastDR = bytesToBools(tdi, bits)
+				// Loop the driven vector back so captures see the pad levels
+				return append([]byte(nil), tdi...), nil
+			}
+		}
+		return make([]byte, (bits+7)/8), nil
+	}
+
+	ch, err := chain.NewController(sim, repo).Discover(1)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	bsrCtl, err := NewController(ch)
+	if err != nil {
+		t.Fatalf("NewController failed: %v", err)
+	}
+
+	dev := bsrCtl.Devices[0]
+	if len(dev.Pins) != 2 {
+		t.Fatalf("expected pair folded into 2 logical pins, got %d", len(dev.Pins))
+	}
+	if _, ok := dev.Pins["LVDS_N"]; ok {
+		t.Fatalf("negative leg should not be a separate pin")
+	}
+	ps := dev.Pins["LVDS_P"]
+	if ps == nil || ps.Pair == nil {
+		t.Fatalf("LVDS_P should carry differential pair info")
+	}
+	if ps.Pair.Negative != "LVDS_N" || ps.Pair.Kind != bsdl.DifferentialVoltage {
+		t.Errorf("unexpected pair %+v", ps.Pair)
+	}
+
+	negRef := PinRef{ChainIndex: 0, DeviceName: "DEV0", PinName: "LVDS_N"}
+	if bsrCtl.DiffPair(negRef) != ps.Pair {
+		t.Errorf("DiffPair should resolve the negative leg to the same pair")
+	}
+	if bsrCtl.GetPinState(negRef) != ps {
+		t.Errorf("GetPinState should resolve the negative leg to the pair state")
+	}
+
+	if err := bsrCtl.EnterExtest(); err != nil {
+		t.Fatalf("EnterExtest failed: %v", err)
+	}
+
+	// Driving the negative leg high means the logical (positive) signal is low
+	if err := bsrCtl.DrivePin(negRef, true); err != nil {
+		t.Fatalf("DrivePin failed: %v", err)
+	}
+	if lastDR[7] {
+		t.Errorf("positive leg output should be low")
+	}
+	if !lastDR[4] {
+		t.Errorf("negative leg output should be high")
+	}
+	if lastDR[8] || lastDR[5] {
+		t.Errorf("both legs should be enabled (control cells 0)")
+	}
+	if !lastDR[2] {
+		t.Errorf("single-ended pin should stay disabled")
+	}
+	if ps.Mode != PinOutput || ps.DrivenVal == nil || *ps.DrivenVal {
+		t.Errorf("pair state should be driven low, got mode %v", ps.Mode)
+	}
+
+	values, err := bsrCtl.CaptureAll()
+	if err != nil {
+		t.Fatalf("CaptureAll failed: %v", err)
+	}
+	for ref := range values {
+		if ref.PinName == "LVDS_N" {
+			t.Errorf("negative leg should not be reported by CaptureAll")
+		}
+	}
+	if _, ok := values[PinRef{ChainIndex: 0, DeviceName: "DEV0", PinName: "LVDS_P"}]; !ok {
+		t.Errorf("pair should be reported under the positive leg")
+	}
+}
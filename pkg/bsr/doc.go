@@ -11,7 +11,10 @@
 // The BSR package provides:
 //   - PinRef: A unique identifier for physical board pins
 //   - Controller: Manages boundary-scan operations on a JTAG chain
+//   - Session: Drives and captures across several chains, each on its own adapter
 //   - Operations: EnterExtest, SetAllPinsHiZ, DrivePin, CaptureAll
+//   - Staged updates: SetPin, ReleasePin and Apply for many pins in one scan
+//   - Non-intrusive access: Sample, Preload, and per-device instructions
 //
 // # Usage
 //
@@ -67,13 +70,67 @@
 //
 // The Controller caches the current DR state to minimize USB traffic. Operations
 // like DrivePin only modify the necessary bits and reuse the cached vector.
+// SetPin and ReleasePin stage changes on any number of pins across devices
+// and Apply shifts them together, so a chip-select and its data lines change
+// in the same Update-DR:
+//
+//	bsrCtl.SetPin(csRef, false)
+//	bsrCtl.SetPin(dataRef, true)
+//	err = bsrCtl.Apply()
+//
+// Pins keep driving until released or until SetAllPinsHiZ; CaptureAll only
+// samples and never applies staged changes. SetLogger reports every pin
+// change shifted out, for debugging.
+//
+// Apply, SetAllPinsHiZ and Preload do not wait for their TDO. On a queuing
+// adapter such as CMSIS-DAP they go out together with the next CaptureAll
+// or Sample, or with Flush, which also reports any error they hit. DrivePin
+// and DrivePins flush before returning.
+//
 // For bulk operations, consider using the underlying chain.Batch API if the
 // pin-centric abstraction is not needed.
 //
+// # Differential Pairs
+//
+// Twin groups from the BSDL PORT_GROUPING attribute (DIFFERENTIAL_VOLTAGE and
+// DIFFERENTIAL_CURRENT) are treated as one logical signal named after the
+// positive leg. DrivePin drives the negative leg to the complement, CaptureAll
+// reports the pair once, and the negative leg does not appear in Pins.
+//
+// # Instructions
+//
+// Every device tracks the instruction held in its IR, and SetInstructions
+// programs several devices at once, so one device can be sampled while
+// another is clamped. Sample monitors the pins of a running device and
+// Preload fills the update latches before EnterExtest so outputs come up at
+// known levels. Clamp, HighZ and Intest act on a single device and fail if
+// its BSDL lacks the instruction.
+//
+// CLAMP, HIGHZ and BYPASS select the 1-bit BYPASS register. DR scans shift a
+// single bit for such devices; Layout and the cached DR vector still cover
+// every boundary register.
+//
+// # Safety
+//
+// The controller starts from the BSDL safe values with every output
+// disabled, and any pin not explicitly driven returns to that state. A Guard
+// (usually loaded per board with LoadGuard) adds a do-not-drive list, pins
+// forced to a fixed level such as a regulator enable, and nets known to be
+// connected. Drives that break these rules fail with ErrUnsafe before any
+// bits are shifted. Session.SetGuard spreads one Guard over several chains.
+//
+// # Monitoring
+//
+// Monitor polls the chain with Sample (or CaptureAll in the current
+// instruction) and publishes timestamped PinEvents for every pin that
+// changed since the previous scan, to Subscribe channels and as the return
+// value of Poll. CSVWriter and VCDWriter log the events for later analysis.
+//
 // # Limitations
 //
-//   - Only EXTEST mode is currently supported (not SAMPLE or PRELOAD)
 //   - Pin filtering excludes power pins by name heuristics (VCC, GND, etc.)
 //   - Control cell disable logic assumes common BSDL conventions
-//   - No support for differential pairs or multi-bit buses
+//   - No support for multi-bit buses
+//   - On a queuing adapter, pins set by Apply, SetAllPinsHiZ or Preload are
+//     not driven until the next capture or Flush
 package bsr
@@ -0,0 +1,310 @@
+package bsr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsafe marks pin operations refused because of the controller's Guard.
+var ErrUnsafe = errors.New("bsr: unsafe pin operation")
+
+// Guard lists board-specific pin restrictions, usually kept in a JSON file
+// next to the project. Pins are named DEVICE.PIN, where DEVICE is the BSDL
+// entity name or the chain index and PIN the BSDL port or package pin, e.g.
+// "STM32F103.PA5" or "1.B7". In a Session, CHAIN.DEVICE.PIN names pins on
+// further chains, e.g. "1.EPM240.K3"; plain DEVICE.PIN names stay on the
+// first chain.
+//
+//	{
+//	  "do_not_drive": ["STM32F103.PA5"],
+//	  "force": {"EPM240.K3": false},
+//	  "nets": [["STM32F103.PB0", "EPM240.J1"]]
+//	}
+type Guard struct {
+	// DoNotDrive pins are never driven and stay HiZ.
+	DoNotDrive []string `json:"do_not_drive,omitempty"`
+	// Force holds pins at a fixed level (true = high) whenever their device
+	// is in the boundary register path, e.g. a regulator enable kept low.
+	Force map[string]bool `json:"force,omitempty"`
+	// Nets groups pins known to be connected. Driving pins of one net to
+	// opposite levels is refused.
+	Nets [][]string `json:"nets,omitempty"`
+}
+
+// LoadGuard reads a Guard from a JSON file.
+func LoadGuard(path string) (*Guard, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("bsr: failed to read guard file: %w", err)
+	}
+	var g Guard
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("bsr: failed to parse guard file %s: %w", path, err)
+	}
+	return &g, nil
+}
+
+// guardPin is a guarded pin resolved to the state that carries it. Negative
+// legs of differential pairs resolve to the positive leg, inverted.
+type guardPin struct {
+	ps       *PinState
+	inverted bool
+	name     string
+}
+
+// guardState is a Guard resolved against the controller's pins.
+type guardState struct {
+	noDrive map[*PinState]string
+	forced  map[*PinState]bool
+	nets    []guardNet
+}
+
+// guardNet is one group of pins from Guard.Nets.
+type guardNet []guardPin
+
+// SetGuard installs pin restrictions checked by every drive operation. The
+// forced pins take their levels on the next scan that drives the boundary
+// register; EnterExtest preloads them so they never glitch. Pass nil to
+// remove the guard.
+func (c *Controller) SetGuard(g *Guard) error {
+	if g == nil {
+		c.guard = nil
+		return nil
+	}
+
+	gs := &guardState{
+		noDrive: make(map[*PinState]string),
+		forced:  make(map[*PinState]bool),
+	}
+	for _, name := range g.DoNotDrive {
+		gp, err := c.resolveGuardPin(name)
+		if err != nil {
+			return err
+		}
+		gs.noDrive[gp.ps] = name
+	}
+	for name, level := range g.Force {
+		gp, err := c.resolveGuardPin(name)
+		if err != nil {
+			return err
+		}
+		if _, ok := gs.noDrive[gp.ps]; ok {
+			return fmt.Errorf("bsr: guard pin %s is both forced and on the do-not-drive list", name)
+		}
+		dev := c.Devices[gp.ps.Ref.ChainIndex]
+		if !hasOutputCell(dev.ChainDev, gp.ps.Ref.PinName) {
+			return fmt.Errorf("bsr: forced pin %s has no output cell", name)
+		}
+		gs.forced[gp.ps] = level != gp.inverted
+	}
+	for _, net := range g.Nets {
+		var pins guardNet
+		for _, name := range net {
+			gp, err := c.resolveGuardPin(name)
+			if err != nil {
+				return err
+			}
+			pins = append(pins, gp)
+		}
+		gs.nets = append(gs.nets, pins)
+	}
+
+	c.guard = gs
+	return c.checkNets(nil)
+}
+
+// CheckDrive reports why ref may not be driven, as an error wrapping
+// ErrUnsafe, or nil if the guard allows driving it to either level.
+func (c *Controller) CheckDrive(ref PinRef) error {
+	if c.guard == nil {
+		return nil
+	}
+	if ref.ChainIndex < 0 || ref.ChainIndex >= len(c.Devices) {
+		return fmt.Errorf("bsr: invalid chain index %d", ref.ChainIndex)
+	}
+	dev := c.Devices[ref.ChainIndex]
+	pinName, _ := dev.resolvePin(ref.PinName, false)
+	ps, ok := dev.Pins[pinName]
+	if !ok {
+		return fmt.Errorf("bsr: pin %s not found on device %s", ref.PinName, ref.DeviceName)
+	}
+	if err := c.guard.check(ps); err != nil {
+		return err
+	}
+	// Toggling a pin that shares a net with a forced pin fights it at one level
+	for _, net := range c.guard.nets {
+		if !net.contains(ps) {
+			continue
+		}
+		for _, gp := range net {
+			if _, ok := c.guard.forced[gp.ps]; ok && gp.ps != ps {
+				return fmt.Errorf("%w: %s shares a net with forced pin %s", ErrUnsafe, pinLabel(ps), pinLabel(gp.ps))
+			}
+		}
+	}
+	return nil
+}
+
+// check refuses pins on the do-not-drive list and forced pins.
+func (gs *guardState) check(ps *PinState) error {
+	if name, ok := gs.noDrive[ps]; ok {
+		return fmt.Errorf("%w: %s is on the do-not-drive list", ErrUnsafe, name)
+	}
+	if level, ok := gs.forced[ps]; ok {
+		return fmt.Errorf("%w: %s is forced %s", ErrUnsafe, pinLabel(ps), levelName(level))
+	}
+	return nil
+}
+
+// checkDrive validates staging ps at value (nil releases it).
+func (gs *guardState) checkDrive(ps *PinState, value *bool) error {
+	if gs == nil {
+		return nil
+	}
+	if name, ok := gs.noDrive[ps]; ok && value != nil {
+		return fmt.Errorf("%w: %s is on the do-not-drive list", ErrUnsafe, name)
+	}
+	if level, ok := gs.forced[ps]; ok && (value == nil || *value != level) {
+		return fmt.Errorf("%w: %s is forced %s", ErrUnsafe, pinLabel(ps), levelName(level))
+	}
+	return nil
+}
+
+// checkNets refuses a drive state in which two pins of a known net drive
+// opposite levels. pending holds staged changes on top of the pin states.
+func (c *Controller) checkNets(pending map[*PinState]*bool) error {
+	if c.guard == nil {
+		return nil
+	}
+	for _, net := range c.guard.nets {
+		var first *guardPin
+		var firstLevel bool
+		for i := range net {
+			gp := &net[i]
+			level, driven := c.drivenLevel(gp.ps, pending)
+			if !driven {
+				continue
+			}
+			level = level != gp.inverted
+			if first == nil {
+				first, firstLevel = gp, level
+				continue
+			}
+			if level != firstLevel {
+				return fmt.Errorf("%w: %s (%s) and %s (%s) would drive the same net",
+					ErrUnsafe, first.name, levelName(firstLevel), gp.name, levelName(level))
+			}
+		}
+	}
+	return nil
+}
+
+// drivenLevel returns the level ps will drive once pending is applied.
+func (c *Controller) drivenLevel(ps *PinState, pending map[*PinState]*bool) (bool, bool) {
+	if c.guard != nil {
+		if level, ok := c.guard.forced[ps]; ok {
+			return level, true
+		}
+	}
+	if value, ok := pending[ps]; ok {
+		if value == nil {
+			return false, false
+		}
+		return *value, true
+	}
+	if ps.Mode == PinOutput && ps.DrivenVal != nil {
+		return *ps.DrivenVal, true
+	}
+	return false, false
+}
+
+// forcedOn returns the forced pin levels on dev, keyed by pin name.
+func (c *Controller) forcedOn(dev *DeviceRuntime) map[string]bool {
+	if c.guard == nil {
+		return nil
+	}
+	out := make(map[string]bool)
+	for ps, level := range c.guard.forced {
+		if c.Devices[ps.Ref.ChainIndex] == dev {
+			out[ps.Ref.PinName] = level
+		}
+	}
+	return out
+}
+
+// resolveGuardPin looks up a DEVICE.PIN name.
+func (c *Controller) resolveGuardPin(name string) (guardPin, error) {
+	devName, pinName, ok := strings.Cut(strings.TrimSpace(name), ".")
+	if !ok || devName == "" || pinName == "" {
+		return guardPin{}, fmt.Errorf("bsr: invalid guard pin %q (use DEVICE.PIN)", name)
+	}
+
+	var dev *DeviceRuntime
+	if idx, err := strconv.Atoi(devName); err == nil {
+		if idx < 0 || idx >= len(c.Devices) {
+			return guardPin{}, fmt.Errorf("bsr: guard pin %s: invalid chain index %d", name, idx)
+		}
+		dev = c.Devices[idx]
+	} else {
+		for _, d := range c.Devices {
+			if strings.EqualFold(d.ChainDev.Name(), devName) {
+				if dev != nil {
+					return guardPin{}, fmt.Errorf("bsr: guard pin %s: several devices are named %s, use the chain index", name, devName)
+				}
+				dev = d
+			}
+		}
+		if dev == nil {
+			return guardPin{}, fmt.Errorf("bsr: guard pin %s: no device named %s", name, devName)
+		}
+	}
+
+	// BSDL port names map to the package pins that key dev.Pins
+	for port, pin := range dev.ChainDev.PinMap() {
+		if strings.EqualFold(port, pinName) {
+			pinName = pin
+			break
+		}
+	}
+	for candidate := range dev.Pins {
+		if strings.EqualFold(candidate, pinName) {
+			pinName = candidate
+			break
+		}
+	}
+	for candidate, pair := range dev.pairs {
+		if strings.EqualFold(candidate, pinName) && pair.Negative == candidate {
+			pinName = candidate
+		}
+	}
+	resolved, positive := dev.resolvePin(pinName, true)
+	ps, ok := dev.Pins[resolved]
+	if !ok {
+		return guardPin{}, fmt.Errorf("bsr: guard pin %s: pin %s not found on device %s", name, pinName, dev.ChainDev.Name())
+	}
+	return guardPin{ps: ps, inverted: !positive, name: name}, nil
+}
+
+func (net guardNet) contains(ps *PinState) bool {
+	for _, gp := range net {
+		if gp.ps == ps {
+			return true
+		}
+	}
+	return false
+}
+
+func pinLabel(ps *PinState) string {
+	return fmt.Sprintf("%s.%s", ps.Ref.DeviceName, ps.Ref.PinName)
+}
+
+func levelName(high bool) string {
+	if high {
+		return "high"
+	}
+	return "low"
+}
@@ -0,0 +1,160 @@
+package bsr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/chain"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
+)
+
+func TestInitialStateUsesSafeValues(t *testing.T) {
+	f := newModesFixture(t)
+	if err := f.ctl.EnterExtest(); err != nil {
+		t.Fatalf("EnterExtest failed: %v", err)
+	}
+	if _, err := f.ctl.CaptureAll(); err != nil {
+		t.Fatalf("CaptureAll failed: %v", err)
+	}
+	// Both control cells (bit 2 of each register) hold their disable value
+	want := []bool{false, false, true, false, false, true}
+	if fmt.Sprint(f.lastDR) != fmt.Sprint(want) {
+		t.Fatalf("DR = %v, want %v", f.lastDR, want)
+	}
+}
+
+func TestGuardRefusesUnsafeDrives(t *testing.T) {
+	f := newModesFixture(t)
+	ref0 := PinRef{ChainIndex: 0, DeviceName: "DEV0", PinName: "PB0"}
+	ref1 := PinRef{ChainIndex: 1, DeviceName: "DEV1", PinName: "PB0"}
+
+	if err := f.ctl.SetGuard(&Guard{DoNotDrive: []string{"dev0.pb0"}}); err != nil {
+		t.Fatalf("SetGuard failed: %v", err)
+	}
+	if err := f.ctl.EnterExtest(); err != nil {
+		t.Fatalf("EnterExtest failed: %v", err)
+	}
+	if err := f.ctl.DrivePin(ref0, true); !errors.Is(err, ErrUnsafe) {
+		t.Errorf("driving a do-not-drive pin: got %v, want ErrUnsafe", err)
+	}
+	if err := f.ctl.CheckDrive(ref1); err != nil {
+		t.Errorf("CheckDrive(DEV1.PB0) = %v", err)
+	}
+
+	// Known net: opposite levels are refused, matching levels are fine
+	if err := f.ctl.SetGuard(&Guard{Nets: [][]string{{"0.PB0", "1.PB0"}}}); err != nil {
+		t.Fatalf("SetGuard failed: %v", err)
+	}
+	if err := f.ctl.DrivePin(ref0, true); err != nil {
+		t.Fatalf("DrivePin failed: %v", err)
+	}
+	f.lastDR = nil
+	if err := f.ctl.DrivePin(ref1, false); !errors.Is(err, ErrUnsafe) {
+		t.Errorf("conflicting drive: got %v, want ErrUnsafe", err)
+	}
+	if f.lastDR != nil {
+		t.Errorf("a refused drive must not shift DR")
+	}
+	if f.ctl.Pending() {
+		t.Errorf("a refused drive must not stay staged")
+	}
+	if err := f.ctl.DrivePin(ref1, true); err != nil {
+		t.Errorf("driving the net to the same level: %v", err)
+	}
+
+	if err := f.ctl.SetGuard(&Guard{DoNotDrive: []string{"DEV9.PB0"}}); err == nil {
+		t.Errorf("expected error for a guard naming an unknown device")
+	}
+}
+
+func TestGuardForcedPins(t *testing.T) {
+	f := newModesFixture(t)
+	ref0 := PinRef{ChainIndex: 0, DeviceName: "DEV0", PinName: "PB0"}
+	ref1 := PinRef{ChainIndex: 1, DeviceName: "DEV1", PinName: "PB0"}
+
+	err := f.ctl.SetGuard(&Guard{
+		Force: map[string]bool{"DEV1.PB0": true},
+		Nets:  [][]string{{"DEV0.PB0", "DEV1.PB0"}},
+	})
+	if err != nil {
+		t.Fatalf("SetGuard failed: %v", err)
+	}
+
+	// EnterExtest preloads the forced level before switching to EXTEST;
+	// a capture shifts the preloaded vector back in
+	if err := f.ctl.EnterExtest(); err != nil {
+		t.Fatalf("EnterExtest failed: %v", err)
+	}
+	if _, err := f.ctl.CaptureAll(); err != nil {
+		t.Fatalf("CaptureAll failed: %v", err)
+	}
+	want := []bool{false, true, false, false, false, true}
+	if fmt.Sprint(f.lastDR) != fmt.Sprint(want) {
+		t.Fatalf("preloaded DR = %v, want %v", f.lastDR, want)
+	}
+
+	if err := f.ctl.SetAllPinsHiZ(); err != nil {
+		t.Fatalf("SetAllPinsHiZ failed: %v", err)
+	}
+	if fmt.Sprint(f.lastDR) != fmt.Sprint(want) {
+		t.Errorf("SetAllPinsHiZ released the forced pin: DR = %v", f.lastDR)
+	}
+	if ps := f.ctl.GetPinState(ref1); ps.Mode != PinOutput || !*ps.DrivenVal {
+		t.Errorf("forced pin should be reported as driven high")
+	}
+
+	if err := f.ctl.DrivePin(ref1, false); !errors.Is(err, ErrUnsafe) {
+		t.Errorf("overriding a forced pin: got %v, want ErrUnsafe", err)
+	}
+	if err := f.ctl.CheckDrive(ref0); !errors.Is(err, ErrUnsafe) {
+		t.Errorf("pin sharing a net with a forced pin: got %v, want ErrUnsafe", err)
+	}
+	if err := f.ctl.DrivePin(ref0, false); !errors.Is(err, ErrUnsafe) {
+		t.Errorf("fighting a forced pin: got %v, want ErrUnsafe", err)
+	}
+}
+
+func TestGuardResolvesPortNames(t *testing.T) {
+	parser, err := bsdl.NewParser()
+	if err != nil {
+		t.Fatalf("parser init failed: %v", err)
+	}
+	file, err := parser.ParseFile("../../testdata/STM32F303_F334_LQFP64.bsd")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	repo := chain.NewMemoryRepository()
+	if _, _, err := repo.AddFile(file); err != nil {
+		t.Fatalf("AddFile failed: %v", err)
+	}
+
+	ids := []uint32{0x06438041}
+	sim := jtag.NewSimAdapter(jtag.AdapterInfo{Name: "sim"})
+	sim.OnShift = func(region jtag.ShiftRegion, tms, tdi []byte, bits int) ([]byte, error) {
+		if region == jtag.ShiftRegionDR && bits == 32 {
+			return encodeIDCodes(ids), nil
+		}
+		return make([]byte, (bits+7)/8), nil
+	}
+	ch, err := chain.NewController(sim, repo).Discover(len(ids))
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	ctl, err := NewController(ch)
+	if err != nil {
+		t.Fatalf("NewController failed: %v", err)
+	}
+
+	// PA5 is package pin 21 in LQFP64; both names guard the same pin
+	pa5 := PinRef{ChainIndex: 0, DeviceName: "STM32F303_F334_LQFP64", PinName: "21"}
+	for _, name := range []string{"STM32F303_F334_LQFP64.PA5", "0.pa5", "0.21"} {
+		if err := ctl.SetGuard(&Guard{DoNotDrive: []string{name}}); err != nil {
+			t.Fatalf("SetGuard(%s) failed: %v", name, err)
+		}
+		if err := ctl.CheckDrive(pa5); !errors.Is(err, ErrUnsafe) {
+			t.Errorf("guard %s: CheckDrive(21) = %v, want ErrUnsafe", name, err)
+		}
+	}
+}
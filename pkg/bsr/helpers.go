@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/chain"
 )
 
 // buildDRLayout constructs the global DR bit map from a list of devices.
@@ -62,29 +63,84 @@ func CanDrivePin(dev *DeviceRuntime, pinName string) bool {
 	return false
 }
 
-// buildDRSegment creates the DR bit vector for a single device.
-// By default, all cells are set to their safe values.
-// pinOverrides maps pin name -> output value for pins that should be driven.
-func buildDRSegment(dev *DeviceRuntime, pinOverrides map[string]bool) ([]bool, error) {
-	cells, err := dev.ChainDev.BoundaryCells()
+// buildDiffPairs collects the device's differential pairs whose legs are both
+// IO pins, keyed by the package pin name of each leg.
+func buildDiffPairs(dev *chain.Device, ioPins []string) (map[string]*DiffPair, error) {
+	groups, err := dev.DifferentialPairs()
 	if err != nil {
-		return nil, fmt.Errorf("bsr: failed to get boundary cells: %w", err)
+		return nil, err
 	}
 
-	// Start with safe values for all cells
-	bits := make([]bool, dev.boundaryLength)
+	isIO := make(map[string]bool, len(ioPins))
+	for _, pin := range ioPins {
+		isIO[pin] = true
+	}
+
+	pairs := make(map[string]*DiffPair)
+	for _, g := range groups {
+		if !isIO[g.Positive] || !isIO[g.Negative] {
+			continue
+		}
+		pair := &DiffPair{
+			Kind:             g.Kind,
+			Positive:         g.Positive,
+			Negative:         g.Negative,
+			negativeDrivable: hasOutputCell(dev, g.Negative),
+		}
+		pairs[g.Positive] = pair
+		pairs[g.Negative] = pair
+	}
+	return pairs, nil
+}
+
+// hasOutputCell reports whether the package pin has an OUTPUT boundary cell.
+func hasOutputCell(dev *chain.Device, pinName string) bool {
+	return hasCell(dev, pinName, "OUTPUT")
+}
+
+// hasCell reports whether the package pin has a boundary cell whose function
+// starts with prefix.
+func hasCell(dev *chain.Device, pinName, prefix string) bool {
+	cells, err := dev.BoundaryCells()
+	if err != nil {
+		return false
+	}
+	pinMap := dev.PinMap()
 	for _, cell := range cells {
-		if cell.Number >= len(bits) {
-			return nil, fmt.Errorf("bsr: cell %d exceeds boundary length %d", cell.Number, len(bits))
+		packagePin, ok := pinMap[cell.Port]
+		if !ok {
+			packagePin = cell.Port
 		}
-		switch strings.ToUpper(strings.TrimSpace(cell.Safe)) {
-		case "1":
-			bits[cell.Number] = true
-		case "0":
-			bits[cell.Number] = false
-		// X or anything else: leave as false
+		if strings.EqualFold(packagePin, pinName) &&
+			strings.HasPrefix(strings.ToUpper(cell.Function), prefix) {
+			return true
 		}
 	}
+	return false
+}
+
+// resolvePin maps a pin name to the logical signal it belongs to. The negative
+// leg of a differential pair resolves to the positive leg with the value
+// inverted; all other pins are returned unchanged.
+func (d *DeviceRuntime) resolvePin(pinName string, value bool) (string, bool) {
+	if pair := d.pairs[pinName]; pair != nil && pair.Negative == pinName {
+		return pair.Positive, !value
+	}
+	return pinName, value
+}
+
+// buildDRSegment creates the DR bit vector for a single device.
+// It starts from the tri-stated safe state of setAllPinsHiZ, so only the
+// pins in pinOverrides (pin name -> output value) are driven.
+func buildDRSegment(dev *DeviceRuntime, pinOverrides map[string]bool) ([]bool, error) {
+	bits, err := setAllPinsHiZ(dev)
+	if err != nil || len(pinOverrides) == 0 {
+		return bits, err
+	}
+	cells, err := dev.ChainDev.BoundaryCells()
+	if err != nil {
+		return nil, fmt.Errorf("bsr: failed to get boundary cells: %w", err)
+	}
 
 	// Build a map of control cells for outputs
 	// Map package pin names to cells
@@ -177,6 +233,9 @@ func applyPinToDRBits(bits []bool, pinName string, outputVal bool, cellsByPort m
 
 // setAllPinsHiZ configures the DR segment so all pins are tri-stated.
 func setAllPinsHiZ(dev *DeviceRuntime) ([]bool, error) {
+	if !dev.ChainDev.HasBSDL() {
+		return nil, nil
+	}
 	cells, err := dev.ChainDev.BoundaryCells()
 	if err != nil {
 		return nil, fmt.Errorf("bsr: failed to get boundary cells: %w", err)
@@ -237,7 +296,7 @@ func setAllPinsHiZ(dev *DeviceRuntime) ([]bool, error) {
 }
 
 // decodeDRBits extracts input pin values from a captured DR bit vector.
-func decodeDRBits(layout *DRLayout, devices []*DeviceRuntime, drBits []bool) (map[PinRef]bool, error) {
+func decodeDRBits(layout *DRLayout, devices []*DeviceRuntime, chainID int, drBits []bool) (map[PinRef]bool, error) {
 	if len(drBits) != layout.TotalBits {
 		return nil, fmt.Errorf("bsr: DR bit count mismatch: got %d, expected %d", len(drBits), layout.TotalBits)
 	}
@@ -246,6 +305,9 @@ func decodeDRBits(layout *DRLayout, devices []*DeviceRuntime, drBits []bool) (ma
 
 	for bitIdx, entry := range layout.Cells {
 		dev := devices[entry.DeviceIndex]
+		if !dev.selectsBoundary() {
+			continue
+		}
 		cells, err := dev.ChainDev.BoundaryCells()
 		if err != nil {
 			continue
@@ -275,7 +337,13 @@ func decodeDRBits(layout *DRLayout, devices []*DeviceRuntime, drBits []bool) (ma
 			packagePin = cell.Port
 		}
 
+		// A differential pair is reported once, under its positive leg
+		if pair := dev.pairs[packagePin]; pair != nil && pair.Negative == packagePin {
+			continue
+		}
+
 		ref := PinRef{
+			Chain:      chainID,
 			ChainIndex: dev.ChainDev.Position,
 			DeviceName: dev.ChainDev.Name(),
 			PinName:    packagePin,
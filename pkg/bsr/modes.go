@@ -0,0 +1,323 @@
+package bsr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/chain"
+)
+
+// Instruction returns the instruction currently held by the device at index,
+// or "" if the controller has not programmed one yet.
+func (c *Controller) Instruction(index int) string {
+	if index < 0 || index >= len(c.Devices) {
+		return ""
+	}
+	return c.Devices[index].instruction
+}
+
+// SetInstructions programs the listed devices (keyed by chain index) in a
+// single IR scan, so each device can sit in a different instruction at once,
+// e.g. an MCU in SAMPLE next to a clamped FPGA. Devices that are not listed
+// keep their current instruction; devices never programmed go to BYPASS.
+//
+// PRELOAD falls back to SAMPLE on devices whose BSDL only names the shared
+// SAMPLE/PRELOAD opcode as SAMPLE.
+func (c *Controller) SetInstructions(modes map[int]string) error {
+	resolved := make(map[int]string, len(modes))
+	for idx, name := range modes {
+		if idx < 0 || idx >= len(c.Devices) {
+			return fmt.Errorf("bsr: invalid chain index %d", idx)
+		}
+		instr, err := c.Devices[idx].resolveInstruction(name)
+		if err != nil {
+			return err
+		}
+		resolved[idx] = instr
+	}
+
+	next := make([]string, len(c.Devices))
+	instMap := make(map[*chain.Device]string, len(c.Devices))
+	for i, dev := range c.Devices {
+		instr := dev.instruction
+		if r, ok := resolved[i]; ok {
+			instr = r
+		}
+		if instr == "" {
+			instr = InstrBypass
+		}
+		next[i] = instr
+		instMap[dev.ChainDev] = instr
+	}
+
+	if err := c.chain.ProgramInstructions(instMap); err != nil {
+		return fmt.Errorf("bsr: failed to program instructions: %w", err)
+	}
+
+	for i, dev := range c.Devices {
+		dev.instruction = next[i]
+	}
+	return nil
+}
+
+// setAll programs the same instruction on every device in the chain that
+// has a BSDL; devices without one stay in BYPASS.
+func (c *Controller) setAll(name string) error {
+	modes := make(map[int]string, len(c.Devices))
+	for i, dev := range c.Devices {
+		if dev.ChainDev.HasBSDL() {
+			modes[i] = name
+		}
+	}
+	return c.SetInstructions(modes)
+}
+
+// EnterSample programs all devices with SAMPLE. The devices keep running
+// from their own logic while the boundary register observes the pins.
+func (c *Controller) EnterSample() error {
+	return c.setAll(InstrSample)
+}
+
+// Sample captures the live pin values of a running device without taking
+// control of its pins. Devices in EXTEST, INTEST or PRELOAD (or not yet
+// programmed) are switched to SAMPLE first; devices parked in BYPASS, CLAMP
+// or HIGHZ stay there and are not reported.
+//
+// The cached DR vector is shifted back in, so update latches loaded by
+// Preload or earlier drives survive repeated sampling.
+func (c *Controller) Sample() (map[PinRef]bool, error) {
+	modes := make(map[int]string)
+	for i, dev := range c.Devices {
+		if dev.instruction != InstrSample && !dev.parked() {
+			modes[i] = InstrSample
+		}
+	}
+	if len(modes) > 0 {
+		if err := c.SetInstructions(modes); err != nil {
+			return nil, err
+		}
+	}
+	return c.CaptureAll()
+}
+
+// Preload loads the update latches with safe values plus the given pin
+// levels, leaving the pins themselves untouched. Listed pins start driving
+// as soon as EXTEST is entered, avoiding the glitch of entering EXTEST with
+// whatever the latches held. Pins forced by the guard are preloaded too.
+// Pin states reflect the preloaded values. On a queuing adapter the scan is
+// queued like Apply's and goes out ahead of any later scan.
+//
+// Devices parked in BYPASS, CLAMP or HIGHZ are skipped; naming one of their
+// pins is an error.
+func (c *Controller) Preload(values map[PinRef]bool) error {
+	overrides := make(map[int]map[string]bool)
+	next := make(map[*PinState]*bool)
+	for ref, value := range values {
+		if ref.ChainIndex < 0 || ref.ChainIndex >= len(c.Devices) {
+			return fmt.Errorf("bsr: invalid chain index %d", ref.ChainIndex)
+		}
+		dev := c.Devices[ref.ChainIndex]
+		if dev.parked() {
+			return fmt.Errorf("bsr: device %s is in %s", dev.ChainDev.Name(), dev.instruction)
+		}
+		pinName, value := dev.resolvePin(ref.PinName, value)
+		ps, ok := dev.Pins[pinName]
+		if !ok {
+			return fmt.Errorf("bsr: pin %s not found on device %s", ref.PinName, ref.DeviceName)
+		}
+		if err := c.guard.checkDrive(ps, &value); err != nil {
+			return err
+		}
+		if overrides[ref.ChainIndex] == nil {
+			overrides[ref.ChainIndex] = make(map[string]bool)
+		}
+		overrides[ref.ChainIndex][pinName] = value
+		next[ps] = &value
+	}
+
+	// Every pin not listed floats once the preloaded values take effect
+	for _, dev := range c.Devices {
+		if dev.parked() {
+			continue
+		}
+		for _, ps := range dev.Pins {
+			if _, ok := next[ps]; !ok {
+				next[ps] = nil
+			}
+		}
+	}
+	if err := c.checkNets(next); err != nil {
+		return err
+	}
+
+	modes := make(map[int]string)
+	for i, dev := range c.Devices {
+		if !dev.parked() {
+			modes[i] = InstrPreload
+		}
+	}
+	if err := c.SetInstructions(modes); err != nil {
+		return err
+	}
+
+	if len(c.currentDR) != c.Layout.TotalBits {
+		c.currentDR = make([]bool, c.Layout.TotalBits)
+	}
+
+	var globalDR []bool
+	offset := 0
+	for devIdx := len(c.Devices) - 1; devIdx >= 0; devIdx-- {
+		dev := c.Devices[devIdx]
+		segment := c.currentDR[offset : offset+dev.boundaryLength]
+		if !dev.parked() {
+			var err error
+			segment, err = c.safeSegment(dev, overrides[devIdx])
+			if err != nil {
+				return fmt.Errorf("bsr: failed to build preload segment for device %s: %w", dev.ChainDev.Name(), err)
+			}
+		}
+		globalDR = append(globalDR, segment...)
+		offset += dev.boundaryLength
+	}
+
+	if err := c.queueDR(globalDR); err != nil {
+		return fmt.Errorf("bsr: failed to shift DR: %w", err)
+	}
+	c.currentDR = globalDR
+
+	for ps, value := range next {
+		if value != nil {
+			ps.Mode = PinOutput
+			ps.DrivenVal = value
+		} else {
+			ps.Mode = PinHiZ
+			ps.DrivenVal = nil
+		}
+	}
+	c.markForced()
+
+	return nil
+}
+
+// Clamp places the device at index in CLAMP: its pins hold the values in
+// the update latches (see Preload) while only its BYPASS bit is scanned.
+func (c *Controller) Clamp(index int) error {
+	return c.SetInstructions(map[int]string{index: InstrClamp})
+}
+
+// HighZ places the device at index in HIGHZ, disabling all of its outputs.
+func (c *Controller) HighZ(index int) error {
+	return c.SetInstructions(map[int]string{index: InstrHighZ})
+}
+
+// Intest places the device at index in INTEST, where the boundary register
+// drives the core logic instead of the pins. Only devices whose BSDL
+// defines INTEST support it.
+func (c *Controller) Intest(index int) error {
+	return c.SetInstructions(map[int]string{index: InstrIntest})
+}
+
+// drSpan maps a device's boundary register between the layout vector and
+// the scanned bit stream.
+type drSpan struct{ layout, stream, length int }
+
+// shiftDR shifts a DR vector laid out according to c.Layout. Devices whose
+// instruction does not select the boundary register contribute their single
+// BYPASS bit instead; their part of the returned vector is left false.
+func (c *Controller) shiftDR(globalDR []bool) ([]bool, error) {
+	stream, spans, err := c.drStream(globalDR)
+	if err != nil {
+		return nil, err
+	}
+
+	tdo, err := c.chain.ShiftDRBits(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	captured := make([]bool, len(globalDR))
+	for _, s := range spans {
+		copy(captured[s.layout:s.layout+s.length], tdo[s.stream:s.stream+s.length])
+	}
+	return captured, nil
+}
+
+// queueDR shifts a DR vector like shiftDR for scans whose TDO is not used.
+// On a queuing adapter the scan waits for the next one that is read, such as
+// CaptureAll, or for Flush, so a run of drives costs one round trip; errors
+// surface there too.
+func (c *Controller) queueDR(globalDR []bool) error {
+	stream, _, err := c.drStream(globalDR)
+	if err != nil {
+		return err
+	}
+	_, err = c.chain.QueueDRBits(stream)
+	return err
+}
+
+// drStream builds the bit stream that scans globalDR through the chain.
+func (c *Controller) drStream(globalDR []bool) ([]bool, []drSpan, error) {
+	if len(globalDR) != c.Layout.TotalBits {
+		return nil, nil, fmt.Errorf("bsr: DR bit count mismatch: got %d, expected %d", len(globalDR), c.Layout.TotalBits)
+	}
+
+	var spans []drSpan
+	stream := make([]bool, 0, len(globalDR))
+	offset := 0
+	for devIdx := len(c.Devices) - 1; devIdx >= 0; devIdx-- {
+		dev := c.Devices[devIdx]
+		if dev.selectsBoundary() {
+			spans = append(spans, drSpan{offset, len(stream), dev.boundaryLength})
+			stream = append(stream, globalDR[offset:offset+dev.boundaryLength]...)
+		} else {
+			stream = append(stream, false)
+		}
+		offset += dev.boundaryLength
+	}
+	return stream, spans, nil
+}
+
+// resolveInstruction validates name against the controller's supported
+// instructions and the device's BSDL, returning the IR name to program.
+func (d *DeviceRuntime) resolveInstruction(name string) (string, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if !d.ChainDev.HasBSDL() {
+		if name != InstrBypass {
+			return "", fmt.Errorf("bsr: device %s has no BSDL and can only be in BYPASS", d.ChainDev.Name())
+		}
+		return name, nil
+	}
+	switch name {
+	case InstrExtest, InstrSample, InstrIntest, InstrClamp, InstrHighZ, InstrBypass:
+	case InstrPreload:
+		if !d.ChainDev.HasInstruction(InstrPreload) && d.ChainDev.HasInstruction(InstrSample) {
+			return InstrSample, nil
+		}
+	default:
+		return "", fmt.Errorf("bsr: unsupported instruction %s", name)
+	}
+	if !d.ChainDev.HasInstruction(name) {
+		return "", fmt.Errorf("bsr: device %s does not define %s", d.ChainDev.Name(), name)
+	}
+	return name, nil
+}
+
+// selectsBoundary reports whether the device's current instruction places
+// its boundary register between TDI and TDO.
+func (d *DeviceRuntime) selectsBoundary() bool {
+	switch d.instruction {
+	case "", InstrExtest, InstrSample, InstrPreload, InstrIntest:
+		return true
+	}
+	return false
+}
+
+// parked reports whether the device was deliberately taken out of the
+// boundary register path.
+func (d *DeviceRuntime) parked() bool {
+	switch d.instruction {
+	case InstrBypass, InstrClamp, InstrHighZ:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+package bsr
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/chain"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
+)
+
+// createModesBSDL builds a device with one bidirectional pin and the full
+// set of non-EXTEST instructions except INTEST.
+func createModesBSDL(name string, id uint32) string {
+	return fmt.Sprintf(`
+entity %s is
+	attribute INSTRUCTION_LENGTH of %s : entity is 5;
+	attribute BOUNDARY_LENGTH of %s : entity is 3;
+	attribute INSTRUCTION_OPCODE of %s : entity is
+		"BYPASS (11111)," &
+		"EXTEST (00000)," &
+		"SAMPLE (00010)," &
+		"PRELOAD (00011)," &
+		"CLAMP (00100)," &
+		"HIGHZ (00101)";
+	attribute IDCODE_REGISTER of %s : entity is "%s";
+	attribute BOUNDARY_REGISTER of %s : entity is
+		"2 (BC_1, *, CONTROL, 1)," &
+		"1 (BC_1, PB0, OUTPUT3, X, 2, 1, Z)," &
+		"0 (BC_1, PB0, INPUT, X)";
+end %s;
+`, name, name, name, name, name, idToBinary(id), name, name)
+}
+
+type modesFixture struct {
+	ctl    *Controller
+	lastIR []bool
+	lastDR []bool
+	drTDO  []bool
+}
+
+func newModesFixture(t *testing.T) *modesFixture {
+	t.Helper()
+	parser, err := bsdl.NewParser()
+	if err != nil {
+		t.Fatalf("parser init failed: %v", err)
+	}
+
+	repo := chain.NewMemoryRepository()
+	ids := []uint32{0x12345678, 0x87654321}
+	for i, id := range ids {
+		file, err := parser.ParseString(createModesBSDL(fmt.Sprintf("DEV%d", i), id))
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		if _, _, err := repo.AddFile(file); err != nil {
+			t.Fatalf("AddFile failed: %v", err)
+		}
+	}
+
+	f := &modesFixture{}
+	sim := jtag.NewSimAdapter(jtag.AdapterInfo{Name: "sim"})
+	idBytes := encodeIDCodes(ids)
+	sim.OnShift = func(region jtag.ShiftRegion, tms, tdi []byte, bits int) ([]byte, error) {
+		switch {
+		case region == jtag.ShiftRegionIR && bits == 10:
+			f.lastIR = bytesToBools(tdi, bits)
+		case region == jtag.ShiftRegionDR && bits == 64:
+			return append([]byte(nil), idBytes...), nil
+		case region == jtag.ShiftRegionDR && (bits == 4 || bits == 6):
+			f.lastDR = bytesToBools(tdi, bits)
+			if f.drTDO != nil {
+				return boolsToBytes(f.drTDO), nil
+			}
+		}
+		return make([]byte, (bits+7)/8), nil
+	}
+
+	ch, err := chain.NewController(sim, repo).Discover(len(ids))
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	f.ctl, err = NewController(ch)
+	if err != nil {
+		t.Fatalf("NewController failed: %v", err)
+	}
+	return f
+}
+
+func TestMixedInstructionsSample(t *testing.T) {
+	f := newModesFixture(t)
+
+	if err := f.ctl.SetInstructions(map[int]string{0: InstrClamp, 1: InstrSample}); err != nil {
+		t.Fatalf("SetInstructions failed: %v", err)
+	}
+	// IR stream is device 0 first, each opcode LSB first
+	wantIR := []bool{false, false, true, false, false, false, true, false, false, false}
+	if fmt.Sprint(f.lastIR) != fmt.Sprint(wantIR) {
+		t.Fatalf("IR stream = %v, want %v", f.lastIR, wantIR)
+	}
+
+	// DR is DEV1's 3-bit boundary register followed by DEV0's bypass bit
+	f.drTDO = []bool{true, false, false, false}
+	values, err := f.ctl.Sample()
+	if err != nil {
+		t.Fatalf("Sample failed: %v", err)
+	}
+	if len(f.lastDR) != 4 {
+		t.Fatalf("expected 4-bit DR scan, got %d", len(f.lastDR))
+	}
+	if len(values) != 1 {
+		t.Fatalf("expected only DEV1 to be sampled, got %v", values)
+	}
+	if !values[PinRef{ChainIndex: 1, DeviceName: "DEV1", PinName: "PB0"}] {
+		t.Errorf("DEV1.PB0 should read high")
+	}
+	if got := f.ctl.Instruction(0); got != InstrClamp {
+		t.Errorf("Sample must not disturb a clamped device, got %s", got)
+	}
+}
+
+func TestPreloadBeforeExtest(t *testing.T) {
+	f := newModesFixture(t)
+
+	ref := PinRef{ChainIndex: 0, DeviceName: "DEV0", PinName: "PB0"}
+	if err := f.ctl.Preload(map[PinRef]bool{ref: true}); err != nil {
+		t.Fatalf("Preload failed: %v", err)
+	}
+	if f.ctl.Instruction(0) != InstrPreload || f.ctl.Instruction(1) != InstrPreload {
+		t.Fatalf("devices should hold PRELOAD, got %s/%s", f.ctl.Instruction(0), f.ctl.Instruction(1))
+	}
+	if len(f.lastDR) != 6 {
+		t.Fatalf("expected 6-bit DR scan, got %d", len(f.lastDR))
+	}
+	// DEV1 occupies bits 0-2, DEV0 bits 3-5
+	if !f.lastDR[4] || f.lastDR[5] {
+		t.Errorf("DEV0.PB0 should be preloaded high and enabled: %v", f.lastDR)
+	}
+	if !f.lastDR[2] {
+		t.Errorf("DEV1 outputs should stay disabled: %v", f.lastDR)
+	}
+	ps := f.ctl.GetPinState(ref)
+	if ps.Mode != PinOutput || ps.DrivenVal == nil || !*ps.DrivenVal {
+		t.Errorf("pin state should reflect the preloaded value")
+	}
+
+	if err := f.ctl.EnterExtest(); err != nil {
+		t.Fatalf("EnterExtest failed: %v", err)
+	}
+	// A capture in EXTEST shifts the preloaded vector back in unchanged
+	if _, err := f.ctl.CaptureAll(); err != nil {
+		t.Fatalf("CaptureAll failed: %v", err)
+	}
+	if !f.lastDR[4] || f.lastDR[5] {
+		t.Errorf("preloaded drive lost after EXTEST: %v", f.lastDR)
+	}
+}
+
+func TestInstructionValidation(t *testing.T) {
+	f := newModesFixture(t)
+
+	if err := f.ctl.Intest(0); err == nil {
+		t.Errorf("expected error for INTEST on a device that does not define it")
+	}
+	if err := f.ctl.SetInstructions(map[int]string{0: "RUNBIST"}); err == nil {
+		t.Errorf("expected error for unsupported instruction")
+	}
+	if err := f.ctl.HighZ(1); err != nil {
+		t.Fatalf("HighZ failed: %v", err)
+	}
+	if got := f.ctl.Instruction(0); got != InstrBypass {
+		t.Errorf("unprogrammed device should default to BYPASS, got %s", got)
+	}
+	ref := PinRef{ChainIndex: 1, DeviceName: "DEV1", PinName: "PB0"}
+	if err := f.ctl.DrivePin(ref, true); err == nil {
+		t.Errorf("expected error driving a pin on a HIGHZ device")
+	}
+	if err := f.ctl.Preload(map[PinRef]bool{ref: true}); err == nil {
+		t.Errorf("expected error preloading a HIGHZ device")
+	}
+}
+
+func TestDeviceWithoutBSDLStaysInBypass(t *testing.T) {
+	parser, err := bsdl.NewParser()
+	if err != nil {
+		t.Fatalf("parser init failed: %v", err)
+	}
+	repo := chain.NewMemoryRepository()
+	file, err := parser.ParseString(createModesBSDL("DEV0", 0x12345678))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if _, _, err := repo.AddFile(file); err != nil {
+		t.Fatalf("AddFile failed: %v", err)
+	}
+
+	// Device 1 is an unknown CPLD with a 3-bit IR
+	var lastIR, lastDR []bool
+	ids := []uint32{0x12345678, 0x0BADC0DF}
+	idBytes := encodeIDCodes(ids)
+	sim := jtag.NewSimAdapter(jtag.AdapterInfo{Name: "sim"})
+	sim.OnShift = func(region jtag.ShiftRegion, tms, tdi []byte, bits int) ([]byte, error) {
+		switch {
+		case region == jtag.ShiftRegionIR && bits == 8:
+			lastIR = bytesToBools(tdi, bits)
+		case region == jtag.ShiftRegionDR && bits == 64:
+			return append([]byte(nil), idBytes...), nil
+		case region == jtag.ShiftRegionDR && bits == 4:
+			lastDR = bytesToBools(tdi, bits)
+		}
+		return make([]byte, (bits+7)/8), nil
+	}
+	ctrl := chain.NewController(sim, repo)
+	ctrl.SetIRLength(1, 3)
+	ch, err := ctrl.Discover(len(ids))
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	ctl, err := NewController(ch)
+	if err != nil {
+		t.Fatalf("NewController failed: %v", err)
+	}
+
+	if pins := ctl.AllPins(); len(pins) != 1 || pins[0].DeviceName != "DEV0" {
+		t.Fatalf("AllPins = %v, want only DEV0's pin", pins)
+	}
+	if err := ctl.EnterExtest(); err != nil {
+		t.Fatalf("EnterExtest failed: %v", err)
+	}
+	wantIR := []bool{false, false, false, false, false, true, true, true}
+	if fmt.Sprint(lastIR) != fmt.Sprint(wantIR) {
+		t.Fatalf("IR stream = %v, want EXTEST then BYPASS %v", lastIR, wantIR)
+	}
+	if got := ctl.Instruction(1); got != InstrBypass {
+		t.Fatalf("device 1 instruction = %q, want BYPASS", got)
+	}
+
+	if err := ctl.DrivePin(PinRef{ChainIndex: 0, DeviceName: "DEV0", PinName: "PB0"}, true); err != nil {
+		t.Fatalf("DrivePin failed: %v", err)
+	}
+	if len(lastDR) != 4 {
+		t.Fatalf("DR scan = %v, want 3 boundary bits plus 1 bypass bit", lastDR)
+	}
+	if err := ctl.SetInstructions(map[int]string{1: InstrSample}); err == nil {
+		t.Fatal("SAMPLE accepted on a device without BSDL")
+	}
+}
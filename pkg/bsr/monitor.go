@@ -0,0 +1,208 @@
+package bsr
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MonitorMode selects how a Monitor captures pin values.
+type MonitorMode int
+
+const (
+	// MonitorSample captures with SAMPLE so the devices keep running normally.
+	MonitorSample MonitorMode = iota
+	// MonitorCapture captures with whatever instruction the devices already
+	// hold, typically EXTEST with some pins driven by the caller.
+	MonitorCapture
+)
+
+// MonitorConfig controls a Monitor's polling.
+type MonitorConfig struct {
+	Interval time.Duration // Delay between scans; zero scans back to back
+	Mode     MonitorMode
+	Pins     []PinRef // Only report these pins; empty reports every pin
+}
+
+// PinEvent is a timestamped change of a single pin seen by a Monitor.
+type PinEvent struct {
+	Time    time.Time
+	Scan    uint64 // Scan number (1-based) in which the change was seen
+	Ref     PinRef
+	Value   bool
+	Initial bool // First observation of the pin rather than an edge
+}
+
+// Monitor repeatedly captures the chain and publishes per-pin changes,
+// acting as a slow logic analyzer on every boundary-scan input. Changes
+// shorter than the scan period are not seen.
+type Monitor struct {
+	ctl    *Controller
+	cfg    MonitorConfig
+	filter map[PinRef]bool
+
+	mu      sync.Mutex
+	subs    map[int]chan PinEvent
+	nextSub int
+	last    map[PinRef]bool
+	scans   uint64
+	dropped uint64
+	now     func() time.Time
+}
+
+// NewMonitor creates a monitor polling ctl. Nothing is scanned until Poll
+// or Run is called.
+func NewMonitor(ctl *Controller, cfg MonitorConfig) *Monitor {
+	m := &Monitor{
+		ctl:  ctl,
+		cfg:  cfg,
+		subs: make(map[int]chan PinEvent),
+		now:  time.Now,
+	}
+	if len(cfg.Pins) > 0 {
+		m.filter = make(map[PinRef]bool, len(cfg.Pins))
+		for _, ref := range cfg.Pins {
+			m.filter[ref] = true
+		}
+	}
+	return m
+}
+
+// Subscribe returns a channel receiving every event published after the
+// call. A subscriber that falls more than buffer events behind loses events
+// (counted by Stats) rather than stalling the scan loop. The returned
+// function unsubscribes and closes the channel; Run closes all channels
+// when it returns.
+func (m *Monitor) Subscribe(buffer int) (<-chan PinEvent, func()) {
+	ch := make(chan PinEvent, buffer)
+
+	m.mu.Lock()
+	id := m.nextSub
+	m.nextSub++
+	m.subs[id] = ch
+	m.mu.Unlock()
+
+	return ch, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if sub, ok := m.subs[id]; ok {
+			delete(m.subs, id)
+			close(sub)
+		}
+	}
+}
+
+// Poll performs a single scan, publishes the changes since the previous scan
+// to subscribers and returns them. The first scan reports every pin with
+// Initial set.
+func (m *Monitor) Poll() ([]PinEvent, error) {
+	var values map[PinRef]bool
+	var err error
+	if m.cfg.Mode == MonitorSample {
+		values, err = m.ctl.Sample()
+	} else {
+		values, err = m.ctl.CaptureAll()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bsr: monitor scan failed: %w", err)
+	}
+	stamp := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.scans++
+	initial := m.last == nil
+	if initial {
+		m.last = make(map[PinRef]bool, len(values))
+	}
+
+	var events []PinEvent
+	for ref, value := range values {
+		if m.filter != nil && !m.filter[ref] {
+			continue
+		}
+		prev, seen := m.last[ref]
+		m.last[ref] = value
+		if seen && prev == value {
+			continue
+		}
+		events = append(events, PinEvent{
+			Time:    stamp,
+			Scan:    m.scans,
+			Ref:     ref,
+			Value:   value,
+			Initial: !seen,
+		})
+	}
+	sort.Slice(events, func(i, j int) bool {
+		a, b := events[i].Ref, events[j].Ref
+		if a.ChainIndex != b.ChainIndex {
+			return a.ChainIndex < b.ChainIndex
+		}
+		return a.PinName < b.PinName
+	})
+
+	for _, ev := range events {
+		for _, sub := range m.subs {
+			select {
+			case sub <- ev:
+			default:
+				m.dropped++
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// Run polls at the configured interval until ctx is cancelled or a scan
+// fails. Cancellation is not an error. All subscriber channels are closed
+// before Run returns.
+func (m *Monitor) Run(ctx context.Context) error {
+	defer m.closeSubscribers()
+
+	var ticker *time.Ticker
+	if m.cfg.Interval > 0 {
+		ticker = time.NewTicker(m.cfg.Interval)
+		defer ticker.Stop()
+	}
+
+	for {
+		if _, err := m.Poll(); err != nil {
+			return err
+		}
+		if ticker == nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stats returns the number of scans performed and events dropped because a
+// subscriber's buffer was full.
+func (m *Monitor) Stats() (scans, dropped uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.scans, m.dropped
+}
+
+func (m *Monitor) closeSubscribers() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, sub := range m.subs {
+		delete(m.subs, id)
+		close(sub)
+	}
+}
@@ -0,0 +1,169 @@
+package bsr
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVWriter logs monitor events as CSV rows with times relative to the
+// first event.
+type CSVWriter struct {
+	w     *csv.Writer
+	start time.Time
+}
+
+// NewCSVWriter writes the header row and returns a writer for events.
+func NewCSVWriter(w io.Writer) (*CSVWriter, error) {
+	cw := &CSVWriter{w: csv.NewWriter(w)}
+	if err := cw.w.Write([]string{"time_s", "scan", "chain_index", "device", "pin", "value"}); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// WriteEvent appends one event.
+func (cw *CSVWriter) WriteEvent(ev PinEvent) error {
+	if cw.start.IsZero() {
+		cw.start = ev.Time
+	}
+	value := "0"
+	if ev.Value {
+		value = "1"
+	}
+	return cw.w.Write([]string{
+		strconv.FormatFloat(ev.Time.Sub(cw.start).Seconds(), 'f', 6, 64),
+		strconv.FormatUint(ev.Scan, 10),
+		strconv.Itoa(ev.Ref.ChainIndex),
+		ev.Ref.DeviceName,
+		ev.Ref.PinName,
+		value,
+	})
+}
+
+// Flush writes buffered rows to the underlying writer.
+func (cw *CSVWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// VCDWriter logs monitor events as a Value Change Dump for waveform viewers
+// such as GTKWave. Each device becomes a scope with one wire per pin; time
+// is in microseconds from the first event.
+type VCDWriter struct {
+	w       io.Writer
+	pins    []PinRef
+	ids     map[PinRef]string
+	start   time.Time
+	lastT   int64
+	started bool
+}
+
+// NewVCDWriter creates a writer for the given pins. The header is emitted
+// with the first event, whose time becomes t=0.
+func NewVCDWriter(w io.Writer, pins []PinRef) *VCDWriter {
+	sorted := append([]PinRef(nil), pins...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].ChainIndex != sorted[j].ChainIndex {
+			return sorted[i].ChainIndex < sorted[j].ChainIndex
+		}
+		return sorted[i].PinName < sorted[j].PinName
+	})
+
+	ids := make(map[PinRef]string, len(sorted))
+	for i, ref := range sorted {
+		ids[ref] = vcdIdentifier(i)
+	}
+	return &VCDWriter{w: w, pins: sorted, ids: ids}
+}
+
+// WriteEvent appends one event. Events for pins not given to NewVCDWriter
+// are ignored.
+func (vw *VCDWriter) WriteEvent(ev PinEvent) error {
+	id, ok := vw.ids[ev.Ref]
+	if !ok {
+		return nil
+	}
+	if !vw.started {
+		vw.start = ev.Time
+		if err := vw.writeHeader(); err != nil {
+			return err
+		}
+		vw.started = true
+		vw.lastT = -1
+	}
+
+	t := ev.Time.Sub(vw.start).Microseconds()
+	if t > vw.lastT {
+		if _, err := fmt.Fprintf(vw.w, "#%d\n", t); err != nil {
+			return err
+		}
+		vw.lastT = t
+	}
+	value := '0'
+	if ev.Value {
+		value = '1'
+	}
+	_, err := fmt.Fprintf(vw.w, "%c%s\n", value, id)
+	return err
+}
+
+func (vw *VCDWriter) writeHeader() error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "$date %s $end\n", vw.start.Format(time.RFC3339))
+	b.WriteString("$version OpenTraceJTAG boundary-scan monitor $end\n")
+	b.WriteString("$timescale 1us $end\n")
+	b.WriteString("$scope module chain $end\n")
+
+	scope := -1
+	for _, ref := range vw.pins {
+		if ref.ChainIndex != scope {
+			if scope >= 0 {
+				b.WriteString("$upscope $end\n")
+			}
+			scope = ref.ChainIndex
+			fmt.Fprintf(&b, "$scope module dev%d_%s $end\n", ref.ChainIndex, vcdName(ref.DeviceName))
+		}
+		fmt.Fprintf(&b, "$var wire 1 %s %s $end\n", vw.ids[ref], vcdName(ref.PinName))
+	}
+	if scope >= 0 {
+		b.WriteString("$upscope $end\n")
+	}
+	b.WriteString("$upscope $end\n$enddefinitions $end\n")
+
+	_, err := io.WriteString(vw.w, b.String())
+	return err
+}
+
+// vcdIdentifier returns the n-th short identifier code built from the
+// printable ASCII range VCD allows.
+func vcdIdentifier(n int) string {
+	const first, count = '!', '~' - '!' + 1
+	var id []byte
+	for {
+		id = append(id, byte(first+n%count))
+		n /= count
+		if n == 0 {
+			break
+		}
+		n--
+	}
+	return string(id)
+}
+
+// vcdName replaces characters that would split a VCD reference name.
+func vcdName(name string) string {
+	if name == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,131 @@
+package bsr
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitorPollEvents(t *testing.T) {
+	f := newModesFixture(t)
+	mon := NewMonitor(f.ctl, MonitorConfig{Mode: MonitorSample})
+	clock := time.Unix(1000, 0)
+	mon.now = func() time.Time { return clock }
+
+	events, unsubscribe := mon.Subscribe(1)
+	defer unsubscribe()
+
+	// DEV1 occupies DR bits 0-2 and DEV0 bits 3-5; bit 0 of each is PB0's input
+	f.drTDO = []bool{true, false, false, false, false, false}
+	initial, err := mon.Poll()
+	if err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	if len(initial) != 2 || !initial[0].Initial || initial[0].Ref.ChainIndex != 0 {
+		t.Fatalf("expected two initial events in chain order, got %+v", initial)
+	}
+	if f.ctl.Instruction(0) != InstrSample {
+		t.Errorf("sample mode should program SAMPLE, got %s", f.ctl.Instruction(0))
+	}
+
+	if changes, err := mon.Poll(); err != nil || len(changes) != 0 {
+		t.Fatalf("unchanged scan should yield no events, got %v (%v)", changes, err)
+	}
+
+	clock = clock.Add(5 * time.Millisecond)
+	f.drTDO = []bool{false, false, false, true, false, false}
+	changes, err := mon.Poll()
+	if err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected both pins to change, got %+v", changes)
+	}
+	if changes[0].Ref.ChainIndex != 0 || !changes[0].Value || changes[0].Initial || changes[0].Scan != 3 {
+		t.Errorf("unexpected DEV0 edge %+v", changes[0])
+	}
+	if changes[1].Ref.ChainIndex != 1 || changes[1].Value {
+		t.Errorf("unexpected DEV1 edge %+v", changes[1])
+	}
+
+	if ev := <-events; !ev.Initial {
+		t.Errorf("subscriber should first see an initial event, got %+v", ev)
+	}
+	if scans, dropped := mon.Stats(); scans != 3 || dropped != 3 {
+		t.Errorf("expected 3 scans and 3 dropped events, got %d/%d", scans, dropped)
+	}
+}
+
+func TestMonitorRunClosesSubscribers(t *testing.T) {
+	f := newModesFixture(t)
+	pb0 := PinRef{ChainIndex: 1, DeviceName: "DEV1", PinName: "PB0"}
+	mon := NewMonitor(f.ctl, MonitorConfig{Interval: time.Millisecond, Pins: []PinRef{pb0}})
+	events, _ := mon.Subscribe(16)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- mon.Run(ctx) }()
+
+	ev, ok := <-events
+	if !ok || ev.Ref != pb0 {
+		t.Fatalf("expected the filtered pin's initial event, got %+v", ev)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	for range events {
+	}
+}
+
+func TestMonitorWriters(t *testing.T) {
+	start := time.Unix(1000, 0)
+	pa0 := PinRef{ChainIndex: 0, DeviceName: "DEV 0", PinName: "PA0"}
+	pb0 := PinRef{ChainIndex: 1, DeviceName: "DEV1", PinName: "PB0"}
+	events := []PinEvent{
+		{Time: start, Scan: 1, Ref: pa0, Value: false, Initial: true},
+		{Time: start, Scan: 1, Ref: pb0, Value: true, Initial: true},
+		{Time: start.Add(1500 * time.Microsecond), Scan: 2, Ref: pa0, Value: true},
+	}
+
+	var vcd bytes.Buffer
+	vw := NewVCDWriter(&vcd, []PinRef{pb0, pa0})
+	var csvBuf bytes.Buffer
+	cw, err := NewCSVWriter(&csvBuf)
+	if err != nil {
+		t.Fatalf("NewCSVWriter failed: %v", err)
+	}
+	for _, ev := range events {
+		if err := vw.WriteEvent(ev); err != nil {
+			t.Fatalf("VCD write failed: %v", err)
+		}
+		if err := cw.WriteEvent(ev); err != nil {
+			t.Fatalf("CSV write failed: %v", err)
+		}
+	}
+	if err := cw.Flush(); err != nil {
+		t.Fatalf("CSV flush failed: %v", err)
+	}
+
+	out := vcd.String()
+	for _, want := range []string{
+		"$scope module dev0_DEV_0 $end\n$var wire 1 ! PA0 $end",
+		"$var wire 1 \" PB0 $end",
+		"#0\n0!\n1\"\n#1500\n1!\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("VCD output missing %q:\n%s", want, out)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(csvBuf.String()), "\n")
+	if len(lines) != 4 || lines[3] != "0.001500,2,0,DEV 0,PA0,1" {
+		t.Errorf("unexpected CSV output:\n%s", csvBuf.String())
+	}
+
+	if vcdIdentifier(94) != "!!" || vcdIdentifier(95) != "\"!" {
+		t.Errorf("identifier overflow: %q %q", vcdIdentifier(94), vcdIdentifier(95))
+	}
+}
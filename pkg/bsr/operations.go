@@ -1,31 +1,28 @@
 package bsr
 
-import (
-	"fmt"
-
-	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/chain"
-)
+import "fmt"
 
 // EnterExtest programs all devices in the chain with the EXTEST instruction.
 // This puts all devices into boundary-scan test mode where the boundary
 // register controls pin values instead of the device's internal logic.
+//
+// With forced pins in the guard, the update latches are preloaded with the
+// safe state first so those pins hold their level from the first TCK in
+// EXTEST.
 func (c *Controller) EnterExtest() error {
-	// Build instruction mapping: all devices get EXTEST
-	instMap := make(map[*chain.Device]string)
-	for _, dev := range c.Devices {
-		instMap[dev.ChainDev] = "EXTEST"
-	}
-
-	if err := c.chain.ProgramInstructions(instMap); err != nil {
-		return fmt.Errorf("bsr: failed to program EXTEST: %w", err)
+	if c.guard != nil && len(c.guard.forced) > 0 {
+		if err := c.Preload(nil); err != nil {
+			return err
+		}
 	}
-
-	return nil
+	return c.setAll(InstrExtest)
 }
 
 // SetAllPinsHiZ tri-states all pins on all devices by setting their control
 // cells to disable outputs. This is typically the first operation after
-// entering EXTEST mode to ensure no conflicts.
+// entering EXTEST mode to ensure no conflicts. Staged changes are discarded;
+// pins forced by the guard keep driving. On a queuing adapter the scan goes
+// out with the next capture or Flush.
 func (c *Controller) SetAllPinsHiZ() error {
 	// Build DR vector with all pins tri-stated
 	var globalDR []bool
@@ -34,7 +31,7 @@ func (c *Controller) SetAllPinsHiZ() error {
 	// DR scan shifts from TDI to TDO, so we reverse when building the vector.
 	for devIdx := len(c.Devices) - 1; devIdx >= 0; devIdx-- {
 		dev := c.Devices[devIdx]
-		segment, err := setAllPinsHiZ(dev)
+		segment, err := c.safeSegment(dev, nil)
 		if err != nil {
 			return fmt.Errorf("bsr: failed to build HiZ segment for device %s: %w", dev.ChainDev.Name(), err)
 		}
@@ -42,111 +39,256 @@ func (c *Controller) SetAllPinsHiZ() error {
 	}
 
 	// Shift DR
-	_, err := c.chain.ShiftDRBits(globalDR)
-	if err != nil {
+	if err := c.queueDR(globalDR); err != nil {
 		return fmt.Errorf("bsr: failed to shift DR: %w", err)
 	}
 
 	// Update cached DR state
 	c.currentDR = globalDR
+	c.pending = nil
 
 	// Update all pin states to HiZ
 	for _, dev := range c.Devices {
+		if dev.parked() {
+			continue
+		}
 		for _, ps := range dev.Pins {
 			ps.Mode = PinHiZ
 			ps.DrivenVal = nil
 		}
 	}
+	c.markForced()
 
 	return nil
 }
 
-// DrivePin drives a single pin to the specified value (high=true, low=false).
-// All other pins on the same device are set to HiZ. Pins on other devices
-// retain their current state.
+// DrivePin drives a single pin to the specified value (high=true, low=false)
+// in one DR scan. Every other pin in the chain keeps its current state; call
+// SetAllPinsHiZ first to float them. Changes staged with SetPin are applied
+// in the same scan. The pin is driven by the time DrivePin returns, even on
+// a queuing adapter.
+//
+// For a differential pair the value applies to the positive leg and the
+// negative leg is driven to the complement. Naming the negative leg drives
+// the pair with the value inverted.
 func (c *Controller) DrivePin(ref PinRef, value bool) error {
-	// Validate the pin reference
-	if ref.ChainIndex < 0 || ref.ChainIndex >= len(c.Devices) {
-		return fmt.Errorf("bsr: invalid chain index %d", ref.ChainIndex)
+	return c.DrivePins(map[PinRef]bool{ref: value})
+}
+
+// DrivePins drives several pins, possibly on different devices, in one DR
+// scan, e.g. a chip-select together with its data lines. Pins not listed
+// keep their current state. Like DrivePin it flushes the scan before
+// returning; use SetPin and Apply to batch drives on a queuing adapter.
+func (c *Controller) DrivePins(values map[PinRef]bool) error {
+	for ref, value := range values {
+		if err := c.SetPin(ref, value); err != nil {
+			c.Discard()
+			return err
+		}
+	}
+	if err := c.Apply(); err != nil {
+		c.Discard()
+		return err
+	}
+	return c.Flush()
+}
+
+// SetPin stages driving a pin to value without scanning. Staged changes
+// accumulate across devices until Apply shifts them in a single DR scan.
+func (c *Controller) SetPin(ref PinRef, value bool) error {
+	ps, value, err := c.stagedPin(ref, value, true)
+	if err != nil {
+		return err
+	}
+	if err := c.guard.checkDrive(ps, &value); err != nil {
+		return err
+	}
+	c.stage(ps, &value)
+	return nil
+}
+
+// ReleasePin stages returning a pin to HiZ without scanning.
+func (c *Controller) ReleasePin(ref PinRef) error {
+	ps, _, err := c.stagedPin(ref, false, false)
+	if err != nil {
+		return err
 	}
+	if err := c.guard.checkDrive(ps, nil); err != nil {
+		return err
+	}
+	c.stage(ps, nil)
+	return nil
+}
 
-	targetDev := c.Devices[ref.ChainIndex]
-	if _, ok := targetDev.Pins[ref.PinName]; !ok {
-		return fmt.Errorf("bsr: pin %s not found on device %s", ref.PinName, ref.DeviceName)
+// Pending reports whether SetPin or ReleasePin staged changes that Apply
+// has not shifted yet.
+func (c *Controller) Pending() bool {
+	return len(c.pending) > 0
+}
+
+// Discard drops all staged changes.
+func (c *Controller) Discard() {
+	c.pending = nil
+}
+
+// Flush sends drive scans still queued on the adapter and reports their
+// errors. Captures flush on their own; call Flush when pins must be driven
+// before something outside the chain happens.
+func (c *Controller) Flush() error {
+	if err := c.chain.Flush(); err != nil {
+		return fmt.Errorf("bsr: %w", err)
 	}
+	return nil
+}
 
-	// Debug logging for PA5
-	if ref.PinName == "PA5" {
-		fmt.Printf("[BSR] DrivePin: dev%d.%s = %v\n", ref.ChainIndex, ref.PinName, value)
+// Apply shifts all staged pin changes in one DR scan. Devices in the
+// boundary register path get a segment rebuilt from their pin states with
+// the staged changes merged in, so pins that were not touched keep driving
+// (or floating) as before. Devices parked in BYPASS, CLAMP or HIGHZ keep
+// their cached segment. Apply with nothing staged rewrites the current state.
+// On a queuing adapter the scan goes out with the next capture or Flush, so
+// a run of Apply calls costs one round trip; errors surface there too.
+//
+// The scan is refused with ErrUnsafe if it would leave two pins of a net
+// known to the guard driving opposite levels.
+func (c *Controller) Apply() error {
+	if len(c.currentDR) != c.Layout.TotalBits {
+		c.currentDR = make([]bool, c.Layout.TotalBits)
+	}
+	for ps := range c.pending {
+		dev := c.Devices[ps.Ref.ChainIndex]
+		if !dev.selectsBoundary() {
+			return fmt.Errorf("bsr: device %s is in %s", dev.ChainDev.Name(), dev.instruction)
+		}
+	}
+	if err := c.checkNets(c.pending); err != nil {
+		return err
 	}
 
-	// Build DR vector
 	var globalDR []bool
-
+	offset := 0
 	for devIdx := len(c.Devices) - 1; devIdx >= 0; devIdx-- {
 		dev := c.Devices[devIdx]
-		var segment []bool
-		var err error
-
-		if devIdx == ref.ChainIndex {
-			// This is the target device - set the pin
-			pinOverrides := map[string]bool{ref.PinName: value}
-			segment, err = buildDRSegment(dev, pinOverrides)
+		segment := c.currentDR[offset : offset+dev.boundaryLength]
+		if dev.selectsBoundary() {
+			var err error
+			segment, err = c.safeSegment(dev, c.outputs(dev))
 			if err != nil {
 				return fmt.Errorf("bsr: failed to build segment for device %s: %w", dev.ChainDev.Name(), err)
 			}
-			
-			// Debug: show what we're writing for PA5
-			if ref.PinName == "PA5" {
-				cells, _ := dev.ChainDev.BoundaryCells()
-				for _, cell := range cells {
-					if cell.Port == "PA5" && (cell.Number >= 94 && cell.Number <= 96) {
-						fmt.Printf("[BSR]   Cell %d (%s): %v\n", cell.Number, cell.Function, segment[cell.Number])
-					}
-				}
-			}
-		} else {
-			// Other devices - keep them in HiZ
-			segment, err = setAllPinsHiZ(dev)
-			if err != nil {
-				return fmt.Errorf("bsr: failed to build HiZ segment for device %s: %w", dev.ChainDev.Name(), err)
-			}
 		}
-
 		globalDR = append(globalDR, segment...)
+		offset += dev.boundaryLength
 	}
 
-	// Shift DR
-	_, err := c.chain.ShiftDRBits(globalDR)
-	if err != nil {
+	for ps, value := range c.pending {
+		if value == nil {
+			c.logf("bsr: dev%d.%s = Z", ps.Ref.ChainIndex, ps.Ref.PinName)
+		} else {
+			c.logf("bsr: dev%d.%s = %v", ps.Ref.ChainIndex, ps.Ref.PinName, *value)
+		}
+	}
+	if err := c.queueDR(globalDR); err != nil {
 		return fmt.Errorf("bsr: failed to shift DR: %w", err)
 	}
-
-	// Update cached DR state
 	c.currentDR = globalDR
 
-	// Update pin states
-	for _, dev := range c.Devices {
-		for _, ps := range dev.Pins {
-			if ps.Ref.ChainIndex == ref.ChainIndex && ps.Ref.PinName == ref.PinName {
-				ps.Mode = PinOutput
-				val := value
-				ps.DrivenVal = &val
-			} else if ps.Ref.ChainIndex == ref.ChainIndex {
-				// Other pins on same device go to HiZ
-				ps.Mode = PinHiZ
-				ps.DrivenVal = nil
-			}
-			// Pins on other devices retain their state
+	for ps, value := range c.pending {
+		if value == nil {
+			ps.Mode = PinHiZ
+			ps.DrivenVal = nil
+		} else {
+			ps.Mode = PinOutput
+			ps.DrivenVal = value
 		}
 	}
-
+	c.pending = nil
+	c.markForced()
 	return nil
 }
 
+// stagedPin validates ref for staging and resolves it to the pin state that
+// carries the change, inverting value for the negative leg of a pair.
+func (c *Controller) stagedPin(ref PinRef, value, drive bool) (*PinState, bool, error) {
+	if ref.ChainIndex < 0 || ref.ChainIndex >= len(c.Devices) {
+		return nil, false, fmt.Errorf("bsr: invalid chain index %d", ref.ChainIndex)
+	}
+	dev := c.Devices[ref.ChainIndex]
+
+	// Either leg of a differential pair drives the pair as one signal
+	pinName, value := dev.resolvePin(ref.PinName, value)
+	ps, ok := dev.Pins[pinName]
+	if !ok {
+		return nil, false, fmt.Errorf("bsr: pin %s not found on device %s", ref.PinName, ref.DeviceName)
+	}
+	if !dev.selectsBoundary() {
+		return nil, false, fmt.Errorf("bsr: device %s is in %s", dev.ChainDev.Name(), dev.instruction)
+	}
+	if drive && !hasOutputCell(dev.ChainDev, pinName) {
+		return nil, false, fmt.Errorf("bsr: pin %s on device %s has no output cell", pinName, dev.ChainDev.Name())
+	}
+	return ps, value, nil
+}
+
+// stage records a change for Apply; a nil value floats the pin.
+func (c *Controller) stage(ps *PinState, value *bool) {
+	if c.pending == nil {
+		c.pending = make(map[*PinState]*bool)
+	}
+	c.pending[ps] = value
+}
+
+// outputs returns the pins the device should drive once the staged changes
+// are applied, keyed by pin name.
+func (c *Controller) outputs(dev *DeviceRuntime) map[string]bool {
+	out := make(map[string]bool)
+	for name, ps := range dev.Pins {
+		if level, driven := c.drivenLevel(ps, c.pending); driven {
+			out[name] = level
+		}
+	}
+	return out
+}
+
+// safeSegment builds the device's DR segment from its safe state with every
+// output disabled, then drives the given pins and the guard's forced pins.
+// The negative legs of drivable pairs follow their positive leg.
+func (c *Controller) safeSegment(dev *DeviceRuntime, drive map[string]bool) ([]bool, error) {
+	overrides := make(map[string]bool)
+	for name, level := range drive {
+		overrides[name] = level
+	}
+	for name, level := range c.forcedOn(dev) {
+		overrides[name] = level
+	}
+	for name, level := range overrides {
+		if pair := dev.pairs[name]; pair != nil && pair.Positive == name && pair.negativeDrivable {
+			overrides[pair.Negative] = !level
+		}
+	}
+	return buildDRSegment(dev, overrides)
+}
+
+// markForced records the guard's forced pins as driven outputs.
+func (c *Controller) markForced() {
+	if c.guard == nil {
+		return
+	}
+	for ps, level := range c.guard.forced {
+		if !c.Devices[ps.Ref.ChainIndex].selectsBoundary() {
+			continue
+		}
+		level := level
+		ps.Mode = PinOutput
+		ps.DrivenVal = &level
+	}
+}
+
 // CaptureAll performs a DR scan to capture the current state of all input pins.
 // It returns a map from PinRef to the captured boolean value.
-// This does not change the driven state of any pins.
+// This does not change the driven state of any pins and does not apply
+// changes staged with SetPin. Devices whose current
+// instruction bypasses the boundary register are not reported.
 func (c *Controller) CaptureAll() (map[PinRef]bool, error) {
 	// Use the current DR state as TDI
 	// The DR scan will capture the current pin states into TDO
@@ -155,13 +297,13 @@ func (c *Controller) CaptureAll() (map[PinRef]bool, error) {
 		c.currentDR = make([]bool, c.Layout.TotalBits)
 	}
 
-	tdo, err := c.chain.ShiftDRBits(c.currentDR)
+	tdo, err := c.shiftDR(c.currentDR)
 	if err != nil {
 		return nil, fmt.Errorf("bsr: failed to capture DR: %w", err)
 	}
 
 	// Decode the captured bits
-	result, err := decodeDRBits(c.Layout, c.Devices, tdo)
+	result, err := decodeDRBits(c.Layout, c.Devices, c.chainID, tdo)
 	if err != nil {
 		return nil, fmt.Errorf("bsr: failed to decode DR bits: %w", err)
 	}
@@ -1,11 +1,13 @@
 package bsr
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/chain"
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/tap"
 )
 
 func TestEnterExtest(t *testing.T) {
@@ -403,3 +405,225 @@ func bytesToBools(buf []byte, bits int) []bool {
 	}
 	return out
 }
+
+func TestStagedPinsApplyInOneScan(t *testing.T) {
+	f := newModesFixture(t)
+	if err := f.ctl.EnterExtest(); err != nil {
+		t.Fatalf("EnterExtest failed: %v", err)
+	}
+	var logged []string
+	f.ctl.SetLogger(func(format string, args ...any) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	})
+
+	ref0 := PinRef{ChainIndex: 0, DeviceName: "DEV0", PinName: "PB0"}
+	ref1 := PinRef{ChainIndex: 1, DeviceName: "DEV1", PinName: "PB0"}
+	if err := f.ctl.SetPin(ref0, true); err != nil {
+		t.Fatalf("SetPin failed: %v", err)
+	}
+	if err := f.ctl.SetPin(ref1, false); err != nil {
+		t.Fatalf("SetPin failed: %v", err)
+	}
+	if f.ctl.GetPinState(ref0).Mode != PinHiZ {
+		t.Errorf("SetPin should not change the pin before Apply")
+	}
+
+	f.lastDR = nil
+	if err := f.ctl.Apply(); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	// DEV1's register comes first; cell 1 is the output, cell 2 the
+	// control (0 enables)
+	want := []bool{false, false, false, false, true, false}
+	if fmt.Sprint(f.lastDR) != fmt.Sprint(want) {
+		t.Fatalf("DR = %v, want %v", f.lastDR, want)
+	}
+	if len(logged) != 2 {
+		t.Errorf("expected 2 log lines, got %v", logged)
+	}
+	if f.ctl.Pending() {
+		t.Errorf("Apply should clear staged changes")
+	}
+
+	// Driving one pin leaves the other one driven
+	if err := f.ctl.DrivePin(ref1, true); err != nil {
+		t.Fatalf("DrivePin failed: %v", err)
+	}
+	want = []bool{false, true, false, false, true, false}
+	if fmt.Sprint(f.lastDR) != fmt.Sprint(want) {
+		t.Fatalf("DR = %v, want %v", f.lastDR, want)
+	}
+	if ps := f.ctl.GetPinState(ref0); ps.Mode != PinOutput || !*ps.DrivenVal {
+		t.Errorf("DEV0.PB0 should still drive high")
+	}
+
+	if err := f.ctl.ReleasePin(ref0); err != nil {
+		t.Fatalf("ReleasePin failed: %v", err)
+	}
+	if err := f.ctl.Apply(); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	want = []bool{false, true, false, false, false, true}
+	if fmt.Sprint(f.lastDR) != fmt.Sprint(want) {
+		t.Fatalf("DR = %v, want %v", f.lastDR, want)
+	}
+	if f.ctl.GetPinState(ref0).Mode != PinHiZ {
+		t.Errorf("DEV0.PB0 should be HiZ after release")
+	}
+}
+
+// newQueuedFixture is newModesFixture on a CMSIS-DAP adapter, whose shifts
+// are queued, over a fake probe that follows the TAP and loops DR scans back.
+func newQueuedFixture(t *testing.T) (*Controller, *jtag.FakeDAPTransport) {
+	t.Helper()
+	ctl, fake, _ := newQueuedTAP(t)
+	return ctl, fake
+}
+
+// queuedTAP is the DR state of a newQueuedTAP probe.
+type queuedTAP struct {
+	// latched holds the bits shifted in by the last completed DR scan.
+	latched []bool
+	// capture, if set, returns the TDO bit at pos of a DR scan in place of
+	// the looped-back TDI bit.
+	capture func(pos int, in bool) bool
+}
+
+// newQueuedTAP is newQueuedFixture exposing the probe's DR state.
+func newQueuedTAP(t *testing.T) (*Controller, *jtag.FakeDAPTransport, *queuedTAP) {
+	t.Helper()
+	parser, err := bsdl.NewParser()
+	if err != nil {
+		t.Fatalf("parser init failed: %v", err)
+	}
+	repo := chain.NewMemoryRepository()
+	ids := []uint32{0x12345678, 0x87654321}
+	for i, id := range ids {
+		file, err := parser.ParseString(createModesBSDL(fmt.Sprintf("DEV%d", i), id))
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		if _, _, err := repo.AddFile(file); err != nil {
+			t.Fatalf("AddFile failed: %v", err)
+		}
+	}
+
+	// The first DR scan after a reset reads the IDCODEs
+	idBits := bytesToBools(encodeIDCodes(ids), 64)
+	state, reset, pos := tap.StateTestLogicReset, true, 0
+	dr := &queuedTAP{}
+	var shifted []bool
+	fake := jtag.NewFakeDAPTransport()
+	fake.OnJTAG = func(tms bool, tdi []byte, bits int) []byte {
+		in := bytesToBools(tdi, bits)
+		out := make([]bool, bits)
+		for i := range in {
+			if state == tap.StateShiftDR {
+				if reset && pos < len(idBits) {
+					out[i] = idBits[pos]
+				} else if !reset && dr.capture != nil {
+					out[i] = dr.capture(pos, in[i])
+				} else if !reset {
+					out[i] = in[i]
+				}
+				shifted = append(shifted, in[i])
+				pos++
+			}
+			state = tap.NextState(state, tms)
+			switch state {
+			case tap.StateTestLogicReset:
+				reset = true
+			case tap.StateCaptureDR:
+				pos, shifted = 0, nil
+			case tap.StateUpdateDR:
+				dr.latched = shifted
+				reset = false
+			case tap.StateUpdateIR:
+				reset = false
+			}
+		}
+		return boolsToBytes(out)
+	}
+
+	adapter, err := jtag.NewCMSISDAPAdapterWithTransport(fake)
+	if err != nil {
+		t.Fatalf("adapter init failed: %v", err)
+	}
+	ch, err := chain.NewController(adapter, repo).Discover(len(ids))
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	ctl, err := NewController(ch)
+	if err != nil {
+		t.Fatalf("NewController failed: %v", err)
+	}
+	return ctl, fake, dr
+}
+
+func TestDrivesQueueUntilCapture(t *testing.T) {
+	ctl, fake := newQueuedFixture(t)
+	if err := ctl.EnterExtest(); err != nil {
+		t.Fatalf("EnterExtest failed: %v", err)
+	}
+	if err := ctl.SetAllPinsHiZ(); err != nil {
+		t.Fatalf("SetAllPinsHiZ failed: %v", err)
+	}
+	if err := ctl.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	ref0 := PinRef{ChainIndex: 0, DeviceName: "DEV0", PinName: "PB0"}
+	ref1 := PinRef{ChainIndex: 1, DeviceName: "DEV1", PinName: "PB0"}
+	before := len(fake.Commands())
+	for _, value := range []bool{true, false, true} {
+		for _, ref := range []PinRef{ref0, ref1} {
+			if err := ctl.SetPin(ref, value); err != nil {
+				t.Fatalf("SetPin failed: %v", err)
+			}
+			if err := ctl.Apply(); err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			value = !value
+		}
+	}
+	if sent := len(fake.Commands()) - before; sent != 0 {
+		t.Fatalf("applies sent %d packets before any capture, want them queued", sent)
+	}
+
+	// The capture flushes the drives ahead of its own scan
+	values, err := ctl.CaptureAll()
+	if err != nil {
+		t.Fatalf("CaptureAll failed: %v", err)
+	}
+	if len(values) != 2 {
+		t.Errorf("CaptureAll returned %v", values)
+	}
+	if sent := len(fake.Commands()) - before; sent == 0 || sent > 2 {
+		t.Errorf("6 applies and a capture took %d packets", sent)
+	}
+	if ps := ctl.GetPinState(ref0); ps.Mode != PinOutput || !*ps.DrivenVal {
+		t.Errorf("DEV0.PB0 state = %+v, want driven high", ps)
+	}
+}
+
+func TestDrivePinFlushes(t *testing.T) {
+	ctl, fake := newQueuedFixture(t)
+	if err := ctl.EnterExtest(); err != nil {
+		t.Fatalf("EnterExtest failed: %v", err)
+	}
+	if err := ctl.SetAllPinsHiZ(); err != nil {
+		t.Fatalf("SetAllPinsHiZ failed: %v", err)
+	}
+	if err := ctl.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	before := len(fake.Commands())
+	ref := PinRef{ChainIndex: 0, DeviceName: "DEV0", PinName: "PB0"}
+	if err := ctl.DrivePin(ref, true); err != nil {
+		t.Fatalf("DrivePin failed: %v", err)
+	}
+	if sent := len(fake.Commands()) - before; sent == 0 {
+		t.Errorf("DrivePin returned with its scan still queued")
+	}
+}
@@ -0,0 +1,289 @@
+package bsr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Session runs boundary-scan operations across several independent chains,
+// e.g. two JTAG headers on one board, each behind its own adapter and
+// Controller. Pins are addressed by PinRef.Chain, the controller's position
+// in the session, so one map of values can span every chain.
+//
+// Drives only scan the chains they touch; captures scan every chain, after
+// all drive scans have completed, so signals crossing between chains are
+// seen like any other net.
+type Session struct {
+	Controllers []*Controller
+}
+
+// NewSession groups controllers into a session and numbers their chains
+// in order: the pins of ctls[i] carry Chain i from then on. A single
+// controller makes a session equivalent to using it directly.
+func NewSession(ctls ...*Controller) (*Session, error) {
+	if len(ctls) == 0 {
+		return nil, fmt.Errorf("bsr: session has no chains")
+	}
+	seen := make(map[*Controller]bool)
+	for i, c := range ctls {
+		if c == nil {
+			return nil, fmt.Errorf("bsr: chain %d has no controller", i)
+		}
+		if seen[c] {
+			return nil, fmt.Errorf("bsr: controller for chain %d is already in the session", i)
+		}
+		seen[c] = true
+	}
+	for i, c := range ctls {
+		c.setChainID(i)
+	}
+	return &Session{Controllers: append([]*Controller(nil), ctls...)}, nil
+}
+
+// Controller returns the controller of the given chain, or nil.
+func (s *Session) Controller(chain int) *Controller {
+	if chain < 0 || chain >= len(s.Controllers) {
+		return nil
+	}
+	return s.Controllers[chain]
+}
+
+// controllerFor returns the controller that owns ref.
+func (s *Session) controllerFor(ref PinRef) (*Controller, error) {
+	c := s.Controller(ref.Chain)
+	if c == nil {
+		return nil, fmt.Errorf("bsr: invalid chain %d", ref.Chain)
+	}
+	return c, nil
+}
+
+// SetLogger installs logf on every chain's controller.
+func (s *Session) SetLogger(logf func(format string, args ...any)) {
+	for _, c := range s.Controllers {
+		c.SetLogger(logf)
+	}
+}
+
+// EnterExtest programs every device on every chain with EXTEST.
+func (s *Session) EnterExtest() error {
+	for i, c := range s.Controllers {
+		if err := c.EnterExtest(); err != nil {
+			return fmt.Errorf("bsr: chain %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// SetAllPinsHiZ tri-states every pin on every chain.
+func (s *Session) SetAllPinsHiZ() error {
+	for i, c := range s.Controllers {
+		if err := c.SetAllPinsHiZ(); err != nil {
+			return fmt.Errorf("bsr: chain %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// DrivePin drives a single pin on its chain; see Controller.DrivePin.
+func (s *Session) DrivePin(ref PinRef, value bool) error {
+	return s.DrivePins(map[PinRef]bool{ref: value})
+}
+
+// DrivePins drives pins on any number of chains like ApplyPins and flushes
+// every chain before returning, so the pins are driven once it returns.
+func (s *Session) DrivePins(values map[PinRef]bool) error {
+	if err := s.ApplyPins(values); err != nil {
+		return err
+	}
+	return s.Flush()
+}
+
+// ApplyPins stages pins on any number of chains and applies them: each
+// chain involved gets one DR scan with its pins staged. Nothing is scanned
+// unless every pin could be staged. Chains are scanned in order, and a
+// failed scan leaves the earlier chains driving. On queuing adapters the
+// scans go out with the next CaptureAll or Flush, as with Controller.Apply.
+func (s *Session) ApplyPins(values map[PinRef]bool) error {
+	staged := make(map[*Controller]bool)
+	discard := func() {
+		for c := range staged {
+			c.Discard()
+		}
+	}
+	for ref, value := range values {
+		c, err := s.controllerFor(ref)
+		if err != nil {
+			discard()
+			return err
+		}
+		if err := c.SetPin(ref, value); err != nil {
+			discard()
+			return err
+		}
+		staged[c] = true
+	}
+	for i, c := range s.Controllers {
+		if !staged[c] {
+			continue
+		}
+		if err := c.Apply(); err != nil {
+			discard()
+			return fmt.Errorf("bsr: chain %d: %w", i, err)
+		}
+		delete(staged, c)
+	}
+	return nil
+}
+
+// Flush sends the queued drive scans of every chain.
+func (s *Session) Flush() error {
+	for i, c := range s.Controllers {
+		if err := c.Flush(); err != nil {
+			return fmt.Errorf("bsr: chain %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// CaptureAll captures the input pins of every chain, in chain order, and
+// returns them in one map keyed by chain-qualified PinRefs. Drive scans
+// still queued on any chain are flushed first, so a pin driven on one chain
+// is seen by the captures of the others.
+func (s *Session) CaptureAll() (map[PinRef]bool, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	result := make(map[PinRef]bool)
+	for i, c := range s.Controllers {
+		values, err := c.CaptureAll()
+		if err != nil {
+			return nil, fmt.Errorf("bsr: chain %d: %w", i, err)
+		}
+		for ref, v := range values {
+			result[ref] = v
+		}
+	}
+	return result, nil
+}
+
+// GetPinState returns the runtime state of a pin, or nil.
+func (s *Session) GetPinState(ref PinRef) *PinState {
+	c := s.Controller(ref.Chain)
+	if c == nil {
+		return nil
+	}
+	return c.GetPinState(ref)
+}
+
+// CanDrive reports whether the pin has an output cell; see
+// Controller.CanDrive.
+func (s *Session) CanDrive(ref PinRef) bool {
+	c := s.Controller(ref.Chain)
+	return c != nil && c.CanDrive(ref)
+}
+
+// CanRead reports whether the pin has an input cell.
+func (s *Session) CanRead(ref PinRef) bool {
+	c := s.Controller(ref.Chain)
+	return c != nil && c.CanRead(ref)
+}
+
+// SetGuard splits g by chain and installs each part on its chain's
+// controller; see Guard for the CHAIN.DEVICE.PIN names. Every pin of a
+// known net must be on one chain, since nets are checked per controller.
+// Pass nil to remove the guards.
+func (s *Session) SetGuard(g *Guard) error {
+	if g == nil {
+		for _, c := range s.Controllers {
+			c.SetGuard(nil)
+		}
+		return nil
+	}
+
+	parts := make([]*Guard, len(s.Controllers))
+	for i := range parts {
+		parts[i] = &Guard{Force: make(map[string]bool)}
+	}
+	for _, name := range g.DoNotDrive {
+		chain, pin, err := s.guardChain(name)
+		if err != nil {
+			return err
+		}
+		parts[chain].DoNotDrive = append(parts[chain].DoNotDrive, pin)
+	}
+	for name, level := range g.Force {
+		chain, pin, err := s.guardChain(name)
+		if err != nil {
+			return err
+		}
+		parts[chain].Force[pin] = level
+	}
+	for _, net := range g.Nets {
+		var pins []string
+		netChain := -1
+		for _, name := range net {
+			chain, pin, err := s.guardChain(name)
+			if err != nil {
+				return err
+			}
+			if netChain >= 0 && chain != netChain {
+				return fmt.Errorf("bsr: guard net %v spans chains %d and %d; only nets within one chain can be checked", net, netChain, chain)
+			}
+			netChain = chain
+			pins = append(pins, pin)
+		}
+		if netChain >= 0 {
+			parts[netChain].Nets = append(parts[netChain].Nets, pins)
+		}
+	}
+
+	for i, c := range s.Controllers {
+		if err := c.SetGuard(parts[i]); err != nil {
+			return fmt.Errorf("bsr: chain %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// guardChain splits a guard pin name into its chain and the DEVICE.PIN
+// name its controller resolves.
+func (s *Session) guardChain(name string) (int, string, error) {
+	fields := strings.Split(strings.TrimSpace(name), ".")
+	if len(fields) != 3 {
+		return 0, name, nil
+	}
+	chain, err := strconv.Atoi(fields[0])
+	if err != nil || s.Controller(chain) == nil {
+		return 0, "", fmt.Errorf("bsr: guard pin %s: invalid chain %q", name, fields[0])
+	}
+	return chain, fields[1] + "." + fields[2], nil
+}
+
+// CheckDrive reports whether the guard of the pin's chain lets it be
+// driven; see Controller.CheckDrive.
+func (s *Session) CheckDrive(ref PinRef) error {
+	c, err := s.controllerFor(ref)
+	if err != nil {
+		return err
+	}
+	return c.CheckDrive(ref)
+}
+
+// DiffPair returns the differential pair ref belongs to, or nil.
+func (s *Session) DiffPair(ref PinRef) *DiffPair {
+	c := s.Controller(ref.Chain)
+	if c == nil {
+		return nil
+	}
+	return c.DiffPair(ref)
+}
+
+// AllPins returns the pins of every chain.
+func (s *Session) AllPins() []PinRef {
+	var pins []PinRef
+	for _, c := range s.Controllers {
+		pins = append(pins, c.AllPins()...)
+	}
+	return pins
+}
@@ -0,0 +1,160 @@
+package bsr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	a, b := newModesFixture(t), newModesFixture(t)
+	if _, err := NewSession(); err == nil {
+		t.Errorf("NewSession accepted no chains")
+	}
+	if _, err := NewSession(a.ctl, a.ctl); err == nil {
+		t.Errorf("NewSession accepted a controller twice")
+	}
+	s, err := NewSession(a.ctl, b.ctl)
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+
+	// Both chains hold DEV0 and DEV1; the chain number tells them apart
+	pins := s.AllPins()
+	if len(pins) != 4 {
+		t.Fatalf("AllPins = %v, want 4 pins", pins)
+	}
+	for _, ref := range b.ctl.AllPins() {
+		if ref.Chain != 1 {
+			t.Errorf("chain 1 pin %+v has Chain %d", ref, ref.Chain)
+		}
+	}
+	if b.ctl.ChainID() != 1 || s.Controller(1) != b.ctl || s.Controller(2) != nil {
+		t.Errorf("chain numbering is off")
+	}
+
+	if err := s.EnterExtest(); err != nil {
+		t.Fatalf("EnterExtest failed: %v", err)
+	}
+	if err := s.SetAllPinsHiZ(); err != nil {
+		t.Fatalf("SetAllPinsHiZ failed: %v", err)
+	}
+
+	// Driving on chain 0 scans chain 0 only
+	driver := PinRef{Chain: 0, ChainIndex: 0, DeviceName: "DEV0", PinName: "PB0"}
+	b.lastDR = nil
+	if err := s.DrivePin(driver, true); err != nil {
+		t.Fatalf("DrivePin failed: %v", err)
+	}
+	if len(a.lastDR) != 6 || !a.lastDR[4] || a.lastDR[5] {
+		t.Errorf("chain 0 DR = %v, want DEV0.PB0 driven high", a.lastDR)
+	}
+	if b.lastDR != nil {
+		t.Errorf("chain 1 was scanned by a drive on chain 0: %v", b.lastDR)
+	}
+	if ps := s.GetPinState(driver); ps == nil || ps.Mode != PinOutput {
+		t.Errorf("driver state = %+v", ps)
+	}
+
+	// The capture covers both chains: DEV1.PB0 on chain 1 sees the drive
+	b.drTDO = []bool{true, false, false, false, false, false}
+	values, err := s.CaptureAll()
+	if err != nil {
+		t.Fatalf("CaptureAll failed: %v", err)
+	}
+	if len(values) != 4 {
+		t.Errorf("CaptureAll returned %d pins, want 4", len(values))
+	}
+	if !values[PinRef{Chain: 1, ChainIndex: 1, DeviceName: "DEV1", PinName: "PB0"}] {
+		t.Errorf("chain 1 DEV1.PB0 not captured high: %v", values)
+	}
+	if values[PinRef{Chain: 0, ChainIndex: 1, DeviceName: "DEV1", PinName: "PB0"}] {
+		t.Errorf("chain 0 DEV1.PB0 captured high: %v", values)
+	}
+
+	if err := s.DrivePins(map[PinRef]bool{driver: false, {Chain: 2, DeviceName: "DEV0", PinName: "PB0"}: true}); err == nil {
+		t.Errorf("DrivePins accepted a pin on an unknown chain")
+	}
+	if a.ctl.Pending() {
+		t.Errorf("failed DrivePins left changes staged")
+	}
+}
+
+func TestSessionGuard(t *testing.T) {
+	a, b := newModesFixture(t), newModesFixture(t)
+	s, err := NewSession(a.ctl, b.ctl)
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	first := PinRef{Chain: 0, ChainIndex: 0, DeviceName: "DEV0", PinName: "PB0"}
+	second := PinRef{Chain: 1, ChainIndex: 0, DeviceName: "DEV0", PinName: "PB0"}
+
+	// Plain names stay on the first chain, CHAIN.DEVICE.PIN picks another
+	if err := s.SetGuard(&Guard{DoNotDrive: []string{"1.DEV0.PB0"}}); err != nil {
+		t.Fatalf("SetGuard failed: %v", err)
+	}
+	if err := s.CheckDrive(first); err != nil {
+		t.Errorf("CheckDrive(chain 0 DEV0.PB0) = %v", err)
+	}
+	if err := s.CheckDrive(second); !errors.Is(err, ErrUnsafe) {
+		t.Errorf("CheckDrive(chain 1 DEV0.PB0) = %v, want ErrUnsafe", err)
+	}
+	if err := s.SetGuard(&Guard{DoNotDrive: []string{"DEV0.PB0"}, Nets: [][]string{{"1.0.PB0", "1.DEV1.PB0"}}}); err != nil {
+		t.Fatalf("SetGuard failed: %v", err)
+	}
+	if err := s.CheckDrive(first); !errors.Is(err, ErrUnsafe) {
+		t.Errorf("CheckDrive(chain 0 DEV0.PB0) = %v, want ErrUnsafe", err)
+	}
+	if err := s.CheckDrive(second); err != nil {
+		t.Errorf("CheckDrive(chain 1 DEV0.PB0) = %v", err)
+	}
+
+	for _, g := range []*Guard{
+		{DoNotDrive: []string{"2.DEV0.PB0"}},
+		{Nets: [][]string{{"DEV0.PB0", "1.DEV1.PB0"}}},
+	} {
+		if err := s.SetGuard(g); err == nil {
+			t.Errorf("SetGuard accepted %+v", g)
+		}
+	}
+}
+
+func TestSessionCaptureFlushesEveryChain(t *testing.T) {
+	a, _, aTAP := newQueuedTAP(t)
+	b, _, bTAP := newQueuedTAP(t)
+	s, err := NewSession(a, b)
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+
+	// Chain 1 DEV0.PB0 is wired to chain 0 DEV1.PB0. DR scans stream DEV1's
+	// cells first, so the input is bit 0 and the driver bits 4 and 5.
+	aTAP.capture = func(pos int, in bool) bool {
+		if pos == 0 {
+			l := bTAP.latched
+			return len(l) == 6 && l[4] && !l[5]
+		}
+		return in
+	}
+	driver := PinRef{Chain: 1, ChainIndex: 0, DeviceName: "DEV0", PinName: "PB0"}
+	receiver := PinRef{Chain: 0, ChainIndex: 1, DeviceName: "DEV1", PinName: "PB0"}
+
+	if err := s.EnterExtest(); err != nil {
+		t.Fatalf("EnterExtest failed: %v", err)
+	}
+	if err := s.SetAllPinsHiZ(); err != nil {
+		t.Fatalf("SetAllPinsHiZ failed: %v", err)
+	}
+	for _, level := range []bool{true, false, true} {
+		// ApplyPins leaves the scan queued on chain 1's probe
+		if err := s.ApplyPins(map[PinRef]bool{driver: level}); err != nil {
+			t.Fatalf("ApplyPins failed: %v", err)
+		}
+		values, err := s.CaptureAll()
+		if err != nil {
+			t.Fatalf("CaptureAll failed: %v", err)
+		}
+		if values[receiver] != level {
+			t.Errorf("chain 0 DEV1.PB0 = %v after driving chain 1 DEV0.PB0 %v", values[receiver], level)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package bsr
 
 import "github.com/OpenTraceLab/OpenTraceJTAG/pkg/chain"
 
-// PinRef uniquely identifies a physical board pin across the entire chain.
+// PinRef uniquely identifies a physical board pin across the entire chain,
+// or across all chains of a Session.
 type PinRef struct {
+	Chain      int    `json:",omitempty"` // Chain number in a Session (0 for a lone Controller)
 	ChainIndex int    // Index into chain.Devices (0 = closest to TDI)
 	DeviceName string // Entity name from BSDL, e.g., "STM32F103"
 	PinName    string // Package pin name from BSDL, e.g., "PA0", "A1"
@@ -19,25 +21,57 @@ const (
 	PinOutput
 )
 
+// Boundary-scan instructions the Controller can place a device in.
+const (
+	InstrExtest  = "EXTEST"  // Boundary register drives and captures the pins
+	InstrSample  = "SAMPLE"  // Boundary register snapshots the pins; device runs normally
+	InstrPreload = "PRELOAD" // Loads the update latches without affecting the pins
+	InstrIntest  = "INTEST"  // Boundary register drives the core logic inputs
+	InstrClamp   = "CLAMP"   // Pins hold the preloaded values; BYPASS register selected
+	InstrHighZ   = "HIGHZ"   // All outputs disabled; BYPASS register selected
+	InstrBypass  = "BYPASS"  // Device is transparent apart from a single bit
+)
+
 // PinState tracks runtime state for a single pin.
 type PinState struct {
 	Ref       PinRef
 	Mode      PinMode
-	DrivenVal *bool // Non-nil when Mode == PinOutput
-	LastRead  *bool // Last captured input value from CaptureAll
+	DrivenVal *bool     // Non-nil when Mode == PinOutput
+	LastRead  *bool     // Last captured input value from CaptureAll
+	Pair      *DiffPair // Non-nil when the pin is the positive leg of a differential pair
+}
+
+// DiffPair describes a differential pair from the BSDL PORT_GROUPING attribute.
+// The pair is handled as one logical signal named after the positive leg: its
+// value is the level on the positive leg and the negative leg carries the
+// complement.
+type DiffPair struct {
+	Kind     string // bsdl.DifferentialVoltage or bsdl.DifferentialCurrent
+	Positive string // Package pin name of the positive (representative) leg
+	Negative string // Package pin name of the negative (associated) leg
+
+	negativeDrivable bool // Negative leg has its own output cell
 }
 
 // DeviceRuntime wraps a chain.Device with boundary-scan-specific runtime state.
 type DeviceRuntime struct {
 	ChainDev *chain.Device
 
-	// Quick lookup: package pin name -> runtime state
+	// Quick lookup: package pin name -> runtime state.
+	// Negative legs of differential pairs are folded into the positive leg.
 	Pins map[string]*PinState
 
+	// Differential pairs keyed by either leg's package pin name
+	pairs map[string]*DiffPair
+
+	// Instruction currently held in the device's IR. Empty until the
+	// controller programs one; the boundary register is assumed then.
+	instruction string
+
 	// Precomputed from BSDL:
-	boundaryLength int     // Total boundary register length
-	extestOpcode   []bool  // Precomputed EXTEST instruction bits
-	bypassOpcode   []bool  // Precomputed BYPASS instruction bits
+	boundaryLength int    // Total boundary register length
+	extestOpcode   []bool // Precomputed EXTEST instruction bits
+	bypassOpcode   []bool // Precomputed BYPASS instruction bits
 }
 
 // DRMapEntry maps a global DR bit index to a specific device and boundary cell.
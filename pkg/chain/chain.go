@@ -3,18 +3,21 @@ package chain
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/idcode/deviceinfo"
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/tap"
 )
 
 // Controller orchestrates JTAG chain discovery and high-level operations.
 type Controller struct {
-	adapter jtag.Adapter
-	repo    Repository
+	adapter   jtag.Adapter
+	repo      Repository
+	irLengths map[int]int
 }
 
 // NewController wires a JTAG adapter with a BSDL repository.
@@ -25,6 +28,15 @@ func NewController(adapter jtag.Adapter, repo Repository) *Controller {
 	}
 }
 
+// SetIRLength fixes the IR length of the device at chain position when it
+// has no BSDL, overriding the device database and IR length detection.
+func (c *Controller) SetIRLength(position, bits int) {
+	if c.irLengths == nil {
+		c.irLengths = make(map[int]int)
+	}
+	c.irLengths[position] = bits
+}
+
 // Chain represents the discovered devices and provides helper queries.
 type Chain struct {
 	devices []*Device
@@ -48,6 +60,42 @@ func (c *Chain) DeviceByName(name string) (*Device, bool) {
 	return nil, false
 }
 
+// SetPackages applies package overrides given as "NAME" (every device whose
+// BSDL defines that package) or "INDEX=NAME" (the device at chain position
+// INDEX).
+func (c *Chain) SetPackages(specs []string) error {
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		if idxStr, name, ok := strings.Cut(spec, "="); ok {
+			idx, err := strconv.Atoi(strings.TrimSpace(idxStr))
+			if err != nil || idx < 0 || idx >= len(c.devices) {
+				return fmt.Errorf("chain: invalid device index in package override %q", spec)
+			}
+			if err := c.devices[idx].SetPackage(strings.TrimSpace(name)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		matched := false
+		for _, dev := range c.devices {
+			for _, pkg := range dev.Packages() {
+				if strings.EqualFold(pkg, spec) {
+					dev.Package = pkg
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			return fmt.Errorf("chain: no device defines package %q", spec)
+		}
+	}
+	return nil
+}
+
 // ProgramInstructions loads the specified instruction into each device's IR.
 // Devices not in the mapping are programmed with BYPASS.
 func (c *Chain) ProgramInstructions(mapping map[*Device]string) error {
@@ -60,6 +108,35 @@ func (c *Chain) ShiftDRBits(bits []bool) ([]bool, error) {
 	return c.shiftDR(bits)
 }
 
+// QueueDRBits queues a DR shift like ShiftDRBits without waiting for it. With
+// a queuing adapter (CMSIS-DAP) many scans then travel per USB round trip;
+// other adapters execute the shift immediately. Call Bits on the result, or
+// Flush, to run the queue.
+func (c *Chain) QueueDRBits(bits []bool) (*PendingBits, error) {
+	return c.queueDR(bits)
+}
+
+// Flush executes all queued shifts.
+func (c *Chain) Flush() error {
+	return c.xport.flush()
+}
+
+// PendingBits is the TDO of a queued DR shift.
+type PendingBits struct {
+	tdo    *jtag.PendingTDO
+	offset int // Bits to skip, e.g. bypass bits ahead of a device register
+	bits   int
+}
+
+// Bits returns the captured TDO bits, flushing the queue if needed.
+func (p *PendingBits) Bits() ([]bool, error) {
+	tdo, err := p.tdo.TDO()
+	if err != nil {
+		return nil, err
+	}
+	return bytesToBools(tdo, p.offset+p.bits)[p.offset:], nil
+}
+
 // Device aggregates useful BSDL-derived metadata.
 type Device struct {
 	Position int
@@ -67,19 +144,36 @@ type Device struct {
 	File     *bsdl.BSDLFile
 	Info     *bsdl.DeviceInfo
 
+	// Package overrides the PHYSICAL_PIN_MAP package used for pin names. When
+	// empty the BSDL generic's default is used. Set it (via SetPackage) before
+	// building runtimes on top of the device, since pin names derive from it.
+	Package string
+
 	boundaryOnce  sync.Once
 	boundaryCells []bsdl.BoundaryCell
 	boundaryErr   error
 	cellByNumber  map[int]*bsdl.BoundaryCell
 	cellsByPort   map[string][]*bsdl.BoundaryCell
+
+	// presetCells are pre-extracted boundary cells supplied by an indexed
+	// repository; when set they replace parsing BOUNDARY_REGISTER.
+	presetCells []bsdl.BoundaryCell
 }
 
-// Name returns the entity name.
+// Name returns the entity name, or UNKNOWN_<position> for a device without
+// BSDL so every device in the chain has a distinct name.
 func (d *Device) Name() string {
 	if d.File != nil && d.File.Entity != nil {
 		return d.File.Entity.Name
 	}
-	return ""
+	return fmt.Sprintf("UNKNOWN_%d", d.Position)
+}
+
+// HasBSDL reports whether the device was matched to a BSDL file. Devices
+// without one are placeholders that only ever sit in BYPASS: they have an IR
+// length but no instructions, boundary cells or pins.
+func (d *Device) HasBSDL() bool {
+	return d.File != nil && d.File.Entity != nil
 }
 
 // Instructions exposes the decoded instruction table.
@@ -90,14 +184,80 @@ func (d *Device) Instructions() []bsdl.Instruction {
 	return d.File.Entity.GetInstructionOpcodes()
 }
 
-// PinMap returns the mapping from signal name to package pin.
+// PinMap returns the mapping from signal name to package pin for the selected
+// package (see PackageName).
 func (d *Device) PinMap() map[string]string {
 	if d.File == nil || d.File.Entity == nil {
 		return nil
 	}
+	if d.Package != "" {
+		if pinMap, err := d.File.Entity.GetPinMapForPackage(d.Package); err == nil {
+			return pinMap
+		}
+	}
 	return d.File.Entity.GetPinMap()
 }
 
+// Packages lists the package variants defined by the device's BSDL.
+func (d *Device) Packages() []string {
+	if d.File == nil || d.File.Entity == nil {
+		return nil
+	}
+	return d.File.Entity.PackageNames()
+}
+
+// PackageName returns the package used for pin names: the override if set,
+// otherwise the PHYSICAL_PIN_MAP default.
+func (d *Device) PackageName() string {
+	if d.Package != "" {
+		return d.Package
+	}
+	if d.File == nil || d.File.Entity == nil {
+		return ""
+	}
+	return d.File.Entity.DefaultPackage()
+}
+
+// SetPackage selects a package variant by name. An empty name restores the
+// BSDL default.
+func (d *Device) SetPackage(name string) error {
+	if name != "" {
+		if d.File == nil || d.File.Entity == nil {
+			return fmt.Errorf("chain: device %s missing BSDL data", d.Name())
+		}
+		if _, err := d.File.Entity.GetPinMapForPackage(name); err != nil {
+			return fmt.Errorf("chain: device %s: %w", d.Name(), err)
+		}
+	}
+	d.Package = name
+	return nil
+}
+
+// DifferentialPairs returns the PORT_GROUPING twin groups with both legs
+// translated to package pin names (matching IOPins).
+func (d *Device) DifferentialPairs() ([]bsdl.DifferentialPair, error) {
+	if d.File == nil || d.File.Entity == nil {
+		return nil, nil
+	}
+	pairs, err := d.File.Entity.GetDifferentialPairs()
+	if err != nil || len(pairs) == 0 {
+		return nil, err
+	}
+
+	pinMap := d.PinMap()
+	packagePin := func(port string) string {
+		if pin, ok := pinMap[port]; ok {
+			return pin
+		}
+		return port
+	}
+	for i := range pairs {
+		pairs[i].Positive = packagePin(pairs[i].Positive)
+		pairs[i].Negative = packagePin(pairs[i].Negative)
+	}
+	return pairs, nil
+}
+
 // ExtestOpcode returns the EXTEST instruction bits for this device.
 func (d *Device) ExtestOpcode() ([]bool, error) {
 	return d.instructionBits("EXTEST")
@@ -108,6 +268,16 @@ func (d *Device) BypassOpcode() ([]bool, error) {
 	return d.instructionBits("BYPASS")
 }
 
+// HasInstruction reports whether the device's instruction table defines name.
+func (d *Device) HasInstruction(name string) bool {
+	for _, instr := range d.Instructions() {
+		if strings.EqualFold(instr.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
 // IOPins returns a list of IO pin names (package pins) for this device.
 // This excludes power pins (VCC, GND), NC (no connect), and internal pins.
 func (d *Device) IOPins() ([]string, error) {
@@ -168,10 +338,13 @@ func (d *Device) boundaryData() ([]bsdl.BoundaryCell, error) {
 		return nil, fmt.Errorf("chain: device %s missing BSDL data", d.Name())
 	}
 	d.boundaryOnce.Do(func() {
-		cells, err := d.File.Entity.GetBoundaryCells()
-		if err != nil {
-			d.boundaryErr = err
-			return
+		cells := d.presetCells
+		if cells == nil {
+			var err error
+			if cells, err = d.File.Entity.GetBoundaryCells(); err != nil {
+				d.boundaryErr = err
+				return
+			}
 		}
 		d.boundaryCells = cells
 		d.cellByNumber = make(map[int]*bsdl.BoundaryCell, len(cells))
@@ -291,6 +464,14 @@ func (d *Device) instructionBits(name string) ([]bool, error) {
 			return opcodeToBits(instr.Opcode, d.Info.InstructionLength)
 		}
 	}
+	// IEEE 1149.1 reserves all ones for BYPASS, so it needs no BSDL entry
+	if wanted == "BYPASS" && d.Info.InstructionLength > 0 {
+		bits := make([]bool, d.Info.InstructionLength)
+		for i := range bits {
+			bits[i] = true
+		}
+		return bits, nil
+	}
 	return nil, fmt.Errorf("chain: instruction %s not found on %s", name, d.Name())
 }
 
@@ -326,33 +507,116 @@ func (c *Controller) Discover(deviceCount int) (*Chain, error) {
 	}
 
 	devices := make([]*Device, 0, deviceCount)
+	var unknown []*Device
 	for idx, id := range ids {
 		file, err := c.repo.Lookup(id)
+		if errors.Is(err, ErrNoBSDL) || (err == nil && file == nil) {
+			dev := &Device{Position: idx, IDCode: id, Info: &bsdl.DeviceInfo{}}
+			devices = append(devices, dev)
+			unknown = append(unknown, dev)
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
 		var info *bsdl.DeviceInfo
-		if mr, ok := c.repo.(*MemoryRepository); ok {
-			info = mr.DeviceInfo(id)
+		if src, ok := c.repo.(deviceInfoSource); ok {
+			info = src.DeviceInfo(id)
 		}
 		if info == nil && file != nil && file.Entity != nil {
 			info = file.Entity.GetDeviceInfo()
 		}
+		var cells []bsdl.BoundaryCell
+		if src, ok := c.repo.(boundarySource); ok {
+			cells = src.BoundaryCells(id)
+		}
 
 		devices = append(devices, &Device{
-			Position: idx,
-			IDCode:   id,
-			File:     file,
-			Info:     info,
+			Position:    idx,
+			IDCode:      id,
+			File:        file,
+			Info:        info,
+			presetCells: cells,
 		})
 	}
 
+	if len(unknown) > 0 {
+		if err := c.resolveIRLengths(xport, devices, unknown); err != nil {
+			return nil, err
+		}
+	}
+
 	return &Chain{
 		devices: devices,
 		xport:   xport,
 	}, nil
 }
 
+// resolveIRLengths fills in the IR length of devices without BSDL from, in
+// order of preference, SetIRLength, the IDCODE device database and finally
+// measurement: the measured total IR length minus every known length gives
+// the length of a single remaining unknown device.
+func (c *Controller) resolveIRLengths(xport *transport, devices, unknown []*Device) error {
+	var unresolved []*Device
+	for _, dev := range unknown {
+		if bits, ok := c.irLengths[dev.Position]; ok && bits > 0 {
+			dev.Info.InstructionLength = bits
+		} else if bits := deviceinfo.Lookup(dev.IDCode).IRLength; bits > 0 {
+			dev.Info.InstructionLength = bits
+		} else {
+			unresolved = append(unresolved, dev)
+		}
+	}
+	if len(unresolved) == 0 {
+		return nil
+	}
+	if len(unresolved) > 1 {
+		var names []string
+		for _, dev := range unresolved {
+			names = append(names, fmt.Sprintf("%d (0x%08X)", dev.Position, dev.IDCode))
+		}
+		return fmt.Errorf("chain: IR length unknown for devices without BSDL at positions %s; set it for all but one of them",
+			strings.Join(names, ", "))
+	}
+
+	known := 0
+	for _, dev := range devices {
+		known += dev.Info.InstructionLength
+	}
+	const maxIRBits = 1024
+	total, _, err := xport.measureIRLength(maxIRBits)
+	if err != nil {
+		return err
+	}
+	// Measuring left the IR in BYPASS; return to the post-reset state
+	if err := xport.gotoState(tap.StateTestLogicReset); err != nil {
+		return err
+	}
+	if err := xport.gotoState(tap.StateRunTestIdle); err != nil {
+		return err
+	}
+
+	dev := unresolved[0]
+	if total == maxIRBits || total-known < 2 {
+		return fmt.Errorf("chain: cannot measure IR length of device %d (0x%08X): chain IR totals %d bits, %d known",
+			dev.Position, dev.IDCode, total, known)
+	}
+	dev.Info.InstructionLength = total - known
+	return nil
+}
+
+// deviceInfoSource is implemented by repositories that keep pre-extracted
+// DeviceInfo (MemoryRepository, IndexedRepository).
+type deviceInfoSource interface {
+	DeviceInfo(id uint32) *bsdl.DeviceInfo
+}
+
+// boundarySource is implemented by repositories that keep pre-extracted
+// boundary cells (IndexedRepository).
+type boundarySource interface {
+	BoundaryCells(id uint32) []bsdl.BoundaryCell
+}
+
 type session struct {
 	transport *transport
 	repo      Repository
@@ -369,14 +633,17 @@ func (s *session) readIDCodes(deviceCount int) ([]uint32, error) {
 		tms[bits-1] = true // exit Shift-DR after final bit
 	}
 
-	tdo, err := s.transport.shiftDR(tms, nil)
+	pending, err := s.transport.shiftDR(tms, nil)
 	if err != nil {
 		return nil, err
 	}
-
 	if err := s.transport.gotoState(tap.StateRunTestIdle); err != nil {
 		return nil, err
 	}
+	tdo, err := pending.TDO()
+	if err != nil {
+		return nil, err
+	}
 
 	bitsOut := bytesToBools(tdo, bits)
 	out := make([]uint32, deviceCount)
@@ -419,27 +686,30 @@ func (t *transport) applySequence(seq tap.Sequence, domain shiftDomain) error {
 	if len(seq.TMS) == 0 {
 		return nil
 	}
-	_, err := t.dispatch(domain, seq.TMS, nil)
+	// Pure state moves capture nothing; failures surface on the next read
+	_, err := t.queue(domain, seq.TMS, nil)
 	return err
 }
 
-func (t *transport) shiftDR(tms, tdi []bool) ([]byte, error) {
+func (t *transport) shiftDR(tms, tdi []bool) (*jtag.PendingTDO, error) {
 	for _, bit := range tms {
 		t.tap.Clock(bit)
 	}
-	return t.dispatch(domainDR, tms, tdi)
+	return t.queue(domainDR, tms, tdi)
 }
 
-func (t *transport) shiftIR(tms, tdi []bool) ([]byte, error) {
+func (t *transport) shiftIR(tms, tdi []bool) (*jtag.PendingTDO, error) {
 	for _, bit := range tms {
 		t.tap.Clock(bit)
 	}
-	return t.dispatch(domainIR, tms, tdi)
+	return t.queue(domainIR, tms, tdi)
 }
 
-func (t *transport) dispatch(domain shiftDomain, tms []bool, tdi []bool) ([]byte, error) {
+// queue hands a shift to the adapter, deferring it when the adapter supports
+// queuing and executing it immediately otherwise.
+func (t *transport) queue(domain shiftDomain, tms []bool, tdi []bool) (*jtag.PendingTDO, error) {
 	if len(tms) == 0 {
-		return nil, nil
+		return jtag.ResolvedTDO(nil, nil), nil
 	}
 	bits := len(tms)
 	tmsBytes := boolsToBytes(tms)
@@ -449,12 +719,34 @@ func (t *transport) dispatch(domain shiftDomain, tms []bool, tdi []bool) ([]byte
 	} else {
 		tdiBytes = boolsToBytes(tdi)
 	}
+
+	if queued, ok := t.adapter.(jtag.QueuedAdapter); ok {
+		if domain == domainIR {
+			return queued.QueueShiftIR(tmsBytes, tdiBytes, bits)
+		}
+		return queued.QueueShiftDR(tmsBytes, tdiBytes, bits)
+	}
+
+	var tdo []byte
+	var err error
 	switch domain {
 	case domainIR:
-		return t.adapter.ShiftIR(tmsBytes, tdiBytes, bits)
+		tdo, err = t.adapter.ShiftIR(tmsBytes, tdiBytes, bits)
 	default:
-		return t.adapter.ShiftDR(tmsBytes, tdiBytes, bits)
+		tdo, err = t.adapter.ShiftDR(tmsBytes, tdiBytes, bits)
 	}
+	if err != nil {
+		return nil, err
+	}
+	return jtag.ResolvedTDO(tdo, nil), nil
+}
+
+// flush executes everything the adapter has queued.
+func (t *transport) flush() error {
+	if queued, ok := t.adapter.(jtag.QueuedAdapter); ok {
+		return queued.Flush()
+	}
+	return nil
 }
 
 type shiftDomain uint8
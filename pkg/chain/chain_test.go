@@ -350,3 +350,90 @@ end DEV;
 		t.Fatalf("expected control capture bit high")
 	}
 }
+
+func TestDevicePackageOverride(t *testing.T) {
+	parser, err := bsdl.NewParser()
+	if err != nil {
+		t.Fatalf("parser init failed: %v", err)
+	}
+	file, err := parser.ParseString(`
+entity MULTI is
+	generic (PHYSICAL_PIN_MAP : string := "PKG_B");
+	constant PKG_A : PIN_MAP_STRING := "IO0 : 1";
+	constant PKG_B : PIN_MAP_STRING := "IO0 : A7";
+end MULTI;
+`)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	dev := &Device{File: file}
+	ch := &Chain{devices: []*Device{dev}}
+
+	if dev.PackageName() != "PKG_B" || dev.PinMap()["IO0"] != "A7" {
+		t.Fatalf("default package not applied: %s %v", dev.PackageName(), dev.PinMap())
+	}
+
+	if err := ch.SetPackages([]string{"0=PKG_A"}); err != nil {
+		t.Fatalf("SetPackages failed: %v", err)
+	}
+	if dev.PackageName() != "PKG_A" || dev.PinMap()["IO0"] != "1" {
+		t.Fatalf("override not applied: %s %v", dev.PackageName(), dev.PinMap())
+	}
+
+	if err := ch.SetPackages([]string{"pkg_b"}); err != nil {
+		t.Fatalf("SetPackages by name failed: %v", err)
+	}
+	if dev.PinMap()["IO0"] != "A7" {
+		t.Fatalf("name override not applied: %v", dev.PinMap())
+	}
+
+	if err := dev.SetPackage("TQFP"); err == nil {
+		t.Errorf("expected error for unknown package")
+	}
+	if err := ch.SetPackages([]string{"5=PKG_A"}); err == nil {
+		t.Errorf("expected error for out-of-range index")
+	}
+}
+
+func TestQueueDRBitsBatchesScans(t *testing.T) {
+	fake := jtag.NewFakeDAPTransport()
+	adapter, err := jtag.NewCMSISDAPAdapterWithTransport(fake)
+	if err != nil {
+		t.Fatalf("adapter init failed: %v", err)
+	}
+	c := &Chain{xport: newTransport(adapter)}
+	before := len(fake.Commands())
+
+	// The fake loops TDI back to TDO
+	var pending []*PendingBits
+	var patterns [][]bool
+	for i := 0; i < 8; i++ {
+		bits := make([]bool, 12)
+		for j := range bits {
+			bits[j] = (i+j)%3 == 0
+		}
+		p, err := c.QueueDRBits(bits)
+		if err != nil {
+			t.Fatalf("QueueDRBits failed: %v", err)
+		}
+		pending = append(pending, p)
+		patterns = append(patterns, bits)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	for i, p := range pending {
+		got, err := p.Bits()
+		if err != nil {
+			t.Fatalf("Bits(%d) failed: %v", i, err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(patterns[i]) {
+			t.Fatalf("scan %d = %v, want %v", i, got, patterns[i])
+		}
+	}
+	if sent := len(fake.Commands()) - before; sent > 2 {
+		t.Fatalf("8 scans took %d packets, want them batched", sent)
+	}
+}
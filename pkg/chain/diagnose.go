@@ -0,0 +1,447 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/tap"
+)
+
+// DiagnoseOptions tunes Controller.Diagnose. Zero values select defaults.
+type DiagnoseOptions struct {
+	MaxDevices int   // Longest chain the length measurement can see (default 32)
+	MaxIRBits  int   // Longest total IR the length measurement can see (default 1024)
+	Speeds     []int // TCK frequencies to sweep in Hz; empty skips the sweep
+	Passes     int   // Random patterns shifted through per speed (default 4)
+	// RestoreHz is the speed set after the sweep. Zero leaves the adapter at
+	// the fastest reliable speed found.
+	RestoreHz int
+}
+
+// TDOStatus describes what the TDO line did during diagnosis.
+type TDOStatus string
+
+const (
+	TDOActive    TDOStatus = "active"
+	TDOStuckLow  TDOStatus = "stuck low"
+	TDOStuckHigh TDOStatus = "stuck high"
+)
+
+// IRCaptureCheck compares the value a device loaded in Capture-IR with the
+// INSTRUCTION_CAPTURE pattern of its BSDL. Both strings are MSB first.
+type IRCaptureCheck struct {
+	Position int
+	Device   string
+	Expected string
+	Captured string
+	OK       bool
+}
+
+// SpeedResult is the shift-through outcome at one TCK frequency.
+type SpeedResult struct {
+	Hz     int
+	Passes int
+	Errors int
+}
+
+// Diagnosis is the result of Controller.Diagnose. Problems lists everything
+// that looked wrong, in plain language; it is empty for a healthy chain.
+type Diagnosis struct {
+	TDO         TDOStatus
+	IRLength    int // Sum of all IR lengths, measured
+	DeviceCount int // Devices in BYPASS, measured
+	PatternOK   bool
+	IDCodes     []uint32 // Per device; 0 when the device has no IDCODE register
+	IRCapture   []IRCaptureCheck
+	Speeds      []SpeedResult
+	MaxSpeedHz  int
+	Problems    []string
+}
+
+// OK reports whether the chain passed every check.
+func (d *Diagnosis) OK() bool {
+	return len(d.Problems) == 0
+}
+
+func (d *Diagnosis) problem(format string, args ...interface{}) {
+	d.Problems = append(d.Problems, fmt.Sprintf(format, args...))
+}
+
+// Diagnose checks the chain's integrity without relying on the expected
+// device count or on IDCODEs being valid, for bringing up a new board or
+// working out why Discover fails. It looks for a stuck TDO, measures the
+// total IR length and the number of devices from BYPASS shift-throughs,
+// verifies a random pattern survives the chain, reads the IDCODEs, compares
+// each device's IR capture with its BSDL when the repository knows it, and
+// optionally sweeps TCK to find the fastest reliable speed.
+//
+// Only IR scans that end in BYPASS and DR scans in BYPASS or IDCODE are
+// used, so pins are never driven. Diagnose returns an error only when the
+// adapter itself fails; chain faults are reported in Diagnosis.Problems.
+func (c *Controller) Diagnose(opts DiagnoseOptions) (*Diagnosis, error) {
+	if c.adapter == nil {
+		return nil, fmt.Errorf("chain: adapter is nil")
+	}
+	if opts.MaxDevices <= 0 {
+		opts.MaxDevices = 32
+	}
+	if opts.MaxIRBits <= 0 {
+		opts.MaxIRBits = 1024
+	}
+	if opts.Passes <= 0 {
+		opts.Passes = 4
+	}
+
+	d := &diagnoser{xport: newTransport(c.adapter), rng: rand.New(rand.NewSource(1))}
+	report := &Diagnosis{TDO: TDOActive}
+
+	if err := d.xport.reset(); err != nil {
+		return nil, err
+	}
+
+	// Measuring the IR length leaves every device in BYPASS
+	irLength, irOut, err := d.xport.measureIRLength(opts.MaxIRBits)
+	if err != nil {
+		return nil, err
+	}
+	report.IRLength = irLength
+
+	// In BYPASS every device is one zero-capturing bit, so a one shifted in
+	// after a run of zeros shows up delayed by the number of devices
+	drScan := make([]bool, 2*opts.MaxDevices)
+	for i := opts.MaxDevices; i < len(drScan); i++ {
+		drScan[i] = true
+	}
+	drOut, err := d.xport.scan(domainDR, drScan)
+	if err != nil {
+		return nil, err
+	}
+	report.DeviceCount = countLeading(drOut[opts.MaxDevices:], false)
+
+	switch all := append(append([]bool(nil), irOut...), drOut...); {
+	case countLeading(all, false) == len(all):
+		report.TDO = TDOStuckLow
+		report.problem("TDO is stuck low: check TDO wiring, target power and that no device holds TDO in reset")
+	case countLeading(all, true) == len(all):
+		report.TDO = TDOStuckHigh
+		report.problem("TDO is stuck high: TDO is probably floating or pulled up; check wiring and target power")
+	}
+	if report.TDO != TDOActive {
+		return report, nil
+	}
+
+	switch {
+	case report.IRLength == opts.MaxIRBits:
+		report.problem("IR length not measurable within %d bits: the chain is broken or longer than expected", opts.MaxIRBits)
+	case report.IRLength < 2:
+		report.problem("total IR length is %d; every TAP has at least 2 IR bits", report.IRLength)
+	}
+	switch {
+	case report.DeviceCount == opts.MaxDevices:
+		report.problem("device count not measurable within %d devices: the chain is broken or longer than expected", opts.MaxDevices)
+	case report.DeviceCount == 0:
+		report.problem("no devices in BYPASS: TDI may be connected straight to TDO")
+	}
+	if !report.OK() {
+		return report, nil
+	}
+
+	ok, err := d.shiftThrough(report.DeviceCount, opts.Passes)
+	if err != nil {
+		return nil, err
+	}
+	report.PatternOK = ok
+	if !ok {
+		report.problem("random patterns are corrupted passing through %d device(s): suspect signal integrity or TCK speed", report.DeviceCount)
+	}
+
+	if report.IDCodes, err = d.readIDCodes(report.DeviceCount); err != nil {
+		return nil, err
+	}
+	for i, id := range report.IDCodes {
+		if id != 0 && (id&1 == 0 || id == 0xFFFFFFFF) {
+			report.problem("device %d IDCODE 0x%08X is invalid", i, id)
+		}
+	}
+
+	c.checkIRCapture(report, irOut[:report.IRLength])
+
+	if len(opts.Speeds) > 0 {
+		if err := d.sweep(report, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// Leave the chain in Test-Logic-Reset, as Discover would
+	if err := d.xport.reset(); err != nil {
+		return nil, err
+	}
+	return report, d.xport.flush()
+}
+
+// checkIRCapture splits the captured IR bits by each device's BSDL IR
+// length. It only runs when every device has a BSDL and the lengths add up
+// to the measured total, since otherwise the split is guesswork.
+func (c *Controller) checkIRCapture(report *Diagnosis, captured []bool) {
+	if c.repo == nil {
+		return
+	}
+	infos := make([]*bsdl.DeviceInfo, len(report.IDCodes))
+	names := make([]string, len(report.IDCodes))
+	total := 0
+	for i, id := range report.IDCodes {
+		if id == 0 {
+			return
+		}
+		file, err := c.repo.Lookup(id)
+		if err != nil || file == nil || file.Entity == nil {
+			return
+		}
+		var info *bsdl.DeviceInfo
+		if src, ok := c.repo.(deviceInfoSource); ok {
+			info = src.DeviceInfo(id)
+		}
+		if info == nil {
+			info = file.Entity.GetDeviceInfo()
+		}
+		infos[i], names[i] = info, file.Entity.Name
+		total += info.InstructionLength
+	}
+	if total != report.IRLength {
+		report.problem("BSDL IR lengths add up to %d bits but the chain measures %d", total, report.IRLength)
+		return
+	}
+
+	offset := 0
+	for i, info := range infos {
+		bits := captured[offset : offset+info.InstructionLength]
+		offset += info.InstructionLength
+
+		check := IRCaptureCheck{
+			Position: i,
+			Device:   names[i],
+			Expected: cleanCapturePattern(info.InstructionCapture),
+			Captured: bitsMSBFirst(bits),
+		}
+		if check.Expected == "" {
+			// IEEE 1149.1 requires the two LSBs to capture 01
+			check.Expected = strings.Repeat("X", len(bits)-2) + "01"
+		}
+		check.OK = matchCapture(check.Expected, check.Captured)
+		if !check.OK {
+			report.problem("device %d (%s) captured IR %s, BSDL expects %s",
+				i, check.Device, check.Captured, check.Expected)
+		}
+		report.IRCapture = append(report.IRCapture, check)
+	}
+}
+
+// sweep shifts random patterns through the chain at each speed, slowest
+// first. The fastest reliable speed is the last one before the first failure.
+func (d *diagnoser) sweep(report *Diagnosis, opts DiagnoseOptions) error {
+	speeds := append([]int(nil), opts.Speeds...)
+	sort.Ints(speeds)
+
+	// Reading the IDCODEs reset the chain; load BYPASS again so every
+	// device is the single bit shiftThrough expects
+	if _, err := d.xport.scan(domainIR, ones(report.IRLength)); err != nil {
+		return err
+	}
+
+	failed := false
+	for _, hz := range speeds {
+		if err := d.xport.flush(); err != nil {
+			return err
+		}
+		if err := d.xport.adapter.SetSpeed(hz); err != nil {
+			if errors.Is(err, jtag.ErrNotImplemented) {
+				report.problem("adapter cannot change TCK speed; sweep skipped")
+				return nil
+			}
+			return fmt.Errorf("chain: set speed %d Hz: %w", hz, err)
+		}
+		result := SpeedResult{Hz: hz}
+		for pass := 0; pass < opts.Passes; pass++ {
+			ok, err := d.shiftThrough(report.DeviceCount, 1)
+			if err != nil {
+				return err
+			}
+			result.Passes++
+			if !ok {
+				result.Errors++
+			}
+		}
+		report.Speeds = append(report.Speeds, result)
+		if result.Errors > 0 {
+			failed = true
+		} else if !failed {
+			report.MaxSpeedHz = hz
+		}
+	}
+	if report.MaxSpeedHz == 0 {
+		report.problem("no swept TCK speed is reliable")
+	}
+
+	restore := opts.RestoreHz
+	if restore == 0 {
+		restore = report.MaxSpeedHz
+	}
+	if restore > 0 {
+		if err := d.xport.flush(); err != nil {
+			return err
+		}
+		return d.xport.adapter.SetSpeed(restore)
+	}
+	return nil
+}
+
+type diagnoser struct {
+	xport *transport
+	rng   *rand.Rand
+}
+
+// shiftThrough sends random 64-bit patterns through a chain of devices in
+// BYPASS and checks each arrives intact, delayed by one bit per device.
+func (d *diagnoser) shiftThrough(devices, passes int) (bool, error) {
+	for pass := 0; pass < passes; pass++ {
+		pattern := make([]bool, 64)
+		for i := range pattern {
+			pattern[i] = d.rng.Intn(2) == 1
+		}
+		tdo, err := d.xport.scan(domainDR, append(append([]bool(nil), pattern...), make([]bool, devices)...))
+		if err != nil {
+			return false, err
+		}
+		for i, bit := range pattern {
+			if tdo[devices+i] != bit {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// readIDCodes resets the chain and reads the IDCODE or BYPASS register each
+// device selects after reset: a leading 1 marks a 32-bit IDCODE, a 0 a
+// one-bit BYPASS register.
+func (d *diagnoser) readIDCodes(devices int) ([]uint32, error) {
+	if err := d.xport.reset(); err != nil {
+		return nil, err
+	}
+	tdo, err := d.xport.scan(domainDR, make([]bool, devices*32))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint32, devices)
+	pos := 0
+	for i := range ids {
+		if pos >= len(tdo) || !tdo[pos] {
+			pos++
+			continue
+		}
+		ids[i] = bitsToUint32(tdo[pos : pos+32])
+		pos += 32
+	}
+	return ids, nil
+}
+
+// scan shifts tdi through the IR or DR from Run-Test/Idle and back, and
+// returns the captured TDO.
+func (t *transport) scan(domain shiftDomain, tdi []bool) ([]bool, error) {
+	shift, state := t.shiftDR, tap.StateShiftDR
+	if domain == domainIR {
+		shift, state = t.shiftIR, tap.StateShiftIR
+	}
+	if err := t.gotoState(state); err != nil {
+		return nil, err
+	}
+	pending, err := shift(shiftPattern(len(tdi)), tdi)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.gotoState(tap.StateRunTestIdle); err != nil {
+		return nil, err
+	}
+	tdo, err := pending.TDO()
+	if err != nil {
+		return nil, err
+	}
+	return bytesToBools(tdo, len(tdi)), nil
+}
+
+// measureIRLength fills the IR with zeros and then ones: the ones reach TDO
+// after exactly the total IR length of the chain, and every device is left
+// with all ones, which is BYPASS. It returns the length and the bits the
+// devices captured, which lead the TDO stream. A length of maxBits means
+// none of the ones came back.
+func (t *transport) measureIRLength(maxBits int) (int, []bool, error) {
+	tdi := make([]bool, 2*maxBits)
+	for i := maxBits; i < len(tdi); i++ {
+		tdi[i] = true
+	}
+	tdo, err := t.scan(domainIR, tdi)
+	if err != nil {
+		return 0, nil, err
+	}
+	length := countLeading(tdo[maxBits:], false)
+	return length, tdo, nil
+}
+
+func ones(n int) []bool {
+	bits := make([]bool, n)
+	for i := range bits {
+		bits[i] = true
+	}
+	return bits
+}
+
+func countLeading(bits []bool, value bool) int {
+	for i, bit := range bits {
+		if bit != value {
+			return i
+		}
+	}
+	return len(bits)
+}
+
+func bitsMSBFirst(bits []bool) string {
+	var b strings.Builder
+	for i := len(bits) - 1; i >= 0; i-- {
+		if bits[i] {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	return b.String()
+}
+
+func cleanCapturePattern(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		switch r {
+		case '0', '1', 'X':
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// matchCapture compares an MSB-first capture against a pattern where X
+// matches either level.
+func matchCapture(pattern, captured string) bool {
+	if len(pattern) != len(captured) {
+		return false
+	}
+	for i := range pattern {
+		if pattern[i] != 'X' && pattern[i] != captured[i] {
+			return false
+		}
+	}
+	return true
+}
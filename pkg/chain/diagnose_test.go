@@ -0,0 +1,292 @@
+package chain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/tap"
+)
+
+// tapDevice is one TAP of tapChain. With IDCode zero the device has no
+// IDCODE register and selects BYPASS after reset.
+type tapDevice struct {
+	irLength  int
+	irCapture []bool // LSB first
+	idcode    uint32
+
+	ir       []bool // Shift stage
+	selected string // "IDCODE" or "BYPASS"
+	dr       []bool // Shift stage of the selected register
+}
+
+// tapChain clocks every TMS bit through a TAP state machine and shifts
+// devices' registers bit by bit, so it behaves like real hardware for any
+// mix of state moves and scans. Device 0 sits nearest TDO.
+type tapChain struct {
+	devices []*tapDevice
+	fsm     *tap.StateMachine
+
+	stuck    *bool // TDO level, when stuck
+	maxSpeed int   // Above this TCK, every 7th TDO bit is corrupted
+	speed    func() int
+}
+
+func (c *tapChain) shift(region jtag.ShiftRegion, tms, tdi []byte, bits int) ([]byte, error) {
+	tmsBits := bytesToBools(tms, bits)
+	tdiBits := bytesToBools(tdi, bits)
+	out := make([]bool, bits)
+	for i := 0; i < bits; i++ {
+		switch c.fsm.State() {
+		case tap.StateCaptureIR:
+			for _, d := range c.devices {
+				d.ir = append([]bool(nil), d.irCapture...)
+			}
+		case tap.StateCaptureDR:
+			for _, d := range c.devices {
+				if d.selected == "IDCODE" {
+					d.dr = bytesToBools([]byte{byte(d.idcode), byte(d.idcode >> 8), byte(d.idcode >> 16), byte(d.idcode >> 24)}, 32)
+				} else {
+					d.dr = []bool{false}
+				}
+			}
+		case tap.StateShiftIR, tap.StateShiftDR:
+			out[i] = c.shiftBit(c.fsm.State() == tap.StateShiftIR, tdiBits[i])
+			if c.maxSpeed > 0 && c.speed() > c.maxSpeed && i%7 == 6 {
+				out[i] = !out[i]
+			}
+		case tap.StateUpdateIR:
+			for _, d := range c.devices {
+				d.selected = "BYPASS"
+				if d.idcode != 0 && !strings.Contains(bitsMSBFirst(d.ir), "1") {
+					d.selected = "IDCODE" // All zeros is IDCODE in this model
+				}
+			}
+		}
+		if c.fsm.Clock(tmsBits[i]) == tap.StateTestLogicReset {
+			for _, d := range c.devices {
+				d.selected = "BYPASS"
+				if d.idcode != 0 {
+					d.selected = "IDCODE"
+				}
+			}
+		}
+		if c.stuck != nil {
+			out[i] = *c.stuck
+		}
+	}
+	return boolsToBytes(out), nil
+}
+
+// shiftBit moves every register of the chain one bit toward TDO.
+func (c *tapChain) shiftBit(ir bool, tdi bool) bool {
+	reg := func(d *tapDevice) *[]bool {
+		if ir {
+			return &d.ir
+		}
+		return &d.dr
+	}
+	tdo := (*reg(c.devices[0]))[0]
+	for i, d := range c.devices {
+		r := reg(d)
+		in := tdi
+		if i+1 < len(c.devices) {
+			in = (*reg(c.devices[i+1]))[0]
+		}
+		*r = append((*r)[1:], in)
+	}
+	return tdo
+}
+
+func newTapChain(devices ...*tapDevice) (*tapChain, *jtag.SimAdapter) {
+	sim := jtag.NewSimAdapter(jtag.AdapterInfo{Name: "sim"})
+	c := &tapChain{devices: devices, fsm: tap.NewStateMachine(), speed: func() int { return sim.SpeedHz }}
+	for _, d := range devices {
+		d.ir = make([]bool, d.irLength)
+		d.dr = []bool{false}
+	}
+	sim.OnShift = c.shift
+	return c, sim
+}
+
+func diagnoseTestRepo(t *testing.T) *MemoryRepository {
+	t.Helper()
+	parser, err := bsdl.NewParser()
+	if err != nil {
+		t.Fatalf("parser init failed: %v", err)
+	}
+	file, err := parser.ParseString(`
+entity CPLD is
+	attribute INSTRUCTION_LENGTH of CPLD : entity is 6;
+	attribute INSTRUCTION_OPCODE of CPLD : entity is
+		"BYPASS (111111)," &
+		"IDCODE (000000)";
+	attribute INSTRUCTION_CAPTURE of CPLD : entity is "0X0001";
+	attribute IDCODE_REGISTER of CPLD : entity is "00000000000000000001000000000011";
+end CPLD;
+`)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	repo := NewMemoryRepository()
+	if _, _, err := repo.AddFile(file); err != nil {
+		t.Fatalf("AddFile failed: %v", err)
+	}
+	return repo
+}
+
+func TestDiagnoseHealthyChain(t *testing.T) {
+	// A CPLD (6-bit IR) nearest TDO and a 4-bit TAP without IDCODE or BSDL
+	cpld := &tapDevice{irLength: 6, irCapture: []bool{true, false, false, false, true, false}, idcode: 0x00001003}
+	bare := &tapDevice{irLength: 4, irCapture: []bool{true, false, false, false}}
+	_, sim := newTapChain(cpld, bare)
+
+	report, err := NewController(sim, diagnoseTestRepo(t)).Diagnose(DiagnoseOptions{})
+	if err != nil {
+		t.Fatalf("Diagnose failed: %v", err)
+	}
+	if report.TDO != TDOActive || report.IRLength != 10 || report.DeviceCount != 2 || !report.PatternOK {
+		t.Fatalf("report = %+v", report)
+	}
+	if len(report.IDCodes) != 2 || report.IDCodes[0] != 0x00001003 || report.IDCodes[1] != 0 {
+		t.Fatalf("IDCodes = %08X", report.IDCodes)
+	}
+	// The BSDL-less device leaves the IR split unknown, so nothing is compared
+	if len(report.IRCapture) != 0 || !report.OK() {
+		t.Fatalf("IRCapture = %+v, problems = %v", report.IRCapture, report.Problems)
+	}
+}
+
+func TestDiagnoseIRCapture(t *testing.T) {
+	good := &tapDevice{irLength: 6, irCapture: []bool{true, false, false, false, true, false}, idcode: 0x00001003}
+	bad := &tapDevice{irLength: 6, irCapture: []bool{true, false, true, false, false, false}, idcode: 0x00001003}
+	_, sim := newTapChain(good, bad)
+
+	report, err := NewController(sim, diagnoseTestRepo(t)).Diagnose(DiagnoseOptions{})
+	if err != nil {
+		t.Fatalf("Diagnose failed: %v", err)
+	}
+	if len(report.IRCapture) != 2 {
+		t.Fatalf("IRCapture = %+v", report.IRCapture)
+	}
+	if !report.IRCapture[0].OK || report.IRCapture[1].OK {
+		t.Fatalf("IRCapture = %+v", report.IRCapture)
+	}
+	if report.IRCapture[1].Captured != "000101" || report.IRCapture[1].Expected != "0X0001" {
+		t.Fatalf("device 1 capture = %+v", report.IRCapture[1])
+	}
+	if len(report.Problems) != 1 {
+		t.Fatalf("problems = %v", report.Problems)
+	}
+}
+
+func TestDiagnoseStuckTDO(t *testing.T) {
+	for _, level := range []bool{false, true} {
+		chain, sim := newTapChain(&tapDevice{irLength: 4, irCapture: []bool{true, false, false, false}})
+		chain.stuck = &level
+
+		report, err := NewController(sim, nil).Diagnose(DiagnoseOptions{})
+		if err != nil {
+			t.Fatalf("Diagnose failed: %v", err)
+		}
+		want := TDOStuckLow
+		if level {
+			want = TDOStuckHigh
+		}
+		if report.TDO != want || report.OK() {
+			t.Fatalf("stuck %v: TDO = %s, problems = %v", level, report.TDO, report.Problems)
+		}
+	}
+}
+
+func TestDiagnoseSpeedSweep(t *testing.T) {
+	chain, sim := newTapChain(&tapDevice{irLength: 4, irCapture: []bool{true, false, false, false}})
+	chain.maxSpeed = 4_000_000
+
+	report, err := NewController(sim, nil).Diagnose(DiagnoseOptions{
+		Speeds: []int{8_000_000, 1_000_000, 4_000_000, 2_000_000},
+	})
+	if err != nil {
+		t.Fatalf("Diagnose failed: %v", err)
+	}
+	if report.MaxSpeedHz != 4_000_000 || len(report.Speeds) != 4 {
+		t.Fatalf("MaxSpeedHz = %d, speeds = %+v", report.MaxSpeedHz, report.Speeds)
+	}
+	if last := report.Speeds[3]; last.Hz != 8_000_000 || last.Errors == 0 {
+		t.Fatalf("8MHz result = %+v", last)
+	}
+	if sim.SpeedHz != 4_000_000 {
+		t.Fatalf("adapter left at %d Hz, want the fastest reliable speed", sim.SpeedHz)
+	}
+}
+
+func TestDiagnoseSpeedSweepWithIDCode(t *testing.T) {
+	// After reset a device with an IDCODE selects it instead of BYPASS; the
+	// sweep must not mistake that for corruption
+	chain, sim := newTapChain(
+		&tapDevice{irLength: 6, irCapture: []bool{true, false, false, false, true, false}, idcode: 0x00001003},
+		&tapDevice{irLength: 4, irCapture: []bool{true, false, false, false}, idcode: 0x0BADC0DF},
+	)
+	chain.maxSpeed = 2_000_000
+
+	report, err := NewController(sim, nil).Diagnose(DiagnoseOptions{
+		Speeds: []int{1_000_000, 2_000_000, 4_000_000},
+	})
+	if err != nil {
+		t.Fatalf("Diagnose failed: %v", err)
+	}
+	if report.MaxSpeedHz != 2_000_000 {
+		t.Fatalf("MaxSpeedHz = %d, speeds = %+v, problems = %v", report.MaxSpeedHz, report.Speeds, report.Problems)
+	}
+	if report.Speeds[0].Errors != 0 || report.Speeds[2].Errors == 0 {
+		t.Fatalf("speeds = %+v", report.Speeds)
+	}
+}
+
+func TestDiscoverUnknownDevice(t *testing.T) {
+	cpld := &tapDevice{irLength: 6, irCapture: []bool{true, false, false, false, true, false}, idcode: 0x00001003}
+	mystery := &tapDevice{irLength: 5, irCapture: []bool{true, false, false, false, false}, idcode: 0x0BADC0DF}
+	_, sim := newTapChain(mystery, cpld)
+
+	ch, err := NewController(sim, diagnoseTestRepo(t)).Discover(2)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	unknown, known := ch.Devices()[0], ch.Devices()[1]
+	if unknown.HasBSDL() || !known.HasBSDL() {
+		t.Fatalf("HasBSDL = %v, %v", unknown.HasBSDL(), known.HasBSDL())
+	}
+	if unknown.Info.InstructionLength != 5 || unknown.Name() != "UNKNOWN_0" {
+		t.Fatalf("placeholder %s has IR length %d, want measured 5", unknown.Name(), unknown.Info.InstructionLength)
+	}
+
+	// The placeholder pads the IR with all ones around the known device
+	if _, err := ch.ScanDevice(known, "IDCODE", make([]bool, 32)); err != nil {
+		t.Fatalf("ScanDevice failed: %v", err)
+	}
+	if bitsMSBFirst(mystery.ir) != "11111" {
+		t.Fatalf("placeholder IR = %s, want BYPASS", bitsMSBFirst(mystery.ir))
+	}
+}
+
+func TestDiscoverUnknownDevicesNeedIRLengths(t *testing.T) {
+	a := &tapDevice{irLength: 4, irCapture: []bool{true, false, false, false}, idcode: 0x0BADC0DF}
+	b := &tapDevice{irLength: 7, irCapture: []bool{true, false, false, false, false, false, false}, idcode: 0x0FEED00F}
+	_, sim := newTapChain(a, b)
+
+	ctrl := NewController(sim, NewMemoryRepository())
+	if _, err := ctrl.Discover(2); err == nil {
+		t.Fatal("two unknown IR lengths should not be guessed")
+	}
+
+	// One override leaves a single unknown, which is then measured
+	ctrl.SetIRLength(0, 4)
+	ch, err := ctrl.Discover(2)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if got := ch.Devices()[1].Info.InstructionLength; got != 7 {
+		t.Fatalf("device 1 IR length = %d, want 7", got)
+	}
+}
@@ -0,0 +1,276 @@
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
+)
+
+// indexVersion is bumped whenever the on-disk index layout or the extracted
+// metadata changes, forcing a full rebuild of older caches.
+const indexVersion = 1
+
+// BSDLIndex is a precompiled, persistent index over a BSDL library. It maps
+// IDCODE value/mask pairs to file paths and keeps the extracted DeviceInfo and
+// boundary cells so discovery does not need to parse the whole library.
+type BSDLIndex struct {
+	Version int          `json:"version"`
+	Root    string       `json:"root"`
+	Built   time.Time    `json:"built"`
+	Entries []IndexEntry `json:"entries"`
+}
+
+// IndexEntry describes one BSDL file in the index. Files that failed to parse
+// are kept with Error set so they are not retried until they change.
+type IndexEntry struct {
+	Path    string              `json:"path"`
+	ModTime time.Time           `json:"mtime"`
+	Size    int64               `json:"size"`
+	Hash    string              `json:"sha256"`
+	Entity  string              `json:"entity,omitempty"`
+	IDValue uint32              `json:"id_value"`
+	IDMask  uint32              `json:"id_mask"`
+	Info    *bsdl.DeviceInfo    `json:"info,omitempty"`
+	Cells   []bsdl.BoundaryCell `json:"cells,omitempty"`
+	Error   string              `json:"error,omitempty"`
+}
+
+// IndexStats summarises the work done by BuildIndex.
+type IndexStats struct {
+	Files    int // BSDL files found under the root
+	Reused   int // Entries taken from the previous index unchanged
+	Reparsed int // Entries parsed because they were new or modified
+	Touched  int // Entries whose mtime changed but content hash did not
+	Failed   int // Entries that could not be parsed or lack an IDCODE
+	Removed  int // Previous entries whose file no longer exists
+}
+
+// Matches reports whether the entry's IDCODE pattern matches id.
+func (e *IndexEntry) Matches(id uint32) bool {
+	return e.Error == "" && (id&e.IDMask) == (e.IDValue&e.IDMask)
+}
+
+// BuildIndex walks root for BSDL files and builds an index. When prev is
+// non-nil its entries are reused for files whose mtime and size are unchanged;
+// a changed mtime only triggers a re-parse if the content hash differs too.
+func BuildIndex(root string, prev *BSDLIndex) (*BSDLIndex, IndexStats, error) {
+	var stats IndexStats
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, stats, fmt.Errorf("chain: index root %s: %w", root, err)
+	}
+
+	byPath := make(map[string]*IndexEntry)
+	byHash := make(map[string]*IndexEntry)
+	if prev != nil && prev.Version == indexVersion {
+		for i := range prev.Entries {
+			entry := &prev.Entries[i]
+			byPath[entry.Path] = entry
+			byHash[entry.Hash] = entry
+		}
+	}
+
+	var parser *bsdl.Parser
+	idx := &BSDLIndex{
+		Version: indexVersion,
+		Root:    absRoot,
+		Built:   time.Now().UTC(),
+	}
+	seen := make(map[string]bool)
+
+	err = filepath.WalkDir(absRoot, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() || !isBSDLFile(path) {
+			return nil
+		}
+		stats.Files++
+		seen[path] = true
+
+		fi, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("chain: stat %s: %w", path, err)
+		}
+
+		if old, ok := byPath[path]; ok && old.ModTime.Equal(fi.ModTime()) && old.Size == fi.Size() {
+			idx.Entries = append(idx.Entries, *old)
+			stats.Reused++
+			if old.Error != "" {
+				stats.Failed++
+			}
+			return nil
+		}
+
+		hash, err := hashFile(path)
+		if err != nil {
+			return fmt.Errorf("chain: hash %s: %w", path, err)
+		}
+		if old, ok := byHash[hash]; ok {
+			entry := *old
+			entry.Path = path
+			entry.ModTime = fi.ModTime()
+			entry.Size = fi.Size()
+			idx.Entries = append(idx.Entries, entry)
+			stats.Reused++
+			stats.Touched++
+			if entry.Error != "" {
+				stats.Failed++
+			}
+			return nil
+		}
+
+		if parser == nil {
+			if parser, err = bsdl.NewParser(); err != nil {
+				return err
+			}
+		}
+		entry := indexFile(parser, path)
+		entry.ModTime = fi.ModTime()
+		entry.Size = fi.Size()
+		entry.Hash = hash
+		idx.Entries = append(idx.Entries, entry)
+		stats.Reparsed++
+		if entry.Error != "" {
+			stats.Failed++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, stats, err
+	}
+
+	for path := range byPath {
+		if !seen[path] {
+			stats.Removed++
+		}
+	}
+
+	return idx, stats, nil
+}
+
+// indexFile parses a single BSDL file and extracts the indexed metadata.
+// Parse problems are recorded on the entry rather than returned.
+func indexFile(parser *bsdl.Parser, path string) IndexEntry {
+	entry := IndexEntry{Path: path}
+
+	file, err := parser.ParseFile(path)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	if file.Entity == nil {
+		entry.Error = "missing entity"
+		return entry
+	}
+	entry.Entity = file.Entity.Name
+
+	info := file.Entity.GetDeviceInfo()
+	if info == nil || info.IDCode == "" {
+		entry.Error = "missing IDCODE_REGISTER"
+		return entry
+	}
+	value, mask, err := parseIDCode(info.IDCode)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	entry.IDValue = value
+	entry.IDMask = mask
+	entry.Info = info
+
+	// Boundary cells are optional: devices without a BOUNDARY_REGISTER can
+	// still be identified and placed in BYPASS.
+	if cells, err := file.Entity.GetBoundaryCells(); err == nil {
+		entry.Cells = cells
+	}
+
+	return entry
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Lookup returns the first entry whose IDCODE pattern matches id, preferring
+// exact (fully masked) entries over wildcard ones.
+func (idx *BSDLIndex) Lookup(id uint32) *IndexEntry {
+	var wildcard *IndexEntry
+	for i := range idx.Entries {
+		entry := &idx.Entries[i]
+		if !entry.Matches(id) {
+			continue
+		}
+		if entry.IDMask == 0xFFFFFFFF {
+			return entry
+		}
+		if wildcard == nil {
+			wildcard = entry
+		}
+	}
+	return wildcard
+}
+
+// LoadIndex reads an index previously written by Save.
+func LoadIndex(path string) (*BSDLIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var idx BSDLIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("chain: decode index %s: %w", path, err)
+	}
+	return &idx, nil
+}
+
+// Save writes the index to path, creating parent directories as needed.
+func (idx *BSDLIndex) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("chain: create index dir: %w", err)
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("chain: encode index: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("chain: write index: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// DefaultIndexPath returns the per-user cache location for the index of the
+// BSDL library rooted at root.
+func DefaultIndexPath(root string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("chain: no user cache dir: %w", err)
+	}
+	sum := sha256.Sum256([]byte(absRoot))
+	name := fmt.Sprintf("bsdl-index-%s.json", hex.EncodeToString(sum[:8]))
+	return filepath.Join(cacheDir, "opentracejtag", name), nil
+}
@@ -0,0 +1,152 @@
+package chain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeIndexFixture(t *testing.T, dir string) {
+	t.Helper()
+	files := map[string]string{
+		"exact.bsd":  simpleBSDL("EXACT", "00010010001101000101011001111000"),
+		"wild.bsdl":  simpleBSDL("WILD", "XXXX0000000000000000000000000001"),
+		"broken.bsm": "this is not BSDL",
+	}
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+func TestBuildIndex(t *testing.T) {
+	dir := t.TempDir()
+	writeIndexFixture(t, dir)
+
+	idx, stats, err := BuildIndex(dir, nil)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+	if stats.Files != 3 || stats.Reparsed != 3 || stats.Failed != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	entry := idx.Lookup(0x12345678)
+	if entry == nil || entry.Entity != "EXACT" {
+		t.Fatalf("exact lookup failed: %+v", entry)
+	}
+	if entry.Info == nil || entry.Info.InstructionLength != 4 {
+		t.Fatalf("expected pre-extracted DeviceInfo, got %+v", entry.Info)
+	}
+	if len(entry.Cells) != 1 {
+		t.Fatalf("expected 1 pre-extracted cell, got %d", len(entry.Cells))
+	}
+	if entry := idx.Lookup(0xA0000001); entry == nil || entry.Entity != "WILD" {
+		t.Fatalf("wildcard lookup failed: %+v", entry)
+	}
+	if idx.Lookup(0xDEADBEEF) != nil {
+		t.Fatalf("unexpected match for unknown IDCODE")
+	}
+}
+
+func TestBuildIndexInvalidation(t *testing.T) {
+	dir := t.TempDir()
+	writeIndexFixture(t, dir)
+
+	first, _, err := BuildIndex(dir, nil)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+
+	cache := filepath.Join(t.TempDir(), "index.json")
+	if err := first.Save(cache); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded, err := LoadIndex(cache)
+	if err != nil {
+		t.Fatalf("LoadIndex failed: %v", err)
+	}
+
+	// Unchanged tree: everything is reused.
+	_, stats, err := BuildIndex(dir, loaded)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+	if stats.Reused != 3 || stats.Reparsed != 0 {
+		t.Fatalf("expected full reuse, got %+v", stats)
+	}
+
+	// Touch without content change: re-hashed but not re-parsed.
+	future := time.Now().Add(time.Hour)
+	exact := filepath.Join(dir, "exact.bsd")
+	if err := os.Chtimes(exact, future, future); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	_, stats, err = BuildIndex(dir, loaded)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+	if stats.Touched != 1 || stats.Reparsed != 0 {
+		t.Fatalf("expected touched-only refresh, got %+v", stats)
+	}
+
+	// Content change: re-parsed, and removal is noticed.
+	text := simpleBSDL("EXACT2", "00010010001101000101011001111000")
+	if err := os.WriteFile(exact, []byte(text), 0o644); err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "broken.bsm")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	idx, stats, err := BuildIndex(dir, loaded)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+	if stats.Reparsed != 1 || stats.Removed != 1 {
+		t.Fatalf("expected one reparse and one removal, got %+v", stats)
+	}
+	if entry := idx.Lookup(0x12345678); entry == nil || entry.Entity != "EXACT2" {
+		t.Fatalf("stale entry after content change: %+v", entry)
+	}
+}
+
+func TestIndexedRepositoryLazyParse(t *testing.T) {
+	dir := t.TempDir()
+	writeIndexFixture(t, dir)
+	cache := filepath.Join(t.TempDir(), "cache", "index.json")
+
+	repo, _, err := OpenIndexedRepository(dir, cache)
+	if err != nil {
+		t.Fatalf("OpenIndexedRepository failed: %v", err)
+	}
+	if _, err := os.Stat(cache); err != nil {
+		t.Fatalf("index cache not written: %v", err)
+	}
+
+	if info := repo.DeviceInfo(0x12345678); info == nil {
+		t.Fatalf("DeviceInfo should come from the index")
+	}
+	if repo.ParsedCount() != 0 {
+		t.Fatalf("DeviceInfo must not parse files")
+	}
+
+	file, err := repo.Lookup(0x12345678)
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if file.Entity.Name != "EXACT" {
+		t.Fatalf("unexpected entity %s", file.Entity.Name)
+	}
+	if _, err := repo.Lookup(0x12345678); err != nil {
+		t.Fatalf("second Lookup failed: %v", err)
+	}
+	if repo.ParsedCount() != 1 {
+		t.Fatalf("expected exactly one parsed file, got %d", repo.ParsedCount())
+	}
+
+	if _, err := repo.Lookup(0xDEADBEEF); err == nil {
+		t.Fatalf("expected error for unknown IDCODE")
+	}
+}
@@ -171,7 +171,10 @@ func (c *Chain) programInstructions(mapping map[*Device]string) error {
 	if _, err := c.xport.shiftIR(tms, stream); err != nil {
 		return err
 	}
-	return c.xport.gotoState(tap.StateRunTestIdle)
+	if err := c.xport.gotoState(tap.StateRunTestIdle); err != nil {
+		return err
+	}
+	return c.xport.flush()
 }
 
 type drSegment struct {
@@ -203,6 +206,14 @@ func (c *Chain) composeDRStreamMulti(vectors map[*Device][]bool, captures map[*D
 }
 
 func (c *Chain) shiftDR(bits []bool) ([]bool, error) {
+	pending, err := c.queueDR(bits)
+	if err != nil {
+		return nil, err
+	}
+	return pending.Bits()
+}
+
+func (c *Chain) queueDR(bits []bool) (*PendingBits, error) {
 	if len(bits) == 0 {
 		return nil, fmt.Errorf("chain: empty DR pattern")
 	}
@@ -217,7 +228,7 @@ func (c *Chain) shiftDR(bits []bool) ([]bool, error) {
 	if err := c.xport.gotoState(tap.StateRunTestIdle); err != nil {
 		return nil, err
 	}
-	return bytesToBools(tdo, len(bits)), nil
+	return &PendingBits{tdo: tdo, bits: len(bits)}, nil
 }
 
 func shiftPattern(length int) []bool {
@@ -1,6 +1,7 @@
 package chain
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"path/filepath"
@@ -15,6 +16,10 @@ type Repository interface {
 	Lookup(id uint32) (*bsdl.BSDLFile, error)
 }
 
+// ErrNoBSDL is wrapped by Lookup when the repository has no file for an
+// IDCODE. Discover turns such devices into BYPASS-only placeholders.
+var ErrNoBSDL = errors.New("chain: no BSDL")
+
 // MemoryRepository is a simple in-memory implementation useful during tests or
 // when the caller preloads a fixed set of devices.
 type MemoryRepository struct {
@@ -89,7 +94,7 @@ func (r *MemoryRepository) Lookup(id uint32) (*bsdl.BSDLFile, error) {
 			return entry.file, nil
 		}
 	}
-	return nil, fmt.Errorf("chain: no BSDL for IDCODE 0x%08X", id)
+	return nil, fmt.Errorf("%w for IDCODE 0x%08X", ErrNoBSDL, id)
 }
 
 // DeviceInfo returns the cached metadata for an ID (if already loaded via Add or
@@ -184,3 +189,93 @@ func (r *MemoryRepository) addEntry(entry repoEntry) {
 func (e repoEntry) matches(id uint32) bool {
 	return (id & e.mask) == (e.value & e.mask)
 }
+
+// IndexedRepository serves lookups from a BSDLIndex and parses only the BSDL
+// files that are actually matched. Parsed files are cached for reuse.
+type IndexedRepository struct {
+	mu     sync.Mutex
+	index  *BSDLIndex
+	parser *bsdl.Parser
+	parsed map[string]*bsdl.BSDLFile
+}
+
+// NewIndexedRepository wraps an existing index.
+func NewIndexedRepository(idx *BSDLIndex) *IndexedRepository {
+	return &IndexedRepository{
+		index:  idx,
+		parsed: make(map[string]*bsdl.BSDLFile),
+	}
+}
+
+// OpenIndexedRepository loads the index cached at cachePath (if any), refreshes
+// it against the files under root and writes it back when anything changed.
+// A missing or unreadable cache simply results in a full rebuild.
+func OpenIndexedRepository(root, cachePath string) (*IndexedRepository, IndexStats, error) {
+	prev, _ := LoadIndex(cachePath)
+	idx, stats, err := BuildIndex(root, prev)
+	if err != nil {
+		return nil, stats, err
+	}
+	if prev == nil || stats.Reparsed > 0 || stats.Touched > 0 || stats.Removed > 0 {
+		if err := idx.Save(cachePath); err != nil {
+			return nil, stats, err
+		}
+	}
+	return NewIndexedRepository(idx), stats, nil
+}
+
+// Index returns the underlying index.
+func (r *IndexedRepository) Index() *BSDLIndex {
+	return r.index
+}
+
+// Lookup implements the Repository interface, parsing the matched file on
+// first use.
+func (r *IndexedRepository) Lookup(id uint32) (*bsdl.BSDLFile, error) {
+	entry := r.index.Lookup(id)
+	if entry == nil {
+		return nil, fmt.Errorf("%w for IDCODE 0x%08X", ErrNoBSDL, id)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if file, ok := r.parsed[entry.Path]; ok {
+		return file, nil
+	}
+	if r.parser == nil {
+		parser, err := bsdl.NewParser()
+		if err != nil {
+			return nil, err
+		}
+		r.parser = parser
+	}
+	file, err := r.parser.ParseFile(entry.Path)
+	if err != nil {
+		return nil, fmt.Errorf("chain: parse %s: %w", entry.Path, err)
+	}
+	r.parsed[entry.Path] = file
+	return file, nil
+}
+
+// DeviceInfo returns the pre-extracted metadata for id without parsing.
+func (r *IndexedRepository) DeviceInfo(id uint32) *bsdl.DeviceInfo {
+	if entry := r.index.Lookup(id); entry != nil {
+		return entry.Info
+	}
+	return nil
+}
+
+// BoundaryCells returns the pre-extracted boundary cells for id.
+func (r *IndexedRepository) BoundaryCells(id uint32) []bsdl.BoundaryCell {
+	if entry := r.index.Lookup(id); entry != nil {
+		return entry.Cells
+	}
+	return nil
+}
+
+// ParsedCount returns how many BSDL files have been parsed so far.
+func (r *IndexedRepository) ParsedCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.parsed)
+}
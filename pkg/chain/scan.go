@@ -0,0 +1,107 @@
+package chain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/tap"
+)
+
+// ScanDevice loads instruction into dev's IR, with every other device in
+// BYPASS, then shifts drBits through the data register the instruction
+// selects and returns the bits captured from that register. The bypass bits
+// of the other devices are padded on TDI and stripped from TDO, so drBits and
+// the result are exactly the target register's length.
+//
+// instruction is an opcode name from the device's BSDL, including USER and
+// private instructions, or a literal binary opcode of the device's IR length
+// (e.g. "0b000010") for instructions the BSDL does not list. drBits are
+// shifted LSB first, as with ShiftDRBits.
+func (c *Chain) ScanDevice(dev *Device, instruction string, drBits []bool) ([]bool, error) {
+	pending, err := c.QueueScanDevice(dev, instruction, drBits)
+	if err != nil {
+		return nil, err
+	}
+	return pending.Bits()
+}
+
+// QueueScanDevice is ScanDevice without waiting for the result, so a series
+// of register accesses can share USB round trips on queuing adapters.
+func (c *Chain) QueueScanDevice(dev *Device, instruction string, drBits []bool) (*PendingBits, error) {
+	if len(drBits) == 0 {
+		return nil, fmt.Errorf("chain: empty DR pattern")
+	}
+	index := c.deviceIndex(dev)
+	if index < 0 {
+		return nil, fmt.Errorf("chain: device %s is not in this chain", dev.Name())
+	}
+	opcode, err := dev.resolveInstruction(instruction)
+	if err != nil {
+		return nil, err
+	}
+
+	// IR: the target opcode in its slot, BYPASS everywhere else
+	var ir []bool
+	for _, other := range c.devices {
+		bits := opcode
+		if other != dev {
+			if bits, err = other.BypassOpcode(); err != nil {
+				return nil, err
+			}
+		}
+		ir = append(ir, bits...)
+	}
+	if err := c.xport.gotoState(tap.StateShiftIR); err != nil {
+		return nil, err
+	}
+	if _, err := c.xport.shiftIR(shiftPattern(len(ir)), ir); err != nil {
+		return nil, err
+	}
+	if err := c.xport.gotoState(tap.StateRunTestIdle); err != nil {
+		return nil, err
+	}
+
+	// DR: one bypass bit per other device around the target register, laid
+	// out in device order like every other chain stream
+	stream := make([]bool, 0, len(c.devices)-1+len(drBits))
+	stream = append(stream, make([]bool, index)...)
+	stream = append(stream, drBits...)
+	stream = append(stream, make([]bool, len(c.devices)-1-index)...)
+
+	pending, err := c.queueDR(stream)
+	if err != nil {
+		return nil, err
+	}
+	pending.offset = index
+	pending.bits = len(drBits)
+	return pending, nil
+}
+
+func (c *Chain) deviceIndex(dev *Device) int {
+	for i, d := range c.devices {
+		if d == dev {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveInstruction looks name up in the instruction table, falling back to
+// a literal binary opcode of the IR length.
+func (d *Device) resolveInstruction(name string) ([]bool, error) {
+	if d.Info == nil {
+		return nil, fmt.Errorf("chain: device %s missing device info", d.Name())
+	}
+	if d.HasInstruction(name) {
+		return d.instructionBits(name)
+	}
+	literal := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "0b")
+	if literal != "" && cleanBinaryString(literal) == literal {
+		if len(literal) != d.Info.InstructionLength {
+			return nil, fmt.Errorf("chain: opcode %s is %d bits, %s has a %d-bit IR",
+				name, len(literal), d.Name(), d.Info.InstructionLength)
+		}
+		return opcodeToBits(literal, d.Info.InstructionLength)
+	}
+	return nil, fmt.Errorf("chain: instruction %s not found on %s", name, d.Name())
+}
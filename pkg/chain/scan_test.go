@@ -0,0 +1,141 @@
+package chain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
+)
+
+// scanTarget models one TAP behind the simulated chain: its IR and a USER
+// data register of userLength bits.
+type scanTarget struct {
+	irLength   int
+	user       string // USER opcode, MSB first
+	userLength int
+	userValue  []bool
+	ir         []bool
+}
+
+// chainModel returns a shift hook that behaves like real TAPs in series:
+// device 0 sits nearest TDO, each device captures into and updates from its
+// own slice of the scan, and devices not in USER are in BYPASS.
+func chainModel(targets []*scanTarget) jtag.ShiftHook {
+	selected := func(t *scanTarget) bool {
+		opcode, _ := opcodeToBits(t.user, t.irLength)
+		return fmt.Sprint(t.ir) == fmt.Sprint(opcode)
+	}
+	return func(region jtag.ShiftRegion, tms, tdi []byte, bits int) ([]byte, error) {
+		in := bytesToBools(tdi, bits)
+		var capture []bool
+		var lengths []int
+		for _, t := range targets {
+			switch {
+			case region == jtag.ShiftRegionIR:
+				c := make([]bool, t.irLength)
+				c[0] = true // IEEE 1149.1 IR capture ends in 01
+				capture = append(capture, c...)
+				lengths = append(lengths, t.irLength)
+			case selected(t):
+				capture = append(capture, t.userValue...)
+				lengths = append(lengths, t.userLength)
+			default:
+				capture = append(capture, false)
+				lengths = append(lengths, 1)
+			}
+		}
+		// State moves carry no data; only full-chain scans update registers
+		if bits != len(capture) {
+			return make([]byte, (bits+7)/8), nil
+		}
+		offset := 0
+		for i, t := range targets {
+			slice := append([]bool(nil), in[offset:offset+lengths[i]]...)
+			if region == jtag.ShiftRegionIR {
+				t.ir = slice
+			} else if selected(t) {
+				t.userValue = slice
+			}
+			offset += lengths[i]
+		}
+		return boolsToBytes(capture), nil
+	}
+}
+
+func scanTestDevice(t *testing.T, name string, target *scanTarget) *Device {
+	t.Helper()
+	parser, err := bsdl.NewParser()
+	if err != nil {
+		t.Fatalf("parser init failed: %v", err)
+	}
+	ones := ""
+	for i := 0; i < target.irLength; i++ {
+		ones += "1"
+	}
+	text := fmt.Sprintf(`
+entity %[1]s is
+	attribute INSTRUCTION_LENGTH of %[1]s : entity is %[2]d;
+	attribute INSTRUCTION_OPCODE of %[1]s : entity is
+		"BYPASS (%[3]s)," &
+		"USER1 (%[4]s)";
+end %[1]s;
+`, name, target.irLength, ones, target.user)
+	file, err := parser.ParseString(text)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	return &Device{File: file, Info: file.Entity.GetDeviceInfo()}
+}
+
+func TestScanDevicePadsBypass(t *testing.T) {
+	targets := []*scanTarget{
+		{irLength: 4, user: "0010", userLength: 8},
+		{irLength: 6, user: "000010", userLength: 12},
+		{irLength: 5, user: "00010", userLength: 3},
+	}
+	var devices []*Device
+	for i, target := range targets {
+		target.userValue = make([]bool, target.userLength)
+		target.userValue[0] = true
+		devices = append(devices, scanTestDevice(t, fmt.Sprintf("DEV%d", i), target))
+	}
+
+	sim := jtag.NewSimAdapter(jtag.AdapterInfo{Name: "sim"})
+	sim.OnShift = chainModel(targets)
+	c := &Chain{devices: devices, xport: newTransport(sim)}
+
+	// Write the middle device's 12-bit USER register, then read it back
+	want := []bool{true, false, true, true, false, false, true, false, true, true, true, false}
+	got, err := c.ScanDevice(devices[1], "USER1", want)
+	if err != nil {
+		t.Fatalf("ScanDevice failed: %v", err)
+	}
+	if len(got) != 12 || !got[0] {
+		t.Fatalf("first scan captured %v, want the 12-bit reset value", got)
+	}
+	if fmt.Sprint(targets[1].userValue) != fmt.Sprint(want) {
+		t.Fatalf("device 1 register = %v, want %v", targets[1].userValue, want)
+	}
+	for _, i := range []int{0, 2} {
+		bypass, _ := devices[i].BypassOpcode()
+		if fmt.Sprint(targets[i].ir) != fmt.Sprint(bypass) {
+			t.Fatalf("device %d IR = %v, want BYPASS", i, targets[i].ir)
+		}
+	}
+
+	got, err = c.ScanDevice(devices[1], "0b000010", make([]bool, 12))
+	if err != nil {
+		t.Fatalf("ScanDevice with literal opcode failed: %v", err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("read back %v, want %v", got, want)
+	}
+
+	if _, err := c.ScanDevice(devices[2], "0b01", []bool{true}); err == nil {
+		t.Fatal("opcode of the wrong IR length accepted")
+	}
+	if _, err := c.ScanDevice(devices[0], "USER9", []bool{true}); err == nil {
+		t.Fatal("unknown instruction accepted")
+	}
+}
@@ -47,6 +47,7 @@ var manufacturers = map[uint16]Manufacturer{
 	0x0B7: {Code: 0x0B7, Name: "Espressif", Abbreviation: "Espressif"},
 	0x13B: {Code: 0x13B, Name: "Nordic Semiconductor", Abbreviation: "Nordic"},
 	0x1F1: {Code: 0x1F1, Name: "Raspberry Pi", Abbreviation: "RPi"},
+	0x23B: {Code: 0x23B, Name: "ARM Ltd", Abbreviation: "ARM"}, // Debug ports (DPIDR) and CoreSight
 }
 
 // LookupManufacturer returns manufacturer info for a JEP106 code
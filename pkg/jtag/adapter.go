@@ -16,6 +16,8 @@ type AdapterInfo struct {
 	MaxFrequency int // Hertz
 	SupportsSRST bool
 	SupportsTRST bool
+	SupportsJTAG bool
+	SupportsSWD  bool
 	Notes        string
 }
 
@@ -28,6 +30,47 @@ type Adapter interface {
 	SetSpeed(hz int) error
 }
 
+// QueuedAdapter is implemented by adapters that can defer shifts and execute
+// many of them per round trip to the probe. Queued shifts run in order and
+// before any later immediate call; reading a PendingTDO flushes the queue.
+type QueuedAdapter interface {
+	Adapter
+	QueueShiftIR(tms, tdi []byte, bits int) (*PendingTDO, error)
+	QueueShiftDR(tms, tdi []byte, bits int) (*PendingTDO, error)
+	Flush() error
+}
+
+// PendingTDO is the TDO of a shift that may not have been executed yet.
+type PendingTDO struct {
+	tdo   []byte
+	err   error
+	done  bool
+	flush func() error
+}
+
+// ResolvedTDO wraps the result of a shift that has already executed.
+func ResolvedTDO(tdo []byte, err error) *PendingTDO {
+	return &PendingTDO{tdo: tdo, err: err, done: true}
+}
+
+// TDO returns the captured bits, flushing the owning adapter's queue first if
+// the shift is still pending.
+func (p *PendingTDO) TDO() ([]byte, error) {
+	if !p.done && p.flush != nil {
+		if err := p.flush(); err != nil && !p.done {
+			return nil, err
+		}
+	}
+	if !p.done {
+		return nil, fmt.Errorf("jtag: queued shift was never executed")
+	}
+	return p.tdo, p.err
+}
+
+func (p *PendingTDO) resolve(tdo []byte, err error) {
+	p.tdo, p.err, p.done = tdo, err, true
+}
+
 // ErrNotImplemented lets backends signal that a requested capability is not yet
 // available without relying on fmt.Errorf each time.
 var ErrNotImplemented = errors.New("jtag: not implemented")
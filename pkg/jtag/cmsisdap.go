@@ -2,29 +2,66 @@ package jtag
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 )
 
 // CMSISDAPAdapter implements the Adapter interface for CMSIS-DAP probes
 type CMSISDAPAdapter struct {
-	transport *USBTransport
+	transport DAPTransport
 	protocol  *CMSISDAPProtocol
 
 	info      AdapterInfo
 	speedHz   int
 	connected bool
 
+	// VoltageInfoID is the vendor DAP_Info ID under which the probe reports
+	// its target voltage sense; zero when it has none. See TargetVoltage.
+	VoltageInfoID byte
+
+	// Command queue; see cmsisdap_queue.go
+	queue           []queuedShift
+	packetCount     int  // Packets the probe can buffer
+	executeCommands bool // Firmware supports DAP_ExecuteCommands
+
 	mu sync.Mutex // Protect concurrent access
 }
 
-// NewCMSISDAPAdapter creates a new CMSIS-DAP adapter
+// NewCMSISDAPAdapter creates a new CMSIS-DAP adapter for the probe with the
+// given VID:PID, using the v2 bulk interface when present and v1 HID otherwise.
 func NewCMSISDAPAdapter(vid, pid uint16) (*CMSISDAPAdapter, error) {
-	// Create USB transport
-	transport, err := NewUSBTransport(vid, pid)
+	return NewCMSISDAPAdapterForProbe(vid, pid, ProbeSelector{})
+}
+
+// NewCMSISDAPAdapterForProbe is NewCMSISDAPAdapter for one of several
+// identical probes, chosen by serial number or USB path.
+func NewCMSISDAPAdapterForProbe(vid, pid uint16, sel ProbeSelector) (*CMSISDAPAdapter, error) {
+	transport, err := OpenCMSISDAPTransport(vid, pid, sel)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open USB device: %w", err)
 	}
+	return NewCMSISDAPAdapterWithTransport(transport)
+}
 
+// OpenCMSISDAPAdapter opens the first probe chosen by sel among the known
+// CMSIS-DAP VID:PIDs (Raspberry Pi debugprobe, DAPLink, J-Link), over
+// whichever of the v2 bulk and v1 HID interfaces it implements.
+func OpenCMSISDAPAdapter(sel ProbeSelector) (*CMSISDAPAdapter, error) {
+	var errs []string
+	for _, known := range knownCMSISDAPVIDPIDs {
+		transport, err := openCMSISDAPTransport(known.VendorID, known.ProductID, sel)
+		if err == nil {
+			return NewCMSISDAPAdapterWithTransport(transport)
+		}
+		errs = append(errs, fmt.Sprintf("%04X:%04X: %v", known.VendorID, known.ProductID, err))
+	}
+	return nil, fmt.Errorf("failed to open USB device: %s", strings.Join(errs, "; "))
+}
+
+// NewCMSISDAPAdapterWithTransport creates a CMSIS-DAP adapter on an already
+// opened transport, such as a FakeDAPTransport in tests. The transport is
+// closed if initialisation fails.
+func NewCMSISDAPAdapterWithTransport(transport DAPTransport) (*CMSISDAPAdapter, error) {
 	protocol := NewCMSISDAPProtocol(transport.GetPacketSize())
 
 	adapter := &CMSISDAPAdapter{
@@ -79,6 +116,24 @@ func (a *CMSISDAPAdapter) queryInfo() error {
 	resp, _ = a.transport.WriteRead(cmd)
 	firmware, _ := a.protocol.DecodeInfo(resp)
 
+	// Packet count bounds how many packets may be in flight at once
+	a.packetCount = 1
+	cmd = a.protocol.EncodeInfo(InfoPacketCount)
+	if resp, err := a.transport.WriteRead(cmd); err == nil &&
+		len(resp) >= 3 && resp[0] == CmdInfo && resp[1] == 1 && resp[2] > 0 {
+		a.packetCount = int(resp[2])
+	}
+	a.executeCommands = supportsExecuteCommands(firmware)
+
+	// Capabilities: which wire protocols the firmware implements. Assume
+	// JTAG when the probe does not say.
+	caps := byte(0x02)
+	cmd = a.protocol.EncodeInfo(InfoCapabilities)
+	if resp, err := a.transport.WriteRead(cmd); err == nil &&
+		len(resp) >= 3 && resp[0] == CmdInfo && resp[1] >= 1 {
+		caps = resp[2]
+	}
+
 	a.info = AdapterInfo{
 		Name:         "CMSIS-DAP Probe",
 		Vendor:       vendor,
@@ -89,6 +144,8 @@ func (a *CMSISDAPAdapter) queryInfo() error {
 		MaxFrequency: 10_000_000, // 10 MHz (typical for CMSIS-DAP)
 		SupportsSRST: true,
 		SupportsTRST: true,
+		SupportsJTAG: caps&0x02 != 0,
+		SupportsSWD:  caps&0x01 != 0,
 	}
 
 	return nil
@@ -122,73 +179,20 @@ func (a *CMSISDAPAdapter) Info() (AdapterInfo, error) {
 
 // ShiftIR shifts data into the instruction register
 func (a *CMSISDAPAdapter) ShiftIR(tms, tdi []byte, bits int) ([]byte, error) {
-	a.mu.Lock()
-	defer a.mu.Unlock()
-
-	if _, err := ValidateShiftBuffers(tms, tdi, bits); err != nil {
+	p, err := a.QueueShiftIR(tms, tdi, bits)
+	if err != nil {
 		return nil, err
 	}
-
-	return a.shiftRegister(tms, tdi, bits)
+	return p.TDO()
 }
 
 // ShiftDR shifts data into the data register
 func (a *CMSISDAPAdapter) ShiftDR(tms, tdi []byte, bits int) ([]byte, error) {
-	a.mu.Lock()
-	defer a.mu.Unlock()
-
-	if _, err := ValidateShiftBuffers(tms, tdi, bits); err != nil {
-		return nil, err
-	}
-
-	return a.shiftRegister(tms, tdi, bits)
-}
-
-// shiftRegister performs the actual JTAG shift operation
-// This handles the complexity of splitting per-bit TMS into CMSIS-DAP sequences
-func (a *CMSISDAPAdapter) shiftRegister(tms, tdi []byte, bits int) ([]byte, error) {
-	// Build sequences - split by TMS changes
-	sequences := a.buildSequences(tms, tdi, bits)
-
-	// Encode and send command
-	cmd := a.protocol.EncodeJTAGSequence(sequences)
-	resp, err := a.transport.WriteRead(cmd)
-	if err != nil {
-		return nil, fmt.Errorf("shift failed: %w", err)
-	}
-
-	// Decode response and extract TDO
-	tdoSeqs, err := a.protocol.DecodeJTAGSequence(resp, sequences)
+	p, err := a.QueueShiftDR(tms, tdi, bits)
 	if err != nil {
 		return nil, err
 	}
-
-	// Combine TDO sequences into single byte array
-	tdo := make([]byte, (bits+7)/8)
-	bitPos := 0
-
-	for _, seqTDO := range tdoSeqs {
-		// Copy bits from this sequence's TDO
-		for i := 0; i < len(seqTDO); i++ {
-			byteIdx := bitPos / 8
-			bitIdx := bitPos % 8
-
-			for bit := 0; bit < 8 && bitPos < bits; bit++ {
-				if (seqTDO[i] & (1 << bit)) != 0 {
-					tdo[byteIdx] |= (1 << bitIdx)
-				}
-				bitPos++
-				if bitPos%8 == 0 {
-					byteIdx++
-					bitIdx = 0
-				} else {
-					bitIdx++
-				}
-			}
-		}
-	}
-
-	return tdo, nil
+	return p.TDO()
 }
 
 // buildSequences splits a shift operation into CMSIS-DAP sequences
@@ -282,6 +286,10 @@ func (a *CMSISDAPAdapter) ResetTAP(hard bool) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	if err := a.flushLocked(); err != nil {
+		return err
+	}
+
 	if hard {
 		// Use DAP_ResetTarget command
 		cmd := a.protocol.EncodeResetTarget()
@@ -311,6 +319,10 @@ func (a *CMSISDAPAdapter) SetSpeed(hz int) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	if err := a.flushLocked(); err != nil {
+		return err
+	}
+
 	if hz < a.info.MinFrequency || hz > a.info.MaxFrequency {
 		return fmt.Errorf("frequency %d Hz out of range [%d, %d]",
 			hz, a.info.MinFrequency, a.info.MaxFrequency)
@@ -335,6 +347,9 @@ func (a *CMSISDAPAdapter) Close() error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	// Shifts still queued are executed so their futures resolve
+	a.flushLocked()
+
 	if a.connected {
 		// Send disconnect command
 		cmd := a.protocol.EncodeDisconnect()
@@ -351,6 +366,10 @@ func (a *CMSISDAPAdapter) ConfigureJTAGChain(irLengths []byte) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	if err := a.flushLocked(); err != nil {
+		return err
+	}
+
 	cmd := a.protocol.EncodeJTAGConfigure(irLengths)
 	resp, err := a.transport.WriteRead(cmd)
 	if err != nil {
@@ -366,6 +385,10 @@ func (a *CMSISDAPAdapter) ReadIDCODE(deviceIndex byte) (uint32, error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	if err := a.flushLocked(); err != nil {
+		return 0, err
+	}
+
 	cmd := a.protocol.EncodeJTAGIDCODE(deviceIndex)
 	resp, err := a.transport.WriteRead(cmd)
 	if err != nil {
@@ -0,0 +1,444 @@
+package jtag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// FakeDAPTransport is an in-memory DAPTransport that emulates CMSIS-DAP
+// firmware, so the adapter can be exercised without a probe. It enforces the
+// packet size and packet count like real firmware, supports pipelined
+// packets and DAP_ExecuteCommands, and records every packet it receives.
+//
+// DAP_JTAG_Sequence TDO data comes from OnJTAG; when nil, TDI is looped back.
+// SWD commands are served by SWD when set. DAP_SWJ_Pins drives Pins, except
+// lines in HeldLow, which read back low as if the board pulled them down.
+type FakeDAPTransport struct {
+	PacketSize  int
+	PacketCount int // Maximum packets outstanding in WritePacket/ReadPacket
+
+	Vendor   string
+	Product  string
+	Serial   string
+	Firmware string
+
+	// IDCodes are returned by DAP_JTAG_IDCODE, indexed by device.
+	IDCodes []uint32
+
+	// OnJTAG produces the TDO bits for one JTAG sequence of bits clocks with
+	// a constant TMS level. TDI and TDO are packed LSB first.
+	OnJTAG func(tms bool, tdi []byte, bits int) []byte
+
+	// SWD is the target behind DAP_SWD_Sequence and DAP_Transfer.
+	SWD *SimSWDTarget
+
+	Pins    AdapterPin
+	HeldLow AdapterPin
+
+	// TargetMillivolts is reported by DAP_Info under VoltageInfoID, if set.
+	VoltageInfoID    byte
+	TargetMillivolts uint16
+
+	mu        sync.Mutex
+	commands  [][]byte
+	port      byte
+	clock     uint32
+	irLengths []byte
+	closed    bool
+	pending   [][]byte // Responses to written but unread packets
+}
+
+// NewFakeDAPTransport returns a fake full-speed (64-byte packet) probe.
+func NewFakeDAPTransport() *FakeDAPTransport {
+	return &FakeDAPTransport{
+		PacketSize:  DefaultPacketSize,
+		PacketCount: 4,
+		Vendor:      "OpenTraceLab",
+		Product:     "Fake CMSIS-DAP",
+		Serial:      "FAKE0001",
+		Firmware:    "2.1.0",
+		Pins:        PinTMS | PinTDI | PinTDO | PinNTRST | PinNRESET,
+	}
+}
+
+// WriteRead handles one command packet.
+func (f *FakeDAPTransport) WriteRead(cmd []byte) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.pending) > 0 {
+		return nil, fmt.Errorf("WriteRead with %d pipelined responses unread", len(f.pending))
+	}
+	return f.handle(cmd)
+}
+
+// WritePacket queues a command packet; its response is returned by a later
+// ReadPacket.
+func (f *FakeDAPTransport) WritePacket(cmd []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.pending) >= f.PacketCount {
+		return fmt.Errorf("more than %d packets outstanding", f.PacketCount)
+	}
+	resp, err := f.handle(cmd)
+	if err != nil {
+		return err
+	}
+	f.pending = append(f.pending, resp)
+	return nil
+}
+
+// ReadPacket returns the response to the oldest unread packet.
+func (f *FakeDAPTransport) ReadPacket() ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.pending) == 0 {
+		return nil, fmt.Errorf("no response pending")
+	}
+	resp := f.pending[0]
+	f.pending = f.pending[1:]
+	return resp, nil
+}
+
+func (f *FakeDAPTransport) handle(cmd []byte) ([]byte, error) {
+	if f.closed {
+		return nil, fmt.Errorf("fake DAP transport closed")
+	}
+	if len(cmd) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	if len(cmd) > f.PacketSize {
+		return nil, fmt.Errorf("command of %d bytes exceeds packet size %d", len(cmd), f.PacketSize)
+	}
+	f.commands = append(f.commands, append([]byte(nil), cmd...))
+
+	var resp []byte
+	if cmd[0] == CmdExecuteCmds {
+		if len(cmd) < 2 {
+			return nil, fmt.Errorf("truncated DAP_ExecuteCommands")
+		}
+		resp = []byte{CmdExecuteCmds, cmd[1]}
+		rest := cmd[2:]
+		for i := 0; i < int(cmd[1]); i++ {
+			if len(rest) == 0 {
+				return nil, fmt.Errorf("truncated DAP_ExecuteCommands")
+			}
+			sub, n, err := f.execute(rest)
+			if err != nil {
+				return nil, err
+			}
+			resp = append(resp, sub...)
+			rest = rest[n:]
+		}
+	} else {
+		var err error
+		if resp, _, err = f.execute(cmd); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(resp) > f.PacketSize {
+		return nil, fmt.Errorf("response of %d bytes exceeds packet size %d", len(resp), f.PacketSize)
+	}
+	return resp, nil
+}
+
+// execute runs the command at the start of cmd and returns its response and
+// the number of request bytes it consumed.
+func (f *FakeDAPTransport) execute(cmd []byte) ([]byte, int, error) {
+	need := func(n int, name string) error {
+		if len(cmd) < n {
+			return fmt.Errorf("truncated %s", name)
+		}
+		return nil
+	}
+
+	switch cmd[0] {
+	case CmdInfo:
+		if err := need(2, "DAP_Info"); err != nil {
+			return nil, 0, err
+		}
+		return f.info(cmd[1]), 2, nil
+
+	case CmdConnect:
+		if err := need(2, "DAP_Connect"); err != nil {
+			return nil, 0, err
+		}
+		port := byte(PortJTAG)
+		if cmd[1] != PortDefault {
+			port = cmd[1]
+		}
+		f.port = port
+		return []byte{CmdConnect, port}, 2, nil
+
+	case CmdDisconnect:
+		f.port = 0
+		return []byte{CmdDisconnect, StatusOK}, 1, nil
+
+	case CmdResetTarget:
+		return []byte{CmdResetTarget, StatusOK, 0}, 1, nil
+
+	case CmdSWJPins:
+		if err := need(7, "DAP_SWJ_Pins"); err != nil {
+			return nil, 0, err
+		}
+		mask := AdapterPin(cmd[2])
+		f.Pins = f.Pins&^mask | AdapterPin(cmd[1])&mask
+		return []byte{CmdSWJPins, byte(f.Pins &^ f.HeldLow)}, 7, nil
+
+	case CmdSWJClock:
+		if err := need(5, "DAP_SWJ_Clock"); err != nil {
+			return nil, 0, err
+		}
+		f.clock = binary.LittleEndian.Uint32(cmd[1:5])
+		return []byte{CmdSWJClock, StatusOK}, 5, nil
+
+	case CmdJTAGConfigure:
+		if err := need(2, "DAP_JTAG_Configure"); err != nil {
+			return nil, 0, err
+		}
+		n := 2 + int(cmd[1])
+		if err := need(n, "DAP_JTAG_Configure"); err != nil {
+			return nil, 0, err
+		}
+		f.irLengths = append([]byte(nil), cmd[2:n]...)
+		return []byte{CmdJTAGConfigure, StatusOK}, n, nil
+
+	case CmdJTAGIDCODE:
+		if err := need(2, "DAP_JTAG_IDCODE"); err != nil {
+			return nil, 0, err
+		}
+		if int(cmd[1]) >= len(f.IDCodes) {
+			return []byte{CmdJTAGIDCODE, StatusError, 0, 0, 0, 0}, 2, nil
+		}
+		resp := []byte{CmdJTAGIDCODE, StatusOK, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(resp[2:], f.IDCodes[cmd[1]])
+		return resp, 2, nil
+
+	case CmdJTAGSequence:
+		return f.jtagSequence(cmd)
+
+	case CmdSWDConfigure:
+		if err := need(2, "DAP_SWD_Configure"); err != nil {
+			return nil, 0, err
+		}
+		return []byte{CmdSWDConfigure, StatusOK}, 2, nil
+
+	case CmdTransferCfg:
+		if err := need(6, "DAP_TransferConfigure"); err != nil {
+			return nil, 0, err
+		}
+		return []byte{CmdTransferCfg, StatusOK}, 6, nil
+
+	case CmdSWDSequence:
+		return f.swdSequence(cmd)
+
+	case CmdTransfer:
+		return f.transfer(cmd)
+	}
+
+	// Unknown commands are answered with DAP_Invalid
+	return []byte{StatusError}, len(cmd), nil
+}
+
+func (f *FakeDAPTransport) info(id byte) []byte {
+	str := func(s string) []byte {
+		return append([]byte{CmdInfo, byte(len(s))}, s...)
+	}
+	switch id {
+	case InfoVendorID:
+		return str(f.Vendor)
+	case InfoProductID:
+		return str(f.Product)
+	case InfoSerialNum:
+		return str(f.Serial)
+	case InfoFirmwareVer:
+		return str(f.Firmware)
+	case InfoCapabilities:
+		return []byte{CmdInfo, 1, 0x03} // SWD and JTAG
+	case InfoPacketCount:
+		return []byte{CmdInfo, 1, byte(f.PacketCount)}
+	case InfoPacketSize:
+		resp := []byte{CmdInfo, 2, 0, 0}
+		binary.LittleEndian.PutUint16(resp[2:], uint16(f.PacketSize))
+		return resp
+	}
+	if id == f.VoltageInfoID && id != 0 {
+		resp := []byte{CmdInfo, 2, 0, 0}
+		binary.LittleEndian.PutUint16(resp[2:], f.TargetMillivolts)
+		return resp
+	}
+	return []byte{CmdInfo, 0}
+}
+
+func (f *FakeDAPTransport) jtagSequence(cmd []byte) ([]byte, int, error) {
+	if len(cmd) < 2 {
+		return nil, 0, fmt.Errorf("truncated DAP_JTAG_Sequence")
+	}
+
+	resp := []byte{CmdJTAGSequence, StatusOK}
+	offset := 2
+	for i := 0; i < int(cmd[1]); i++ {
+		if offset >= len(cmd) {
+			return nil, 0, fmt.Errorf("truncated DAP_JTAG_Sequence")
+		}
+		seq := JTAGSequence{Info: cmd[offset]}
+		offset++
+		bits := seq.TCKCount()
+		n := (bits + 7) / 8
+		if offset+n > len(cmd) {
+			return nil, 0, fmt.Errorf("truncated DAP_JTAG_Sequence")
+		}
+		tdi := cmd[offset : offset+n]
+		offset += n
+
+		tdo := tdi
+		if f.OnJTAG != nil {
+			tdo = f.OnJTAG(seq.TMS(), append([]byte(nil), tdi...), bits)
+		}
+		if seq.CaptureTDO() {
+			out := make([]byte, n)
+			copy(out, tdo)
+			resp = append(resp, out...)
+		}
+	}
+
+	if f.port != PortJTAG {
+		return []byte{CmdJTAGSequence, StatusError}, offset, nil
+	}
+	return resp, offset, nil
+}
+
+func (f *FakeDAPTransport) swdSequence(cmd []byte) ([]byte, int, error) {
+	if len(cmd) < 2 {
+		return nil, 0, fmt.Errorf("truncated DAP_SWD_Sequence")
+	}
+
+	ok := f.port == PortSWD && f.SWD != nil
+	resp := []byte{CmdSWDSequence, StatusOK}
+	offset := 2
+	for i := 0; i < int(cmd[1]); i++ {
+		if offset >= len(cmd) {
+			return nil, 0, fmt.Errorf("truncated DAP_SWD_Sequence")
+		}
+		info := cmd[offset]
+		offset++
+		bits := int(info & 0x3F)
+		if bits == 0 {
+			bits = 64
+		}
+		n := (bits + 7) / 8
+		if info&0x80 != 0 {
+			// Input: SWDIO is not driven back, reads as zero
+			resp = append(resp, make([]byte, n)...)
+			continue
+		}
+		if offset+n > len(cmd) {
+			return nil, 0, fmt.Errorf("truncated DAP_SWD_Sequence")
+		}
+		if ok {
+			f.SWD.SWDSequence(bits, cmd[offset:offset+n])
+		}
+		offset += n
+	}
+
+	if !ok {
+		return []byte{CmdSWDSequence, StatusError}, offset, nil
+	}
+	return resp, offset, nil
+}
+
+func (f *FakeDAPTransport) transfer(cmd []byte) ([]byte, int, error) {
+	if len(cmd) < 3 {
+		return nil, 0, fmt.Errorf("truncated DAP_Transfer")
+	}
+
+	resp := []byte{CmdTransfer, 0, 0}
+	offset := 3
+	stopped := f.port != PortSWD || f.SWD == nil
+	if stopped {
+		resp[2] = byte(SWDAckNone)
+	}
+	for i := 0; i < int(cmd[2]); i++ {
+		if offset >= len(cmd) {
+			return nil, 0, fmt.Errorf("truncated DAP_Transfer")
+		}
+		req := cmd[offset]
+		offset++
+		read := req&TransferRnW != 0
+		var wdata uint32
+		if !read {
+			if offset+4 > len(cmd) {
+				return nil, 0, fmt.Errorf("truncated DAP_Transfer")
+			}
+			wdata = binary.LittleEndian.Uint32(cmd[offset:])
+			offset += 4
+		}
+		if stopped {
+			continue
+		}
+
+		ack, data, parity := f.SWD.packet(req&TransferAPnDP != 0, read, req&0x0C, wdata)
+		resp[2] = byte(ack)
+		if ack != SWDAckOK {
+			stopped = true
+			continue
+		}
+		if read && parity != swdParity(data) {
+			resp[2] |= TransferParityError
+			stopped = true
+			continue
+		}
+		resp[1]++
+		if read {
+			resp = binary.LittleEndian.AppendUint32(resp, data)
+		}
+	}
+	return resp, offset, nil
+}
+
+// GetPacketSize returns the emulated packet size.
+func (f *FakeDAPTransport) GetPacketSize() int {
+	return f.PacketSize
+}
+
+// Close marks the transport closed; later commands fail.
+func (f *FakeDAPTransport) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+// Commands returns a copy of every command packet received so far.
+func (f *FakeDAPTransport) Commands() [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([][]byte, len(f.commands))
+	copy(out, f.commands)
+	return out
+}
+
+// Clock returns the last frequency set with DAP_SWJ_Clock.
+func (f *FakeDAPTransport) Clock() uint32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.clock
+}
+
+// IRLengths returns the chain configured with DAP_JTAG_Configure.
+func (f *FakeDAPTransport) IRLengths() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]byte(nil), f.irLengths...)
+}
+
+// Closed reports whether Close has been called.
+func (f *FakeDAPTransport) Closed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
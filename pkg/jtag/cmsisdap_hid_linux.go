@@ -0,0 +1,204 @@
+package jtag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HIDTransport talks to a CMSIS-DAP v1 probe through its HID interface using
+// the Linux hidraw driver. Each packet is one HID report.
+type HIDTransport struct {
+	file       *os.File
+	path       string
+	packetSize int
+	timeout    time.Duration
+}
+
+// hidrawDevice describes a hidraw node found in sysfs.
+type hidrawDevice struct {
+	Path    string // /dev/hidrawN
+	VID     uint16
+	PID     uint16
+	Name    string
+	Serial  string
+	USBPath string // bus:port of the parent USB device
+}
+
+// NewHIDTransport opens the first hidraw device matching vid:pid and sel,
+// preferring one whose HID name mentions CMSIS-DAP on composite probes.
+func NewHIDTransport(vid, pid uint16, sel ProbeSelector) (*HIDTransport, error) {
+	devices, err := listHIDRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	var match *hidrawDevice
+	for i := range devices {
+		dev := &devices[i]
+		if dev.VID != vid || dev.PID != pid || !sel.Matches(dev.Serial, dev.USBPath) {
+			continue
+		}
+		if match == nil || strings.Contains(strings.ToUpper(dev.Name), "CMSIS-DAP") {
+			match = dev
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("no hidraw device for VID:0x%04X PID:0x%04X (%s)", vid, pid, sel)
+	}
+
+	file, err := os.OpenFile(match.Path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", match.Path, err)
+	}
+
+	t := &HIDTransport{
+		file:       file,
+		path:       match.Path,
+		packetSize: DefaultPacketSize,
+		timeout:    DefaultTimeout,
+	}
+
+	// Full-speed probes use 64-byte reports; high-speed ones report larger
+	// packets through DAP_Info.
+	if resp, err := t.WriteRead([]byte{CmdInfo, InfoPacketSize}); err == nil &&
+		len(resp) >= 4 && resp[0] == CmdInfo && resp[1] == 2 {
+		if size := int(binary.LittleEndian.Uint16(resp[2:4])); size > 0 {
+			t.packetSize = size
+		}
+	}
+
+	return t, nil
+}
+
+// listHIDRaw enumerates hidraw nodes and their USB identity from sysfs.
+func listHIDRaw() ([]hidrawDevice, error) {
+	entries, err := filepath.Glob("/sys/class/hidraw/hidraw*")
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []hidrawDevice
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(entry, "device", "uevent"))
+		if err != nil {
+			continue
+		}
+		dev, ok := parseHIDUevent(string(data))
+		if !ok {
+			continue
+		}
+		dev.Path = filepath.Join("/dev", filepath.Base(entry))
+		if real, err := filepath.EvalSymlinks(filepath.Join(entry, "device")); err == nil {
+			dev.USBPath = usbPathFromSysfs(real)
+		}
+		devices = append(devices, dev)
+	}
+	return devices, nil
+}
+
+// usbPathFromSysfs finds the USB device in a sysfs device path such as
+// /sys/devices/pci0000:00/.../usb1/1-2/1-2.3/1-2.3:1.0/0003:2E8A:000C.0001
+// and returns its bus:port form ("1:2.3"), or "" if there is none.
+func usbPathFromSysfs(devPath string) string {
+	path := ""
+	for _, part := range strings.Split(filepath.ToSlash(devPath), "/") {
+		if usbPathPattern.MatchString(part) && strings.Contains(part, "-") {
+			path = normalizeUSBPath(part)
+		}
+	}
+	return path
+}
+
+// parseHIDUevent extracts the USB IDs, name and serial from a HID uevent
+// file, e.g. "HID_ID=0003:00000D28:00000204".
+func parseHIDUevent(text string) (hidrawDevice, bool) {
+	var dev hidrawDevice
+	haveID := false
+	for _, line := range strings.Split(text, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "HID_ID":
+			parts := strings.Split(value, ":")
+			if len(parts) != 3 {
+				continue
+			}
+			vid, err1 := strconv.ParseUint(parts[1], 16, 32)
+			pid, err2 := strconv.ParseUint(parts[2], 16, 32)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			dev.VID, dev.PID = uint16(vid), uint16(pid)
+			haveID = true
+		case "HID_NAME":
+			dev.Name = value
+		case "HID_UNIQ":
+			dev.Serial = value
+		}
+	}
+	return dev, haveID
+}
+
+// WriteRead sends a command as one output report and reads the response
+// input report.
+func (t *HIDTransport) WriteRead(cmd []byte) ([]byte, error) {
+	if err := t.WritePacket(cmd); err != nil {
+		return nil, err
+	}
+	return t.ReadPacket()
+}
+
+// WritePacket sends a command as one output report without waiting for the
+// response.
+func (t *HIDTransport) WritePacket(cmd []byte) error {
+	if len(cmd) > t.packetSize {
+		return fmt.Errorf("HID command of %d bytes exceeds packet size %d", len(cmd), t.packetSize)
+	}
+
+	// Report ID 0 prefix, then the zero-padded packet
+	report := make([]byte, t.packetSize+1)
+	copy(report[1:], cmd)
+	if _, err := t.file.Write(report); err != nil {
+		return fmt.Errorf("HID write failed: %w", err)
+	}
+	return nil
+}
+
+// ReadPacket reads the next response input report.
+func (t *HIDTransport) ReadPacket() ([]byte, error) {
+	// Deadlines are best effort: not every kernel makes hidraw pollable
+	_ = t.file.SetReadDeadline(time.Now().Add(t.timeout))
+	resp := make([]byte, t.packetSize)
+	n, err := t.file.Read(resp)
+	if err != nil {
+		return nil, fmt.Errorf("HID read failed: %w", err)
+	}
+	return resp[:n], nil
+}
+
+// GetPacketSize returns the HID report size used for packets.
+func (t *HIDTransport) GetPacketSize() int {
+	return t.packetSize
+}
+
+// SetTimeout sets the response timeout.
+func (t *HIDTransport) SetTimeout(timeout time.Duration) {
+	t.timeout = timeout
+}
+
+// Close releases the hidraw device.
+func (t *HIDTransport) Close() error {
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
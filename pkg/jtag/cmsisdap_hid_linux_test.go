@@ -0,0 +1,32 @@
+package jtag
+
+import "testing"
+
+func TestParseHIDUevent(t *testing.T) {
+	text := "DRIVER=hid-generic\nHID_ID=0003:00000D28:00000204\nHID_NAME=ARM DAPLink CMSIS-DAP\nHID_PHYS=usb-0000:00:14.0-1/input3\nHID_UNIQ=0240000034544e45\n"
+
+	dev, ok := parseHIDUevent(text)
+	if !ok {
+		t.Fatalf("expected HID_ID to be parsed")
+	}
+	if dev.VID != 0x0D28 || dev.PID != 0x0204 {
+		t.Errorf("unexpected IDs %04X:%04X", dev.VID, dev.PID)
+	}
+	if dev.Name != "ARM DAPLink CMSIS-DAP" || dev.Serial != "0240000034544e45" {
+		t.Errorf("unexpected name/serial %q/%q", dev.Name, dev.Serial)
+	}
+
+	if _, ok := parseHIDUevent("DRIVER=hid-generic\n"); ok {
+		t.Errorf("uevent without HID_ID should be rejected")
+	}
+}
+
+func TestUSBPathFromSysfs(t *testing.T) {
+	path := "/sys/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2.3/1-2.3:1.0/0003:2E8A:000C.0001"
+	if got := usbPathFromSysfs(path); got != "1:2.3" {
+		t.Errorf("usbPathFromSysfs() = %q, want 1:2.3", got)
+	}
+	if got := usbPathFromSysfs("/sys/devices/virtual/misc/uhid/0003:2E8A:000C.0002"); got != "" {
+		t.Errorf("virtual device path = %q, want empty", got)
+	}
+}
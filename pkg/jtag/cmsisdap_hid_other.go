@@ -0,0 +1,46 @@
+//go:build !linux
+
+package jtag
+
+import (
+	"fmt"
+	"time"
+)
+
+// HIDTransport talks to a CMSIS-DAP v1 probe through its HID interface. It
+// is currently only implemented on Linux (hidraw).
+type HIDTransport struct{}
+
+// NewHIDTransport reports that CMSIS-DAP v1 HID probes are not supported on
+// this platform.
+func NewHIDTransport(vid, pid uint16, sel ProbeSelector) (*HIDTransport, error) {
+	return nil, fmt.Errorf("CMSIS-DAP v1 HID transport is only supported on Linux")
+}
+
+// WriteRead is not supported on this platform.
+func (t *HIDTransport) WriteRead(cmd []byte) ([]byte, error) {
+	return nil, ErrNotImplemented
+}
+
+// WritePacket is not supported on this platform.
+func (t *HIDTransport) WritePacket(cmd []byte) error {
+	return ErrNotImplemented
+}
+
+// ReadPacket is not supported on this platform.
+func (t *HIDTransport) ReadPacket() ([]byte, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetPacketSize returns the default packet size.
+func (t *HIDTransport) GetPacketSize() int {
+	return DefaultPacketSize
+}
+
+// SetTimeout is a no-op on this platform.
+func (t *HIDTransport) SetTimeout(timeout time.Duration) {}
+
+// Close is a no-op on this platform.
+func (t *HIDTransport) Close() error {
+	return nil
+}
@@ -0,0 +1,75 @@
+package jtag
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// swjPinsWaitUs bounds how long DAP_SWJ_Pins waits for driven pins to reach
+// their level, so a reset line held by the board is noticed rather than
+// returned as if it had moved.
+const swjPinsWaitUs = 1000
+
+// SetPins drives pins with DAP_SWJ_Pins and returns the levels read back.
+// Close sends DAP_Disconnect, which releases every line again.
+func (a *CMSISDAPAdapter) SetPins(mask, value AdapterPin) (AdapterPin, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.flushLocked(); err != nil {
+		return 0, err
+	}
+	return a.swjPins(byte(value&mask), byte(mask), swjPinsWaitUs)
+}
+
+// ReadPins returns the pin levels without driving anything.
+func (a *CMSISDAPAdapter) ReadPins() (AdapterPin, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.flushLocked(); err != nil {
+		return 0, err
+	}
+	return a.swjPins(0, 0, 0)
+}
+
+// TargetVoltage reads the target supply sensed by the probe with DAP_Info.
+// CMSIS-DAP reserves no Info ID for it, so firmware that senses the supply
+// reports it under a vendor ID, set in VoltageInfoID, as millivolts in a
+// 16-bit little-endian value. Without one, or when the probe answers with no
+// data, TargetVoltage returns ErrNotImplemented.
+func (a *CMSISDAPAdapter) TargetVoltage() (float64, error) {
+	if a.VoltageInfoID == 0 {
+		return 0, ErrNotImplemented
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.flushLocked(); err != nil {
+		return 0, err
+	}
+	resp, err := a.transport.WriteRead(a.protocol.EncodeInfo(a.VoltageInfoID))
+	if err != nil {
+		return 0, fmt.Errorf("target voltage query failed: %w", err)
+	}
+	if len(resp) < 2 || resp[0] != CmdInfo {
+		return 0, fmt.Errorf("invalid DAP_Info response")
+	}
+	if resp[1] < 2 || len(resp) < 4 {
+		return 0, ErrNotImplemented
+	}
+	return float64(binary.LittleEndian.Uint16(resp[2:4])) / 1000, nil
+}
+
+func (a *CMSISDAPAdapter) swjPins(output, selectMask byte, waitUs uint32) (AdapterPin, error) {
+	resp, err := a.transport.WriteRead(a.protocol.EncodeSWJPins(output, selectMask, waitUs))
+	if err != nil {
+		return 0, fmt.Errorf("pin access failed: %w", err)
+	}
+	levels, err := a.protocol.DecodeSWJPins(resp)
+	if err != nil {
+		return 0, err
+	}
+	return AdapterPin(levels), nil
+}
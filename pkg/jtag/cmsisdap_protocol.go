@@ -11,12 +11,18 @@ const (
 	CmdHostStatus    = 0x01
 	CmdConnect       = 0x02
 	CmdDisconnect    = 0x03
+	CmdTransferCfg   = 0x04
+	CmdTransfer      = 0x05
 	CmdResetTarget   = 0x0A
+	CmdSWJPins       = 0x10
 	CmdSWJClock      = 0x11
 	CmdSWJSequence   = 0x12
+	CmdSWDConfigure  = 0x13
 	CmdJTAGSequence  = 0x14
 	CmdJTAGConfigure = 0x15
 	CmdJTAGIDCODE    = 0x16
+	CmdSWDSequence   = 0x1D
+	CmdExecuteCmds   = 0x7F
 )
 
 // DAP_Info Info IDs
@@ -25,7 +31,7 @@ const (
 	InfoProductID    = 0x02
 	InfoSerialNum    = 0x03
 	InfoFirmwareVer  = 0x04
-	InfoCapabilities = 0xF0
+	InfoCapabilities = 0xF0 // Bit 0 SWD, bit 1 JTAG
 	InfoPacketCount  = 0xFE
 	InfoPacketSize   = 0xFF
 )
@@ -37,6 +43,14 @@ const (
 	PortJTAG    = 2
 )
 
+// DAP_Transfer request and response bits
+const (
+	TransferAPnDP       = 0x01 // Request: access an AP instead of the DP
+	TransferRnW         = 0x02 // Request: read instead of write
+	TransferAckMask     = 0x07 // Response: SWD ACK bits
+	TransferParityError = 0x08 // Response: read data parity mismatch
+)
+
 // Status codes
 const (
 	StatusOK    = 0x00
@@ -305,3 +319,120 @@ func (p *CMSISDAPProtocol) DecodeResetTarget(resp []byte) error {
 	}
 	return nil
 }
+
+// EncodeSWDConfigure builds a DAP_SWD_Configure command for the given
+// turnaround period (1-4 clocks) and data phase setting.
+func (p *CMSISDAPProtocol) EncodeSWDConfigure(turnaround int, dataPhase bool) []byte {
+	cfg := byte((turnaround - 1) & 0x03)
+	if dataPhase {
+		cfg |= 0x04
+	}
+	return []byte{CmdSWDConfigure, cfg}
+}
+
+// EncodeTransferConfigure builds a DAP_TransferConfigure command
+func (p *CMSISDAPProtocol) EncodeTransferConfigure(idleCycles uint8, waitRetry, matchRetry uint16) []byte {
+	cmd := make([]byte, 6)
+	cmd[0] = CmdTransferCfg
+	cmd[1] = idleCycles
+	binary.LittleEndian.PutUint16(cmd[2:], waitRetry)
+	binary.LittleEndian.PutUint16(cmd[4:], matchRetry)
+	return cmd
+}
+
+// DecodeStatus parses the common [command, status] response
+func (p *CMSISDAPProtocol) DecodeStatus(resp []byte, cmd byte) error {
+	if len(resp) < 2 {
+		return fmt.Errorf("response too short")
+	}
+	if resp[0] != cmd {
+		return fmt.Errorf("invalid command ID: 0x%02X", resp[0])
+	}
+	if resp[1] != StatusOK {
+		return fmt.Errorf("command 0x%02X failed", cmd)
+	}
+	return nil
+}
+
+// EncodeSWDSequence builds a DAP_SWD_Sequence command that clocks out bits
+// on SWDIO, LSB first. A single sequence carries at most 64 bits; longer
+// patterns are split.
+func (p *CMSISDAPProtocol) EncodeSWDSequence(bits int, data []byte) []byte {
+	cmd := []byte{CmdSWDSequence, 0}
+	for pos := 0; pos < bits; pos += 64 {
+		n := bits - pos
+		if n > 64 {
+			n = 64
+		}
+		chunk := make([]byte, (n+7)/8)
+		for i := 0; i < n; i++ {
+			bit := pos + i
+			if bit/8 < len(data) && data[bit/8]&(1<<(bit%8)) != 0 {
+				chunk[i/8] |= 1 << (i % 8)
+			}
+		}
+		cmd = append(cmd, byte(n&0x3F))
+		cmd = append(cmd, chunk...)
+		cmd[1]++
+	}
+	return cmd
+}
+
+// EncodeTransfer builds a DAP_Transfer command with a single transfer
+func (p *CMSISDAPProtocol) EncodeTransfer(ap, read bool, addr uint8, wdata uint32) []byte {
+	req := addr & 0x0C
+	if ap {
+		req |= TransferAPnDP
+	}
+	if read {
+		req |= TransferRnW
+	}
+	cmd := []byte{CmdTransfer, 0, 1, req}
+	if !read {
+		cmd = binary.LittleEndian.AppendUint32(cmd, wdata)
+	}
+	return cmd
+}
+
+// DecodeTransfer parses a single-transfer DAP_Transfer response into the
+// SWD ACK, whether read data failed its parity check, and the read data.
+func (p *CMSISDAPProtocol) DecodeTransfer(resp []byte, read bool) (SWDAck, bool, uint32, error) {
+	if len(resp) < 3 {
+		return 0, false, 0, fmt.Errorf("response too short")
+	}
+	if resp[0] != CmdTransfer {
+		return 0, false, 0, fmt.Errorf("invalid command ID: 0x%02X", resp[0])
+	}
+	ack := SWDAck(resp[2] & TransferAckMask)
+	parityErr := resp[2]&TransferParityError != 0
+	if resp[1] != 1 || ack != SWDAckOK || parityErr || !read {
+		return ack, parityErr, 0, nil
+	}
+	if len(resp) < 7 {
+		return 0, false, 0, fmt.Errorf("incomplete transfer data")
+	}
+	return ack, false, binary.LittleEndian.Uint32(resp[3:7]), nil
+}
+
+// EncodeSWJPins builds a DAP_SWJ_Pins command that drives the pins in
+// selectMask to output and then waits up to waitUs microseconds for them to
+// reach that level.
+func (p *CMSISDAPProtocol) EncodeSWJPins(output, selectMask byte, waitUs uint32) []byte {
+	cmd := make([]byte, 7)
+	cmd[0] = CmdSWJPins
+	cmd[1] = output
+	cmd[2] = selectMask
+	binary.LittleEndian.PutUint32(cmd[3:], waitUs)
+	return cmd
+}
+
+// DecodeSWJPins parses the pin levels from a DAP_SWJ_Pins response
+func (p *CMSISDAPProtocol) DecodeSWJPins(resp []byte) (byte, error) {
+	if len(resp) < 2 {
+		return 0, fmt.Errorf("response too short")
+	}
+	if resp[0] != CmdSWJPins {
+		return 0, fmt.Errorf("invalid command ID: 0x%02X", resp[0])
+	}
+	return resp[1], nil
+}
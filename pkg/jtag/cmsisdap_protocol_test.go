@@ -374,3 +374,50 @@ func TestProtocolEncodeSetClock(t *testing.T) {
 		})
 	}
 }
+
+func TestProtocolTransfer(t *testing.T) {
+	proto := NewCMSISDAPProtocol(64)
+
+	if got := proto.EncodeTransfer(true, true, 0x0C, 0); !bytes.Equal(got, []byte{0x05, 0x00, 0x01, 0x0F}) {
+		t.Errorf("EncodeTransfer(AP read 0xC) = %X", got)
+	}
+	want := []byte{0x05, 0x00, 0x01, 0x08, 0x78, 0x56, 0x34, 0x12}
+	if got := proto.EncodeTransfer(false, false, 0x08, 0x12345678); !bytes.Equal(got, want) {
+		t.Errorf("EncodeTransfer(DP write 0x8) = %X, want %X", got, want)
+	}
+
+	tests := []struct {
+		name       string
+		resp       []byte
+		wantAck    SWDAck
+		wantParity bool
+		wantData   uint32
+	}{
+		{"read ok", []byte{0x05, 0x01, 0x01, 0x77, 0x14, 0xA0, 0x2B}, SWDAckOK, false, 0x2BA01477},
+		{"wait", []byte{0x05, 0x00, 0x02}, SWDAckWait, false, 0},
+		{"fault", []byte{0x05, 0x00, 0x04}, SWDAckFault, false, 0},
+		{"parity", []byte{0x05, 0x00, 0x09}, SWDAckOK, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ack, parity, data, err := proto.DecodeTransfer(tt.resp, true)
+			if err != nil {
+				t.Fatalf("DecodeTransfer() error = %v", err)
+			}
+			if ack != tt.wantAck || parity != tt.wantParity || data != tt.wantData {
+				t.Errorf("DecodeTransfer() = %v, %v, 0x%08X", ack, parity, data)
+			}
+		})
+	}
+}
+
+func TestProtocolEncodeSWDSequence(t *testing.T) {
+	proto := NewCMSISDAPProtocol(64)
+
+	// 72 bits split into a 64-bit (count 0) and an 8-bit sequence
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	want := []byte{0x1D, 0x02, 0x00, 1, 2, 3, 4, 5, 6, 7, 8, 0x08, 9}
+	if got := proto.EncodeSWDSequence(72, data); !bytes.Equal(got, want) {
+		t.Errorf("EncodeSWDSequence() = %X, want %X", got, want)
+	}
+}
@@ -0,0 +1,291 @@
+package jtag
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// queuedShift is a shift accepted by QueueShiftIR/QueueShiftDR and not yet
+// sent to the probe.
+type queuedShift struct {
+	seqs    []JTAGSequence
+	bits    int
+	pending *PendingTDO
+}
+
+// dapPacket is one command packet: a single DAP_JTAG_Sequence command, or
+// several wrapped in DAP_ExecuteCommands.
+type dapPacket struct {
+	commands [][]JTAGSequence
+}
+
+// QueueShiftIR queues an instruction register shift. It is sent together
+// with other queued shifts on the next Flush or TDO read.
+func (a *CMSISDAPAdapter) QueueShiftIR(tms, tdi []byte, bits int) (*PendingTDO, error) {
+	return a.queueShift(tms, tdi, bits)
+}
+
+// QueueShiftDR queues a data register shift. It is sent together with other
+// queued shifts on the next Flush or TDO read.
+func (a *CMSISDAPAdapter) QueueShiftDR(tms, tdi []byte, bits int) (*PendingTDO, error) {
+	return a.queueShift(tms, tdi, bits)
+}
+
+func (a *CMSISDAPAdapter) queueShift(tms, tdi []byte, bits int) (*PendingTDO, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := ValidateShiftBuffers(tms, tdi, bits); err != nil {
+		return nil, err
+	}
+
+	p := &PendingTDO{flush: a.Flush}
+	a.queue = append(a.queue, queuedShift{
+		seqs:    a.buildSequences(tms, tdi, bits),
+		bits:    bits,
+		pending: p,
+	})
+	return p, nil
+}
+
+// Flush executes every queued shift and resolves their pending TDO. On
+// failure all of them resolve with the error.
+func (a *CMSISDAPAdapter) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.flushLocked()
+}
+
+func (a *CMSISDAPAdapter) flushLocked() error {
+	if len(a.queue) == 0 {
+		return nil
+	}
+	queue := a.queue
+	a.queue = nil
+
+	var sequences []JTAGSequence
+	for _, q := range queue {
+		sequences = append(sequences, q.seqs...)
+	}
+
+	tdos, err := a.runPackets(a.planPackets(sequences))
+	if err != nil {
+		err = fmt.Errorf("shift failed: %w", err)
+		for _, q := range queue {
+			q.pending.resolve(nil, err)
+		}
+		return err
+	}
+
+	// buildSequences captures TDO on every sequence, so tdos lines up with
+	// sequences one to one
+	next := 0
+	for _, q := range queue {
+		tdo := make([]byte, (q.bits+7)/8)
+		bitPos := 0
+		for _, seq := range q.seqs {
+			seqTDO := tdos[next]
+			next++
+			n := seq.TCKCount()
+			for bit := 0; bit < n && bitPos < q.bits; bit++ {
+				if seqTDO[bit/8]&(1<<(bit%8)) != 0 {
+					tdo[bitPos/8] |= 1 << (bitPos % 8)
+				}
+				bitPos++
+			}
+		}
+		q.pending.resolve(tdo, nil)
+	}
+	return nil
+}
+
+// planPackets packs sequences into as few packets as possible. Sequences are
+// appended to the current DAP_JTAG_Sequence command while its request and
+// response fit; after that a new command is started in the same packet via
+// DAP_ExecuteCommands when the firmware supports it, else a new packet.
+func (a *CMSISDAPAdapter) planPackets(sequences []JTAGSequence) []dapPacket {
+	size := a.transport.GetPacketSize()
+	fits := func(cmdSize, respSize int) bool {
+		return cmdSize <= size && respSize <= size
+	}
+
+	var packets []dapPacket
+	var cur dapPacket
+	cmdSize, respSize := 0, 0
+
+	for _, seq := range sequences {
+		seqCmd := 1 + len(seq.TDI)
+		seqResp := 0
+		if seq.CaptureTDO() {
+			seqResp = len(seq.TDI)
+		}
+
+		if n := len(cur.commands); n > 0 {
+			last := cur.commands[n-1]
+			if len(last) < 255 && fits(cmdSize+seqCmd, respSize+seqResp) {
+				cur.commands[n-1] = append(last, seq)
+				cmdSize += seqCmd
+				respSize += seqResp
+				continue
+			}
+
+			// A new command costs its own two-byte header, plus the
+			// DAP_ExecuteCommands header once the packet holds two
+			extra := 2
+			if n == 1 {
+				extra += 2
+			}
+			if a.executeCommands && n < 255 &&
+				fits(cmdSize+extra+seqCmd, respSize+extra+seqResp) {
+				cur.commands = append(cur.commands, []JTAGSequence{seq})
+				cmdSize += extra + seqCmd
+				respSize += extra + seqResp
+				continue
+			}
+
+			packets = append(packets, cur)
+		}
+
+		cur = dapPacket{commands: [][]JTAGSequence{{seq}}}
+		cmdSize, respSize = 2+seqCmd, 2+seqResp
+	}
+	if len(cur.commands) > 0 {
+		packets = append(packets, cur)
+	}
+	return packets
+}
+
+// encodePacket builds the request bytes for a planned packet.
+func (a *CMSISDAPAdapter) encodePacket(p dapPacket) []byte {
+	if len(p.commands) == 1 {
+		return a.protocol.EncodeJTAGSequence(p.commands[0])
+	}
+	cmd := []byte{CmdExecuteCmds, byte(len(p.commands))}
+	for _, seqs := range p.commands {
+		cmd = append(cmd, a.protocol.EncodeJTAGSequence(seqs)...)
+	}
+	return cmd
+}
+
+// decodePacket returns the captured TDO of every sequence in the packet.
+func (a *CMSISDAPAdapter) decodePacket(p dapPacket, resp []byte) ([][]byte, error) {
+	if len(p.commands) == 1 {
+		return a.protocol.DecodeJTAGSequence(resp, p.commands[0])
+	}
+
+	if len(resp) < 2 || resp[0] != CmdExecuteCmds {
+		return nil, fmt.Errorf("invalid DAP_ExecuteCommands response")
+	}
+	if int(resp[1]) != len(p.commands) {
+		return nil, fmt.Errorf("DAP_ExecuteCommands ran %d of %d commands", resp[1], len(p.commands))
+	}
+
+	var tdos [][]byte
+	offset := 2
+	for _, seqs := range p.commands {
+		n := 2
+		for _, seq := range seqs {
+			if seq.CaptureTDO() {
+				n += len(seq.TDI)
+			}
+		}
+		// A failed command answers with just its status, so pass the rest
+		// through and let the decoder report it
+		end := offset + n
+		if end > len(resp) {
+			end = len(resp)
+		}
+		out, err := a.protocol.DecodeJTAGSequence(resp[offset:end], seqs)
+		if err != nil {
+			return nil, err
+		}
+		tdos = append(tdos, out...)
+		offset = end
+	}
+	return tdos, nil
+}
+
+// runPackets sends the packets, keeping up to packetCount of them in flight
+// when the transport can split writes from reads, and returns the decoded TDO
+// of all sequences in order.
+func (a *CMSISDAPAdapter) runPackets(packets []dapPacket) ([][]byte, error) {
+	pipe, ok := a.transport.(PipelinedDAPTransport)
+	window := a.packetCount
+	if !ok || window < 1 {
+		pipe = &serialTransport{DAPTransport: a.transport}
+		window = 1
+	}
+
+	var tdos [][]byte
+	sent := 0
+	for done := 0; done < len(packets); done++ {
+		for sent < len(packets) && sent-done < window {
+			if err := pipe.WritePacket(a.encodePacket(packets[sent])); err != nil {
+				drainPackets(pipe, sent-done)
+				return nil, err
+			}
+			sent++
+		}
+
+		resp, err := pipe.ReadPacket()
+		if err != nil {
+			return nil, err
+		}
+		out, err := a.decodePacket(packets[done], resp)
+		if err != nil {
+			drainPackets(pipe, sent-done-1)
+			return nil, err
+		}
+		tdos = append(tdos, out...)
+	}
+	return tdos, nil
+}
+
+// drainPackets reads and discards the responses to packets still in flight
+// so the next command sees its own response.
+func drainPackets(pipe PipelinedDAPTransport, n int) {
+	for i := 0; i < n; i++ {
+		if _, err := pipe.ReadPacket(); err != nil {
+			return
+		}
+	}
+}
+
+// serialTransport adapts a plain DAPTransport to the pipelined interface with
+// one packet in flight.
+type serialTransport struct {
+	DAPTransport
+	resp []byte
+	err  error
+}
+
+func (t *serialTransport) WritePacket(cmd []byte) error {
+	t.resp, t.err = t.WriteRead(cmd)
+	return t.err
+}
+
+func (t *serialTransport) ReadPacket() ([]byte, error) {
+	resp, err := t.resp, t.err
+	t.resp, t.err = nil, nil
+	return resp, err
+}
+
+// supportsExecuteCommands reports whether a DAP_Info firmware version is at
+// least 1.1, which introduced DAP_ExecuteCommands. v1 firmware reports
+// versions like "1.10", v2 firmware like "2.1.0".
+func supportsExecuteCommands(firmware string) bool {
+	parts := strings.SplitN(strings.TrimSpace(firmware), ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	return major > 1 || (major == 1 && minor > 0)
+}
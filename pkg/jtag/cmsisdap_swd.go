@@ -0,0 +1,94 @@
+package jtag
+
+import "fmt"
+
+// EnableSWD reconnects the probe in SWD mode and configures the SWD and
+// transfer parameters. JTAG shifts fail until the adapter is reopened.
+func (a *CMSISDAPAdapter) EnableSWD() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.flushLocked(); err != nil {
+		return err
+	}
+
+	resp, err := a.transport.WriteRead(a.protocol.EncodeConnect(PortSWD))
+	if err != nil {
+		return fmt.Errorf("SWD connect failed: %w", err)
+	}
+	port, err := a.protocol.DecodeConnect(resp)
+	if err != nil {
+		return err
+	}
+	if port != PortSWD {
+		return fmt.Errorf("probe does not support SWD (got port %d)", port)
+	}
+
+	// One turnaround clock, no data phase on WAIT/FAULT. WAIT is retried by
+	// SWDPort, so the firmware reports it straight away.
+	for _, cmd := range [][]byte{
+		a.protocol.EncodeSWDConfigure(1, false),
+		a.protocol.EncodeTransferConfigure(0, 0, 0),
+	} {
+		resp, err := a.transport.WriteRead(cmd)
+		if err != nil {
+			return fmt.Errorf("SWD configure failed: %w", err)
+		}
+		if err := a.protocol.DecodeStatus(resp, cmd[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SWDSequence clocks bits out on SWDIO with DAP_SWD_Sequence.
+func (a *CMSISDAPAdapter) SWDSequence(bits int, data []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := ValidateShiftBuffers(nil, data, bits); err != nil {
+		return err
+	}
+	// Each 64-bit chunk takes 9 bytes, so keep commands within a packet
+	maxBits := (a.transport.GetPacketSize() - 2) / 9 * 64
+	for pos := 0; pos < bits; pos += maxBits {
+		n := bits - pos
+		if n > maxBits {
+			n = maxBits
+		}
+		chunk := make([]byte, (n+7)/8)
+		for i := 0; i < n; i++ {
+			bit := pos + i
+			if bit/8 < len(data) && data[bit/8]&(1<<(bit%8)) != 0 {
+				chunk[i/8] |= 1 << (i % 8)
+			}
+		}
+		resp, err := a.transport.WriteRead(a.protocol.EncodeSWDSequence(n, chunk))
+		if err != nil {
+			return fmt.Errorf("SWD sequence failed: %w", err)
+		}
+		if err := a.protocol.DecodeStatus(resp, CmdSWDSequence); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SWDTransfer runs one DP or AP access with DAP_Transfer.
+func (a *CMSISDAPAdapter) SWDTransfer(ap, read bool, addr uint8, wdata uint32) (uint32, SWDAck, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	resp, err := a.transport.WriteRead(a.protocol.EncodeTransfer(ap, read, addr, wdata))
+	if err != nil {
+		return 0, 0, fmt.Errorf("SWD transfer failed: %w", err)
+	}
+	ack, parityErr, data, err := a.protocol.DecodeTransfer(resp, read)
+	if err != nil {
+		return 0, 0, err
+	}
+	if parityErr {
+		return 0, ack, ErrSWDParity
+	}
+	return data, ack, nil
+}
@@ -1,6 +1,9 @@
 package jtag
 
 import (
+	"bytes"
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -127,6 +130,327 @@ func TestCMSISDAPAdapter_ValidateInterface(t *testing.T) {
 	var _ Adapter = (*CMSISDAPAdapter)(nil)
 }
 
+func TestCMSISDAPAdapter_ValidateQueuedInterface(t *testing.T) {
+	var _ QueuedAdapter = (*CMSISDAPAdapter)(nil)
+	var _ PipelinedDAPTransport = (*FakeDAPTransport)(nil)
+}
+
+// newFakeAdapter opens an adapter on fake and clears the setup commands.
+func newFakeAdapter(t *testing.T, fake *FakeDAPTransport) *CMSISDAPAdapter {
+	t.Helper()
+	adapter, err := NewCMSISDAPAdapterWithTransport(fake)
+	if err != nil {
+		t.Fatalf("NewCMSISDAPAdapterWithTransport() failed: %v", err)
+	}
+	fake.commands = nil
+	return adapter
+}
+
+func TestCMSISDAPAdapter_FakeTransport(t *testing.T) {
+	fake := NewFakeDAPTransport()
+	fake.PacketCount = 8
+	fake.IDCodes = []uint32{0x4BA00477}
+	adapter := newFakeAdapter(t, fake)
+
+	info, _ := adapter.Info()
+	if info.Vendor != "OpenTraceLab" || info.SerialNumber != "FAKE0001" {
+		t.Errorf("Info() = %+v", info)
+	}
+	if adapter.packetCount != 8 || !adapter.executeCommands {
+		t.Errorf("packetCount=%d executeCommands=%v, want 8 and true",
+			adapter.packetCount, adapter.executeCommands)
+	}
+	if fake.Clock() != 1_000_000 {
+		t.Errorf("clock = %d, want 1000000", fake.Clock())
+	}
+
+	if err := adapter.ConfigureJTAGChain([]byte{4}); err != nil {
+		t.Fatalf("ConfigureJTAGChain() failed: %v", err)
+	}
+	id, err := adapter.ReadIDCODE(0)
+	if err != nil || id != 0x4BA00477 {
+		t.Errorf("ReadIDCODE() = 0x%08X, %v", id, err)
+	}
+
+	adapter.Close()
+	if !fake.Closed() {
+		t.Error("transport not closed")
+	}
+}
+
+func TestCMSISDAPAdapter_ShiftOverFake(t *testing.T) {
+	adapter := newFakeAdapter(t, NewFakeDAPTransport())
+
+	// 300 bits with TMS toggling on the last bit spans several packets and
+	// sequences that are not byte multiples
+	bits := 300
+	tdi := make([]byte, (bits+7)/8)
+	for i := range tdi {
+		tdi[i] = byte(i*37 + 5)
+	}
+	tdi[len(tdi)-1] &= 0x0F
+	tms := make([]byte, len(tdi))
+	tms[(bits-1)/8] = 1 << ((bits - 1) % 8)
+
+	tdo, err := adapter.ShiftDR(tms, tdi, bits)
+	if err != nil {
+		t.Fatalf("ShiftDR() failed: %v", err)
+	}
+	if !bytes.Equal(tdo, tdi) {
+		t.Errorf("loopback TDO mismatch:\n got %X\nwant %X", tdo, tdi)
+	}
+}
+
+func TestCMSISDAPAdapter_ResetSpeedClose(t *testing.T) {
+	fake := NewFakeDAPTransport()
+	adapter := newFakeAdapter(t, fake)
+
+	if err := adapter.ResetTAP(false); err != nil {
+		t.Fatalf("ResetTAP(false) failed: %v", err)
+	}
+	if err := adapter.ResetTAP(true); err != nil {
+		t.Fatalf("ResetTAP(true) failed: %v", err)
+	}
+	cmds := fake.Commands()
+	if len(cmds) != 2 || cmds[0][0] != CmdJTAGSequence || cmds[1][0] != CmdResetTarget {
+		t.Fatalf("reset commands = %X", cmds)
+	}
+	// Soft reset: one sequence of 5 clocks with TMS high
+	if seq := (JTAGSequence{Info: cmds[0][2]}); cmds[0][1] != 1 || seq.TCKCount() != 5 || !seq.TMS() {
+		t.Errorf("soft reset sequence = %X", cmds[0])
+	}
+
+	if err := adapter.SetSpeed(20_000_000); err == nil {
+		t.Error("SetSpeed accepted 20 MHz")
+	}
+	if err := adapter.SetSpeed(250_000); err != nil || fake.Clock() != 250_000 {
+		t.Errorf("SetSpeed(250000): clock %d, %v", fake.Clock(), err)
+	}
+
+	fake.commands = nil
+	adapter.Close()
+	if cmds := fake.Commands(); len(cmds) != 1 || cmds[0][0] != CmdDisconnect {
+		t.Errorf("Close sent %X, want DAP_Disconnect", cmds)
+	}
+	if !fake.Closed() {
+		t.Error("transport not closed")
+	}
+}
+
+func TestCMSISDAPAdapter_V1Firmware(t *testing.T) {
+	// A v1 HID probe: one 64-byte packet at a time, no DAP_ExecuteCommands
+	fake := NewFakeDAPTransport()
+	fake.PacketCount = 1
+	fake.Firmware = "1.0"
+	adapter := newFakeAdapter(t, fake)
+	if adapter.packetCount != 1 || adapter.executeCommands {
+		t.Fatalf("packetCount=%d executeCommands=%v, want 1 and false",
+			adapter.packetCount, adapter.executeCommands)
+	}
+
+	tdi := []byte{0xA5, 0x5A, 0x0F}
+	tdo, err := adapter.ShiftDR(make([]byte, 3), tdi, 20)
+	if err != nil {
+		t.Fatalf("ShiftDR() failed: %v", err)
+	}
+	if !bytes.Equal(tdo, []byte{0xA5, 0x5A, 0x0F}) {
+		t.Errorf("TDO = %X, want %X", tdo, tdi)
+	}
+	for _, cmd := range fake.Commands() {
+		if cmd[0] == CmdExecuteCmds {
+			t.Errorf("v1 firmware was sent DAP_ExecuteCommands: %X", cmd)
+		}
+	}
+}
+
+func TestCMSISDAPAdapter_InitFailure(t *testing.T) {
+	// The probe refuses the JTAG port, e.g. an SWD-only firmware
+	fake := NewFakeDAPTransport()
+	refusing := &refusingConnect{FakeDAPTransport: fake}
+	if _, err := NewCMSISDAPAdapterWithTransport(refusing); err == nil {
+		t.Fatal("NewCMSISDAPAdapterWithTransport() accepted a probe without JTAG")
+	}
+	if !fake.Closed() {
+		t.Error("transport left open after failed initialisation")
+	}
+}
+
+// refusingConnect answers DAP_Connect with port 0 (failed).
+type refusingConnect struct {
+	*FakeDAPTransport
+}
+
+func (r *refusingConnect) WriteRead(cmd []byte) ([]byte, error) {
+	if len(cmd) > 0 && cmd[0] == CmdConnect {
+		return []byte{CmdConnect, 0}, nil
+	}
+	return r.FakeDAPTransport.WriteRead(cmd)
+}
+
+func TestOpenCMSISDAPAdapter(t *testing.T) {
+	// Only a DAPLink (0D28:0204) is attached
+	fake := NewFakeDAPTransport()
+	var tried []uint16
+	defer func(open func(vid, pid uint16, sel ProbeSelector) (DAPTransport, error)) {
+		openCMSISDAPTransport = open
+	}(openCMSISDAPTransport)
+	openCMSISDAPTransport = func(vid, pid uint16, sel ProbeSelector) (DAPTransport, error) {
+		tried = append(tried, vid)
+		if sel.Serial != "FAKE0001" {
+			t.Errorf("selector %s not passed through", sel)
+		}
+		if vid == 0x0d28 && pid == 0x0204 {
+			return fake, nil
+		}
+		return nil, fmt.Errorf("not found")
+	}
+
+	adapter, err := OpenCMSISDAPAdapter(ProbeSelector{Serial: "FAKE0001"})
+	if err != nil {
+		t.Fatalf("OpenCMSISDAPAdapter() failed: %v", err)
+	}
+	defer adapter.Close()
+	if len(tried) != 2 || tried[0] != VendorIDRaspberryPi {
+		t.Errorf("tried vendors %04X, want the Raspberry Pi probe first, then DAPLink", tried)
+	}
+
+	openCMSISDAPTransport = func(vid, pid uint16, sel ProbeSelector) (DAPTransport, error) {
+		return nil, fmt.Errorf("not found")
+	}
+	if _, err := OpenCMSISDAPAdapter(ProbeSelector{}); err == nil ||
+		!strings.Contains(err.Error(), "0D28:0204") {
+		t.Errorf("error without probes = %v, want every VID:PID listed", err)
+	}
+}
+
+func TestCMSISDAPAdapter_QueuePacksShifts(t *testing.T) {
+	fake := NewFakeDAPTransport()
+	adapter := newFakeAdapter(t, fake)
+
+	// Each shift is a 7-bit run plus a TMS exit bit: two sequences
+	var pending []*PendingTDO
+	for i := 0; i < 40; i++ {
+		p, err := adapter.QueueShiftDR([]byte{0x80}, []byte{byte(i)}, 8)
+		if err != nil {
+			t.Fatalf("QueueShiftDR() failed: %v", err)
+		}
+		pending = append(pending, p)
+	}
+	if n := len(fake.Commands()); n != 0 {
+		t.Fatalf("%d packets sent before any TDO was read", n)
+	}
+
+	for i, p := range pending {
+		tdo, err := p.TDO()
+		if err != nil {
+			t.Fatalf("TDO(%d) failed: %v", i, err)
+		}
+		if tdo[0] != byte(i) {
+			t.Errorf("TDO(%d) = 0x%02X, want 0x%02X", i, tdo[0], byte(i))
+		}
+	}
+
+	// 80 sequences of 2 bytes each fit in 3 packets of 64 bytes
+	if n := len(fake.Commands()); n > 3 {
+		t.Errorf("sent %d packets for 40 shifts, want at most 3", n)
+	}
+}
+
+func TestCMSISDAPAdapter_QueueSplitsCommands(t *testing.T) {
+	tests := []struct {
+		name        string
+		firmware    string
+		wantPackets int
+	}{
+		{name: "v2 firmware", firmware: "2.1.0", wantPackets: 1},
+		{name: "v1.1 firmware", firmware: "1.10", wantPackets: 1},
+		{name: "v1.0 firmware", firmware: "1.0", wantPackets: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFakeDAPTransport()
+			fake.PacketSize = 1024
+			fake.Firmware = tt.firmware
+			adapter := newFakeAdapter(t, fake)
+
+			// 300 alternating-TMS bits make 300 one-bit sequences, more than
+			// one DAP_JTAG_Sequence command may hold
+			bits := 300
+			tms := make([]byte, (bits+7)/8)
+			tdi := make([]byte, len(tms))
+			for i := range tms {
+				tms[i] = 0x55
+				tdi[i] = byte(i * 11)
+			}
+			tms[len(tms)-1] &= 0x0F
+			tdi[len(tdi)-1] &= 0x0F
+
+			tdo, err := adapter.ShiftDR(tms, tdi, bits)
+			if err != nil {
+				t.Fatalf("ShiftDR() failed: %v", err)
+			}
+			if !bytes.Equal(tdo, tdi) {
+				t.Errorf("loopback TDO mismatch:\n got %X\nwant %X", tdo, tdi)
+			}
+
+			packets := fake.Commands()
+			if len(packets) != tt.wantPackets {
+				t.Errorf("sent %d packets, want %d", len(packets), tt.wantPackets)
+			}
+			if tt.wantPackets == 1 && packets[0][0] != CmdExecuteCmds {
+				t.Errorf("packet starts with 0x%02X, want DAP_ExecuteCommands", packets[0][0])
+			}
+		})
+	}
+}
+
+func TestCMSISDAPAdapter_QueuePipelines(t *testing.T) {
+	fake := NewFakeDAPTransport()
+	fake.PacketCount = 2
+	adapter := newFakeAdapter(t, fake)
+
+	// 2560 bits need several packets; the fake fails if more than
+	// PacketCount are outstanding
+	var pending []*PendingTDO
+	for i := 0; i < 10; i++ {
+		tdi := bytes.Repeat([]byte{byte(i)}, 32)
+		p, err := adapter.QueueShiftDR(nil, tdi, 256)
+		if err != nil {
+			t.Fatalf("QueueShiftDR() failed: %v", err)
+		}
+		pending = append(pending, p)
+	}
+	if err := adapter.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+	for i, p := range pending {
+		tdo, err := p.TDO()
+		if err != nil || !bytes.Equal(tdo, bytes.Repeat([]byte{byte(i)}, 32)) {
+			t.Errorf("TDO(%d) = %X, %v", i, tdo, err)
+		}
+	}
+	if n := len(fake.Commands()); n <= fake.PacketCount {
+		t.Errorf("sent %d packets, want more than the %d in flight", n, fake.PacketCount)
+	}
+}
+
+func TestCMSISDAPAdapter_QueueError(t *testing.T) {
+	fake := NewFakeDAPTransport()
+	adapter := newFakeAdapter(t, fake)
+
+	first, _ := adapter.QueueShiftDR(nil, []byte{0x01}, 8)
+	second, _ := adapter.QueueShiftIR(nil, []byte{0x02}, 8)
+	fake.Close()
+
+	if _, err := second.TDO(); err == nil {
+		t.Error("TDO() succeeded on a closed transport")
+	}
+	if _, err := first.TDO(); err == nil {
+		t.Error("earlier shift in the failed flush did not report the error")
+	}
+}
+
 // Integration test - requires real CMSIS-DAP hardware
 func TestCMSISDAPAdapter_Integration(t *testing.T) {
 	if testing.Short() {
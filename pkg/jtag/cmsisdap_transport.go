@@ -23,7 +23,46 @@ const (
 	DefaultTimeout    = 5 * time.Second
 )
 
-// USBTransport handles USB communication with CMSIS-DAP probe
+// DAPTransport carries CMSIS-DAP command and response packets between the
+// host and a probe. WriteRead sends one command packet and returns the
+// matching response packet.
+type DAPTransport interface {
+	WriteRead(cmd []byte) ([]byte, error)
+	GetPacketSize() int
+	Close() error
+}
+
+// PipelinedDAPTransport is implemented by transports that can have several
+// command packets outstanding before their responses are read, up to the
+// packet count the probe reports. Responses arrive in command order.
+type PipelinedDAPTransport interface {
+	DAPTransport
+	WritePacket(cmd []byte) error
+	ReadPacket() ([]byte, error)
+}
+
+// OpenCMSISDAPTransport opens the probe with the given VID:PID chosen by sel,
+// preferring the CMSIS-DAP v2 bulk interface and falling back to the v1 HID
+// interface for probes that only implement v1. The bulk attempt checks the
+// descriptors before claiming anything, so it leaves the HID driver of a
+// v1-only probe attached for the fallback.
+func OpenCMSISDAPTransport(vid, pid uint16, sel ProbeSelector) (DAPTransport, error) {
+	bulk, bulkErr := NewUSBTransportForProbe(vid, pid, sel)
+	if bulkErr == nil {
+		return bulk, nil
+	}
+	hid, hidErr := NewHIDTransport(vid, pid, sel)
+	if hidErr == nil {
+		return hid, nil
+	}
+	return nil, fmt.Errorf("no CMSIS-DAP interface usable (v2 bulk: %v; v1 HID: %v)", bulkErr, hidErr)
+}
+
+// openCMSISDAPTransport is OpenCMSISDAPTransport, replaced in tests.
+var openCMSISDAPTransport = OpenCMSISDAPTransport
+
+// USBTransport handles USB communication with a CMSIS-DAP v2 probe over its
+// vendor-class bulk endpoints.
 type USBTransport struct {
 	ctx  *gousb.Context
 	dev  *gousb.Device
@@ -32,6 +71,7 @@ type USBTransport struct {
 	epOut *gousb.OutEndpoint
 	epIn  *gousb.InEndpoint
 
+	intfNum    int // Vendor-class interface carrying the bulk endpoints
 	packetSize int
 	timeout    time.Duration
 
@@ -41,17 +81,50 @@ type USBTransport struct {
 
 // NewUSBTransport creates a USB transport for CMSIS-DAP
 func NewUSBTransport(vid, pid uint16) (*USBTransport, error) {
+	return NewUSBTransportForProbe(vid, pid, ProbeSelector{})
+}
+
+// NewUSBTransportForProbe creates a USB transport for the CMSIS-DAP probe
+// with the given VID:PID that matches sel.
+func NewUSBTransportForProbe(vid, pid uint16, sel ProbeSelector) (*USBTransport, error) {
 	ctx := gousb.NewContext()
 
-	// Find and open device
-	dev, err := ctx.OpenDeviceWithVIDPID(gousb.ID(vid), gousb.ID(pid))
-	if err != nil {
-		ctx.Close()
-		return nil, fmt.Errorf("USB error: %w", err)
+	// Open every candidate; the serial is only readable once open
+	byPath := ProbeSelector{Path: sel.Path}
+	devs, err := ctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+		return uint16(desc.Vendor) == vid && uint16(desc.Product) == pid &&
+			byPath.Matches("", FormatUSBPath(desc.Bus, desc.Path))
+	})
+
+	var dev *gousb.Device
+	for _, d := range devs {
+		if dev == nil {
+			serial := ""
+			if sel.Serial != "" {
+				serial, _ = d.SerialNumber()
+			}
+			if sel.Matches(serial, FormatUSBPath(d.Desc.Bus, d.Desc.Path)) {
+				dev = d
+				continue
+			}
+		}
+		d.Close()
 	}
 	if dev == nil {
 		ctx.Close()
-		return nil, fmt.Errorf("device not found (VID:0x%04X PID:0x%04X)", vid, pid)
+		if err != nil {
+			return nil, fmt.Errorf("USB error: %w", err)
+		}
+		return nil, fmt.Errorf("device not found (VID:0x%04X PID:0x%04X, %s)", vid, pid, sel)
+	}
+
+	// A v1-only probe has no bulk interface; detaching its HID driver
+	// would hide the hidraw node the HID transport needs
+	intfNum, ok := bulkInterface(dev.Desc, 1)
+	if !ok {
+		dev.Close()
+		ctx.Close()
+		return nil, fmt.Errorf("no CMSIS-DAP v2 bulk interface (VID:0x%04X PID:0x%04X)", vid, pid)
 	}
 
 	// Set auto-detach kernel driver (important for Linux)
@@ -63,6 +136,7 @@ func NewUSBTransport(vid, pid uint16) (*USBTransport, error) {
 	transport := &USBTransport{
 		ctx:        ctx,
 		dev:        dev,
+		intfNum:    intfNum,
 		packetSize: DefaultPacketSize,
 		timeout:    DefaultTimeout,
 		vid:        vid,
@@ -79,37 +153,48 @@ func NewUSBTransport(vid, pid uint16) (*USBTransport, error) {
 	return transport, nil
 }
 
-// claimInterface finds and claims the CMSIS-DAP vendor interface
-func (t *USBTransport) claimInterface() error {
-	// CMSIS-DAP typically uses interface 0 (vendor class)
-	// But we should search for the vendor interface to be safe
-	cfg, err := t.dev.Config(1)
-	if err != nil {
-		return fmt.Errorf("failed to get config: %w", err)
+// bulkInterface returns the vendor-class (0xFF) interface of configuration
+// cfgNum that has bulk IN and OUT endpoints, as CMSIS-DAP v2 requires. It
+// reads descriptors only, so nothing is claimed or detached.
+func bulkInterface(desc *gousb.DeviceDesc, cfgNum int) (int, bool) {
+	cfg, ok := desc.Configs[cfgNum]
+	if !ok {
+		return 0, false
 	}
-
-	// Find vendor interface (class 0xFF)
-	var vendorIntfNum int = -1
-	for _, intf := range cfg.Desc.Interfaces {
-		if len(intf.AltSettings) > 0 {
-			alt := intf.AltSettings[0]
-			// CMSIS-DAP uses vendor-specific class (0xFF)
-			if alt.Class == gousb.ClassVendorSpec {
-				vendorIntfNum = intf.Number
-				break
+	for _, intf := range cfg.Interfaces {
+		if len(intf.AltSettings) == 0 || intf.AltSettings[0].Class != gousb.ClassVendorSpec {
+			continue
+		}
+		var in, out bool
+		for _, ep := range intf.AltSettings[0].Endpoints {
+			if ep.TransferType != gousb.TransferTypeBulk {
+				continue
 			}
+			if ep.Direction == gousb.EndpointDirectionIn {
+				in = true
+			} else {
+				out = true
+			}
+		}
+		if in && out {
+			return intf.Number, true
 		}
 	}
+	return 0, false
+}
 
-	if vendorIntfNum == -1 {
-		// Fall back to interface 0
-		vendorIntfNum = 0
+// claimInterface claims the CMSIS-DAP vendor interface found by
+// bulkInterface
+func (t *USBTransport) claimInterface() error {
+	cfg, err := t.dev.Config(1)
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
 	}
 
 	// Claim the interface
-	intf, err := cfg.Interface(vendorIntfNum, 0)
+	intf, err := cfg.Interface(t.intfNum, 0)
 	if err != nil {
-		return fmt.Errorf("failed to claim interface %d: %w", vendorIntfNum, err)
+		return fmt.Errorf("failed to claim interface %d: %w", t.intfNum, err)
 	}
 	t.intf = intf
 
@@ -214,6 +299,22 @@ func (t *USBTransport) WriteRead(cmd []byte) ([]byte, error) {
 	return resp[:n], nil
 }
 
+// WritePacket sends a command packet without waiting for its response.
+func (t *USBTransport) WritePacket(cmd []byte) error {
+	_, err := t.Write(cmd)
+	return err
+}
+
+// ReadPacket reads the next response packet.
+func (t *USBTransport) ReadPacket() ([]byte, error) {
+	resp := make([]byte, t.packetSize)
+	n, err := t.Read(resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp[:n], nil
+}
+
 // GetPacketSize returns the current packet size
 func (t *USBTransport) GetPacketSize() int {
 	return t.packetSize
@@ -276,6 +377,7 @@ func EnumerateCMSISDAPProbes() ([]DeviceInfo, error) {
 			VID:          uint16(dev.Desc.Vendor),
 			PID:          uint16(dev.Desc.Product),
 			SerialNumber: serial,
+			Path:         FormatUSBPath(dev.Desc.Bus, dev.Desc.Path),
 			Description:  fmt.Sprintf("%s %s", manufacturer, product),
 		}
 
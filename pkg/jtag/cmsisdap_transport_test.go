@@ -2,6 +2,8 @@ package jtag
 
 import (
 	"testing"
+
+	"github.com/google/gousb"
 )
 
 func TestUSBTransportConstants(t *testing.T) {
@@ -78,3 +80,41 @@ func TestUSBTransportIntegration(t *testing.T) {
 		t.Logf("Probe vendor: %s", vendor)
 	}
 }
+
+func TestBulkInterface(t *testing.T) {
+	bulk := map[gousb.EndpointAddress]gousb.EndpointDesc{
+		0x01: {Number: 1, Direction: gousb.EndpointDirectionOut, TransferType: gousb.TransferTypeBulk},
+		0x81: {Number: 1, Direction: gousb.EndpointDirectionIn, TransferType: gousb.TransferTypeBulk},
+	}
+	hid := map[gousb.EndpointAddress]gousb.EndpointDesc{
+		0x02: {Number: 2, Direction: gousb.EndpointDirectionOut, TransferType: gousb.TransferTypeInterrupt},
+		0x82: {Number: 2, Direction: gousb.EndpointDirectionIn, TransferType: gousb.TransferTypeInterrupt},
+	}
+	device := func(intfs ...gousb.InterfaceSetting) *gousb.DeviceDesc {
+		cfg := gousb.ConfigDesc{Number: 1}
+		for _, alt := range intfs {
+			cfg.Interfaces = append(cfg.Interfaces, gousb.InterfaceDesc{Number: alt.Number, AltSettings: []gousb.InterfaceSetting{alt}})
+		}
+		return &gousb.DeviceDesc{Configs: map[int]gousb.ConfigDesc{1: cfg}}
+	}
+
+	// v1-only probe: a HID interface on 0 must not be mistaken for bulk
+	if n, ok := bulkInterface(device(gousb.InterfaceSetting{Number: 0, Class: gousb.ClassHID, Endpoints: hid}), 1); ok {
+		t.Errorf("v1-only probe reported bulk interface %d", n)
+	}
+	// Vendor class without bulk endpoints is not CMSIS-DAP v2 either
+	if n, ok := bulkInterface(device(gousb.InterfaceSetting{Number: 0, Class: gousb.ClassVendorSpec, Endpoints: hid}), 1); ok {
+		t.Errorf("vendor interface without bulk endpoints reported as %d", n)
+	}
+	// Composite v1+v2 probe: the bulk interface follows the HID one
+	desc := device(
+		gousb.InterfaceSetting{Number: 0, Class: gousb.ClassHID, Endpoints: hid},
+		gousb.InterfaceSetting{Number: 1, Class: gousb.ClassVendorSpec, Endpoints: bulk},
+	)
+	if n, ok := bulkInterface(desc, 1); !ok || n != 1 {
+		t.Errorf("bulkInterface() = %d, %v; want 1, true", n, ok)
+	}
+	if _, ok := bulkInterface(desc, 2); ok {
+		t.Error("bulkInterface() found an interface in a missing configuration")
+	}
+}
@@ -24,7 +24,7 @@ type InterfaceInfo struct {
 	VendorID    uint16
 	ProductID   uint16
 	Serial      string
-	Path        string
+	Path        string // USB bus:port, e.g. "1:2.3"
 }
 
 // Label returns a user-friendly description for the interface.
@@ -39,14 +39,16 @@ func (i InterfaceInfo) Label() string {
 }
 
 // DiscoverInterfaces enumerates connected JTAG-capable USB devices that match
-// known VID/PID pairs. It always returns at least the simulator entry so the
-// user can exercise the UI without hardware connected.
+// known VID/PID pairs, with their USB path and, where the device can be
+// opened, serial number. It always returns at least the simulator entry so
+// the user can exercise the UI without hardware connected.
 func DiscoverInterfaces(ctx context.Context) ([]InterfaceInfo, error) {
 	var results []InterfaceInfo
 	usb := gousb.NewContext()
 	defer usb.Close()
 
-	_, err := usb.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+	// Known devices are opened so their serial string can be read
+	devs, err := usb.OpenDevices(func(desc *gousb.DeviceDesc) bool {
 		select {
 		case <-ctx.Done():
 			return false
@@ -54,10 +56,22 @@ func DiscoverInterfaces(ctx context.Context) ([]InterfaceInfo, error) {
 		}
 
 		if info, ok := classifyUSBDevice(desc); ok {
+			info.Path = FormatUSBPath(desc.Bus, desc.Path)
 			results = append(results, info)
+			return true
 		}
 		return false
 	})
+	for _, dev := range devs {
+		path := FormatUSBPath(dev.Desc.Bus, dev.Desc.Path)
+		serial, _ := dev.SerialNumber()
+		for i := range results {
+			if results[i].Path == path {
+				results[i].Serial = serial
+			}
+		}
+		dev.Close()
+	}
 	if err != nil && err != gousb.ErrorAccess {
 		return results, err
 	}
@@ -70,6 +84,16 @@ func DiscoverInterfaces(ctx context.Context) ([]InterfaceInfo, error) {
 	return results, nil
 }
 
+// Selector returns a ProbeSelector that reopens this interface: by serial
+// number when known, since it survives moving the probe to another port, and
+// by USB path otherwise.
+func (i InterfaceInfo) Selector() ProbeSelector {
+	if i.Serial != "" {
+		return ProbeSelector{Serial: i.Serial}
+	}
+	return ProbeSelector{Path: i.Path}
+}
+
 func classifyUSBDevice(desc *gousb.DeviceDesc) (InterfaceInfo, bool) {
 	for _, known := range knownCMSISDAPVIDPIDs {
 		if uint16(desc.Vendor) == known.VendorID && uint16(desc.Product) == known.ProductID {
@@ -0,0 +1,105 @@
+package jtag
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AdapterPin is a set of probe control lines. The bit layout follows
+// CMSIS-DAP DAP_SWJ_Pins so masks pass straight through to the probe.
+type AdapterPin uint8
+
+const (
+	PinTCK    AdapterPin = 1 << 0 // TCK / SWCLK
+	PinTMS    AdapterPin = 1 << 1 // TMS / SWDIO
+	PinTDI    AdapterPin = 1 << 2
+	PinTDO    AdapterPin = 1 << 3
+	PinNTRST  AdapterPin = 1 << 5 // Active-low TAP reset
+	PinNRESET AdapterPin = 1 << 7 // Active-low system reset (SRST)
+)
+
+var adapterPinNames = []struct {
+	pin  AdapterPin
+	name string
+}{
+	{PinTCK, "TCK"},
+	{PinTMS, "TMS"},
+	{PinTDI, "TDI"},
+	{PinTDO, "TDO"},
+	{PinNTRST, "nTRST"},
+	{PinNRESET, "nRESET"},
+}
+
+func (p AdapterPin) String() string {
+	var names []string
+	for _, n := range adapterPinNames {
+		if p&n.pin != 0 {
+			names = append(names, n.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// ParseAdapterPin resolves a pin name such as "nRESET", "SRST" or "TRST".
+func ParseAdapterPin(name string) (AdapterPin, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "TCK", "SWCLK":
+		return PinTCK, nil
+	case "TMS", "SWDIO":
+		return PinTMS, nil
+	case "TDI":
+		return PinTDI, nil
+	case "TDO":
+		return PinTDO, nil
+	case "NTRST", "TRST":
+		return PinNTRST, nil
+	case "NRESET", "SRST", "NSRST", "RESET":
+		return PinNRESET, nil
+	}
+	return 0, fmt.Errorf("jtag: unknown adapter pin %q", name)
+}
+
+// PinController is implemented by adapters that can drive and sense their
+// control lines directly, outside of shift operations. Check for it with a
+// type assertion; AdapterInfo.SupportsSRST/SupportsTRST say which resets are
+// wired.
+type PinController interface {
+	// SetPins drives the pins in mask to the levels in value and returns the
+	// levels of all pins read back afterwards.
+	SetPins(mask, value AdapterPin) (AdapterPin, error)
+	// ReadPins returns the current pin levels.
+	ReadPins() (AdapterPin, error)
+	// TargetVoltage returns the sensed target supply in volts, or
+	// ErrNotImplemented when the probe cannot measure it.
+	TargetVoltage() (float64, error)
+}
+
+// AssertReset drives active-low reset pins low (assert) or high (release).
+func AssertReset(pc PinController, pins AdapterPin, assert bool) error {
+	value := pins
+	if assert {
+		value = 0
+	}
+	levels, err := pc.SetPins(pins, value)
+	if err != nil {
+		return err
+	}
+	// A released reset that still reads low is held by the target or board
+	if !assert && levels&pins != pins {
+		return fmt.Errorf("jtag: %s still low after release", pins&^levels)
+	}
+	return nil
+}
+
+// PulseReset asserts active-low reset pins for width, then releases them.
+func PulseReset(pc PinController, pins AdapterPin, width time.Duration) error {
+	if err := AssertReset(pc, pins, true); err != nil {
+		return err
+	}
+	time.Sleep(width)
+	return AssertReset(pc, pins, false)
+}
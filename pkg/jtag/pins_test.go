@@ -0,0 +1,92 @@
+package jtag
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAdapterPinString(t *testing.T) {
+	if got := (PinNRESET | PinNTRST).String(); got != "nTRST|nRESET" {
+		t.Errorf("String() = %q", got)
+	}
+	if got := AdapterPin(0).String(); got != "none" {
+		t.Errorf("String() = %q", got)
+	}
+	for name, want := range map[string]AdapterPin{"srst": PinNRESET, "nTRST": PinNTRST, "SWCLK": PinTCK} {
+		if got, err := ParseAdapterPin(name); err != nil || got != want {
+			t.Errorf("ParseAdapterPin(%q) = %v, %v", name, got, err)
+		}
+	}
+	if _, err := ParseAdapterPin("VREF"); err == nil {
+		t.Error("ParseAdapterPin(VREF) succeeded")
+	}
+}
+
+func TestSimAdapterPins(t *testing.T) {
+	sim := NewSimAdapter(AdapterInfo{})
+	var pc PinController = sim
+
+	if err := AssertReset(pc, PinNRESET, true); err != nil {
+		t.Fatalf("AssertReset() failed: %v", err)
+	}
+	if sim.Pins&PinNRESET != 0 || sim.Pins&PinNTRST == 0 {
+		t.Errorf("pins after assert = %s", sim.Pins)
+	}
+	if err := PulseReset(pc, PinNTRST, time.Millisecond); err != nil {
+		t.Fatalf("PulseReset() failed: %v", err)
+	}
+	if err := AssertReset(pc, PinNRESET, false); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	if sim.Pins&(PinNRESET|PinNTRST) != PinNRESET|PinNTRST {
+		t.Errorf("pins after release = %s", sim.Pins)
+	}
+	if v, err := pc.TargetVoltage(); err != nil || v != 3.3 {
+		t.Errorf("TargetVoltage() = %v, %v", v, err)
+	}
+}
+
+func TestCMSISDAPAdapter_Pins(t *testing.T) {
+	fake := NewFakeDAPTransport()
+	adapter := newFakeAdapter(t, fake)
+
+	info, _ := adapter.Info()
+	if !info.SupportsJTAG || !info.SupportsSWD {
+		t.Errorf("capabilities: JTAG=%v SWD=%v", info.SupportsJTAG, info.SupportsSWD)
+	}
+
+	if err := AssertReset(adapter, PinNRESET, true); err != nil {
+		t.Fatalf("AssertReset() failed: %v", err)
+	}
+	levels, err := adapter.ReadPins()
+	if err != nil || levels&PinNRESET != 0 {
+		t.Errorf("ReadPins() = %s, %v; want nRESET low", levels, err)
+	}
+	if cmd := fake.Commands()[0]; cmd[0] != CmdSWJPins || cmd[1] != 0 || cmd[2] != byte(PinNRESET) {
+		t.Errorf("SWJ_Pins command = % X", cmd)
+	}
+
+	// A reset line the board keeps low must not be reported as released
+	fake.HeldLow = PinNRESET
+	if err := AssertReset(adapter, PinNRESET, false); err == nil {
+		t.Error("release of a held-low nRESET succeeded")
+	}
+	fake.HeldLow = 0
+	if err := AssertReset(adapter, PinNRESET, false); err != nil {
+		t.Errorf("release failed: %v", err)
+	}
+
+	// Without a vendor Info ID the probe has no voltage sense
+	if _, err := adapter.TargetVoltage(); !errors.Is(err, ErrNotImplemented) {
+		t.Errorf("TargetVoltage() error = %v, want ErrNotImplemented", err)
+	}
+	adapter.VoltageInfoID = 0x80
+	if _, err := adapter.TargetVoltage(); !errors.Is(err, ErrNotImplemented) {
+		t.Errorf("TargetVoltage() with no reply error = %v, want ErrNotImplemented", err)
+	}
+	fake.VoltageInfoID, fake.TargetMillivolts = 0x80, 3300
+	if v, err := adapter.TargetVoltage(); err != nil || v != 3.3 {
+		t.Errorf("TargetVoltage() = %v, %v; want 3.3", v, err)
+	}
+}
@@ -0,0 +1,73 @@
+package jtag
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ProbeSelector picks one probe when several with the same VID:PID are
+// connected. Empty fields match any probe; the zero value opens the first.
+type ProbeSelector struct {
+	Serial string `json:"serial,omitempty"` // USB serial number string
+	Path   string `json:"path,omitempty"`   // USB bus:port path, e.g. "1:2.3"
+}
+
+var usbPathPattern = regexp.MustCompile(`^\d+[:-]\d+(\.\d+)*$`)
+
+// ParseProbeSelector interprets a command-line probe spec. Specs shaped like a
+// USB path ("1:2", "3:1.4", or the Linux sysfs form "3-1.4") select by bus
+// and port; anything else is taken as a serial number.
+func ParseProbeSelector(spec string) ProbeSelector {
+	spec = strings.TrimSpace(spec)
+	if usbPathPattern.MatchString(spec) {
+		return ProbeSelector{Path: normalizeUSBPath(spec)}
+	}
+	return ProbeSelector{Serial: spec}
+}
+
+// IsZero reports whether the selector matches any probe.
+func (s ProbeSelector) IsZero() bool {
+	return s.Serial == "" && s.Path == ""
+}
+
+// Matches reports whether a probe with the given serial and USB path is
+// selected. An empty serial or path on the probe side never matches a
+// selector that constrains it.
+func (s ProbeSelector) Matches(serial, path string) bool {
+	if s.Serial != "" && s.Serial != serial {
+		return false
+	}
+	if s.Path != "" && normalizeUSBPath(s.Path) != normalizeUSBPath(path) {
+		return false
+	}
+	return true
+}
+
+func (s ProbeSelector) String() string {
+	switch {
+	case s.Serial != "" && s.Path != "":
+		return fmt.Sprintf("serial %s at %s", s.Serial, s.Path)
+	case s.Serial != "":
+		return "serial " + s.Serial
+	case s.Path != "":
+		return "USB path " + s.Path
+	}
+	return "any probe"
+}
+
+// FormatUSBPath renders a bus number and its chain of hub ports as
+// "bus:port.port...", e.g. bus 1, ports [2 3] gives "1:2.3".
+func FormatUSBPath(bus int, ports []int) string {
+	parts := make([]string, len(ports))
+	for i, p := range ports {
+		parts[i] = strconv.Itoa(p)
+	}
+	return fmt.Sprintf("%d:%s", bus, strings.Join(parts, "."))
+}
+
+// normalizeUSBPath accepts the sysfs "bus-port" spelling as well.
+func normalizeUSBPath(path string) string {
+	return strings.Replace(strings.TrimSpace(path), "-", ":", 1)
+}
@@ -0,0 +1,46 @@
+package jtag
+
+import "testing"
+
+func TestParseProbeSelector(t *testing.T) {
+	tests := []struct {
+		spec string
+		want ProbeSelector
+	}{
+		{"E6614C311B4A8D2B", ProbeSelector{Serial: "E6614C311B4A8D2B"}},
+		{"1:4", ProbeSelector{Path: "1:4"}},
+		{"3:1.4.2", ProbeSelector{Path: "3:1.4.2"}},
+		{"3-1.4", ProbeSelector{Path: "3:1.4"}},
+		{" 0240000034544e45 ", ProbeSelector{Serial: "0240000034544e45"}},
+	}
+	for _, tt := range tests {
+		if got := ParseProbeSelector(tt.spec); got != tt.want {
+			t.Errorf("ParseProbeSelector(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestProbeSelectorMatches(t *testing.T) {
+	probes := []struct{ serial, path string }{
+		{"AAAA", FormatUSBPath(1, []int{2, 1})},
+		{"BBBB", FormatUSBPath(1, []int{2, 2})},
+		{"CCCC", FormatUSBPath(3, []int{1})},
+	}
+
+	tests := []struct {
+		sel  ProbeSelector
+		want []bool
+	}{
+		{ProbeSelector{}, []bool{true, true, true}},
+		{ProbeSelector{Serial: "BBBB"}, []bool{false, true, false}},
+		{ProbeSelector{Path: "1-2.1"}, []bool{true, false, false}},
+		{ProbeSelector{Serial: "CCCC", Path: "1:2.2"}, []bool{false, false, false}},
+	}
+	for _, tt := range tests {
+		for i, p := range probes {
+			if got := tt.sel.Matches(p.serial, p.path); got != tt.want[i] {
+				t.Errorf("%s matches %s@%s = %v, want %v", tt.sel, p.serial, p.path, got, tt.want[i])
+			}
+		}
+	}
+}
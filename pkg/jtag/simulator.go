@@ -30,6 +30,11 @@ type SimAdapter struct {
 
 	OnShift ShiftHook
 
+	// Pins holds the control line levels driven through SetPins, and
+	// TargetVolts the supply TargetVoltage reports.
+	Pins        AdapterPin
+	TargetVolts float64
+
 	lastShift ShiftOp
 	resets    int
 	hardReset int
@@ -37,7 +42,11 @@ type SimAdapter struct {
 
 // NewSimAdapter constructs a simulator configured with the provided AdapterInfo.
 func NewSimAdapter(info AdapterInfo) *SimAdapter {
-	return &SimAdapter{InfoData: info}
+	return &SimAdapter{
+		InfoData:    info,
+		Pins:        PinTMS | PinTDI | PinTDO | PinNTRST | PinNRESET,
+		TargetVolts: 3.3,
+	}
 }
 
 // LastShift returns a copy of the most recent shift request.
@@ -84,6 +93,22 @@ func (s *SimAdapter) SetSpeed(hz int) error {
 	return nil
 }
 
+// SetPins drives the simulated control lines.
+func (s *SimAdapter) SetPins(mask, value AdapterPin) (AdapterPin, error) {
+	s.Pins = s.Pins&^mask | value&mask
+	return s.Pins, nil
+}
+
+// ReadPins returns the simulated control line levels.
+func (s *SimAdapter) ReadPins() (AdapterPin, error) {
+	return s.Pins, nil
+}
+
+// TargetVoltage reports TargetVolts.
+func (s *SimAdapter) TargetVoltage() (float64, error) {
+	return s.TargetVolts, nil
+}
+
 func (s *SimAdapter) shift(region ShiftRegion, tms, tdi []byte, bits int) ([]byte, error) {
 	if _, err := ValidateShiftBuffers(tms, tdi, bits); err != nil {
 		return nil, err
@@ -0,0 +1,321 @@
+package jtag
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SWDAck is the three-bit acknowledgement a target returns for an SWD packet.
+type SWDAck uint8
+
+const (
+	SWDAckOK    SWDAck = 0x1
+	SWDAckWait  SWDAck = 0x2
+	SWDAckFault SWDAck = 0x4
+	// SWDAckNone is what the host reads when nothing drives SWDIO, e.g. the
+	// target is still in JTAG mode or locked out after a line reset.
+	SWDAckNone SWDAck = 0x7
+)
+
+func (a SWDAck) String() string {
+	switch a {
+	case SWDAckOK:
+		return "OK"
+	case SWDAckWait:
+		return "WAIT"
+	case SWDAckFault:
+		return "FAULT"
+	case SWDAckNone:
+		return "no response"
+	}
+	return fmt.Sprintf("invalid ACK 0b%03b", uint8(a))
+}
+
+// SWDAdapter is implemented by adapters that can drive Serial Wire Debug in
+// addition to (or instead of) JTAG. SWDPort builds DP and AP access on it.
+type SWDAdapter interface {
+	// EnableSWD switches the probe's pins to SWD operation.
+	EnableSWD() error
+	// SWDSequence clocks bits out on SWDIO, LSB first, for line resets and
+	// protocol switching.
+	SWDSequence(bits int, data []byte) error
+	// SWDTransfer runs one SWD packet and returns the read data and ACK. AP
+	// reads return the register value; the adapter handles the posted read.
+	// A read data parity mismatch is reported as ErrSWDParity.
+	SWDTransfer(ap, read bool, addr uint8, wdata uint32) (uint32, SWDAck, error)
+}
+
+// ErrSWDParity reports read data whose parity bit did not match.
+var ErrSWDParity = errors.New("jtag: SWD read data parity error")
+
+// SWDAckError reports an SWD packet the target did not acknowledge with OK.
+type SWDAckError struct {
+	Ack  SWDAck
+	AP   bool
+	Read bool
+	Addr uint8
+}
+
+func (e *SWDAckError) Error() string {
+	port, dir := "DP", "write"
+	if e.AP {
+		port = "AP"
+	}
+	if e.Read {
+		dir = "read"
+	}
+	return fmt.Sprintf("jtag: SWD %s %s 0x%02X: %s", port, dir, e.Addr, e.Ack)
+}
+
+// Debug port registers (ADIv5). DPIDR/ABORT and SELECT/RESEND share an
+// address and are told apart by direction.
+const (
+	DPRegIDR      = 0x0 // Read
+	DPRegAbort    = 0x0 // Write
+	DPRegCtrlStat = 0x4
+	DPRegSelect   = 0x8 // Write
+	DPRegRdBuff   = 0xC // Read
+)
+
+// CTRL/STAT and ABORT bits
+const (
+	DPCtrlStickyErr  = 1 << 5
+	DPCtrlDbgPwrReq  = 1 << 28
+	DPCtrlDbgPwrAck  = 1 << 29
+	DPCtrlSysPwrReq  = 1 << 30
+	DPCtrlSysPwrAck  = 1 << 31
+	DPAbortClearAll  = 0x1E // STKCMPCLR | STKERRCLR | WDERRCLR | ORUNERRCLR
+	dpPowerUpRequest = DPCtrlDbgPwrReq | DPCtrlSysPwrReq
+	dpPowerUpAck     = DPCtrlDbgPwrAck | DPCtrlSysPwrAck
+)
+
+// MEM-AP registers
+const (
+	MemAPRegCSW  = 0x00
+	MemAPRegTAR  = 0x04
+	MemAPRegDRW  = 0x0C
+	MemAPRegBase = 0xF8
+	MemAPRegIDR  = 0xFC
+
+	// memAPCSW32 selects 32-bit accesses without address increment, with
+	// the debug software access bits most MEM-APs expect.
+	memAPCSW32 = 0x23000002
+)
+
+// SWD line sequences, LSB first
+var (
+	swdLineResetBits = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF} // 56 ones
+	swdJTAGToSWD     = []byte{0x9E, 0xE7}                               // 0xE79E
+	swdIdleBits      = []byte{0x00}
+)
+
+// SWDPort gives register-level access to an ARM debug port over SWD:
+// connection, DP and AP reads and writes with WAIT retries, sticky error
+// recovery after FAULT, and 32-bit memory access through a MEM-AP.
+type SWDPort struct {
+	adapter SWDAdapter
+
+	// Retries is how many times a WAIT response is retried before giving up.
+	Retries int
+
+	selectValue uint32
+	selectValid bool
+}
+
+// NewSWDPort wraps an SWD-capable adapter.
+func NewSWDPort(adapter SWDAdapter) *SWDPort {
+	return &SWDPort{adapter: adapter, Retries: 100}
+}
+
+// Connect switches the target from JTAG to SWD, performs a line reset,
+// reads DPIDR and clears any sticky errors. It returns DPIDR, whose designer
+// field uses the JEP106 layout of a JTAG IDCODE.
+func (p *SWDPort) Connect() (uint32, error) {
+	if err := p.adapter.EnableSWD(); err != nil {
+		return 0, fmt.Errorf("enable SWD: %w", err)
+	}
+	p.selectValid = false
+
+	// Line reset, JTAG-to-SWD select sequence, line reset, idle
+	for _, seq := range []struct {
+		bits int
+		data []byte
+	}{
+		{56, swdLineResetBits},
+		{16, swdJTAGToSWD},
+		{56, swdLineResetBits},
+		{8, swdIdleBits},
+	} {
+		if err := p.adapter.SWDSequence(seq.bits, seq.data); err != nil {
+			return 0, fmt.Errorf("SWD switch sequence: %w", err)
+		}
+	}
+
+	// DPIDR must be the first transfer after a line reset
+	dpidr, err := p.ReadDP(DPRegIDR)
+	if err != nil {
+		return 0, fmt.Errorf("read DPIDR: %w", err)
+	}
+	if err := p.ClearErrors(); err != nil {
+		return 0, err
+	}
+	return dpidr, nil
+}
+
+// PowerUp requests debug and system power and waits for the acknowledge bits.
+func (p *SWDPort) PowerUp() error {
+	if err := p.WriteDP(DPRegCtrlStat, dpPowerUpRequest); err != nil {
+		return err
+	}
+	for i := 0; i <= p.Retries; i++ {
+		stat, err := p.ReadDP(DPRegCtrlStat)
+		if err != nil {
+			return err
+		}
+		if stat&dpPowerUpAck == dpPowerUpAck {
+			return nil
+		}
+	}
+	return fmt.Errorf("jtag: SWD debug power-up not acknowledged")
+}
+
+// ClearErrors clears the DP sticky error flags through ABORT.
+func (p *SWDPort) ClearErrors() error {
+	_, err := p.transfer(false, false, DPRegAbort, DPAbortClearAll)
+	return err
+}
+
+// ReadDP reads a debug port register.
+func (p *SWDPort) ReadDP(addr uint8) (uint32, error) {
+	return p.transfer(false, true, addr, 0)
+}
+
+// WriteDP writes a debug port register.
+func (p *SWDPort) WriteDP(addr uint8, value uint32) error {
+	if addr == DPRegSelect {
+		p.selectValid = false
+	}
+	_, err := p.transfer(false, false, addr, value)
+	return err
+}
+
+// ReadAP reads register addr (0x00-0xFC) of access port apsel.
+func (p *SWDPort) ReadAP(apsel, addr uint8) (uint32, error) {
+	if err := p.selectAP(apsel, addr); err != nil {
+		return 0, err
+	}
+	return p.transfer(true, true, addr, 0)
+}
+
+// WriteAP writes register addr (0x00-0xFC) of access port apsel.
+func (p *SWDPort) WriteAP(apsel, addr uint8, value uint32) error {
+	if err := p.selectAP(apsel, addr); err != nil {
+		return err
+	}
+	_, err := p.transfer(true, false, addr, value)
+	return err
+}
+
+// ReadMem32 reads a word of target memory through MEM-AP apsel.
+func (p *SWDPort) ReadMem32(apsel uint8, addr uint32) (uint32, error) {
+	if err := p.setupMemAccess(apsel, addr); err != nil {
+		return 0, err
+	}
+	return p.ReadAP(apsel, MemAPRegDRW)
+}
+
+// WriteMem32 writes a word of target memory through MEM-AP apsel.
+func (p *SWDPort) WriteMem32(apsel uint8, addr, value uint32) error {
+	if err := p.setupMemAccess(apsel, addr); err != nil {
+		return err
+	}
+	return p.WriteAP(apsel, MemAPRegDRW, value)
+}
+
+func (p *SWDPort) setupMemAccess(apsel uint8, addr uint32) error {
+	if addr&3 != 0 {
+		return fmt.Errorf("jtag: unaligned 32-bit access at 0x%08X", addr)
+	}
+	if err := p.WriteAP(apsel, MemAPRegCSW, memAPCSW32); err != nil {
+		return err
+	}
+	return p.WriteAP(apsel, MemAPRegTAR, addr)
+}
+
+// selectAP points DP SELECT at the AP and register bank, skipping the write
+// when it already does.
+func (p *SWDPort) selectAP(apsel, addr uint8) error {
+	value := uint32(apsel)<<24 | uint32(addr&0xF0)
+	if p.selectValid && p.selectValue == value {
+		return nil
+	}
+	if _, err := p.transfer(false, false, DPRegSelect, value); err != nil {
+		return err
+	}
+	p.selectValue, p.selectValid = value, true
+	return nil
+}
+
+// transfer runs one packet, retrying WAIT and clearing sticky errors after
+// FAULT so the next access can proceed.
+func (p *SWDPort) transfer(ap, read bool, addr uint8, wdata uint32) (uint32, error) {
+	for attempt := 0; ; attempt++ {
+		data, ack, err := p.adapter.SWDTransfer(ap, read, addr&0x0C, wdata)
+		if err != nil {
+			return 0, err
+		}
+		switch ack {
+		case SWDAckOK:
+			return data, nil
+		case SWDAckWait:
+			if attempt < p.Retries {
+				continue
+			}
+		case SWDAckFault:
+			// ABORT is always accepted, even with sticky flags set
+			p.adapter.SWDTransfer(false, false, DPRegAbort, DPAbortClearAll)
+		default:
+			// Protocol error: the target lost sync and needs a line reset
+			p.selectValid = false
+		}
+		return 0, &SWDAckError{Ack: ack, AP: ap, Read: read, Addr: addr}
+	}
+}
+
+// swdParity returns the even parity bit of a 32-bit SWD data word.
+func swdParity(v uint32) bool {
+	v ^= v >> 16
+	v ^= v >> 8
+	v ^= v >> 4
+	v ^= v >> 2
+	v ^= v >> 1
+	return v&1 != 0
+}
+
+// DPIDRInfo is a decoded SWD DPIDR.
+type DPIDRInfo struct {
+	Raw      uint32
+	Designer IDCodeInfo // Manufacturer fields, decoded like a JTAG IDCODE
+	Version  uint8      // DP architecture version (1 = DPv1, 2 = DPv2)
+	MinDP    bool       // Minimal DP without pushed operations
+	PartNo   uint8
+	Revision uint8
+}
+
+// DecodeDPIDR splits a DPIDR into its fields. The designer code sits in the
+// same bits as the manufacturer of a JTAG IDCODE.
+func DecodeDPIDR(raw uint32) DPIDRInfo {
+	return DPIDRInfo{
+		Raw:      raw,
+		Designer: DecodeIDCode(raw),
+		Version:  uint8(raw>>12) & 0xF,
+		MinDP:    raw&(1<<16) != 0,
+		PartNo:   uint8(raw >> 20),
+		Revision: uint8(raw >> 28),
+	}
+}
+
+func (d DPIDRInfo) String() string {
+	return fmt.Sprintf("0x%08X (Designer: %s, DPv%d, Part: 0x%02X, Rev: %d)",
+		d.Raw, d.Designer.ManufName, d.Version, d.PartNo, d.Revision)
+}
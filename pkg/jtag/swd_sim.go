@@ -0,0 +1,250 @@
+package jtag
+
+import "sync"
+
+// Defaults for SimSWDTarget, matching a Cortex-M4 MCU.
+const (
+	SimSWDDefaultDPIDR  = 0x2BA01477 // ARM ADIv5 SW-DP
+	SimSWDDefaultAPIDR  = 0x24770011 // AHB-AP (MEM-AP)
+	SimSWDDefaultCPUID  = 0x410FC241 // Cortex-M4 r0p1
+	cortexMCPUIDAddress = 0xE000ED00
+)
+
+// SimSWDTarget emulates the SWD side of an ARM MCU: the JTAG-to-SWD switch
+// and line reset rules, a DP with CTRL/STAT power handshake and sticky
+// errors, and MEM-AP 0 over a sparse word memory. It implements SWDAdapter,
+// so SWDPort can run against it directly, and also backs the SWD commands of
+// FakeDAPTransport.
+//
+// Waits, Faults and ParityErrors inject that many WAIT responses, FAULT
+// responses and corrupted read parity bits into upcoming transfers.
+type SimSWDTarget struct {
+	DPIDR  uint32
+	APIDR  uint32            // IDR of AP 0
+	Memory map[uint32]uint32 // Word-aligned target memory
+
+	Waits        int
+	Faults       int
+	ParityErrors int
+
+	mu        sync.Mutex
+	line      []bool // SWDIO bits clocked since the last packet
+	armed     bool   // JTAG-to-SWD sequence seen
+	swd       bool   // Target is in SWD mode
+	lockedOut bool   // Line reset seen; only a DPIDR read is accepted
+	ctrlStat  uint32
+	selectReg uint32
+	csw, tar  uint32
+	transfers int
+}
+
+// NewSimSWDTarget returns a Cortex-M4-like target with its CPUID in memory.
+func NewSimSWDTarget() *SimSWDTarget {
+	return &SimSWDTarget{
+		DPIDR:  SimSWDDefaultDPIDR,
+		APIDR:  SimSWDDefaultAPIDR,
+		Memory: map[uint32]uint32{cortexMCPUIDAddress: SimSWDDefaultCPUID},
+	}
+}
+
+// EnableSWD is a no-op: the simulated pins are always connected.
+func (t *SimSWDTarget) EnableSWD() error {
+	return nil
+}
+
+// SWDSequence records bits clocked out on SWDIO.
+func (t *SimSWDTarget) SWDSequence(bits int, data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := 0; i < bits; i++ {
+		t.line = append(t.line, i/8 < len(data) && data[i/8]&(1<<(i%8)) != 0)
+	}
+	return nil
+}
+
+// SWDTransfer runs one packet against the target and checks the read parity
+// like a host would.
+func (t *SimSWDTarget) SWDTransfer(ap, read bool, addr uint8, wdata uint32) (uint32, SWDAck, error) {
+	ack, data, parity := t.packet(ap, read, addr, wdata)
+	if ack == SWDAckOK && read && parity != swdParity(data) {
+		return 0, ack, ErrSWDParity
+	}
+	return data, ack, nil
+}
+
+// Connected reports whether the target has been switched to SWD.
+func (t *SimSWDTarget) Connected() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.swd
+}
+
+// Transfers returns how many packets the target has seen.
+func (t *SimSWDTarget) Transfers() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.transfers
+}
+
+// packet is the target side of one SWD packet: it returns the ACK, the read
+// data and the parity bit the target drove.
+func (t *SimSWDTarget) packet(ap, read bool, addr uint8, wdata uint32) (SWDAck, uint32, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.transfers++
+	t.scanLine()
+	if !t.swd {
+		return SWDAckNone, 0, false
+	}
+	if t.lockedOut {
+		if ap || !read || addr != DPRegIDR {
+			return SWDAckNone, 0, false
+		}
+		t.lockedOut = false
+	}
+
+	if t.Waits > 0 {
+		t.Waits--
+		return SWDAckWait, 0, false
+	}
+	if t.Faults > 0 {
+		t.Faults--
+		t.ctrlStat |= DPCtrlStickyErr
+		return SWDAckFault, 0, false
+	}
+
+	var data uint32
+	if ap {
+		if t.ctrlStat&DPCtrlStickyErr != 0 {
+			return SWDAckFault, 0, false
+		}
+		if t.ctrlStat&DPCtrlDbgPwrReq == 0 {
+			t.ctrlStat |= DPCtrlStickyErr
+			return SWDAckFault, 0, false
+		}
+		data = t.accessAP(read, addr, wdata)
+	} else {
+		data = t.accessDP(read, addr, wdata)
+	}
+
+	if !read {
+		return SWDAckOK, 0, false
+	}
+	parity := swdParity(data)
+	if t.ParityErrors > 0 {
+		t.ParityErrors--
+		parity = !parity
+	}
+	return SWDAckOK, data, parity
+}
+
+func (t *SimSWDTarget) accessDP(read bool, addr uint8, wdata uint32) uint32 {
+	switch {
+	case read && addr == DPRegIDR:
+		return t.DPIDR
+	case !read && addr == DPRegAbort:
+		if wdata&0x04 != 0 { // STKERRCLR
+			t.ctrlStat &^= DPCtrlStickyErr
+		}
+	case addr == DPRegCtrlStat:
+		if !read {
+			t.ctrlStat = t.ctrlStat&DPCtrlStickyErr | wdata&^(DPCtrlStickyErr|dpPowerUpAck)
+			break
+		}
+		stat := t.ctrlStat
+		if stat&DPCtrlDbgPwrReq != 0 {
+			stat |= DPCtrlDbgPwrAck
+		}
+		if stat&DPCtrlSysPwrReq != 0 {
+			stat |= DPCtrlSysPwrAck
+		}
+		return stat
+	case !read && addr == DPRegSelect:
+		t.selectReg = wdata
+	}
+	return 0
+}
+
+func (t *SimSWDTarget) accessAP(read bool, addr uint8, wdata uint32) uint32 {
+	if t.selectReg>>24 != 0 {
+		return 0 // Only AP 0 is implemented; the rest read as zero
+	}
+	reg := uint8(t.selectReg&0xF0) | addr&0x0C
+	switch reg {
+	case MemAPRegCSW:
+		if !read {
+			t.csw = wdata
+		}
+		return t.csw
+	case MemAPRegTAR:
+		if !read {
+			t.tar = wdata
+		}
+		return t.tar
+	case MemAPRegDRW:
+		addr := t.tar &^ 3
+		var data uint32
+		if read {
+			data = t.Memory[addr]
+		} else {
+			if t.Memory == nil {
+				t.Memory = make(map[uint32]uint32)
+			}
+			t.Memory[addr] = wdata
+		}
+		if t.csw&0x30 == 0x10 { // Single address increment
+			t.tar += 4
+		}
+		return data
+	case MemAPRegIDR:
+		return t.APIDR
+	}
+	return 0
+}
+
+// scanLine interprets the bits clocked since the last packet: 50 or more
+// ones followed by 0xE79E arm the switch to SWD, and 50 or more ones ended by
+// a zero are a line reset, which completes the switch.
+func (t *SimSWDTarget) scanLine() {
+	bits := t.line
+	t.line = nil
+
+	for i := 0; i < len(bits); {
+		run := 0
+		for i+run < len(bits) && bits[i+run] {
+			run++
+		}
+		if run < 50 {
+			i += run + 1
+			continue
+		}
+
+		j := i + run
+		if j+16 <= len(bits) && boolsToUint16(bits[j:j+16]) == 0xE79E {
+			t.armed = true
+			i = j + 16
+			continue
+		}
+		if j < len(bits) {
+			if t.armed {
+				t.swd, t.armed = true, false
+			}
+			if t.swd {
+				t.lockedOut = true
+				t.selectReg = 0
+			}
+		}
+		i = j
+	}
+}
+
+func boolsToUint16(bits []bool) uint16 {
+	var v uint16
+	for i, b := range bits {
+		if b {
+			v |= 1 << i
+		}
+	}
+	return v
+}
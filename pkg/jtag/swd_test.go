@@ -0,0 +1,156 @@
+package jtag
+
+import (
+	"errors"
+	"testing"
+)
+
+func connectSimSWD(t *testing.T) (*SWDPort, *SimSWDTarget) {
+	t.Helper()
+	target := NewSimSWDTarget()
+	port := NewSWDPort(target)
+	dpidr, err := port.Connect()
+	if err != nil {
+		t.Fatalf("Connect() failed: %v", err)
+	}
+	if dpidr != SimSWDDefaultDPIDR {
+		t.Fatalf("DPIDR = 0x%08X, want 0x%08X", dpidr, SimSWDDefaultDPIDR)
+	}
+	return port, target
+}
+
+func TestSWDPort_RequiresSwitchSequence(t *testing.T) {
+	target := NewSimSWDTarget()
+	port := NewSWDPort(target)
+
+	_, err := port.ReadDP(DPRegIDR)
+	var ackErr *SWDAckError
+	if !errors.As(err, &ackErr) || ackErr.Ack != SWDAckNone {
+		t.Fatalf("ReadDP before switching = %v, want no response", err)
+	}
+
+	if _, err := port.Connect(); err != nil {
+		t.Fatalf("Connect() failed: %v", err)
+	}
+	if !target.Connected() {
+		t.Error("target not in SWD mode after Connect")
+	}
+}
+
+func TestSWDPort_MemoryAccess(t *testing.T) {
+	port, target := connectSimSWD(t)
+
+	// AP accesses fault until debug power is up
+	if _, err := port.ReadAP(0, MemAPRegIDR); err == nil {
+		t.Fatal("AP read before power-up succeeded")
+	}
+	if err := port.PowerUp(); err != nil {
+		t.Fatalf("PowerUp() failed: %v", err)
+	}
+
+	idr, err := port.ReadAP(0, MemAPRegIDR)
+	if err != nil || idr != SimSWDDefaultAPIDR {
+		t.Fatalf("AP IDR = 0x%08X, %v", idr, err)
+	}
+	cpuid, err := port.ReadMem32(0, cortexMCPUIDAddress)
+	if err != nil || cpuid != SimSWDDefaultCPUID {
+		t.Fatalf("CPUID = 0x%08X, %v", cpuid, err)
+	}
+
+	if err := port.WriteMem32(0, 0x20000000, 0xCAFEF00D); err != nil {
+		t.Fatalf("WriteMem32() failed: %v", err)
+	}
+	if target.Memory[0x20000000] != 0xCAFEF00D {
+		t.Errorf("memory = 0x%08X after write", target.Memory[0x20000000])
+	}
+	if _, err := port.ReadMem32(0, 0x20000002); err == nil {
+		t.Error("unaligned ReadMem32 succeeded")
+	}
+}
+
+func TestSWDPort_AckHandling(t *testing.T) {
+	port, target := connectSimSWD(t)
+	if err := port.PowerUp(); err != nil {
+		t.Fatalf("PowerUp() failed: %v", err)
+	}
+
+	// WAIT is retried transparently
+	target.Waits = 3
+	if _, err := port.ReadAP(0, MemAPRegIDR); err != nil {
+		t.Errorf("ReadAP with WAITs failed: %v", err)
+	}
+
+	// FAULT is reported and the sticky error cleared for the next access
+	target.Faults = 1
+	_, err := port.ReadAP(0, MemAPRegIDR)
+	var ackErr *SWDAckError
+	if !errors.As(err, &ackErr) || ackErr.Ack != SWDAckFault || !ackErr.AP {
+		t.Fatalf("ReadAP with FAULT = %v", err)
+	}
+	if _, err := port.ReadAP(0, MemAPRegIDR); err != nil {
+		t.Errorf("ReadAP after FAULT failed: %v", err)
+	}
+
+	// Endless WAIT gives up
+	target.Waits = port.Retries + 1
+	if _, err := port.ReadDP(DPRegCtrlStat); err == nil {
+		t.Error("ReadDP succeeded despite endless WAIT")
+	}
+	target.Waits = 0
+
+	target.ParityErrors = 1
+	if _, err := port.ReadDP(DPRegCtrlStat); !errors.Is(err, ErrSWDParity) {
+		t.Errorf("ReadDP with bad parity = %v, want ErrSWDParity", err)
+	}
+}
+
+func TestSWDPort_OverCMSISDAP(t *testing.T) {
+	fake := NewFakeDAPTransport()
+	fake.SWD = NewSimSWDTarget()
+	adapter := newFakeAdapter(t, fake)
+
+	port := NewSWDPort(adapter)
+	dpidr, err := port.Connect()
+	if err != nil {
+		t.Fatalf("Connect() failed: %v", err)
+	}
+	if dpidr != SimSWDDefaultDPIDR {
+		t.Errorf("DPIDR = 0x%08X", dpidr)
+	}
+	if err := port.PowerUp(); err != nil {
+		t.Fatalf("PowerUp() failed: %v", err)
+	}
+	cpuid, err := port.ReadMem32(0, cortexMCPUIDAddress)
+	if err != nil || cpuid != SimSWDDefaultCPUID {
+		t.Errorf("CPUID = 0x%08X, %v", cpuid, err)
+	}
+
+	fake.SWD.Faults = 1
+	if _, err := port.ReadMem32(0, cortexMCPUIDAddress); err == nil {
+		t.Error("FAULT not reported through DAP_Transfer")
+	}
+	fake.SWD.ParityErrors = 1
+	if _, err := port.ReadDP(DPRegCtrlStat); !errors.Is(err, ErrSWDParity) {
+		t.Errorf("parity error through DAP_Transfer = %v", err)
+	}
+
+	seen := map[byte]bool{}
+	for _, cmd := range fake.Commands() {
+		seen[cmd[0]] = true
+	}
+	for _, id := range []byte{CmdSWDConfigure, CmdTransferCfg, CmdSWDSequence, CmdTransfer} {
+		if !seen[id] {
+			t.Errorf("command 0x%02X never sent", id)
+		}
+	}
+}
+
+func TestDecodeDPIDR(t *testing.T) {
+	info := DecodeDPIDR(SimSWDDefaultDPIDR)
+	if info.Version != 1 || info.PartNo != 0xBA || info.Revision != 2 || info.MinDP {
+		t.Errorf("DecodeDPIDR() = %+v", info)
+	}
+	if info.Designer.Manufacturer != 0x23B {
+		t.Errorf("designer = 0x%03X, want ARM (0x23B)", info.Designer.Manufacturer)
+	}
+}
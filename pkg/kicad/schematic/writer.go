@@ -0,0 +1,421 @@
+package schematic
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/kicad/sexp"
+)
+
+// DefaultVersion is the file format version written when Schematic.Version
+// is zero (KiCad 8.0)
+const DefaultVersion = 20231120
+
+// WriteFile writes a schematic to a .kicad_sch file
+func WriteFile(filename string, sch *Schematic) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	if err := Write(file, sch); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Write writes a schematic in KiCad's S-expression format. It is the
+// counterpart of Parse: every field Parse reads is written back.
+// Coordinates are in millimeters and angles in degrees.
+func Write(w io.Writer, sch *Schematic) error {
+	if _, err := buildSchematic(sch).WriteTo(w); err != nil {
+		return fmt.Errorf("failed to write schematic: %w", err)
+	}
+	return nil
+}
+
+// buildSchematic converts the schematic to its (kicad_sch ...) tree
+func buildSchematic(sch *Schematic) *sexp.Node {
+	version := sch.Version
+	if version == 0 {
+		version = DefaultVersion
+	}
+	generator := sch.Generator
+	if generator == "" {
+		generator = "opentracejtag"
+	}
+	paper := sch.Paper
+	if paper == "" {
+		paper = "A4"
+	}
+
+	root := sexp.List("kicad_sch",
+		sexp.List("version", sexp.Int(version)),
+		sexp.List("generator", sexp.Str(generator)),
+	)
+	if sch.GeneratorVer != "" {
+		root.Add(sexp.List("generator_version", sexp.Str(sch.GeneratorVer)))
+	}
+	if sch.UUID != "" {
+		root.Add(uuidNode(sch.UUID))
+	}
+	root.Add(sexp.List("paper", sexp.Str(paper)))
+	if sch.TitleBlock != (TitleBlock{}) {
+		root.Add(titleBlockNode(sch.TitleBlock))
+	}
+
+	libs := sexp.List("lib_symbols")
+	for _, sym := range sch.LibSymbols {
+		libs.Add(libSymbolNode(sym))
+	}
+	root.Add(libs)
+
+	for _, j := range sch.Junctions {
+		root.Add(sexp.List("junction",
+			posNode("at", j.Position),
+			sexp.List("diameter", sexp.Num(j.Diameter)),
+			sexp.List("color", sexp.Num(j.Color.R*255), sexp.Num(j.Color.G*255), sexp.Num(j.Color.B*255), sexp.Num(j.Color.A)),
+			uuidNode(j.UUID),
+		))
+	}
+	for _, nc := range sch.NoConnects {
+		root.Add(sexp.List("no_connect", posNode("at", nc.Position), uuidNode(nc.UUID)))
+	}
+	for _, be := range sch.BusEntries {
+		root.Add(sexp.List("bus_entry",
+			posNode("at", be.Position),
+			sexp.List("size", sexp.Num(be.Size.Width), sexp.Num(be.Size.Height)),
+			strokeNode(be.Stroke),
+			uuidNode(be.UUID),
+		))
+	}
+	for _, wire := range sch.Wires {
+		root.Add(sexp.List("wire", ptsNode(wire.Points), strokeNode(wire.Stroke), uuidNode(wire.UUID)))
+	}
+	for _, bus := range sch.Buses {
+		root.Add(sexp.List("bus", ptsNode(bus.Points), strokeNode(bus.Stroke), uuidNode(bus.UUID)))
+	}
+	for _, poly := range sch.Polylines {
+		root.Add(sexp.List("polyline", ptsNode(poly.Points), strokeNode(poly.Stroke), uuidNode(poly.UUID)))
+	}
+	for _, text := range sch.Texts {
+		root.Add(sexp.List("text", sexp.Str(text.Text),
+			atNode(text.Position, text.Angle),
+			effectsNode(text.Effects),
+			uuidNode(text.UUID),
+		))
+	}
+	for _, label := range sch.Labels {
+		root.Add(sexp.List("label", sexp.Str(label.Text),
+			atNode(label.Position, label.Angle),
+			effectsNode(label.Effects),
+			uuidNode(label.UUID),
+		))
+	}
+	for _, label := range sch.GlobalLabels {
+		node := sexp.List("global_label", sexp.Str(label.Text),
+			sexp.List("shape", sexp.Sym(orDefault(label.Shape, "passive"))),
+			atNode(label.Position, label.Angle),
+			effectsNode(label.Effects),
+			uuidNode(label.UUID),
+		)
+		for _, prop := range label.Properties {
+			node.Add(propertyNode(prop))
+		}
+		root.Add(node)
+	}
+	for _, label := range sch.HierLabels {
+		root.Add(sexp.List("hierarchical_label", sexp.Str(label.Text),
+			sexp.List("shape", sexp.Sym(orDefault(label.Shape, "passive"))),
+			atNode(label.Position, label.Angle),
+			effectsNode(label.Effects),
+			uuidNode(label.UUID),
+		))
+	}
+	for _, sym := range sch.Symbols {
+		root.Add(symbolNode(sym, sch.UUID))
+	}
+	for _, sheet := range sch.Sheets {
+		root.Add(sheetNode(sheet))
+	}
+
+	instances := sch.SheetInstances
+	if len(instances) == 0 {
+		instances = []SheetInstance{{Path: "/", Page: "1"}}
+	}
+	inst := sexp.List("sheet_instances")
+	for _, si := range instances {
+		inst.Add(sexp.List("path", sexp.Str(si.Path), sexp.List("page", sexp.Str(si.Page))))
+	}
+	root.Add(inst)
+
+	return root
+}
+
+// titleBlockNode writes the non-empty title block fields
+func titleBlockNode(tb TitleBlock) *sexp.Node {
+	node := sexp.List("title_block")
+	for _, field := range []struct{ key, value string }{
+		{"title", tb.Title},
+		{"date", tb.Date},
+		{"rev", tb.Revision},
+		{"company", tb.Company},
+	} {
+		if field.value != "" {
+			node.Add(sexp.List(field.key, sexp.Str(field.value)))
+		}
+	}
+	for i, comment := range []string{tb.Comment1, tb.Comment2, tb.Comment3, tb.Comment4} {
+		if comment != "" {
+			node.Add(sexp.List("comment", sexp.Int(i+1), sexp.Str(comment)))
+		}
+	}
+	return node
+}
+
+// libSymbolNode writes a library symbol. Without Units, Graphics go into
+// the shared unit NAME_0_1 and Pins into NAME_1_1, as Eeschema lays out a
+// single-unit symbol.
+func libSymbolNode(sym LibSymbol) *sexp.Node {
+	node := sexp.List("symbol", sexp.Str(sym.Name))
+	if !sym.PinNumbers {
+		node.Add(sexp.List("pin_numbers", sexp.Sym("hide")))
+	}
+	if sym.PinNames {
+		node.Add(sexp.List("pin_names", sexp.List("offset", sexp.Num(1.016))))
+	} else {
+		node.Add(sexp.List("pin_names", sexp.Sym("hide")))
+	}
+	node.Add(
+		sexp.List("in_bom", sexp.YesNo(sym.InBom)),
+		sexp.List("on_board", sexp.YesNo(sym.OnBoard)),
+	)
+	for _, prop := range sym.Properties {
+		node.Add(propertyNode(prop))
+	}
+
+	units := sym.Units
+	if len(units) == 0 {
+		base := sym.Name
+		if i := strings.LastIndex(base, ":"); i >= 0 {
+			base = base[i+1:]
+		}
+		units = []SymbolUnit{
+			{Name: base + "_0_1", Graphics: sym.Graphics},
+			{Name: base + "_1_1", Pins: sym.Pins},
+		}
+	}
+	for _, unit := range units {
+		un := sexp.List("symbol", sexp.Str(unit.Name))
+		for _, g := range unit.Graphics {
+			un.Add(graphicNode(g))
+		}
+		for _, pin := range unit.Pins {
+			un.Add(pinNode(pin))
+		}
+		node.Add(un)
+	}
+	return node
+}
+
+// graphicNode writes a symbol graphic. Arcs keep their mid point in Center,
+// as Parse stores it.
+func graphicNode(g SymGraphic) *sexp.Node {
+	switch g.Type {
+	case "rectangle":
+		return sexp.List("rectangle", posNode("start", g.Start), posNode("end", g.End), strokeNode(g.Stroke), fillNode(g.Fill))
+	case "circle":
+		return sexp.List("circle", posNode("center", g.Center), sexp.List("radius", sexp.Num(g.Radius)), strokeNode(g.Stroke), fillNode(g.Fill))
+	case "arc":
+		return sexp.List("arc", posNode("start", g.Start), posNode("mid", g.Center), posNode("end", g.End), strokeNode(g.Stroke), fillNode(g.Fill))
+	case "polyline":
+		return sexp.List("polyline", ptsNode(g.Points), strokeNode(g.Stroke), fillNode(g.Fill))
+	case "text":
+		return sexp.List("text", sexp.Str(g.Text), posNode("at", g.Start), effectsNode(Effects{}))
+	}
+	return nil
+}
+
+// pinNode writes a library symbol pin
+func pinNode(pin Pin) *sexp.Node {
+	node := sexp.List("pin",
+		sexp.Sym(orDefault(pin.Type, "passive")),
+		sexp.Sym(orDefault(pin.Style, "line")),
+		atNode(pin.Position, pin.Angle),
+		sexp.List("length", sexp.Num(pin.Length)),
+	)
+	if pin.Hide {
+		node.Add(sexp.Sym("hide"))
+	}
+	node.Add(
+		sexp.List("name", sexp.Str(pin.Name.Name), effectsNode(pin.Name.Effects)),
+		sexp.List("number", sexp.Str(pin.Number.Number), effectsNode(pin.Number.Effects)),
+	)
+	for _, alt := range pin.Alternate {
+		node.Add(sexp.List("alternate", sexp.Str(alt.Name),
+			sexp.Sym(orDefault(alt.Type, "passive")), sexp.Sym(orDefault(alt.Style, "line"))))
+	}
+	return node
+}
+
+// symbolNode writes a placed symbol. With a schematic UUID, the Reference
+// property is also written as the symbol's instance on the root sheet.
+func symbolNode(sym Symbol, root UUID) *sexp.Node {
+	unit := sym.Unit
+	if unit == 0 {
+		unit = 1
+	}
+	node := sexp.List("symbol",
+		sexp.List("lib_id", sexp.Str(sym.LibID)),
+		atNode(sym.Position, sym.Angle),
+	)
+	if sym.Mirror != "" {
+		node.Add(sexp.List("mirror", sexp.Sym(sym.Mirror)))
+	}
+	node.Add(
+		sexp.List("unit", sexp.Int(unit)),
+		sexp.List("in_bom", sexp.YesNo(sym.InBom)),
+		sexp.List("on_board", sexp.YesNo(sym.OnBoard)),
+		uuidNode(sym.UUID),
+	)
+	reference := ""
+	for _, prop := range sym.Properties {
+		node.Add(propertyNode(prop))
+		if prop.Key == "Reference" {
+			reference = prop.Value
+		}
+	}
+	for _, pin := range sym.Pins {
+		node.Add(sexp.List("pin", sexp.Str(pin.Number), uuidNode(pin.UUID)))
+	}
+	if root != "" && reference != "" {
+		node.Add(sexp.List("instances",
+			sexp.List("project", sexp.Str(""),
+				sexp.List("path", sexp.Str("/"+string(root)),
+					sexp.List("reference", sexp.Str(reference)),
+					sexp.List("unit", sexp.Int(unit)),
+				),
+			),
+		))
+	}
+	return node
+}
+
+// sheetNode writes a hierarchical sheet with its name and file properties
+func sheetNode(sheet Sheet) *sexp.Node {
+	node := sexp.List("sheet",
+		posNode("at", sheet.Position),
+		sexp.List("size", sexp.Num(sheet.Size.Width), sexp.Num(sheet.Size.Height)),
+		strokeNode(sheet.Stroke),
+		fillNode(sheet.Fill),
+		uuidNode(sheet.UUID),
+		propertyNode(Property{Key: "Sheetname", Value: sheet.Name.Name, Effects: sheet.Name.Effects}),
+		propertyNode(Property{Key: "Sheetfile", Value: sheet.FileName.Name, Effects: sheet.FileName.Effects}),
+	)
+	for _, prop := range sheet.Properties {
+		node.Add(propertyNode(prop))
+	}
+	for _, pin := range sheet.Pins {
+		node.Add(sexp.List("pin", sexp.Str(pin.Name), sexp.Sym(orDefault(pin.Shape, "passive")),
+			posNode("at", pin.Position),
+			effectsNode(pin.Effects),
+			uuidNode(pin.UUID),
+		))
+	}
+	return node
+}
+
+// propertyNode writes (property "key" "value" (at ...) (effects ...))
+func propertyNode(prop Property) *sexp.Node {
+	return sexp.List("property", sexp.Str(prop.Key), sexp.Str(prop.Value),
+		atNode(prop.Position.Position, prop.Position.Angle),
+		effectsNode(prop.Effects),
+	)
+}
+
+// effectsNode writes text effects; a zero font size becomes KiCad's
+// default 1.27mm
+func effectsNode(e Effects) *sexp.Node {
+	size := e.Font.Size
+	if size.Width == 0 && size.Height == 0 {
+		size = Size{Width: 1.27, Height: 1.27}
+	}
+	font := sexp.List("font", sexp.List("size", sexp.Num(size.Width), sexp.Num(size.Height)))
+	if e.Font.Face != "" {
+		font.Add(sexp.List("face", sexp.Str(e.Font.Face)))
+	}
+	if e.Font.Thickness != 0 {
+		font.Add(sexp.List("thickness", sexp.Num(e.Font.Thickness)))
+	}
+	if e.Font.Bold {
+		font.Add(sexp.Sym("bold"))
+	}
+	if e.Font.Italic {
+		font.Add(sexp.Sym("italic"))
+	}
+
+	node := sexp.List("effects", font)
+	var justify []sexp.Item
+	if h := e.Justify.Horizontal; h == "left" || h == "right" {
+		justify = append(justify, sexp.Sym(h))
+	}
+	if v := e.Justify.Vertical; v == "top" || v == "bottom" {
+		justify = append(justify, sexp.Sym(v))
+	}
+	if e.Justify.Mirror {
+		justify = append(justify, sexp.Sym("mirror"))
+	}
+	if len(justify) > 0 {
+		node.Add(sexp.List("justify", justify...))
+	}
+	if e.Hide {
+		node.Add(sexp.Sym("hide"))
+	}
+	return node
+}
+
+// strokeNode writes a stroke; an empty type is written as "default"
+func strokeNode(s Stroke) *sexp.Node {
+	return sexp.List("stroke",
+		sexp.List("width", sexp.Num(s.Width)),
+		sexp.List("type", sexp.Sym(orDefault(s.Type, "default"))),
+	)
+}
+
+// fillNode writes a fill; an empty type is written as "none"
+func fillNode(f Fill) *sexp.Node {
+	return sexp.List("fill", sexp.List("type", sexp.Sym(orDefault(f.Type, "none"))))
+}
+
+func atNode(pos Position, angle Angle) *sexp.Node {
+	return sexp.List("at", sexp.Num(pos.X), sexp.Num(pos.Y), sexp.Num(float64(angle)))
+}
+
+func posNode(key string, pos Position) *sexp.Node {
+	return sexp.List(key, sexp.Num(pos.X), sexp.Num(pos.Y))
+}
+
+func ptsNode(points []Position) *sexp.Node {
+	node := sexp.List("pts")
+	for _, p := range points {
+		node.Add(posNode("xy", p))
+	}
+	return node
+}
+
+// uuidNode writes (uuid "..."), or nothing for an empty UUID
+func uuidNode(id UUID) *sexp.Node {
+	if id == "" {
+		return nil
+	}
+	return sexp.List("uuid", sexp.Str(string(id)))
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
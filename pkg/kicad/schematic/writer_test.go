@@ -0,0 +1,136 @@
+package schematic
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteRoundTrip(t *testing.T) {
+	sch := &Schematic{
+		UUID:       "0b7c1a52-5f0e-4c5e-9d59-0d7f3d1b8e21",
+		Paper:      "A3",
+		TitleBlock: TitleBlock{Title: `Board "rev B"`, Comment2: "generated"},
+		LibSymbols: []LibSymbol{{
+			Name:       "jtag:MCU",
+			PinNumbers: true,
+			PinNames:   true,
+			InBom:      true,
+			OnBoard:    true,
+			Properties: []Property{{Key: "Reference", Value: "U"}},
+			Graphics: []SymGraphic{{
+				Type:  "rectangle",
+				Start: Position{X: -7.62, Y: 5.08},
+				End:   Position{X: 7.62, Y: -5.08},
+				Fill:  Fill{Type: "background"},
+			}},
+			Pins: []Pin{
+				{Type: "input", Style: "line", Position: Position{X: -10.16, Y: 2.54}, Length: 2.54,
+					Name: PinName{Name: "PA0"}, Number: PinNum{Number: "12"}},
+				{Type: "bidirectional", Style: "line", Position: Position{X: 10.16, Y: 2.54}, Angle: 180, Length: 2.54,
+					Name: PinName{Name: "PB1"}, Number: PinNum{Number: "A7"}},
+			},
+		}},
+		Symbols: []Symbol{{
+			LibID:    "jtag:MCU",
+			Position: Position{X: 101.6, Y: 76.2},
+			InBom:    true,
+			OnBoard:  true,
+			UUID:     "5d1e8a44-1111-4c5e-9d59-0d7f3d1b8e21",
+			Properties: []Property{
+				{Key: "Reference", Value: "U3"},
+				{Key: "Footprint", Value: "Package_QFP:LQFP-48_7x7mm_P0.5mm"},
+			},
+			Pins: []PinRef{{Number: "12", UUID: "pin-12"}, {Number: "A7", UUID: "pin-a7"}},
+		}},
+		Wires: []Wire{{Points: []Position{{X: 88.9, Y: 73.66}, {X: 81.28, Y: 73.66}}, UUID: "wire-1"}},
+		GlobalLabels: []GlobalLabel{{
+			Text:     "Net-(U3-PA0)",
+			Shape:    "input",
+			Position: Position{X: 81.28, Y: 73.66},
+			Effects:  Effects{Justify: Justify{Horizontal: "right"}},
+			UUID:     "label-1",
+		}},
+		NoConnects: []NoConnect{{Position: Position{X: 111.76, Y: 73.66}, UUID: "nc-1"}},
+		Texts:      []Text{{Text: "line one\nline two", Position: Position{X: 20, Y: 20}, UUID: "text-1"}},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, sch); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"(version 20231120)",
+		`(title "Board \"rev B\"")`,
+		`(comment 2 "generated")`,
+		`(symbol "MCU_1_1"`,
+		`(path "/0b7c1a52-5f0e-4c5e-9d59-0d7f3d1b8e21"`,
+		`(reference "U3")`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %s:\n%s", want, out)
+		}
+	}
+
+	got, err := Parse(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("Parse of written schematic failed: %v\n%s", err, out)
+	}
+	if got.Version != DefaultVersion || got.Paper != "A3" || got.UUID != sch.UUID {
+		t.Errorf("header = %d %q %q", got.Version, got.Paper, got.UUID)
+	}
+	if got.TitleBlock.Title != sch.TitleBlock.Title {
+		t.Errorf("title = %q", got.TitleBlock.Title)
+	}
+	if len(got.LibSymbols) != 1 || len(got.LibSymbols[0].Pins) != 2 || len(got.LibSymbols[0].Graphics) != 1 {
+		t.Fatalf("lib symbols = %+v", got.LibSymbols)
+	}
+	pin := got.LibSymbols[0].Pins[1]
+	if pin.Type != "bidirectional" || pin.Name.Name != "PB1" || pin.Number.Number != "A7" || pin.Position.X != 10.16 {
+		t.Errorf("pin = %+v", pin)
+	}
+	if refs := got.GetAllReferences(); len(refs) != 1 || refs[0] != "U3" {
+		t.Errorf("references = %v", refs)
+	}
+	if len(got.Symbols[0].Pins) != 2 || got.Symbols[0].Position != sch.Symbols[0].Position {
+		t.Errorf("symbol = %+v", got.Symbols[0])
+	}
+	if len(got.Wires) != 1 || len(got.Wires[0].Points) != 2 {
+		t.Errorf("wires = %+v", got.Wires)
+	}
+	if len(got.GlobalLabels) != 1 || got.GlobalLabels[0].Text != "Net-(U3-PA0)" || got.GlobalLabels[0].Shape != "input" ||
+		got.GlobalLabels[0].Effects.Justify.Horizontal != "right" {
+		t.Errorf("global labels = %+v", got.GlobalLabels)
+	}
+	if len(got.NoConnects) != 1 || len(got.Texts) != 1 || got.Texts[0].Text != "line one\nline two" {
+		t.Errorf("no connects = %+v, texts = %+v", got.NoConnects, got.Texts)
+	}
+}
+
+func TestWriteParsedFile(t *testing.T) {
+	sch, err := ParseFile("../../../testdata/test/test.kicad_sch")
+	if err != nil {
+		t.Fatalf("Failed to parse test file: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, sch); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	got, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse of written schematic failed: %v", err)
+	}
+
+	if len(got.LibSymbols) != len(sch.LibSymbols) || len(got.Symbols) != len(sch.Symbols) ||
+		len(got.Wires) != len(sch.Wires) || len(got.Junctions) != len(sch.Junctions) ||
+		len(got.GetLabels()) != len(sch.GetLabels()) {
+		t.Errorf("round trip changed element counts: %d/%d/%d/%d/%d, want %d/%d/%d/%d/%d",
+			len(got.LibSymbols), len(got.Symbols), len(got.Wires), len(got.Junctions), len(got.GetLabels()),
+			len(sch.LibSymbols), len(sch.Symbols), len(sch.Wires), len(sch.Junctions), len(sch.GetLabels()))
+	}
+	if strings.Join(got.GetAllReferences(), ",") != strings.Join(sch.GetAllReferences(), ",") {
+		t.Errorf("references = %v, want %v", got.GetAllReferences(), sch.GetAllReferences())
+	}
+}
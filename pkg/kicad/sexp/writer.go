@@ -0,0 +1,136 @@
+package sexp
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// S-expression writing helpers
+
+// Item is an element of a Node. Only Atom and *Node implement it.
+type Item interface {
+	item()
+}
+
+// Atom is a leaf written as-is. Use Sym, Str, Num and Int to build one.
+type Atom string
+
+func (Atom) item() {}
+
+// Node is a list being built for writing: (Name items...)
+type Node struct {
+	Name  string
+	Items []Item
+}
+
+func (*Node) item() {}
+
+// List creates a node. Nil items, including nil *Node values, are
+// skipped, so optional children can be passed inline.
+func List(name string, items ...Item) *Node {
+	n := &Node{Name: name}
+	return n.Add(items...)
+}
+
+// Add appends items to the node, skipping nils.
+func (n *Node) Add(items ...Item) *Node {
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		if v, ok := item.(*Node); ok && v == nil {
+			continue
+		}
+		n.Items = append(n.Items, item)
+	}
+	return n
+}
+
+// Sym returns an unquoted symbol atom, e.g. yes or input.
+func Sym(s string) Atom {
+	return Atom(s)
+}
+
+// Str returns a quoted string atom.
+func Str(s string) Atom {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return Atom(`"` + r.Replace(s) + `"`)
+}
+
+// Num returns a number atom with at most four decimals, the precision
+// KiCad writes.
+func Num(v float64) Atom {
+	v = math.Round(v*1e4) / 1e4
+	if v == 0 {
+		v = 0 // Avoid -0
+	}
+	return Atom(strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+// Int returns an integer atom.
+func Int(v int) Atom {
+	return Atom(strconv.Itoa(v))
+}
+
+// YesNo returns the yes/no symbol KiCad uses for flags.
+func YesNo(b bool) Atom {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// WriteTo writes the node in KiCad's layout: lists holding only atoms on
+// one line, other lists with one child per line, indented by tabs.
+func (n *Node) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	cw := &countWriter{w: bw}
+	n.write(cw, 0)
+	cw.WriteString("\n")
+	if cw.err == nil {
+		cw.err = bw.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func (n *Node) write(w *countWriter, depth int) {
+	w.WriteString("(" + n.Name)
+	nested := false
+	for _, item := range n.Items {
+		switch v := item.(type) {
+		case Atom:
+			if nested {
+				w.WriteString("\n" + strings.Repeat("\t", depth+1) + string(v))
+			} else {
+				w.WriteString(" " + string(v))
+			}
+		case *Node:
+			nested = true
+			w.WriteString("\n" + strings.Repeat("\t", depth+1))
+			v.write(w, depth+1)
+		}
+	}
+	if nested {
+		w.WriteString("\n" + strings.Repeat("\t", depth))
+	}
+	w.WriteString(")")
+}
+
+// countWriter keeps the first error and the byte count for WriteTo.
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countWriter) WriteString(s string) {
+	if c.err != nil {
+		return
+	}
+	n, err := c.w.WriteString(s)
+	c.n += int64(n)
+	c.err = err
+}
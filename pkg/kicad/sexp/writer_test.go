@@ -0,0 +1,99 @@
+package sexp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/kicad/sexp/kicadsexp"
+)
+
+func TestStr(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Atom
+	}{
+		{"", `""`},
+		{"U1", `"U1"`},
+		{"a b", `"a b"`},
+		{`Board "rev B"`, `"Board \"rev B\""`},
+		{`C:\lib`, `"C:\\lib"`},
+		{"line 1\nline 2", `"line 1\nline 2"`},
+	}
+	for _, tt := range tests {
+		if got := Str(tt.in); got != tt.want {
+			t.Errorf("Str(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+
+		// The reader must give back the original text
+		sexps, err := kicadsexp.ParseString("(s " + string(Str(tt.in)) + ")")
+		if err != nil {
+			t.Fatalf("parse %s: %v", Str(tt.in), err)
+		}
+		list, ok := sexps[0].(*kicadsexp.List)
+		if !ok || list.Len() != 2 {
+			t.Fatalf("parse %s gave %v", Str(tt.in), sexps[0])
+		}
+		if got := list.Get(1).String(); got != tt.in {
+			t.Errorf("Str(%q) reads back as %q", tt.in, got)
+		}
+	}
+}
+
+func TestAtoms(t *testing.T) {
+	tests := []struct {
+		got, want Atom
+	}{
+		{Sym("input"), "input"},
+		{Num(2.54), "2.54"},
+		{Num(1.000049), "1"},
+		{Num(-0.00001), "0"},
+		{Num(-12.7), "-12.7"},
+		{Int(42), "42"},
+		{YesNo(true), "yes"},
+		{YesNo(false), "no"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("atom = %s, want %s", tt.got, tt.want)
+		}
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	var missing *Node
+	root := List("kicad_sch",
+		List("version", Int(20231120)),
+		missing,
+		nil,
+		List("symbol", Str("U1"),
+			List("at", Num(1.27), Num(2.54), Int(0)),
+			Sym("hide"),
+			List("property", Str("Reference"), Str("U1")),
+		),
+	)
+	root.Add(List("empty"))
+
+	var buf bytes.Buffer
+	n, err := root.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	want := "(kicad_sch\n" +
+		"\t(version 20231120)\n" +
+		"\t(symbol \"U1\"\n" +
+		"\t\t(at 1.27 2.54 0)\n" +
+		"\t\thide\n" +
+		"\t\t(property \"Reference\" \"U1\")\n" +
+		"\t)\n" +
+		"\t(empty)\n" +
+		")\n"
+	if buf.String() != want {
+		t.Errorf("WriteTo wrote:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo returned %d bytes, wrote %d", n, buf.Len())
+	}
+	if len(root.Items) != 3 {
+		t.Errorf("root has %d items, want nils skipped", len(root.Items))
+	}
+}
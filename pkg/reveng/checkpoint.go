@@ -0,0 +1,253 @@
+package reveng
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
+)
+
+// checkpointVersion is bumped whenever the file layout changes.
+const checkpointVersion = 1
+
+// Checkpoint is the saved progress of a DiscoverNetlist run. Set
+// Config.CheckpointFile to have one written while the run goes on, and pass
+// it back through Config.Resume to pick up where the run stopped.
+type Checkpoint struct {
+	Version    int          `json:"version"`
+	Saved      time.Time    `json:"saved"`
+	Chain      string       `json:"chain"`  // ChainFingerprint of the scanned chain(s)
+	Config     Config       `json:"config"` // Settings the run was started with
+	Classified bool         `json:"classified,omitempty"`
+	Done       []bsr.PinRef `json:"done"` // Drivers already scanned
+	Netlist    netlistState `json:"netlist"`
+}
+
+// netlistState is the union-find state of a Netlist before Finalize.
+type netlistState struct {
+	Pins   []bsr.PinRef      `json:"pins"`
+	Parent map[string]string `json:"parent"`
+	Rank   map[string]int    `json:"rank"`
+	Pairs  []DiffPairLeg     `json:"diff_pairs,omitempty"`
+	Edges  []Edge            `json:"edges,omitempty"`
+	Attrs  []PinAttr         `json:"pin_attrs,omitempty"`
+}
+
+// LoadCheckpoint reads a checkpoint written by an earlier run.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reveng: failed to read checkpoint: %w", err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("reveng: failed to parse checkpoint %s: %w", path, err)
+	}
+	if cp.Version != checkpointVersion {
+		return nil, fmt.Errorf("reveng: checkpoint %s has version %d, want %d", path, cp.Version, checkpointVersion)
+	}
+	return &cp, nil
+}
+
+// ChainFingerprint identifies the scanned chain by each device's IDCODE,
+// name, boundary length and pin count, so a checkpoint is only resumed on
+// the board (and BSDL/package selection) it was taken on.
+func ChainFingerprint(ctl *bsr.Controller) string {
+	parts := make([]string, 0, len(ctl.Devices))
+	for _, dev := range ctl.Devices {
+		length := 0
+		if dev.ChainDev.Info != nil {
+			length = dev.ChainDev.Info.BoundaryLength
+		}
+		parts = append(parts, fmt.Sprintf("0x%08X/%s/%d/%d",
+			dev.ChainDev.IDCode, dev.ChainDev.Name(), length, len(dev.Pins)))
+	}
+	return strings.Join(parts, " ")
+}
+
+// sessionFingerprint joins the fingerprints of the session's chains; for a
+// single chain it is its ChainFingerprint.
+func sessionFingerprint(sess *bsr.Session) string {
+	parts := make([]string, 0, len(sess.Controllers))
+	for _, ctl := range sess.Controllers {
+		parts = append(parts, ChainFingerprint(ctl))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// checkpointer tracks the drivers a run has finished and saves them with
+// the netlist every Config.CheckpointEvery drivers.
+type checkpointer struct {
+	cfg        *Config
+	chain      string
+	nl         *Netlist
+	done       map[string]bool
+	order      []bsr.PinRef
+	classified bool
+	unsaved    int
+}
+
+func newCheckpointer(sess *bsr.Session, cfg *Config, nl *Netlist) *checkpointer {
+	return &checkpointer{
+		cfg:   cfg,
+		chain: sessionFingerprint(sess),
+		nl:    nl,
+		done:  make(map[string]bool),
+	}
+}
+
+// resume restores cp into the run after checking it was taken on the same
+// chain with the same settings.
+func (c *checkpointer) resume(cp *Checkpoint) error {
+	if cp.Chain != c.chain {
+		return fmt.Errorf("reveng: checkpoint was taken on a different chain (%s, now %s)", cp.Chain, c.chain)
+	}
+	if !c.cfg.sameScan(&cp.Config) {
+		return fmt.Errorf("reveng: checkpoint was taken with different settings")
+	}
+	if err := c.nl.restore(cp.Netlist); err != nil {
+		return err
+	}
+	for _, ref := range cp.Done {
+		c.markDone(ref)
+	}
+	c.classified = cp.Classified
+	c.unsaved = 0
+	return nil
+}
+
+func (c *checkpointer) isDone(ref bsr.PinRef) bool {
+	return c.done[pinKey(ref)]
+}
+
+// finish marks a driver done and saves when the interval is reached.
+func (c *checkpointer) finish(ref bsr.PinRef) error {
+	c.markDone(ref)
+	c.unsaved++
+	if c.unsaved < c.cfg.CheckpointEvery {
+		return nil
+	}
+	return c.save()
+}
+
+func (c *checkpointer) markDone(ref bsr.PinRef) {
+	if !c.done[pinKey(ref)] {
+		c.done[pinKey(ref)] = true
+		c.order = append(c.order, ref)
+	}
+}
+
+// save writes the checkpoint file, if one is configured. The file is
+// replaced atomically so an interrupted save keeps the previous one.
+func (c *checkpointer) save() error {
+	c.unsaved = 0
+	if c.cfg.CheckpointFile == "" {
+		return nil
+	}
+	cp := Checkpoint{
+		Version:    checkpointVersion,
+		Saved:      time.Now(),
+		Chain:      c.chain,
+		Config:     *c.cfg,
+		Classified: c.classified,
+		Done:       c.order,
+		Netlist:    c.nl.state(),
+	}
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("reveng: failed to encode checkpoint: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.cfg.CheckpointFile), ".reveng-checkpoint-*")
+	if err != nil {
+		return fmt.Errorf("reveng: failed to save checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("reveng: failed to save checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("reveng: failed to save checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.cfg.CheckpointFile); err != nil {
+		return fmt.Errorf("reveng: failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// sameScan reports whether two configurations select and test pins the same
+// way. Checkpoint settings, the seed and the compiled pattern are not
+// compared.
+func (c *Config) sameScan(o *Config) bool {
+	a, b := *c, *o
+	for _, cfg := range []*Config{&a, &b} {
+		cfg.CheckpointFile, cfg.CheckpointEvery, cfg.Resume, cfg.Seed = "", 0, nil, nil
+		cfg.pinRegex = nil
+		if len(cfg.OnlyDevices) == 0 {
+			cfg.OnlyDevices = nil
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// state captures the netlist's union-find state.
+func (nl *Netlist) state() netlistState {
+	st := netlistState{
+		Pins:   append([]bsr.PinRef(nil), nl.allPins...),
+		Parent: make(map[string]string, len(nl.parent)),
+		Rank:   make(map[string]int, len(nl.rank)),
+		Edges:  append([]Edge(nil), nl.edges...),
+	}
+	for k, v := range nl.parent {
+		st.Parent[k] = v
+	}
+	for k, v := range nl.rank {
+		st.Rank[k] = v
+	}
+	for _, leg := range nl.pairs {
+		st.Pairs = append(st.Pairs, leg)
+	}
+	for _, attr := range nl.attrs {
+		st.Attrs = append(st.Attrs, attr)
+	}
+	return st
+}
+
+// restore loads a saved union-find state into nl, which must hold the same
+// pins.
+func (nl *Netlist) restore(st netlistState) error {
+	if len(st.Pins) != len(nl.allPins) {
+		return fmt.Errorf("reveng: checkpoint has %d pins, run has %d", len(st.Pins), len(nl.allPins))
+	}
+	for _, pin := range st.Pins {
+		key := pinKey(pin)
+		if _, ok := nl.pinKeys[key]; !ok {
+			return fmt.Errorf("reveng: checkpoint pin %s.%s is not part of this run", pin.DeviceName, pin.PinName)
+		}
+		parent, ok := st.Parent[key]
+		if _, known := nl.pinKeys[parent]; !ok || !known {
+			return fmt.Errorf("reveng: checkpoint has no valid parent for %s.%s", pin.DeviceName, pin.PinName)
+		}
+	}
+
+	for k, v := range st.Parent {
+		nl.parent[k] = v
+	}
+	for k, v := range st.Rank {
+		nl.rank[k] = v
+	}
+	for _, leg := range st.Pairs {
+		nl.pairs[pinKey(leg.Pin)] = leg
+	}
+	nl.edges = append([]Edge(nil), st.Edges...)
+	for _, attr := range st.Attrs {
+		nl.attrs[pinKey(attr.Pin)] = attr
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package reveng
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiscoverNetlistResume(t *testing.T) {
+	nets := [][]string{
+		{"DEV0.A1", "DEV1.A3", "DEV2.A3"},
+		{"DEV0.A2", "DEV1.A1"},
+		{"DEV2.A2", "DEV0.A3"},
+	}
+	want := "[DEV0.A1,DEV1.A3,DEV2.A3 DEV0.A2,DEV1.A1 DEV0.A3,DEV2.A2]"
+
+	for _, algo := range []Algorithm{AlgorithmSequential, AlgorithmCoded} {
+		t.Run(string(algo), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "reveng.checkpoint")
+			newConfig := func() *Config {
+				cfg := DefaultConfig()
+				cfg.Algorithm = algo
+				cfg.SkipKnownJTAGPins = false
+				cfg.SkipPowerPins = false
+				cfg.DetectPullResistors = true
+				cfg.CheckpointFile = path
+				cfg.CheckpointEvery = 1
+				return cfg
+			}
+
+			// Full run for reference
+			full := &codedBoard{nets: nets}
+			if _, err := DiscoverNetlist(context.Background(), newCodedBoardController(t, full), newConfig(), nil); err != nil {
+				t.Fatalf("DiscoverNetlist failed: %v", err)
+			}
+
+			// Interrupted run: cancel once a few drivers are done
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			first := &codedBoard{nets: nets}
+			limit := full.scans * 2 / 3
+			first.onScan = func(scans int) {
+				if scans == limit {
+					cancel()
+				}
+			}
+			partial, err := DiscoverNetlist(ctx, newCodedBoardController(t, first), newConfig(), nil)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("interrupted run returned %v, want context.Canceled", err)
+			}
+			if partial == nil || partial.Nets == nil {
+				t.Fatalf("interrupted run returned no partial netlist")
+			}
+
+			cp, err := LoadCheckpoint(path)
+			if err != nil {
+				t.Fatalf("LoadCheckpoint failed: %v", err)
+			}
+			if len(cp.Done) == 0 || !cp.Classified {
+				t.Fatalf("checkpoint holds %d drivers, classified=%v", len(cp.Done), cp.Classified)
+			}
+
+			// Resumed run finishes the job with fewer scans
+			second := &codedBoard{nets: nets}
+			cfg := newConfig()
+			cfg.Resume = cp
+			nl, err := DiscoverNetlist(context.Background(), newCodedBoardController(t, second), cfg, nil)
+			if err != nil {
+				t.Fatalf("resumed DiscoverNetlist failed: %v", err)
+			}
+			if got := fmt.Sprint(multiPinNets(nl)); got != want {
+				t.Errorf("resumed nets = %s, want %s", got, want)
+			}
+			if len(nl.Pins) == 0 {
+				t.Errorf("resumed run lost the pin classes")
+			}
+			if second.scans >= full.scans {
+				t.Errorf("resume took %d scans, a full run %d", second.scans, full.scans)
+			}
+		})
+	}
+}
+
+func TestResumeRejectsOtherChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reveng.checkpoint")
+	cfg := DefaultConfig()
+	cfg.CheckpointFile = path
+	board := &codedBoard{}
+	if _, err := DiscoverNetlist(context.Background(), newCodedBoardController(t, board), cfg, nil); err != nil {
+		t.Fatalf("DiscoverNetlist failed: %v", err)
+	}
+	cp, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint failed: %v", err)
+	}
+
+	other := *cp
+	other.Chain = strings.Replace(cp.Chain, "0x11111111", "0x11111112", 1)
+	cfg = DefaultConfig()
+	cfg.Resume = &other
+	if _, err := DiscoverNetlist(context.Background(), newCodedBoardController(t, &codedBoard{}), cfg, nil); err == nil ||
+		!strings.Contains(err.Error(), "different chain") {
+		t.Errorf("resume on another chain returned %v", err)
+	}
+
+	cfg = DefaultConfig()
+	cfg.RepeatsPerPin = 2
+	cfg.Resume = cp
+	if _, err := DiscoverNetlist(context.Background(), newCodedBoardController(t, &codedBoard{}), cfg, nil); err == nil ||
+		!strings.Contains(err.Error(), "different settings") {
+		t.Errorf("resume with other settings returned %v", err)
+	}
+}
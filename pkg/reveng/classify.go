@@ -0,0 +1,137 @@
+package reveng
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
+)
+
+// PinClass describes how a pin behaves when nothing drives it.
+type PinClass string
+
+const (
+	// PinUnknown means the pin could not be pre-charged, so its idle level
+	// says nothing about what holds it there.
+	PinUnknown PinClass = "unknown"
+	// PinFloating pins keep whatever level they were last driven to.
+	PinFloating PinClass = "floating"
+	// PinPullUp and PinPullDown pins return to one level once released.
+	PinPullUp   PinClass = "pull_up"
+	PinPullDown PinClass = "pull_down"
+	// PinStuckLow and PinStuckHigh pins cannot be moved by their own
+	// drivers, which usually means a hard tie to GND or VCC.
+	PinStuckLow  PinClass = "stuck_low"
+	PinStuckHigh PinClass = "stuck_high"
+	// PinWeakDriver pins sit on a net whose connections were only seen in
+	// some of the toggle repeats.
+	PinWeakDriver PinClass = "weak_driver"
+)
+
+// PinAttr is the classification of one pin.
+type PinAttr struct {
+	Pin      bsr.PinRef `json:"pin"`
+	Class    PinClass   `json:"class"`
+	IdleHigh bool       `json:"idle_high"` // Level read with every pin HiZ
+
+	// Measured is the class classifyPins found when Finalize has since
+	// reported the pin as PinWeakDriver.
+	Measured PinClass `json:"measured,omitempty"`
+}
+
+// classifyPins records a PinAttr for every candidate with an input cell.
+//
+// With all pins HiZ it captures the idle levels. It then drives every
+// drivable candidate high, captures, releases them all and captures again,
+// and repeats that low. A driven pin that reads the same level both times
+// is stuck there. A pin that moved with the drive is floating if it kept
+// the level after release, or pulled if it went back to one level either
+// way. Receivers only take part through a drivable pin on their net.
+func classifyPins(
+	ctx context.Context,
+	sess *bsr.Session,
+	candidates []bsr.PinRef,
+	nl *Netlist,
+	progress chan<- Progress,
+) error {
+	if progress != nil {
+		progress <- Progress{Phase: "classifying", Total: len(candidates)}
+	}
+
+	if err := sess.SetAllPinsHiZ(); err != nil {
+		return fmt.Errorf("reveng: failed to set HiZ: %w", err)
+	}
+	idle, err := sess.CaptureAll()
+	if err != nil {
+		return fmt.Errorf("reveng: failed to capture idle levels: %w", err)
+	}
+
+	drivable := make(map[bsr.PinRef]bool)
+	for _, ref := range candidates {
+		if sess.CanDrive(ref) {
+			drivable[ref] = true
+		}
+	}
+
+	var driven, released [2]map[bsr.PinRef]bool
+	for i, level := range []bool{false, true} {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		values := make(map[bsr.PinRef]bool, len(drivable))
+		for ref := range drivable {
+			values[ref] = level
+		}
+		if len(values) > 0 {
+			if err := sess.ApplyPins(values); err != nil {
+				return fmt.Errorf("reveng: failed to drive pins %s: %w", levelName(level), err)
+			}
+		}
+		if driven[i], err = sess.CaptureAll(); err != nil {
+			return fmt.Errorf("reveng: failed to capture driven levels: %w", err)
+		}
+		if err := sess.SetAllPinsHiZ(); err != nil {
+			return fmt.Errorf("reveng: failed to set HiZ: %w", err)
+		}
+		if released[i], err = sess.CaptureAll(); err != nil {
+			return fmt.Errorf("reveng: failed to capture released levels: %w", err)
+		}
+	}
+
+	for _, ref := range candidates {
+		idleHigh, ok := idle[ref]
+		if !ok {
+			continue // No input cell
+		}
+		attr := PinAttr{Pin: ref, Class: PinUnknown, IdleHigh: idleHigh}
+		low, high := driven[0][ref], driven[1][ref]
+		switch {
+		case low == high && drivable[ref]:
+			attr.Class = PinStuckLow
+			if high {
+				attr.Class = PinStuckHigh
+			}
+		case low == high || !high:
+			// Never moved, or moved against the drive
+		case released[0][ref] == released[1][ref]:
+			attr.Class = PinPullDown
+			if released[1][ref] {
+				attr.Class = PinPullUp
+			}
+		case released[1][ref] && !released[0][ref]:
+			attr.Class = PinFloating
+		}
+		nl.SetPinAttr(attr)
+	}
+	return nil
+}
+
+func levelName(high bool) string {
+	if high {
+		return "high"
+	}
+	return "low"
+}
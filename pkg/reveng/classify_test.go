@@ -0,0 +1,124 @@
+package reveng
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
+)
+
+func TestClassifyPins(t *testing.T) {
+	board := &codedBoard{
+		nets: [][]string{
+			{"DEV0.A1", "DEV1.A3"},
+			{"DEV0.A2", "DEV2.A3"},
+		},
+		flaky: map[string]bool{"DEV2.A3": true},
+		pulls: map[string]bool{"DEV0.A1": true, "DEV0.A2": false, "DEV2.A1": false},
+		ties:  map[string]bool{"DEV1.A1": false, "DEV2.A2": true},
+		hold:  true,
+	}
+	ctl := newCodedBoardController(t, board)
+	cfg := DefaultConfig()
+	cfg.SkipKnownJTAGPins = false
+	cfg.SkipPowerPins = false
+	cfg.RepeatsPerPin = 5
+	cfg.DetectPullResistors = true
+	nl, err := DiscoverNetlist(context.Background(), ctl, cfg, nil)
+	if err != nil {
+		t.Fatalf("DiscoverNetlist failed: %v", err)
+	}
+
+	want := map[string]PinClass{
+		"DEV0.A1": PinPullUp,
+		"DEV1.A3": PinPullUp, // Input-only, pre-charged through DEV0.A1
+		"DEV0.A2": PinWeakDriver,
+		"DEV2.A3": PinWeakDriver,
+		"DEV1.A1": PinStuckLow,
+		"DEV2.A2": PinStuckHigh,
+		"DEV2.A1": PinPullDown,
+		"DEV1.A2": PinFloating,
+		"DEV0.A3": PinUnknown, // Nothing can drive it
+	}
+	if len(nl.Pins) != 9 {
+		t.Errorf("got %d classified pins, want 9", len(nl.Pins))
+	}
+	for _, attr := range nl.Pins {
+		name := attr.Pin.DeviceName + "." + attr.Pin.PinName
+		if attr.Class != want[name] {
+			t.Errorf("%s classified %s, want %s", name, attr.Class, want[name])
+		}
+	}
+
+	kicad, err := nl.ExportKiCad()
+	if err != nil {
+		t.Fatalf("ExportKiCad failed: %v", err)
+	}
+	for _, line := range []string{
+		`(name "Net-(U2-PA1)")`,
+		`(node (ref "U2") (pin "A1") (pinfunction "PA1") (pintype "passive"))`,
+		`(name "unconnected-(U2-PA2)")`,
+		`(node (ref "U2") (pin "A2") (pinfunction "PA2") (pintype "tri_state"))`,
+		`(node (ref "U3") (pin "A3") (pinfunction "PA3") (pintype "bidirectional"))`,
+	} {
+		if !strings.Contains(kicad, line) {
+			t.Errorf("KiCad export lacks %s:\n%s", line, kicad)
+		}
+	}
+	if strings.Contains(kicad, "U1-PA3") {
+		t.Errorf("unknown pin should not get a net:\n%s", kicad)
+	}
+
+	data, err := nl.ExportJSON()
+	if err != nil {
+		t.Fatalf("ExportJSON failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"class": "stuck_high"`) {
+		t.Errorf("JSON export lacks pin classes:\n%s", data)
+	}
+}
+
+// TestFinalizeRecomputesWeakDriver checks that PinWeakDriver follows the
+// current edges and never replaces the measured class.
+func TestFinalizeRecomputesWeakDriver(t *testing.T) {
+	a := bsr.PinRef{DeviceName: "DEV0", PinName: "A1"}
+	b := bsr.PinRef{ChainIndex: 1, DeviceName: "DEV1", PinName: "A1"}
+	nl := NewNetlist([]bsr.PinRef{a, b})
+	nl.SetPinAttr(PinAttr{Pin: a, Class: PinPullUp})
+	nl.SetPinAttr(PinAttr{Pin: b, Class: PinStuckLow})
+
+	nl.ConnectVotes(a, b, 3, 5)
+	nl.Finalize()
+	if attr, _ := nl.PinAttr(a); attr.Class != PinWeakDriver || attr.Measured != PinPullUp {
+		t.Errorf("weak net: %s = %+v, want weak_driver measured pull_up", a.PinName, attr)
+	}
+	if attr, _ := nl.PinAttr(b); attr.Class != PinStuckLow {
+		t.Errorf("weak net: stuck pin reclassified as %s", attr.Class)
+	}
+
+	// JSON keeps the measured class through an import
+	data, err := nl.ExportJSON()
+	if err != nil {
+		t.Fatalf("ExportJSON failed: %v", err)
+	}
+	imported, err := ImportJSON(data)
+	if err != nil {
+		t.Fatalf("ImportJSON failed: %v", err)
+	}
+	if attr, _ := imported.PinAttr(a); attr.Class != PinWeakDriver || attr.Measured != PinPullUp {
+		t.Errorf("imported: %+v, want weak_driver measured pull_up", attr)
+	}
+
+	// Once every vote agrees, the measured class is back
+	nl.ConnectVotes(a, b, 5, 5)
+	nl.Finalize()
+	if attr, _ := nl.PinAttr(a); attr.Class != PinPullUp || attr.Measured != "" {
+		t.Errorf("solid net: %+v, want pull_up", attr)
+	}
+	for _, attr := range nl.Pins {
+		if attr.Class == PinWeakDriver {
+			t.Errorf("solid net: Pins still reports %s as weak", attr.Pin.PinName)
+		}
+	}
+}
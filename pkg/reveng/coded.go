@@ -0,0 +1,231 @@
+package reveng
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
+)
+
+// discoverCoded drives all drivers at once while every candidate listens.
+// Driver i gets the code i+1; for each code bit all drivers put out that bit
+// once as is and once complemented, so 2·log2(n) scans replace three scans
+// per pin. A receiver that follows every bit spells out the code of the pin
+// driving its net.
+//
+// Nets with more than one drivable pin make those drivers fight. That shows
+// up as a driver that does not read back its own code, or a receiver whose
+// bits do not decode; those drivers are confirmed with single-pin drives,
+// which also settle the receivers they reach. It returns the number of
+// drivers that reached at least one other pin.
+//
+// The coded patterns are cheap and always rerun on resume; only confirmed
+// drivers are checkpointed.
+func discoverCoded(
+	ctx context.Context,
+	sess *bsr.Session,
+	cfg *Config,
+	candidates, drivers []bsr.PinRef,
+	run *checkpointer,
+	progress chan<- Progress,
+) (int, error) {
+	nl := run.nl
+	if len(drivers) == 0 {
+		return 0, nil
+	}
+
+	// Phase 2a: coded patterns, repeated and required to agree
+	codeBits := bits.Len(uint(len(drivers)))
+	total := 2 * codeBits * cfg.RepeatsPerPin
+	var decoded map[bsr.PinRef]int
+	var captured map[bsr.PinRef]bool
+	scan := 0
+	for rep := 0; rep < cfg.RepeatsPerPin; rep++ {
+		high := make([]map[bsr.PinRef]bool, codeBits)
+		low := make([]map[bsr.PinRef]bool, codeBits)
+		for bit := 0; bit < codeBits; bit++ {
+			for _, complement := range []bool{false, true} {
+				select {
+				case <-ctx.Done():
+					return 0, ctx.Err()
+				default:
+				}
+				if progress != nil {
+					progress <- Progress{Phase: "scanning", Index: scan, Total: total}
+				}
+				scan++
+
+				values := make(map[bsr.PinRef]bool, len(drivers))
+				for i, d := range drivers {
+					values[d] = ((i+1)>>bit)&1 == 1 != complement
+				}
+				if err := sess.ApplyPins(values); err != nil {
+					return 0, fmt.Errorf("reveng: coded drive of bit %d failed: %w", bit, err)
+				}
+				capture, err := sess.CaptureAll()
+				if err != nil {
+					return 0, fmt.Errorf("reveng: coded capture of bit %d failed: %w", bit, err)
+				}
+				if complement {
+					low[bit] = capture
+				} else {
+					high[bit] = capture
+				}
+				captured = capture
+			}
+		}
+
+		pass := decodeCodes(candidates, high, low, len(drivers))
+		if decoded == nil {
+			decoded = pass
+			continue
+		}
+		for ref, idx := range decoded {
+			if got, ok := pass[ref]; !ok || got != idx {
+				decoded[ref] = -1
+			}
+		}
+		for ref := range pass {
+			if _, ok := decoded[ref]; !ok {
+				decoded[ref] = -1
+			}
+		}
+	}
+	if err := sess.SetAllPinsHiZ(); err != nil {
+		return 0, fmt.Errorf("reveng: failed to set HiZ: %w", err)
+	}
+
+	// A driver that can read itself back must see its own code
+	contended := make(map[int]bool)
+	for i, d := range drivers {
+		if _, readable := captured[d]; !readable {
+			continue // No input cell
+		}
+		if idx, ok := decoded[d]; !ok || idx != i {
+			contended[i] = true
+		}
+	}
+	ambiguous := false
+	for _, ref := range candidates {
+		if idx, ok := decoded[ref]; ok && (idx < 0 || contended[idx]) {
+			ambiguous = true
+			break
+		}
+	}
+
+	// Phase 2b: confirm contended drivers one at a time. Output-only drivers
+	// nobody decoded may be what the ambiguous receivers see, so they are
+	// confirmed as well.
+	var confirm []bsr.PinRef
+	seen := make(map[int]bool)
+	for _, idx := range decoded {
+		if idx >= 0 {
+			seen[idx] = true
+		}
+	}
+	for i, d := range drivers {
+		_, readable := captured[d]
+		if contended[i] || (ambiguous && !readable && !seen[i]) {
+			confirm = append(confirm, d)
+		}
+	}
+
+	// Drivers confirmed before a resume settle the pins of their nets
+	netsFound := 0
+	settled := make(map[bsr.PinRef]bool)
+	doneRoots := make(map[bsr.PinRef]bool)
+	for _, driver := range confirm {
+		if run.isDone(driver) {
+			doneRoots[nl.Find(driver)] = true
+		}
+	}
+	for _, ref := range candidates {
+		if doneRoots[nl.Find(ref)] {
+			settled[ref] = true
+		}
+	}
+
+	for i, driver := range confirm {
+		if run.isDone(driver) {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		default:
+		}
+		if progress != nil {
+			progress <- Progress{
+				Phase:     "confirming",
+				Driver:    driver,
+				Index:     i,
+				Total:     len(confirm),
+				NetsFound: netsFound,
+			}
+		}
+
+		togglers, err := detectTogglers(sess, driver, cfg)
+		if err != nil {
+			return 0, fmt.Errorf("reveng: failed to detect togglers for %s.%s: %w",
+				driver.DeviceName, driver.PinName, err)
+		}
+		settled[driver] = true
+		for toggler, votes := range togglers {
+			nl.ConnectVotes(driver, toggler, votes, cfg.RepeatsPerPin)
+			settled[toggler] = true
+		}
+		if len(togglers) > 0 {
+			netsFound++
+		}
+		if err := run.finish(driver); err != nil {
+			return 0, err
+		}
+	}
+
+	// Phase 2c: connect the receivers the codes identified
+	reached := make(map[int]bool)
+	for _, ref := range candidates {
+		idx, ok := decoded[ref]
+		if !ok || idx < 0 || contended[idx] || settled[ref] || drivers[idx] == ref {
+			continue
+		}
+		nl.ConnectVotes(drivers[idx], ref, cfg.RepeatsPerPin, cfg.RepeatsPerPin)
+		reached[idx] = true
+	}
+
+	return netsFound + len(reached), nil
+}
+
+// decodeCodes maps each receiver that followed at least one code bit to the
+// index of the driver whose code it spelled out, or -1 when it followed only
+// some bits or spelled a code no driver has.
+func decodeCodes(receivers []bsr.PinRef, high, low []map[bsr.PinRef]bool, drivers int) map[bsr.PinRef]int {
+	decoded := make(map[bsr.PinRef]int)
+	for _, ref := range receivers {
+		code, follows := 0, 0
+		for bit := range high {
+			h, okHigh := high[bit][ref]
+			l, okLow := low[bit][ref]
+			if !okHigh || !okLow {
+				follows = -1
+				break
+			}
+			if h != l {
+				follows++
+				if h {
+					code |= 1 << bit
+				}
+			}
+		}
+		switch {
+		case follows <= 0:
+			continue
+		case follows == len(high) && code >= 1 && code <= drivers:
+			decoded[ref] = code - 1
+		default:
+			decoded[ref] = -1
+		}
+	}
+	return decoded
+}
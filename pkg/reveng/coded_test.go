@@ -0,0 +1,278 @@
+package reveng
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/chain"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/jtag"
+)
+
+// createCodedTestBSDL builds a device with two bidirectional pins (A1, A2)
+// and one input-only pin (A3).
+func createCodedTestBSDL(name string, id uint32) string {
+	return fmt.Sprintf(`
+entity %s is
+	attribute INSTRUCTION_LENGTH of %s : entity is 5;
+	attribute BOUNDARY_LENGTH of %s : entity is 7;
+	attribute INSTRUCTION_OPCODE of %s : entity is
+		"BYPASS (11111)," &
+		"EXTEST (00000)," &
+		"SAMPLE (00010)";
+	attribute IDCODE_REGISTER of %s : entity is "%s";
+	attribute BOUNDARY_REGISTER of %s : entity is
+		"6 (BC_1, PA3, INPUT, X)," &
+		"5 (BC_1, *, CONTROL, 1)," &
+		"4 (BC_1, PA2, OUTPUT3, X, 5, 1, Z)," &
+		"3 (BC_1, PA2, INPUT, X)," &
+		"2 (BC_1, *, CONTROL, 1)," &
+		"1 (BC_1, PA1, OUTPUT3, X, 2, 1, Z)," &
+		"0 (BC_1, PA1, INPUT, X)";
+	constant PKG_TEST: PIN_MAP_STRING :=
+		"PA1 : A1," &
+		"PA2 : A2," &
+		"PA3 : A3";
+end %s;
+`, name, name, name, name, name, idToBinary(id), name, name)
+}
+
+// codedBoard models such devices on a board, three on one chain unless
+// built with newCodedBoardChain. Like real hardware, a DR
+// scan captures the pins as left by the previous Update-DR; a net driven to
+// both levels reads low (wired-AND). Flaky pins read low on every fifth
+// scan, like a marginal contact. Undriven nets read low unless pulled, or
+// keep their last driven level when hold is set; tied nets never move.
+type codedBoard struct {
+	nets    [][]string // "DEV0.A1" style names
+	flaky   map[string]bool
+	pulls   map[string]bool // Pull level of a pin's net
+	ties    map[string]bool // Rail a pin's net is tied to
+	hold    bool
+	charge  map[string]bool // Last driven level per net, keyed by first pin
+	latched map[int][]bool  // Update latches per device
+	scans   int
+	onScan  func(scans int)
+	fail    func(tdi []bool) error // Fails a boundary scan like a lost transfer
+}
+
+const codedBoardBits = 7
+
+func (b *codedBoard) pinLevel(pin string) (bool, bool) {
+	var dev, num int
+	fmt.Sscanf(pin, "DEV%d.A%d", &dev, &num)
+	cells := b.latched[dev]
+	if cells == nil || num == 3 {
+		return false, false
+	}
+	out, ctl := 1, 2
+	if num == 2 {
+		out, ctl = 4, 5
+	}
+	if cells[ctl] {
+		return false, false // Control 1 disables
+	}
+	return cells[out], true
+}
+
+func (b *codedBoard) netLevel(pin string) bool {
+	members := []string{pin}
+	for _, net := range b.nets {
+		for _, p := range net {
+			if p == pin {
+				members = net
+			}
+		}
+	}
+	for _, p := range members {
+		if rail, ok := b.ties[p]; ok {
+			return rail
+		}
+	}
+	level, driven := true, false
+	for _, p := range members {
+		if v, ok := b.pinLevel(p); ok {
+			level = level && v
+			driven = true
+		}
+	}
+	if driven {
+		if b.hold {
+			b.charge[members[0]] = level
+		}
+		return level
+	}
+	for _, p := range members {
+		if pull, ok := b.pulls[p]; ok {
+			return pull
+		}
+	}
+	return b.charge[members[0]]
+}
+
+// shift scans a chain holding DEV<first> to DEV<first+devices-1>.
+func (b *codedBoard) shift(first, devices int, tdi []bool) []bool {
+	b.scans++
+	if b.onScan != nil {
+		b.onScan(b.scans)
+	}
+	tdo := make([]bool, len(tdi))
+	for i := 0; i < devices; i++ {
+		dev := first + devices - 1 - i
+		base := i * codedBoardBits
+		for num, cell := range map[int]int{1: 0, 2: 3, 3: 6} {
+			pin := fmt.Sprintf("DEV%d.A%d", dev, num)
+			tdo[base+cell] = b.netLevel(pin) && !(b.flaky[pin] && b.scans%5 == 0)
+		}
+	}
+	for i := 0; i < devices; i++ {
+		b.latched[first+devices-1-i] = append([]bool(nil), tdi[i*codedBoardBits:(i+1)*codedBoardBits]...)
+	}
+	return tdo
+}
+
+func newCodedBoardController(t *testing.T, board *codedBoard) *bsr.Controller {
+	t.Helper()
+	board.latched = make(map[int][]bool)
+	board.charge = make(map[string]bool)
+	return newCodedBoardChain(t, board, 0, 3)
+}
+
+// newCodedBoardChain builds a chain of DEV<first> to DEV<first+devices-1>
+// on its own adapter, sharing the board with other chains.
+func newCodedBoardChain(t *testing.T, board *codedBoard, first, devices int) *bsr.Controller {
+	t.Helper()
+	parser, err := bsdl.NewParser()
+	if err != nil {
+		t.Fatalf("parser init failed: %v", err)
+	}
+	repo := chain.NewMemoryRepository()
+	var ids []uint32
+	for i := first; i < first+devices; i++ {
+		id := uint32(i+1) * 0x11111111
+		file, err := parser.ParseString(createCodedTestBSDL(fmt.Sprintf("DEV%d", i), id))
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		if _, _, err := repo.AddFile(file); err != nil {
+			t.Fatalf("AddFile failed: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	sim := jtag.NewSimAdapter(jtag.AdapterInfo{Name: "sim"})
+	idBytes := encodeIDCodes(ids)
+	sim.OnShift = func(region jtag.ShiftRegion, tms, tdi []byte, bits int) ([]byte, error) {
+		switch {
+		case region == jtag.ShiftRegionDR && bits == 32*len(ids):
+			return append([]byte(nil), idBytes...), nil
+		case region == jtag.ShiftRegionDR && bits == codedBoardBits*len(ids):
+			if board.fail != nil {
+				if err := board.fail(bytesToBools(tdi, bits)); err != nil {
+					return nil, err
+				}
+			}
+			return boolsToBytes(board.shift(first, len(ids), bytesToBools(tdi, bits))), nil
+		}
+		return make([]byte, (bits+7)/8), nil
+	}
+
+	ch, err := chain.NewController(sim, repo).Discover(len(ids))
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	ctl, err := bsr.NewController(ch)
+	if err != nil {
+		t.Fatalf("NewController failed: %v", err)
+	}
+	return ctl
+}
+
+func multiPinNets(nl *Netlist) []string {
+	var nets []string
+	for _, net := range nl.Nets {
+		if len(net.Pins) < 2 {
+			continue
+		}
+		var pins []string
+		for _, p := range net.Pins {
+			pins = append(pins, p.DeviceName+"."+p.PinName)
+		}
+		sort.Strings(pins)
+		nets = append(nets, strings.Join(pins, ","))
+	}
+	sort.Strings(nets)
+	return nets
+}
+
+func TestDiscoverNetlistCoded(t *testing.T) {
+	nets := [][]string{
+		{"DEV0.A1", "DEV1.A3", "DEV2.A3"}, // One driver, decoded directly
+		{"DEV0.A2", "DEV1.A1"},            // Two drivers fight, confirmed
+		{"DEV2.A2", "DEV0.A3"},
+	}
+	want := []string{
+		"DEV0.A1,DEV1.A3,DEV2.A3",
+		"DEV0.A2,DEV1.A1",
+		"DEV0.A3,DEV2.A2",
+	}
+
+	results := make(map[Algorithm][]string)
+	scans := make(map[Algorithm]int)
+	for _, algo := range []Algorithm{AlgorithmSequential, AlgorithmCoded} {
+		board := &codedBoard{nets: nets}
+		ctl := newCodedBoardController(t, board)
+
+		cfg := DefaultConfig()
+		cfg.Algorithm = algo
+		cfg.SkipKnownJTAGPins = false
+		cfg.SkipPowerPins = false
+		nl, err := DiscoverNetlist(context.Background(), ctl, cfg, nil)
+		if err != nil {
+			t.Fatalf("%s: DiscoverNetlist failed: %v", algo, err)
+		}
+		results[algo] = multiPinNets(nl)
+		scans[algo] = board.scans
+	}
+
+	for algo, got := range results {
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s nets = %v, want %v", algo, got, want)
+		}
+	}
+	if scans[AlgorithmCoded] >= scans[AlgorithmSequential] {
+		t.Errorf("coded took %d scans, sequential %d", scans[AlgorithmCoded], scans[AlgorithmSequential])
+	}
+}
+
+func TestDecodeCodes(t *testing.T) {
+	a := bsr.PinRef{DeviceName: "D", PinName: "A"}
+	b := bsr.PinRef{DeviceName: "D", PinName: "B"}
+	c := bsr.PinRef{DeviceName: "D", PinName: "C"}
+	d := bsr.PinRef{DeviceName: "D", PinName: "D"}
+
+	// a follows code 0b10 (driver 1), b is stuck, c follows one bit only,
+	// d spells the unused code 0b11
+	high := []map[bsr.PinRef]bool{
+		{a: false, b: true, c: true, d: true},
+		{a: true, b: true, c: true, d: true},
+	}
+	low := []map[bsr.PinRef]bool{
+		{a: true, b: true, c: false, d: false},
+		{a: false, b: true, c: true, d: false},
+	}
+	got := decodeCodes([]bsr.PinRef{a, b, c, d}, high, low, 2)
+	if got[a] != 1 {
+		t.Errorf("a decoded to %d, want 1", got[a])
+	}
+	if _, ok := got[b]; ok {
+		t.Errorf("stuck pin should not decode")
+	}
+	if got[c] != -1 || got[d] != -1 {
+		t.Errorf("partial and unknown codes should be ambiguous: c=%d d=%d", got[c], got[d])
+	}
+}
@@ -1,12 +1,31 @@
 package reveng
 
-import "regexp"
+import (
+	"fmt"
+	"regexp"
+)
+
+// Algorithm selects how DiscoverNetlist drives the candidate pins.
+type Algorithm string
+
+const (
+	// AlgorithmSequential drives one pin at a time through 0→1→0. It needs
+	// three scans per pin but never drives two pins at once.
+	AlgorithmSequential Algorithm = "sequential"
+	// AlgorithmCoded drives every pin at once with a unique binary code and
+	// its complement, needing about 2·log2(n) scans for n pins. Nets with
+	// several drivable pins are confirmed with single-pin drives.
+	AlgorithmCoded Algorithm = "coded"
+)
 
 // Config controls the behavior of the reverse engineering algorithm.
 type Config struct {
+	// Algorithm picks the drive strategy (default: AlgorithmSequential)
+	Algorithm Algorithm
+
 	// Detection settings
 	RepeatsPerPin          int  // Number of 0→1→0 cycles per pin (default: 1)
-	RequireSymmetricToggle bool // Require both 0→1→0 AND 1→0→1 patterns (default: false)
+	RequireSymmetricToggle bool // Also run a 1→0→1 cycle per repeat; both must toggle (default: false)
 
 	// Pin filtering
 	SkipKnownJTAGPins bool     // Exclude TCK/TMS/TDI/TDO pins (default: true)
@@ -14,9 +33,26 @@ type Config struct {
 	OnlyDevices       []string // If set, only scan pins from these devices (by name)
 	OnlyPinPattern    string   // If set, only scan pins matching this regex
 
-	// Advanced heuristics (future enhancements)
+	// Advanced heuristics
 	DetectPullResistors bool // Attempt to detect weak pull-up/down (default: false)
-	MinToggleStrength   int  // Minimum number of successful toggles required (default: 1)
+	MinToggleStrength   int  // Repeats a connection must toggle in to be kept (default: 1)
+
+	// Seed holds nets already known, from a previous run or a schematic
+	// (build one with NewNetlist and Connect). Only one drivable pin per
+	// seeded net is driven; the others are checked as receivers and any
+	// disagreement is reported in Netlist.Contradictions. Renamed seed nets
+	// keep their names. Resumed runs need the same seed.
+	Seed *Netlist `json:"-"`
+
+	// Footprints maps BSDL package names (case-insensitive) to KiCad
+	// Library:Footprint ids, giving each discovered part the footprint of
+	// its package. Parts whose package is not listed get none.
+	Footprints map[string]string `json:"-"`
+
+	// Checkpointing
+	CheckpointFile  string      `json:"-"` // Save progress here (default: none)
+	CheckpointEvery int         `json:"-"` // Drivers scanned between saves (default: 16)
+	Resume          *Checkpoint `json:"-"` // Continue the run this checkpoint was taken from
 
 	// Internal compiled regex
 	pinRegex *regexp.Regexp
@@ -25,6 +61,7 @@ type Config struct {
 // DefaultConfig returns a Config with sensible defaults for most use cases.
 func DefaultConfig() *Config {
 	return &Config{
+		Algorithm:              AlgorithmSequential,
 		RepeatsPerPin:          1,
 		RequireSymmetricToggle: false,
 		SkipKnownJTAGPins:      true,
@@ -33,6 +70,7 @@ func DefaultConfig() *Config {
 		OnlyPinPattern:         "",
 		DetectPullResistors:    false,
 		MinToggleStrength:      1,
+		CheckpointEvery:        16,
 	}
 }
 
@@ -45,6 +83,20 @@ func (c *Config) Validate() error {
 	if c.MinToggleStrength < 1 {
 		c.MinToggleStrength = 1
 	}
+	if c.CheckpointEvery < 1 {
+		c.CheckpointEvery = 16
+	}
+	if c.MinToggleStrength > c.RepeatsPerPin {
+		return fmt.Errorf("min toggle strength %d exceeds repeats per pin %d", c.MinToggleStrength, c.RepeatsPerPin)
+	}
+
+	switch c.Algorithm {
+	case "":
+		c.Algorithm = AlgorithmSequential
+	case AlgorithmSequential, AlgorithmCoded:
+	default:
+		return fmt.Errorf("unknown algorithm %q (use %s or %s)", c.Algorithm, AlgorithmSequential, AlgorithmCoded)
+	}
 
 	// Compile pin pattern regex if provided
 	if c.OnlyPinPattern != "" {
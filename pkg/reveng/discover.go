@@ -2,6 +2,7 @@ package reveng
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -10,7 +11,7 @@ import (
 
 // Progress reports the current state of the reverse engineering process.
 type Progress struct {
-	Phase     string      // "init", "scanning", "finalizing"
+	Phase     string      // "init", "classifying", "scanning", "confirming", "finalizing"
 	Driver    bsr.PinRef  // Currently driven pin
 	Index     int         // Current pin index (0-based)
 	Total     int         // Total number of pins to scan
@@ -32,18 +33,56 @@ type Progress struct {
 //    f. Connect driver to all togglers in netlist
 // 3. Finalize: Build net list from union-find structure
 //
+// With cfg.Algorithm set to AlgorithmCoded, step 2 drives all candidates at
+// once with binary codes instead; see discoverCoded. With
+// cfg.DetectPullResistors set, every pin is first classified as floating,
+// pulled or stuck; see classifyPins.
+//
 // Parameters:
 //   - ctx: Context for cancellation support
 //   - ctl: BSR controller (must be initialized with a discovered chain)
 //   - cfg: Configuration options (use DefaultConfig() if unsure)
 //   - progress: Optional channel for progress updates (can be nil)
 //
+// With cfg.Seed set, only one representative of each seeded net is driven;
+// see Config.Seed.
+//
+// With cfg.CheckpointFile set, the scanned drivers and the netlist state are
+// saved every cfg.CheckpointEvery drivers and when the run stops; pass the
+// loaded Checkpoint as cfg.Resume to skip the drivers already done. If the
+// scan is cancelled or fails, the finalized partial netlist is returned along
+// with the error.
+//
 // Returns the discovered netlist or an error.
 func DiscoverNetlist(
 	ctx context.Context,
 	ctl *bsr.Controller,
 	cfg *Config,
 	progress chan<- Progress,
+) (*Netlist, error) {
+	sess, err := bsr.NewSession(ctl)
+	if err != nil {
+		return nil, fmt.Errorf("reveng: %w", err)
+	}
+	return DiscoverSession(ctx, sess, cfg, progress)
+}
+
+// DiscoverSession runs DiscoverNetlist across every chain of a session:
+// each candidate is driven on its own chain and listened for on all of
+// them, so the netlist includes nets that cross between chains. Pins in
+// the netlist carry their chain in PinRef.Chain, and parts on chain n > 0
+// default to the references Un01, Un02, ... (U101 for the first part of
+// chain 1). Config filters, seeds and checkpoints apply to the whole
+// session; a checkpoint only resumes on the same set of chains.
+//
+// As with DiscoverNetlist, a scan that is cancelled or fails returns the
+// finalized partial netlist along with the error, and callers may use it;
+// every other error comes with a nil netlist.
+func DiscoverSession(
+	ctx context.Context,
+	sess *bsr.Session,
+	cfg *Config,
+	progress chan<- Progress,
 ) (*Netlist, error) {
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
@@ -56,32 +95,139 @@ func DiscoverNetlist(
 	}
 
 	// Enter EXTEST mode
-	if err := ctl.EnterExtest(); err != nil {
+	if err := sess.EnterExtest(); err != nil {
 		return nil, fmt.Errorf("reveng: failed to enter EXTEST: %w", err)
 	}
 
 	// Set all pins to HiZ as baseline
-	if err := ctl.SetAllPinsHiZ(); err != nil {
+	if err := sess.SetAllPinsHiZ(); err != nil {
 		return nil, fmt.Errorf("reveng: failed to set HiZ: %w", err)
 	}
 
 	// Select candidate pins
-	candidates := selectCandidatePins(ctl, cfg)
+	candidates := selectCandidatePins(sess, cfg)
 	if len(candidates) == 0 {
 		return nil, fmt.Errorf("reveng: no candidate pins found")
 	}
 
-	// Initialize netlist
+	// Initialize netlist. Differential pairs are scanned as one signal via
+	// their positive leg; record the negative leg so exports can show it,
+	// along with the parts and port names exports label pins with.
 	nl := NewNetlist(candidates)
+	for _, ref := range candidates {
+		nl.MarkDiffPair(ref, sess.DiffPair(ref))
+	}
+	nl.describeSession(sess, candidates, cfg.Footprints)
+
+	run := newCheckpointer(sess, cfg, nl)
+	if cfg.Resume != nil {
+		if err := run.resume(cfg.Resume); err != nil {
+			return nil, err
+		}
+	}
+	seed := newSeedPlan(sess, cfg.Seed, candidates)
+
+	// Phase 2: Scan the pins
+	netsFound, err := scanPins(ctx, sess, cfg, candidates, seed, run, progress)
+	if err != nil {
+		// Keep what was found; a checkpoint lets a later run pick it up
+		if saveErr := run.save(); saveErr != nil {
+			err = fmt.Errorf("%w (%v)", err, saveErr)
+		}
+		finalizeRun(nl, cfg)
+		return nl, err
+	}
+	if err := run.save(); err != nil {
+		return nil, err
+	}
+	// Drive scans may still be queued on the adapter; report their errors here
+	if err := sess.Flush(); err != nil {
+		return nil, fmt.Errorf("reveng: %w", err)
+	}
+	nl.Contradictions = seed.apply(sess, nl)
+
+	// Phase 3: Finalize
+	if progress != nil {
+		progress <- Progress{
+			Phase:     "finalizing",
+			Index:     len(candidates),
+			Total:     len(candidates),
+			NetsFound: netsFound,
+		}
+	}
+
+	finalizeRun(nl, cfg)
+	return nl, nil
+}
+
+// finalizeRun finalizes a discovered netlist, carrying the names and notes
+// of cfg.Seed over as ImportJSON does for a file's nets.
+func finalizeRun(nl *Netlist, cfg *Config) {
+	if cfg.Seed != nil {
+		nl.Nets = cfg.Seed.Nets
+	}
+	nl.Finalize()
+}
+
+// scanPins runs the pin classification and the configured discovery
+// algorithm, skipping whatever run restored from a checkpoint and the
+// drivers seed makes redundant.
+func scanPins(
+	ctx context.Context,
+	sess *bsr.Session,
+	cfg *Config,
+	candidates []bsr.PinRef,
+	seed *seedPlan,
+	run *checkpointer,
+	progress chan<- Progress,
+) (int, error) {
+	if cfg.DetectPullResistors && !run.classified {
+		if err := classifyPins(ctx, sess, candidates, run.nl, progress); err != nil {
+			return 0, err
+		}
+		run.classified = true
+		if err := run.save(); err != nil {
+			return 0, err
+		}
+	}
+
+	// Receiver-only pins and seeded net members other than the
+	// representative are listened to but never driven
+	var drivers []bsr.PinRef
+	for _, ref := range candidates {
+		if sess.CanDrive(ref) && !seed.redundant(ref) {
+			drivers = append(drivers, ref)
+		}
+	}
+
+	if cfg.Algorithm == AlgorithmCoded {
+		return discoverCoded(ctx, sess, cfg, candidates, drivers, run, progress)
+	}
+	return discoverSequential(ctx, sess, cfg, drivers, run, progress)
+}
 
-	// Phase 2: Scan each pin
+// discoverSequential drives each driver through 0→1→0 on its own and
+// connects it to every pin that followed. It returns the number of drivers
+// that reached at least one other pin.
+func discoverSequential(
+	ctx context.Context,
+	sess *bsr.Session,
+	cfg *Config,
+	drivers []bsr.PinRef,
+	run *checkpointer,
+	progress chan<- Progress,
+) (int, error) {
 	netsFound := 0
 
-	for i, driver := range candidates {
+	for i, driver := range drivers {
+		if run.isDone(driver) {
+			continue
+		}
+
 		// Check for cancellation
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return 0, ctx.Err()
 		default:
 		}
 
@@ -91,50 +237,42 @@ func DiscoverNetlist(
 				Phase:     "scanning",
 				Driver:    driver,
 				Index:     i,
-				Total:     len(candidates),
+				Total:     len(drivers),
 				NetsFound: netsFound,
 			}
 		}
 
 		// Perform toggle detection for this driver pin
-		togglers, err := detectTogglers(ctl, driver, cfg)
+		togglers, err := detectTogglers(sess, driver, cfg)
 		if err != nil {
-			return nil, fmt.Errorf("reveng: failed to detect togglers for %s.%s: %w",
+			return 0, fmt.Errorf("reveng: failed to detect togglers for %s.%s: %w",
 				driver.DeviceName, driver.PinName, err)
 		}
 
 		// Connect driver to all pins that toggled
-		for _, toggler := range togglers {
-			nl.Connect(driver, toggler)
+		for toggler, votes := range togglers {
+			run.nl.ConnectVotes(driver, toggler, votes, cfg.RepeatsPerPin)
 		}
 
 		// Update nets found count
 		if len(togglers) > 0 {
 			netsFound++
 		}
-	}
 
-	// Phase 3: Finalize
-	if progress != nil {
-		progress <- Progress{
-			Phase:     "finalizing",
-			Index:     len(candidates),
-			Total:     len(candidates),
-			NetsFound: netsFound,
+		if err := run.finish(driver); err != nil {
+			return 0, err
 		}
 	}
 
-	nl.Finalize()
-
-	return nl, nil
+	return netsFound, nil
 }
 
-// selectCandidatePins filters the controller's pins to select which ones
+// selectCandidatePins filters the session's pins to select which ones
 // should be scanned during reverse engineering.
-func selectCandidatePins(ctl *bsr.Controller, cfg *Config) []bsr.PinRef {
+func selectCandidatePins(sess *bsr.Session, cfg *Config) []bsr.PinRef {
 	var candidates []bsr.PinRef
 
-	for _, dev := range ctl.Devices {
+	for _, dev := range sessionDevices(sess) {
 		// Check device filter
 		if !cfg.ShouldScanDevice(dev.ChainDev.Name()) {
 			continue
@@ -156,6 +294,11 @@ func selectCandidatePins(ctl *bsr.Controller, cfg *Config) []bsr.PinRef {
 				continue
 			}
 
+			// Never toggle pins the controller's guard protects
+			if sess.CheckDrive(ps.Ref) != nil {
+				continue
+			}
+
 			candidates = append(candidates, ps.Ref)
 		}
 	}
@@ -163,52 +306,100 @@ func selectCandidatePins(ctl *bsr.Controller, cfg *Config) []bsr.PinRef {
 	return candidates
 }
 
-// detectTogglers drives the given pin through a 0→1→0 cycle and detects
-// which other pins toggled in response.
+// sessionDevices returns the devices of every chain in the session.
+func sessionDevices(sess *bsr.Session) []*bsr.DeviceRuntime {
+	var devices []*bsr.DeviceRuntime
+	for _, ctl := range sess.Controllers {
+		devices = append(devices, ctl.Devices...)
+	}
+	return devices
+}
+
+// detectTogglers drives the given pin through cfg.RepeatsPerPin 0→1→0
+// cycles, each followed by a 1→0→1 cycle when cfg.RequireSymmetricToggle is
+// set. A pin earns one vote per repeat in which it toggled with the driver
+// (in both cycles when symmetric). It returns the vote count of every pin
+// with at least cfg.MinToggleStrength votes; a nil map means the driver has
+// no output cell.
 func detectTogglers(
-	ctl *bsr.Controller,
+	sess *bsr.Session,
 	driver bsr.PinRef,
 	cfg *Config,
-) ([]bsr.PinRef, error) {
+) (map[bsr.PinRef]int, error) {
 	// Set all pins to HiZ
-	if err := ctl.SetAllPinsHiZ(); err != nil {
+	if err := sess.SetAllPinsHiZ(); err != nil {
 		return nil, err
 	}
 
-	// Drive LOW and capture baseline
-	if err := ctl.DrivePin(driver, false); err != nil {
-		// Pin can't be driven (no output cell) - skip it
-		return nil, nil
+	votes := make(map[bsr.PinRef]int)
+	for rep := 0; rep < cfg.RepeatsPerPin; rep++ {
+		up, err := toggleCycle(sess, driver, false, cfg)
+		if err != nil || up == nil {
+			return nil, err
+		}
+		if cfg.RequireSymmetricToggle {
+			down, err := toggleCycle(sess, driver, true, cfg)
+			if err != nil || down == nil {
+				return nil, err
+			}
+			up = intersectPins(up, down)
+		}
+		for _, ref := range up {
+			votes[ref]++
+		}
 	}
-	baseline, err := ctl.CaptureAll()
-	if err != nil {
-		return nil, err
+
+	for ref, n := range votes {
+		if n < cfg.MinToggleStrength {
+			delete(votes, ref)
+		}
 	}
+	return votes, nil
+}
 
-	// Drive HIGH and capture
-	if err := ctl.DrivePin(driver, true); err != nil {
-		return nil, nil
+// toggleCycle drives the pin to start, !start and start again, capturing
+// after each step, and returns the pins that toggled along. It returns nil
+// without error when the guard refuses the drive.
+func toggleCycle(sess *bsr.Session, driver bsr.PinRef, start bool, cfg *Config) ([]bsr.PinRef, error) {
+	var captures [3]map[bsr.PinRef]bool
+	for i, level := range []bool{start, !start, start} {
+		if err := sess.ApplyPins(map[bsr.PinRef]bool{driver: level}); err != nil {
+			if errors.Is(err, bsr.ErrUnsafe) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		values, err := sess.CaptureAll()
+		if err != nil {
+			return nil, err
+		}
+		captures[i] = values
 	}
-	high, err := ctl.CaptureAll()
-	if err != nil {
-		return nil, err
+	togglers := findTogglers(driver, captures[0], captures[1], captures[2], cfg)
+	if togglers == nil {
+		togglers = []bsr.PinRef{}
 	}
+	return togglers, nil
+}
 
-	// Drive LOW again and capture
-	if err := ctl.DrivePin(driver, false); err != nil {
-		return nil, err
+// intersectPins returns the pins present in both lists.
+func intersectPins(a, b []bsr.PinRef) []bsr.PinRef {
+	inB := make(map[bsr.PinRef]bool, len(b))
+	for _, ref := range b {
+		inB[ref] = true
 	}
-	low2, err := ctl.CaptureAll()
-	if err != nil {
-		return nil, err
+	out := []bsr.PinRef{}
+	for _, ref := range a {
+		if inB[ref] {
+			out = append(out, ref)
+		}
 	}
-
-	// Detect togglers
-	return findTogglers(driver, baseline, high, low2, cfg), nil
+	return out
 }
 
-// findTogglers analyzes captured pin states to find pins that toggled
-// in response to the driver pin changing.
+// findTogglers analyzes one cycle of captures to find pins that toggled in
+// response to the driver pin changing, in phase (0→1→0) or inverted
+// (1→0→1).
 func findTogglers(
 	driver bsr.PinRef,
 	baseline, high, low2 map[bsr.PinRef]bool,
@@ -218,9 +409,7 @@ func findTogglers(
 
 	for ref, baseVal := range baseline {
 		// Skip the driver itself
-		if ref.ChainIndex == driver.ChainIndex &&
-			ref.DeviceName == driver.DeviceName &&
-			ref.PinName == driver.PinName {
+		if ref == driver {
 			continue
 		}
 
@@ -232,24 +421,9 @@ func findTogglers(
 			continue // Pin not captured in all phases
 		}
 
-		// Detect 0→1→0 pattern (toggled up)
-		toggledUp := (baseVal == false && highVal == true && low2Val == false)
-
-		// Detect 1→0→1 pattern (toggled down)
-		toggledDown := (baseVal == true && highVal == false && low2Val == true)
-
-		if cfg.RequireSymmetricToggle {
-			// For strict mode, we would need to run the test twice
-			// (once with 0→1→0 and once with 1→0→1)
-			// For now, accept either pattern
-			if toggledUp || toggledDown {
-				togglers = append(togglers, ref)
-			}
-		} else {
-			// Accept any toggle pattern
-			if toggledUp || toggledDown {
-				togglers = append(togglers, ref)
-			}
+		// The pin must change with the driver and return with it
+		if highVal != baseVal && low2Val == baseVal {
+			togglers = append(togglers, ref)
 		}
 	}
 
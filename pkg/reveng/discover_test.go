@@ -3,6 +3,7 @@ package reveng
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
@@ -415,3 +416,167 @@ func bytesToBools(buf []byte, bits int) []bool {
 	}
 	return out
 }
+
+func TestDiscoverSession(t *testing.T) {
+	// DEV0-DEV2 on one chain, DEV3 and DEV4 on a second header
+	nets := [][]string{
+		{"DEV0.A1", "DEV3.A3"}, // Chain 0 drives chain 1
+		{"DEV4.A2", "DEV1.A3"}, // Chain 1 drives chain 0
+		{"DEV3.A1", "DEV4.A1"},
+		{"DEV0.A2", "DEV2.A1"},
+	}
+	want := []string{"DEV0.A1,DEV3.A3", "DEV0.A2,DEV2.A1", "DEV1.A3,DEV4.A2", "DEV3.A1,DEV4.A1"}
+
+	for _, algo := range []Algorithm{AlgorithmSequential, AlgorithmCoded} {
+		board := &codedBoard{nets: nets}
+		sess, err := bsr.NewSession(newCodedBoardController(t, board), newCodedBoardChain(t, board, 3, 2))
+		if err != nil {
+			t.Fatalf("NewSession failed: %v", err)
+		}
+
+		cfg := DefaultConfig()
+		cfg.Algorithm = algo
+		nl, err := DiscoverSession(context.Background(), sess, cfg, nil)
+		if err != nil {
+			t.Fatalf("%s: DiscoverSession failed: %v", algo, err)
+		}
+		if got := multiPinNets(nl); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s nets = %v, want %v", algo, got, want)
+		}
+
+		for _, net := range nl.Nets {
+			for _, pin := range net.Pins {
+				var dev int
+				fmt.Sscanf(pin.DeviceName, "DEV%d", &dev)
+				if wantChain := dev / 3; pin.Chain != wantChain || pin.ChainIndex != dev-3*wantChain {
+					t.Errorf("%s: pin %+v not qualified by its chain", algo, pin)
+				}
+			}
+		}
+	}
+
+	// Parts on the second chain get their own references, and keep their
+	// chain through a KiCad round trip
+	board := &codedBoard{nets: nets}
+	sess, err := bsr.NewSession(newCodedBoardController(t, board), newCodedBoardChain(t, board, 3, 2))
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	if err := sess.Controllers[1].Devices[0].ChainDev.SetPackage("PKG_TEST"); err != nil {
+		t.Fatalf("SetPackage failed: %v", err)
+	}
+	cfg := DefaultConfig()
+	cfg.Footprints = map[string]string{"pkg_test": "Package_QFP:LQFP-64_10x10mm_P0.5mm"}
+	nl, err := DiscoverSession(context.Background(), sess, cfg, nil)
+	if err != nil {
+		t.Fatalf("DiscoverSession failed: %v", err)
+	}
+	kicad, err := nl.ExportKiCad()
+	if err != nil {
+		t.Fatalf("ExportKiCad failed: %v", err)
+	}
+	for _, s := range []string{`(ref "U3")`, `(ref "U101")`, `(ref "U102")`, `(node (ref "U101") (pin "A3")`, `(name "jtag_chain") (value "1")`, `(name "jtag_package") (value "PKG_TEST")`} {
+		if !strings.Contains(kicad, s) {
+			t.Errorf("KiCad export lacks %s:\n%s", s, kicad)
+		}
+	}
+	// Only the part with a package gets a footprint, mapped from it
+	if n := strings.Count(kicad, "(footprint"); n != 1 || !strings.Contains(kicad, `(footprint "Package_QFP:LQFP-64_10x10mm_P0.5mm")`) {
+		t.Errorf("KiCad export has %d footprints, want the one mapped from PKG_TEST:\n%s", n, kicad)
+	}
+	got, err := ImportKiCad([]byte(kicad))
+	if err != nil {
+		t.Fatalf("ImportKiCad failed: %v", err)
+	}
+	if fmt.Sprint(multiPinNets(got)) != fmt.Sprint(want) {
+		t.Errorf("imported nets = %v, want %v", multiPinNets(got), want)
+	}
+	for _, net := range got.Nets {
+		for _, pin := range net.Pins {
+			if pin.DeviceName == "DEV4" && pin.Chain != 1 {
+				t.Errorf("imported pin %+v lost its chain", pin)
+			}
+		}
+	}
+	if parts := nl.SessionParts(sess); len(parts) != 5 || parts[4].Ref != "U102" {
+		t.Errorf("SessionParts = %+v", parts)
+	}
+}
+
+func TestDiscoverNetlistVotes(t *testing.T) {
+	nets := [][]string{
+		{"DEV0.A1", "DEV1.A3"},
+		{"DEV0.A2", "DEV2.A3"}, // DEV2.A3 drops out now and then
+	}
+	discover := func(minVotes int) *Netlist {
+		board := &codedBoard{nets: nets, flaky: map[string]bool{"DEV2.A3": true}}
+		ctl := newCodedBoardController(t, board)
+		cfg := DefaultConfig()
+		cfg.SkipKnownJTAGPins = false
+		cfg.SkipPowerPins = false
+		cfg.RepeatsPerPin = 5
+		cfg.RequireSymmetricToggle = true
+		cfg.MinToggleStrength = minVotes
+		nl, err := DiscoverNetlist(context.Background(), ctl, cfg, nil)
+		if err != nil {
+			t.Fatalf("DiscoverNetlist failed: %v", err)
+		}
+		return nl
+	}
+
+	nl := discover(1)
+	if got := fmt.Sprint(multiPinNets(nl)); got != "[DEV0.A1,DEV1.A3 DEV0.A2,DEV2.A3]" {
+		t.Fatalf("nets = %s", got)
+	}
+	for _, net := range nl.Nets {
+		if len(net.Edges) == 0 {
+			t.Fatalf("net %d has no edges", net.ID)
+		}
+		flaky := false
+		for _, e := range net.Edges {
+			if e.Trials != 5 || e.Confidence != float64(e.Votes)/5 {
+				t.Errorf("edge %s.%s→%s.%s: %d/%d votes, confidence %v",
+					e.Driver.DeviceName, e.Driver.PinName, e.Receiver.DeviceName, e.Receiver.PinName,
+					e.Votes, e.Trials, e.Confidence)
+			}
+			flaky = flaky || e.Receiver.DeviceName == "DEV2"
+		}
+		if flaky && !(net.Confidence > 0 && net.Confidence < 1) {
+			t.Errorf("flaky net confidence = %v, want between 0 and 1", net.Confidence)
+		}
+		if !flaky && net.Confidence != 1 {
+			t.Errorf("solid net confidence = %v, want 1", net.Confidence)
+		}
+	}
+
+	if got := fmt.Sprint(multiPinNets(discover(5))); got != "[DEV0.A1,DEV1.A3]" {
+		t.Errorf("with 5 required votes nets = %s", got)
+	}
+}
+
+// TestDiscoverNetlistDriveError checks that a drive scan failing mid-run
+// stops discovery instead of skipping the driver.
+func TestDiscoverNetlistDriveError(t *testing.T) {
+	board := &codedBoard{nets: [][]string{{"DEV0.A1", "DEV1.A3"}}}
+	ctl := newCodedBoardController(t, board)
+	failed := false
+	board.fail = func(tdi []bool) error {
+		// DEV0 is last in the chain: A1 output cell 15, control cell 16
+		if !failed && tdi[15] && !tdi[16] {
+			failed = true
+			return fmt.Errorf("USB transfer lost")
+		}
+		return nil
+	}
+
+	cfg := DefaultConfig()
+	cfg.SkipKnownJTAGPins = false
+	cfg.SkipPowerPins = false
+	_, err := DiscoverNetlist(context.Background(), ctl, cfg, nil)
+	if !failed {
+		t.Fatal("DEV0.A1 was never driven high")
+	}
+	if err == nil || !strings.Contains(err.Error(), "USB transfer lost") {
+		t.Errorf("DiscoverNetlist error = %v, want the lost transfer", err)
+	}
+}
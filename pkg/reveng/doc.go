@@ -57,6 +57,8 @@
 // - Tri-state outputs (via EXTEST control cells)
 // - Bidirectional pins (both input and output cells)
 // - Multiple drivers on the same net (detected as togglers)
+// - Differential pairs, scanned once via the positive leg and annotated on
+//   the net (JSON "diff_pairs", KiCad _P/_N net pairs)
 //
 // # Performance
 //
@@ -67,6 +69,14 @@
 //
 // Memory complexity: O(n) for union-find and netlist storage
 //
+// For large boards set Config.Algorithm to AlgorithmCoded. Every drivable
+// pin then gets a unique binary code and all pins drive at once, one scan
+// per code bit plus one per complemented bit, about 2·log2(n) scans in
+// total. Receivers decode which pin drives their net. Where two drivable
+// pins share a net they fight, fail to read back their own code, and are
+// re-tested with the sequential drive. A 1000-pin board needs 20 coded
+// scans plus the re-tests instead of about 3000.
+//
 // # Limitations
 //
 //   - Requires all devices to support EXTEST instruction
@@ -75,6 +85,27 @@
 //   - Pull-up/down resistors can cause false positives (use filters)
 //   - Assumes no active circuitry interfering with boundary scan
 //
+// # Pin Classification
+//
+// With Config.DetectPullResistors set, DiscoverNetlist first classifies
+// every pin that has an input cell (Netlist.Pins, Netlist.PinAttr). It
+// reads the idle levels with everything HiZ, then drives all drivable pins
+// low and high, capturing each time while driven and right after release:
+//   - stuck_low / stuck_high: a driven pin that would not move, usually tied
+//     to GND or VCC
+//   - pull_up / pull_down: moved while driven, returned to one level when
+//     released
+//   - floating: kept whichever level it was last driven to
+//   - weak_driver: on a net whose connections showed up in only some of the
+//     RepeatsPerPin repeats
+//   - unknown: nothing could drive it, so the idle level is all we know
+//
+// Receivers without an output cell are classified through a drivable pin on
+// their net. The JSON export lists the classes under "pins"; the KiCad export
+// maps them to node pintypes (floating pins tri_state, weak drivers
+// bidirectional, the rest passive) and gives classified pins outside every
+// net a single-node net, named unconnected-(...) when floating.
+//
 // # Configuration Options
 //
 // Key configuration options:
@@ -83,12 +114,116 @@
 //   - OnlyDevices: Limit scanning to specific devices
 //   - OnlyPinPattern: Regex filter for pin names
 //   - RepeatsPerPin: Number of toggle cycles (default: 1)
+//   - RequireSymmetricToggle: Also check each repeat with a 1→0→1 cycle
+//   - MinToggleStrength: Repeats a connection must show up in to be kept
+//
+// Every connection carries a vote count: the repeats in which the receiver
+// followed the driver. Net.Edges lists them with Confidence = votes/repeats,
+// and Net.Confidence is the weakest edge of the net. Raising RepeatsPerPin
+// with a MinToggleStrength below it lets a noisy board keep connections that
+// drop out occasionally while still flagging them.
+//
+// Pins protected by the controller's bsr.Guard (do-not-drive, forced, or
+// sharing a known net with a forced pin) are never used as drivers. A
+// sequential drive the guard still refuses skips that driver; any other
+// drive or capture error aborts the run.
+//
+// # Seeded Runs
+//
+// Config.Seed takes nets that are already known, e.g. from an earlier run.
+// Each seeded net is driven through one drivable member only; the others
+// are read as receivers. Pins without an output cell are never driven in
+// any run. Where the measurement disagrees with the seed, DiscoverNetlist
+// keeps the measurement and lists the disagreement in
+// Netlist.Contradictions: a readable member that did not follow (missing)
+// or two seeded nets found connected (merged). Members that cannot be read
+// back are trusted and connected as seeded.
+//
+// # Checkpoints
+//
+// Long runs can be interrupted. With Config.CheckpointFile set, the drivers
+// already scanned and the netlist's union-find state are saved every
+// Config.CheckpointEvery drivers, together with the configuration and the
+// ChainFingerprint. LoadCheckpoint reads the file back; setting
+// Config.Resume continues the run once the chain and settings match. A
+// cancelled or failed DiscoverNetlist still returns the partial netlist
+// alongside its error.
+//
+// # Multiple Chains
+//
+// Boards with several JTAG headers are scanned as one with DiscoverSession
+// and a bsr.Session holding a Controller per chain. Each driver is toggled
+// on its own chain and every chain is captured after it, so nets between
+// chains come out like any other. Pins carry their chain in PinRef.Chain,
+// and KiCad exports name the devices of chain n from U<n*100+1> on.
+//
+//	sess, err := bsr.NewSession(ctlA, ctlB)
+//	...
+//	netlist, err := reveng.DiscoverSession(ctx, sess, cfg, progress)
+//
+// # Net Names
+//
+// Finalize names each net from the BSDL port names of its pins (NameNets).
+// GPIO-style ports such as PA5 or IO_B7 give way to a descriptive port on
+// the same net, and bus roles are named after their bus, so an MCU's PA5
+// wired to a flash's SCK becomes SPI_SCK, SDA becomes I2C_SDA, TXD
+// UART_TX, and A12 or D(3) ADDR12 or DATA3. RenameNet sets a name by hand;
+// renamed nets keep it through later naming, Finalize and JSON round trips.
+// NetName falls back to the KiCad style Net-(U1-PA5) for nets without a
+// descriptive port, and is the name every export uses.
+//
+// # Editing
+//
+// An Editor applies hand corrections to a finished netlist: Merge and
+// Split nets, AddNet and DeleteNet, AddPin and RemovePin, Rename and
+// Annotate. Each edit recomputes edges, confidence and names, is recorded
+// in Netlist.Changes and can be taken back with Undo and Redo. The change
+// log and net notes are saved in JSON exports; the GUI net editor and the
+// otj jtag netlist commands both edit through an Editor.
+//
+//	ed := reveng.NewEditor(nl)
+//	net, err := ed.Merge(3, 8)
+//	...
+//	ed.Undo()
 //
 // # Export Formats
 //
 // Supported export formats:
 //   - JSON: Machine-readable format with full metadata
-//   - KiCad: Standard netlist format for PCB design tools
+//   - KiCad: Version E netlist, as written by Eeschema and read by Pcbnew
+//   - KiCad schematic: a .kicad_sch skeleton built by ExportSchematic
+//
+// DiscoverNetlist records a Component per chain device, with its BSDL
+// package, and the BSDL port name of every candidate pin. The package is
+// exported as the jtag_package property rather than as the footprint, which
+// must name a KiCad library footprint; Config.Footprints maps packages to
+// footprints, e.g. "LQFP64" to "Package_QFP:LQFP-64_10x10mm_P0.5mm".
+// Callers that know the board override parts with SetComponent, e.g. with
+// their reference designators. The KiCad export names each component by its reference (U1, U2,
+// ... in chain order by default), lists package pin numbers with the port
+// name as pinfunction, and names nets after their first pin:
+//
+//	(net (code "1") (name "Net-(U1-PA5)")
+//	  (node (ref "U1") (pin "23") (pinfunction "PA5") (pintype "passive"))
+//	  (node (ref "U2") (pin "B7") (pinfunction "IO_B7") (pintype "passive")))
+//
+// ImportJSON and ImportKiCad read the files back, so saved netlists can be
+// edited, used as Config.Seed or merged with other tools. KiCad components
+// map back to chain devices through their jtag_chain_index and jtag_device
+// properties; a differential _N net comes back as a plain net.
+//
+// ExportSchematic draws one symbol per SchematicPart, built from the BSDL
+// port clause by PartFromBSDL (or ChainParts for a live chain): inputs and
+// bidirectional pins on the left, outputs and linkage/power pins on the
+// right. Nets are drawn as global labels carrying the KiCad net name, so
+// the sheet annotates to the same connectivity as the netlist export.
+// Write the result with package kicad/schematic:
+//
+//	sch, err := nl.ExportSchematic(nl.ChainParts(ctl))
+//	if err != nil {
+//		return err
+//	}
+//	err = schematic.WriteFile("board.kicad_sch", sch)
 //
 // # See Also
 //
@@ -0,0 +1,436 @@
+package reveng
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
+)
+
+// Change is one entry of a netlist's change log.
+type Change struct {
+	Time   time.Time `json:"time"`
+	Op     string    `json:"op"`
+	Nets   []int     `json:"nets,omitempty"` // IDs of the nets involved, at the time of the edit
+	Detail string    `json:"detail"`
+}
+
+// Change log operations
+const (
+	ChangeMerge     = "merge"
+	ChangeSplit     = "split"
+	ChangeAddNet    = "add_net"
+	ChangeDeleteNet = "delete_net"
+	ChangeAddPin    = "add_pin"
+	ChangeRemovePin = "remove_pin"
+	ChangeRename    = "rename"
+	ChangeAnnotate  = "annotate"
+)
+
+// maxUndo bounds the undo history of an Editor
+const maxUndo = 100
+
+// Editor edits a finalized netlist in place, with undo and redo. Every edit
+// is appended to Netlist.Changes, which ExportJSON saves.
+//
+// Edits work on Nets directly and keep net IDs stable; new nets get the
+// next free ID. Pin classes, port names and parts are left alone. Edges
+// and differential pair legs follow the pins they belong to, and derived
+// names are refreshed after every edit.
+type Editor struct {
+	nl   *Netlist
+	undo []*Netlist
+	redo []*Netlist
+}
+
+// NewEditor returns an editor for nl.
+func NewEditor(nl *Netlist) *Editor {
+	return &Editor{nl: nl}
+}
+
+// Netlist returns the netlist being edited.
+func (e *Editor) Netlist() *Netlist {
+	return e.nl
+}
+
+// CanUndo reports whether there is an edit to undo.
+func (e *Editor) CanUndo() bool {
+	return len(e.undo) > 0
+}
+
+// CanRedo reports whether there is an undone edit to redo.
+func (e *Editor) CanRedo() bool {
+	return len(e.redo) > 0
+}
+
+// Undo reverts the last edit, including its change log entry.
+func (e *Editor) Undo() error {
+	if len(e.undo) == 0 {
+		return fmt.Errorf("reveng: nothing to undo")
+	}
+	e.redo = append(e.redo, e.nl.Clone())
+	*e.nl = *e.undo[len(e.undo)-1]
+	e.undo = e.undo[:len(e.undo)-1]
+	return nil
+}
+
+// Redo applies the last undone edit again.
+func (e *Editor) Redo() error {
+	if len(e.redo) == 0 {
+		return fmt.Errorf("reveng: nothing to redo")
+	}
+	e.undo = append(e.undo, e.nl.Clone())
+	*e.nl = *e.redo[len(e.redo)-1]
+	e.redo = e.redo[:len(e.redo)-1]
+	return nil
+}
+
+// Merge joins the given nets into the one with the lowest ID. The merged
+// net keeps the first user-given name and all notes.
+func (e *Editor) Merge(ids ...int) (*Net, error) {
+	var merged *Net
+	err := e.apply(ChangeMerge, func() ([]int, string, error) {
+		ids = uniqueInts(ids)
+		if len(ids) < 2 {
+			return nil, "", fmt.Errorf("reveng: merge needs at least two nets")
+		}
+		nets := make([]*Net, len(ids))
+		for i, id := range ids {
+			net := e.nl.net(id)
+			if net == nil {
+				return nil, "", fmt.Errorf("reveng: no net %d", id)
+			}
+			nets[i] = net
+		}
+
+		merged = nets[0]
+		var notes []string
+		if merged.Note != "" {
+			notes = append(notes, merged.Note)
+		}
+		for _, net := range nets[1:] {
+			merged.Pins = append(merged.Pins, net.Pins...)
+			if !merged.Renamed && net.Renamed {
+				merged.Name, merged.Renamed = net.Name, true
+			}
+			if net.Note != "" {
+				notes = append(notes, net.Note)
+			}
+			e.nl.removeNet(net.ID)
+		}
+		merged.Note = strings.Join(notes, "; ")
+		return ids, fmt.Sprintf("merged nets %s into net %d", joinInts(ids), merged.ID), nil
+	})
+	return merged, err
+}
+
+// Split moves the given pins of a net into a new net, which it returns.
+// At least one pin must stay behind.
+func (e *Editor) Split(id int, pins ...bsr.PinRef) (*Net, error) {
+	var split *Net
+	err := e.apply(ChangeSplit, func() ([]int, string, error) {
+		net := e.nl.net(id)
+		if net == nil {
+			return nil, "", fmt.Errorf("reveng: no net %d", id)
+		}
+		move := make(map[string]bool)
+		for _, pin := range pins {
+			if !net.holds(pin) {
+				return nil, "", fmt.Errorf("reveng: net %d does not hold %s", id, pinString(pin))
+			}
+			move[pinKey(pin)] = true
+		}
+		if len(move) == 0 {
+			return nil, "", fmt.Errorf("reveng: no pins to split off net %d", id)
+		}
+		if len(move) == len(net.Pins) {
+			return nil, "", fmt.Errorf("reveng: splitting every pin off net %d leaves it empty", id)
+		}
+
+		split = &Net{ID: e.nl.nextNetID()}
+		kept := net.Pins[:0:0]
+		for _, pin := range net.Pins {
+			if move[pinKey(pin)] {
+				split.Pins = append(split.Pins, pin)
+			} else {
+				kept = append(kept, pin)
+			}
+		}
+		net.Pins = kept
+		e.nl.Nets = append(e.nl.Nets, split)
+		return []int{id, split.ID}, fmt.Sprintf("split %s off net %d into net %d", pinList(split.Pins), id, split.ID), nil
+	})
+	return split, err
+}
+
+// AddNet creates a net holding the given pins, taking them off the nets
+// they were on. The net may start empty.
+func (e *Editor) AddNet(pins ...bsr.PinRef) (*Net, error) {
+	var added *Net
+	err := e.apply(ChangeAddNet, func() ([]int, string, error) {
+		added = &Net{ID: e.nl.nextNetID()}
+		e.nl.Nets = append(e.nl.Nets, added)
+		for _, pin := range pins {
+			e.nl.movePin(pin, added)
+		}
+		if len(pins) == 0 {
+			return []int{added.ID}, fmt.Sprintf("added empty net %d", added.ID), nil
+		}
+		return []int{added.ID}, fmt.Sprintf("added net %d with %s", added.ID, pinList(added.Pins)), nil
+	})
+	return added, err
+}
+
+// DeleteNet removes a net; its pins are left on no net.
+func (e *Editor) DeleteNet(id int) error {
+	return e.apply(ChangeDeleteNet, func() ([]int, string, error) {
+		net := e.nl.net(id)
+		if net == nil {
+			return nil, "", fmt.Errorf("reveng: no net %d", id)
+		}
+		e.nl.removeNet(id)
+		return []int{id}, fmt.Sprintf("deleted net %d (%s)", id, e.nl.NetName(net)), nil
+	})
+}
+
+// AddPin adds a pin to a net, taking it off the net it was on.
+func (e *Editor) AddPin(id int, pin bsr.PinRef) error {
+	return e.apply(ChangeAddPin, func() ([]int, string, error) {
+		net := e.nl.net(id)
+		if net == nil {
+			return nil, "", fmt.Errorf("reveng: no net %d", id)
+		}
+		if net.holds(pin) {
+			return nil, "", fmt.Errorf("reveng: net %d already holds %s", id, pinString(pin))
+		}
+		e.nl.movePin(pin, net)
+		return []int{id}, fmt.Sprintf("added %s to net %d", pinString(pin), id), nil
+	})
+}
+
+// RemovePin takes a pin off a net.
+func (e *Editor) RemovePin(id int, pin bsr.PinRef) error {
+	return e.apply(ChangeRemovePin, func() ([]int, string, error) {
+		net := e.nl.net(id)
+		if net == nil {
+			return nil, "", fmt.Errorf("reveng: no net %d", id)
+		}
+		if !net.holds(pin) {
+			return nil, "", fmt.Errorf("reveng: net %d does not hold %s", id, pinString(pin))
+		}
+		net.Pins = removePin(net.Pins, pin)
+		return []int{id}, fmt.Sprintf("removed %s from net %d", pinString(pin), id), nil
+	})
+}
+
+// Rename names a net by hand, see RenameNet.
+func (e *Editor) Rename(id int, name string) error {
+	return e.apply(ChangeRename, func() ([]int, string, error) {
+		if err := e.nl.RenameNet(id, name); err != nil {
+			return nil, "", err
+		}
+		if name = strings.TrimSpace(name); name == "" {
+			return []int{id}, fmt.Sprintf("cleared the name of net %d", id), nil
+		}
+		return []int{id}, fmt.Sprintf("renamed net %d to %s", id, name), nil
+	})
+}
+
+// Annotate sets the free-form note of a net; an empty note clears it.
+func (e *Editor) Annotate(id int, note string) error {
+	return e.apply(ChangeAnnotate, func() ([]int, string, error) {
+		net := e.nl.net(id)
+		if net == nil {
+			return nil, "", fmt.Errorf("reveng: no net %d", id)
+		}
+		net.Note = strings.TrimSpace(note)
+		if net.Note == "" {
+			return []int{id}, fmt.Sprintf("cleared the note of net %d", id), nil
+		}
+		return []int{id}, fmt.Sprintf("noted net %d: %s", id, net.Note), nil
+	})
+}
+
+// apply runs one edit. On error the netlist is left as it was; on success
+// it is relinked, the change is logged and the edit can be undone.
+func (e *Editor) apply(op string, edit func() (nets []int, detail string, err error)) error {
+	if e.nl.Nets == nil {
+		return fmt.Errorf("reveng: netlist not finalized")
+	}
+	before := e.nl.Clone()
+	nets, detail, err := edit()
+	if err != nil {
+		*e.nl = *before
+		return err
+	}
+	e.nl.relink()
+	e.nl.Changes = append(e.nl.Changes, Change{
+		Time:   time.Now(),
+		Op:     op,
+		Nets:   nets,
+		Detail: detail,
+	})
+
+	e.undo = append(e.undo, before)
+	if len(e.undo) > maxUndo {
+		e.undo = e.undo[len(e.undo)-maxUndo:]
+	}
+	e.redo = nil
+	return nil
+}
+
+// relink brings everything derived from Nets up to date after an edit:
+// the union-find sets, so a later Finalize gives the same nets, and each
+// net's pair legs, edges, confidence and derived name.
+func (nl *Netlist) relink() {
+	for key := range nl.parent {
+		nl.parent[key] = key
+		nl.rank[key] = 0
+	}
+
+	netOf := make(map[string]*Net)
+	for _, net := range nl.Nets {
+		sort.Slice(net.Pins, func(i, j int) bool {
+			return pinLess(net.Pins[i], net.Pins[j])
+		})
+		net.DiffPairs, net.Edges, net.Confidence = nil, nil, 0
+		for i, pin := range net.Pins {
+			netOf[pinKey(pin)] = net
+			if i > 0 {
+				nl.Connect(net.Pins[0], pin)
+			}
+			if leg, ok := nl.pairs[pinKey(pin)]; ok {
+				net.DiffPairs = append(net.DiffPairs, leg)
+			}
+		}
+	}
+
+	// Observations across nets stay in the raw edge list but no longer
+	// count towards either net
+	for _, edge := range nl.edges {
+		net := netOf[pinKey(edge.Driver)]
+		if net == nil || net != netOf[pinKey(edge.Receiver)] {
+			continue
+		}
+		if len(net.Edges) == 0 || edge.Confidence < net.Confidence {
+			net.Confidence = edge.Confidence
+		}
+		net.Edges = append(net.Edges, edge)
+	}
+	for _, net := range nl.Nets {
+		sort.Slice(net.Edges, func(i, j int) bool {
+			if a, b := pinKey(net.Edges[i].Driver), pinKey(net.Edges[j].Driver); a != b {
+				return a < b
+			}
+			return pinKey(net.Edges[i].Receiver) < pinKey(net.Edges[j].Receiver)
+		})
+	}
+
+	nl.NameNets()
+}
+
+// net returns the net with the given ID, or nil.
+func (nl *Netlist) net(id int) *Net {
+	for _, net := range nl.Nets {
+		if net.ID == id {
+			return net
+		}
+	}
+	return nil
+}
+
+// nextNetID returns an ID no net uses yet.
+func (nl *Netlist) nextNetID() int {
+	next := 0
+	for _, net := range nl.Nets {
+		if net.ID >= next {
+			next = net.ID + 1
+		}
+	}
+	return next
+}
+
+func (nl *Netlist) removeNet(id int) {
+	kept := nl.Nets[:0]
+	for _, net := range nl.Nets {
+		if net.ID != id {
+			kept = append(kept, net)
+		}
+	}
+	nl.Nets = kept
+}
+
+// movePin puts a pin on net, taking it off any other net first. Pins the
+// netlist has not seen are registered.
+func (nl *Netlist) movePin(pin bsr.PinRef, net *Net) {
+	key := pinKey(pin)
+	if _, ok := nl.pinKeys[key]; !ok {
+		nl.allPins = append(nl.allPins, pin)
+		nl.pinKeys[key] = pin
+		nl.parent[key] = key
+		nl.rank[key] = 0
+	}
+	for _, other := range nl.Nets {
+		if other != net && other.holds(pin) {
+			other.Pins = removePin(other.Pins, pin)
+		}
+	}
+	if !net.holds(pin) {
+		net.Pins = append(net.Pins, pin)
+	}
+}
+
+// holds reports whether pin is on the net.
+func (net *Net) holds(pin bsr.PinRef) bool {
+	for _, p := range net.Pins {
+		if pinKey(p) == pinKey(pin) {
+			return true
+		}
+	}
+	return false
+}
+
+func removePin(pins []bsr.PinRef, pin bsr.PinRef) []bsr.PinRef {
+	kept := make([]bsr.PinRef, 0, len(pins))
+	for _, p := range pins {
+		if pinKey(p) != pinKey(pin) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+func pinString(pin bsr.PinRef) string {
+	return pin.DeviceName + "." + pin.PinName
+}
+
+func pinList(pins []bsr.PinRef) string {
+	names := make([]string, len(pins))
+	for i, pin := range pins {
+		names[i] = pinString(pin)
+	}
+	return strings.Join(names, ", ")
+}
+
+func uniqueInts(ids []int) []int {
+	seen := make(map[int]bool)
+	var out []int
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	sort.Ints(out)
+	return out
+}
+
+func joinInts(ids []int) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = fmt.Sprint(id)
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,137 @@
+package reveng
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
+)
+
+// editNets lists the nets as "ID:NAME=PIN,PIN" for comparisons.
+func editNets(nl *Netlist) string {
+	var out []string
+	for _, net := range nl.Nets {
+		out = append(out, fmt.Sprintf("%d:%s=%s", net.ID, nl.NetName(net), pinList(net.Pins)))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestEditor(t *testing.T) {
+	pin := func(dev int, name string) bsr.PinRef {
+		return bsr.PinRef{ChainIndex: dev, DeviceName: fmt.Sprintf("DEV%d", dev), PinName: name}
+	}
+	a1, a2, a3 := pin(0, "A1"), pin(0, "A2"), pin(0, "A3")
+	b1, b2, b3 := pin(1, "B1"), pin(1, "B2"), pin(1, "B3")
+
+	nl := NewNetlist([]bsr.PinRef{a1, a2, a3, b1, b2, b3})
+	nl.SetPortName(b1, "SCK")
+	nl.SetPortName(b2, "SDA")
+	nl.ConnectVotes(a1, b1, 4, 4)
+	nl.ConnectVotes(a2, b2, 3, 4)
+	nl.Finalize()
+
+	ed := NewEditor(nl)
+	if ed.CanUndo() || ed.Undo() == nil {
+		t.Errorf("fresh editor has something to undo")
+	}
+
+	merged, err := ed.Merge(1, 0)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if merged.ID != 0 || len(merged.Edges) != 2 || merged.Confidence != 0.75 {
+		t.Errorf("merged net = %+v", merged)
+	}
+	if got, want := editNets(nl), "0:SPI_SCK=DEV0.A1, DEV0.A2, DEV1.B1, DEV1.B2"; got != want {
+		t.Errorf("after merge: %s, want %s", got, want)
+	}
+
+	// Splitting drops the edges between the halves
+	split, err := ed.Split(0, a2, b2)
+	if err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	if split.ID != 1 || len(split.Edges) != 1 || nl.Nets[0].Confidence != 1 {
+		t.Errorf("split net = %+v, rest %+v", split, nl.Nets[0])
+	}
+	if _, err := ed.Split(0, a1, b1); err == nil {
+		t.Errorf("Split accepted emptying a net")
+	}
+	if _, err := ed.Split(0, b3); err == nil {
+		t.Errorf("Split accepted a pin the net does not hold")
+	}
+
+	added, err := ed.AddNet(a3, a1)
+	if err != nil {
+		t.Fatalf("AddNet failed: %v", err)
+	}
+	if err := ed.AddPin(added.ID, b3); err != nil {
+		t.Fatalf("AddPin failed: %v", err)
+	}
+	if err := ed.RemovePin(added.ID, a1); err != nil {
+		t.Fatalf("RemovePin failed: %v", err)
+	}
+	if err := ed.Rename(added.ID, "RESET"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if err := ed.Annotate(added.ID, "goes to the reset button"); err != nil {
+		t.Fatalf("Annotate failed: %v", err)
+	}
+	if err := ed.DeleteNet(7); err == nil {
+		t.Errorf("DeleteNet accepted an unknown net")
+	}
+	want := "0:Net-(U2-SCK)=DEV1.B1 1:I2C_SDA=DEV0.A2, DEV1.B2 2:RESET=DEV0.A3, DEV1.B3"
+	if got := editNets(nl); got != want {
+		t.Errorf("after edits: %s, want %s", got, want)
+	}
+
+	var ops []string
+	for _, c := range nl.Changes {
+		ops = append(ops, c.Op)
+	}
+	if got := strings.Join(ops, " "); got != "merge split add_net add_pin remove_pin rename annotate" {
+		t.Errorf("change log = %s", got)
+	}
+
+	// Undo walks back through the log, redo forward again
+	for i := 0; i < 3; i++ {
+		if err := ed.Undo(); err != nil {
+			t.Fatalf("Undo failed: %v", err)
+		}
+	}
+	if got, want := editNets(nl), "0:Net-(U2-SCK)=DEV1.B1 1:I2C_SDA=DEV0.A2, DEV1.B2 2:Net-(U1-A1)=DEV0.A1, DEV0.A3, DEV1.B3"; got != want {
+		t.Errorf("after undo: %s, want %s", got, want)
+	}
+	if len(nl.Changes) != 4 || nl.Nets[2].Note != "" {
+		t.Errorf("undo kept %d changes, note %q", len(nl.Changes), nl.Nets[2].Note)
+	}
+	for ed.CanRedo() {
+		if err := ed.Redo(); err != nil {
+			t.Fatalf("Redo failed: %v", err)
+		}
+	}
+	if got := editNets(nl); got != want {
+		t.Errorf("after redo: %s, want %s", got, want)
+	}
+
+	// The edits survive a JSON round trip and re-finalizing
+	data, err := nl.ExportJSON()
+	if err != nil {
+		t.Fatalf("ExportJSON failed: %v", err)
+	}
+	got, err := ImportJSON(data)
+	if err != nil {
+		t.Fatalf("ImportJSON failed: %v", err)
+	}
+	if s := editNets(got); s != "0:I2C_SDA=DEV0.A2, DEV1.B2 1:RESET=DEV0.A3, DEV1.B3" {
+		t.Errorf("imported nets: %s", s)
+	}
+	if len(got.Changes) != 7 || got.Nets[1].Note != "goes to the reset button" {
+		t.Errorf("import kept %d changes, note %q", len(got.Changes), got.Nets[1].Note)
+	}
+	nl.Finalize()
+	if s := editNets(nl); s != "0:I2C_SDA=DEV0.A2, DEV1.B2 1:RESET=DEV0.A3, DEV1.B3" {
+		t.Errorf("re-finalized nets: %s", s)
+	}
+}
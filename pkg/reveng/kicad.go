@@ -0,0 +1,542 @@
+package reveng
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/kicad/sexp"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/kicad/sexp/kicadsexp"
+)
+
+// Component describes the board part behind one chain device. Exports use
+// it for the reference designator, value and footprint; empty fields fall
+// back to "U<index+1>", the device name and no footprint. Parts on chain
+// n > 0 of a session default to "U<n*100+index+1>" instead.
+//
+// Footprint is a KiCad Library:Footprint id that Pcbnew can resolve, set
+// from Config.Footprints by the part's package when discovered. The BSDL
+// package name is kept apart in Package, exported as the jtag_package
+// property.
+type Component struct {
+	Chain      int    `json:"chain,omitempty"` // Chain in a bsr.Session
+	ChainIndex int    `json:"chain_index"`
+	Device     string `json:"device"`              // BSDL entity name
+	Ref        string `json:"ref,omitempty"`       // e.g. "U3"
+	Value      string `json:"value,omitempty"`     // e.g. "STM32F103C8"
+	Footprint  string `json:"footprint,omitempty"` // e.g. "Package_QFP:LQFP-48_7x7mm_P0.5mm"
+	Package    string `json:"package,omitempty"`   // BSDL package, e.g. "LQFP64"
+}
+
+// PinRef returns the reference of one of the part's package pins.
+func (c Component) PinRef(pin string) bsr.PinRef {
+	return bsr.PinRef{Chain: c.Chain, ChainIndex: c.ChainIndex, DeviceName: c.Device, PinName: pin}
+}
+
+// partID locates a chain device within a session.
+type partID struct {
+	chain, index int
+}
+
+func (id partID) less(o partID) bool {
+	if id.chain != o.chain {
+		return id.chain < o.chain
+	}
+	return id.index < o.index
+}
+
+func pinPart(pin bsr.PinRef) partID {
+	return partID{pin.Chain, pin.ChainIndex}
+}
+
+// SetComponent records the part for c.Chain and c.ChainIndex, replacing any
+// earlier one.
+func (nl *Netlist) SetComponent(c Component) {
+	nl.components[partID{c.Chain, c.ChainIndex}] = c
+}
+
+// Components returns the recorded parts ordered by chain and chain index.
+func (nl *Netlist) Components() []Component {
+	out := make([]Component, 0, len(nl.components))
+	for _, c := range nl.components {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return partID{out[i].Chain, out[i].ChainIndex}.less(partID{out[j].Chain, out[j].ChainIndex})
+	})
+	return out
+}
+
+// SetPortName records the BSDL port name of a package pin, e.g. "PA5" for
+// pin "23".
+func (nl *Netlist) SetPortName(pin bsr.PinRef, name string) {
+	nl.ports[pinKey(pin)] = name
+}
+
+// PortName returns the BSDL port name recorded for pin.
+func (nl *Netlist) PortName(pin bsr.PinRef) (string, bool) {
+	name, ok := nl.ports[pinKey(pin)]
+	return name, ok
+}
+
+// describeSession records a component per device of every chain, with its
+// BSDL package and the footprint footprints maps it to, and the port names
+// of the candidates and their negative legs.
+func (nl *Netlist) describeSession(sess *bsr.Session, candidates []bsr.PinRef, footprints map[string]string) {
+	ports := make(map[partID]map[string]string)
+	for chain, ctl := range sess.Controllers {
+		for i, dev := range ctl.Devices {
+			pkg := dev.ChainDev.PackageName()
+			nl.SetComponent(Component{
+				Chain:      chain,
+				ChainIndex: i,
+				Device:     dev.ChainDev.Name(),
+				Package:    pkg,
+				Footprint:  packageFootprint(footprints, pkg),
+			})
+			byPin := make(map[string]string)
+			for port, pin := range dev.ChainDev.PinMap() {
+				byPin[pin] = port
+			}
+			ports[partID{chain, i}] = byPin
+		}
+	}
+
+	for _, ref := range candidates {
+		byPin := ports[pinPart(ref)]
+		if port, ok := byPin[ref.PinName]; ok {
+			nl.SetPortName(ref, port)
+		}
+		if leg, ok := nl.pairs[pinKey(ref)]; ok {
+			if port, ok := byPin[leg.Negative]; ok {
+				nl.SetPortName(negativeLeg(leg), port)
+			}
+		}
+	}
+}
+
+// packageFootprint looks a BSDL package up in a Config.Footprints table.
+func packageFootprint(footprints map[string]string, pkg string) string {
+	if pkg == "" {
+		return ""
+	}
+	if fp, ok := footprints[pkg]; ok {
+		return fp
+	}
+	for name, fp := range footprints {
+		if strings.EqualFold(name, pkg) {
+			return fp
+		}
+	}
+	return ""
+}
+
+// Part returns the part for a chain device as the exports name it: the
+// recorded Component with defaults filled in, so Ref is "U<index+1>", or
+// "U<chain*100+index+1>" past the first chain, unless SetComponent gave one.
+// device is used when no part was recorded for the device.
+func (nl *Netlist) Part(chain, chainIndex int, device string) Component {
+	c := nl.components[partID{chain, chainIndex}]
+	c.Chain, c.ChainIndex = chain, chainIndex
+	if c.Device == "" {
+		c.Device = device
+	}
+	if c.Ref == "" {
+		c.Ref = fmt.Sprintf("U%d", chain*100+chainIndex+1)
+	}
+	if c.Value == "" {
+		c.Value = c.Device
+	}
+	return c
+}
+
+// ExportKiCad exports the netlist as a KiCad version E netlist, the format
+// Eeschema writes and Pcbnew reads.
+//
+// Every chain device becomes a component with its reference, value and
+// footprint from SetComponent, and its BSDL package as the jtag_package
+// property; nodes carry the package pin number and, when
+// known, the BSDL port name as pin function. Nets carry their NetName: the
+// derived or user-given name, else KiCad's "Net-(REF-PIN)" style after the
+// first pin. Differential nets become a
+// _P/_N pair holding the positive and negative legs. Node pintypes are
+// KiCad electrical types derived from the pin classes (see kicadPinType),
+// and classified pins outside every net get a net of their own; floating
+// ones follow KiCad's unconnected naming.
+func (nl *Netlist) ExportKiCad() (string, error) {
+	if nl.Nets == nil {
+		return "", fmt.Errorf("reveng: netlist not finalized")
+	}
+
+	// Collect every pin the export mentions, per device
+	type devicePins struct {
+		id     partID
+		device string
+		pins   map[string]bsr.PinRef
+	}
+	devices := make(map[partID]*devicePins)
+	addPin := func(pin bsr.PinRef) {
+		d, ok := devices[pinPart(pin)]
+		if !ok {
+			d = &devicePins{id: pinPart(pin), device: pin.DeviceName, pins: make(map[string]bsr.PinRef)}
+			devices[d.id] = d
+		}
+		d.pins[pin.PinName] = pin
+	}
+	for _, net := range nl.Nets {
+		for _, pin := range net.Pins {
+			addPin(pin)
+		}
+		for _, leg := range net.DiffPairs {
+			addPin(negativeLeg(leg))
+		}
+	}
+	isolated := nl.isolatedPins()
+	for _, attr := range isolated {
+		addPin(attr.Pin)
+	}
+	for id, c := range nl.components {
+		if _, ok := devices[id]; !ok {
+			devices[id] = &devicePins{id: id, device: c.Device, pins: make(map[string]bsr.PinRef)}
+		}
+	}
+	order := make([]*devicePins, 0, len(devices))
+	for _, d := range devices {
+		order = append(order, d)
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i].id.less(order[j].id) })
+
+	var b strings.Builder
+	b.WriteString("(export (version \"E\")\n")
+	b.WriteString("  (design\n")
+	b.WriteString("    (source \"JTAG Boundary Scan Reverse Engineering\")\n")
+	fmt.Fprintf(&b, "    (date %s)\n", kicadQuote(time.Now().Format("2006-01-02 15:04:05")))
+	b.WriteString("    (tool \"OpenTraceJTAG reveng\"))\n")
+
+	b.WriteString("  (components\n")
+	for _, d := range order {
+		c := nl.Part(d.id.chain, d.id.index, d.device)
+		fmt.Fprintf(&b, "    (comp (ref %s)\n", kicadQuote(c.Ref))
+		fmt.Fprintf(&b, "      (value %s)\n", kicadQuote(c.Value))
+		if c.Footprint != "" {
+			fmt.Fprintf(&b, "      (footprint %s)\n", kicadQuote(c.Footprint))
+		}
+		fmt.Fprintf(&b, "      (libsource (lib \"jtag\") (part %s) (description \"\"))\n", kicadQuote(c.Device))
+		if c.Chain > 0 {
+			fmt.Fprintf(&b, "      (property (name \"jtag_chain\") (value \"%d\"))\n", c.Chain)
+		}
+		fmt.Fprintf(&b, "      (property (name \"jtag_chain_index\") (value \"%d\"))\n", c.ChainIndex)
+		if c.Package != "" {
+			fmt.Fprintf(&b, "      (property (name \"jtag_package\") (value %s))\n", kicadQuote(c.Package))
+		}
+		fmt.Fprintf(&b, "      (property (name \"jtag_device\") (value %s)))\n", kicadQuote(c.Device))
+	}
+	b.WriteString("  )\n")
+
+	// One library part per device type, listing the pins seen on any
+	// instance of it
+	parts := make(map[string]map[string]string)
+	var partNames []string
+	for _, d := range order {
+		c := nl.Part(d.id.chain, d.id.index, d.device)
+		if _, ok := parts[c.Device]; !ok {
+			parts[c.Device] = make(map[string]string)
+			partNames = append(partNames, c.Device)
+		}
+		for name, pin := range d.pins {
+			parts[c.Device][name] = nl.pinFunction(pin)
+		}
+	}
+	sort.Strings(partNames)
+	b.WriteString("  (libparts\n")
+	for _, part := range partNames {
+		fmt.Fprintf(&b, "    (libpart (lib \"jtag\") (part %s)\n", kicadQuote(part))
+		b.WriteString("      (pins")
+		nums := make([]string, 0, len(parts[part]))
+		for num := range parts[part] {
+			nums = append(nums, num)
+		}
+		sort.Strings(nums)
+		for _, num := range nums {
+			fmt.Fprintf(&b, "\n        (pin (num %s) (name %s) (type \"passive\"))",
+				kicadQuote(num), kicadQuote(parts[part][num]))
+		}
+		b.WriteString("))\n")
+	}
+	b.WriteString("  )\n")
+
+	b.WriteString("  (nets\n")
+	code := 1
+	writeNet := func(name string, pins []bsr.PinRef) {
+		fmt.Fprintf(&b, "    (net (code \"%d\") (name %s)\n", code, kicadQuote(name))
+		for _, pin := range pins {
+			b.WriteString(nl.kicadNode(pin))
+		}
+		b.WriteString("    )\n")
+		code++
+	}
+	for _, net := range nl.Nets {
+		if len(net.Pins) < 2 {
+			continue // Skip single-pin nets
+		}
+		name := nl.NetName(net)
+		if len(net.DiffPairs) == 0 {
+			writeNet(name, net.Pins)
+			continue
+		}
+		negatives := make([]bsr.PinRef, 0, len(net.DiffPairs))
+		for _, leg := range net.DiffPairs {
+			negatives = append(negatives, negativeLeg(leg))
+		}
+		writeNet(name+"_P", net.Pins)
+		writeNet(name+"_N", negatives)
+	}
+	for _, attr := range isolated {
+		name := "Net-(" + nl.pinLabel(attr.Pin) + ")"
+		if attr.Class == PinFloating {
+			name = "unconnected-(" + nl.pinLabel(attr.Pin) + ")"
+		}
+		writeNet(name, []bsr.PinRef{attr.Pin})
+	}
+	b.WriteString("  )\n")
+	b.WriteString(")\n")
+
+	return b.String(), nil
+}
+
+// isolatedPins returns the classified pins that are on no net, skipping
+// those whose class is unknown.
+func (nl *Netlist) isolatedPins() []PinAttr {
+	inNet := make(map[string]bool)
+	for _, net := range nl.Nets {
+		for _, pin := range net.Pins {
+			inNet[pinKey(pin)] = true
+		}
+	}
+	var out []PinAttr
+	for _, attr := range nl.Pins {
+		if !inNet[pinKey(attr.Pin)] && attr.Class != PinUnknown {
+			out = append(out, attr)
+		}
+	}
+	return out
+}
+
+// kicadNode formats a net node, with the pin type its class suggests.
+func (nl *Netlist) kicadNode(pin bsr.PinRef) string {
+	c := nl.Part(pin.Chain, pin.ChainIndex, pin.DeviceName)
+	attr, _ := nl.PinAttr(pin)
+	pintype := kicadPinType(attr.Class)
+	node := fmt.Sprintf("      (node (ref %s) (pin %s)", kicadQuote(c.Ref), kicadQuote(pin.PinName))
+	if port, ok := nl.ports[pinKey(pin)]; ok {
+		node += fmt.Sprintf(" (pinfunction %s)", kicadQuote(port))
+	}
+	return node + fmt.Sprintf(" (pintype %s))\n", kicadQuote(pintype))
+}
+
+// kicadPinType maps a pin class to a KiCad electrical pin type. Pins that
+// keep any level they are driven to are tri_state and pins with unreliable
+// connections bidirectional; pulled, tied and unclassified pins are
+// passive, since a resistor or rail holds them rather than a driver ERC
+// should check.
+func kicadPinType(class PinClass) string {
+	switch class {
+	case PinFloating:
+		return "tri_state"
+	case PinWeakDriver:
+		return "bidirectional"
+	}
+	return "passive"
+}
+
+// pinFunction returns the port name of pin, or the pin name without one.
+func (nl *Netlist) pinFunction(pin bsr.PinRef) string {
+	if port, ok := nl.ports[pinKey(pin)]; ok {
+		return port
+	}
+	return pin.PinName
+}
+
+// pinLabel names a pin "REF-FUNCTION" for net names.
+func (nl *Netlist) pinLabel(pin bsr.PinRef) string {
+	return nl.Part(pin.Chain, pin.ChainIndex, pin.DeviceName).Ref + "-" + nl.pinFunction(pin)
+}
+
+func negativeLeg(leg DiffPairLeg) bsr.PinRef {
+	neg := leg.Pin
+	neg.PinName = leg.Negative
+	return neg
+}
+
+// kicadQuote quotes s as a KiCad string.
+func kicadQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// ImportKiCad reads a KiCad netlist, as written by ExportKiCad or by
+// Eeschema. Components map to chain devices through their jtag_chain_index
+// and jtag_device properties; without them the component's position in the
+// file is its chain index and its value the device name; jtag_package gives
+// the BSDL package. Pin classes are
+// not restored, since KiCad pin types only hint at them.
+//
+// Net names other than KiCad's generated Net-(...) and unconnected-(...)
+// ones are kept as renames when NameNets would not derive them anyway.
+//
+// KiCad has no notion of differential pairs, so the _N net of a pair comes
+// back as a net of its own rather than as DiffPairs on the _P net.
+func ImportKiCad(data []byte) (*Netlist, error) {
+	exprs, err := kicadsexp.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("reveng: failed to parse KiCad netlist: %w", err)
+	}
+	if len(exprs) == 0 {
+		return nil, fmt.Errorf("reveng: empty KiCad netlist")
+	}
+	root := exprs[0]
+	if name, err := sexp.GetNodeName(root); err != nil || name != "export" {
+		return nil, fmt.Errorf("reveng: not a KiCad netlist (no export section)")
+	}
+
+	byRef := make(map[string]Component)
+	if comps, ok := sexp.FindNode(root, "components"); ok {
+		for i, comp := range sexp.FindAllNodes(comps, "comp") {
+			c, err := kicadComponent(comp, i)
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := byRef[c.Ref]; dup {
+				return nil, fmt.Errorf("reveng: component %s appears twice", c.Ref)
+			}
+			byRef[c.Ref] = c
+		}
+	}
+
+	type node struct {
+		pin      bsr.PinRef
+		function string
+	}
+	var nets [][]node
+	var names []string
+	if section, ok := sexp.FindNode(root, "nets"); ok {
+		for _, net := range sexp.FindAllNodes(section, "net") {
+			var nodes []node
+			for _, n := range sexp.FindAllNodes(net, "node") {
+				ref := kicadField(n, "ref")
+				c, ok := byRef[ref]
+				if !ok {
+					return nil, fmt.Errorf("reveng: net %q uses unknown component %q", kicadField(net, "name"), ref)
+				}
+				pin := kicadField(n, "pin")
+				if pin == "" {
+					return nil, fmt.Errorf("reveng: node of %s in net %q has no pin", ref, kicadField(net, "name"))
+				}
+				nodes = append(nodes, node{
+					pin:      c.PinRef(pin),
+					function: kicadField(n, "pinfunction"),
+				})
+			}
+			nets = append(nets, nodes)
+			names = append(names, kicadField(net, "name"))
+		}
+	}
+
+	var pins []bsr.PinRef
+	seen := make(map[string]bool)
+	for _, nodes := range nets {
+		for _, n := range nodes {
+			if !seen[pinKey(n.pin)] {
+				seen[pinKey(n.pin)] = true
+				pins = append(pins, n.pin)
+			}
+		}
+	}
+
+	nl := NewNetlist(pins)
+	for _, c := range byRef {
+		nl.SetComponent(c)
+	}
+	for _, nodes := range nets {
+		for i, n := range nodes {
+			if i > 0 {
+				nl.Connect(nodes[0].pin, n.pin)
+			}
+			if n.function != "" {
+				nl.SetPortName(n.pin, n.function)
+			}
+		}
+	}
+	nl.Finalize()
+
+	byPin := make(map[string]*Net)
+	for _, net := range nl.Nets {
+		for _, pin := range net.Pins {
+			byPin[pinKey(pin)] = net
+		}
+	}
+	for i, nodes := range nets {
+		name := names[i]
+		if len(nodes) < 2 || strings.HasPrefix(name, "Net-(") || strings.HasPrefix(name, "unconnected-(") {
+			continue
+		}
+		if net := byPin[pinKey(nodes[0].pin)]; net != nil && name != "" && net.Name != name {
+			net.Name, net.Renamed = name, true
+		}
+	}
+	nl.NameNets()
+	return nl, nil
+}
+
+// kicadComponent reads a comp entry; index is its position in the file.
+func kicadComponent(comp kicadsexp.Sexp, index int) (Component, error) {
+	c := Component{
+		ChainIndex: index,
+		Ref:        kicadField(comp, "ref"),
+		Value:      kicadField(comp, "value"),
+		Footprint:  kicadField(comp, "footprint"),
+		Device:     kicadField(comp, "value"),
+	}
+	if c.Ref == "" {
+		return c, fmt.Errorf("reveng: component %d has no reference", index)
+	}
+	for _, prop := range sexp.FindAllNodes(comp, "property") {
+		value := kicadField(prop, "value")
+		switch kicadField(prop, "name") {
+		case "jtag_chain":
+			chain, err := strconv.Atoi(value)
+			if err != nil || chain < 0 {
+				return c, fmt.Errorf("reveng: component %s has bad jtag_chain %q", c.Ref, value)
+			}
+			c.Chain = chain
+		case "jtag_chain_index":
+			idx, err := strconv.Atoi(value)
+			if err != nil || idx < 0 {
+				return c, fmt.Errorf("reveng: component %s has bad jtag_chain_index %q", c.Ref, value)
+			}
+			c.ChainIndex = idx
+		case "jtag_device":
+			c.Device = value
+		case "jtag_package":
+			c.Package = value
+		}
+	}
+	return c, nil
+}
+
+// kicadField returns the first value of the child list named key, or "".
+func kicadField(s kicadsexp.Sexp, key string) string {
+	n, ok := sexp.FindNode(s, key)
+	if !ok || n.IsLeaf() {
+		return ""
+	}
+	value, err := sexp.GetString(n, 1)
+	if err != nil {
+		return ""
+	}
+	return value
+}
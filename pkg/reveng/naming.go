@@ -0,0 +1,247 @@
+package reveng
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Net names are derived from the BSDL port names of a net's pins. Pins
+// named after their GPIO position (PA5, P1_12, IO_B7, GPIO3) say nothing
+// about the net, so a named peripheral pin on the other end wins:
+// MCU PA5 + flash SCK gives SPI_SCK. Known bus roles get the bus as
+// prefix, keeping an instance number when the port has one (SPI2_MISO,
+// I2C1_SDA, USART3_TX); address and data lines become ADDRn and DATAn.
+
+var (
+	// Ports named after their position rather than their function
+	genericPortRe = regexp.MustCompile(`^(P[A-Z]{1,2}_?\d+|P\d+[_.]\d+|PT[A-Z]\d+|PIO\d*_?\d+|GPIO_?[A-Z]?\d+|IO_?[A-Z]*\d+(_[A-Z0-9]+)?)$`)
+
+	busPrefixRe = regexp.MustCompile(`^(Q?SPI|SSP|I2C|IIC|TWI|UART|USART|LPUART|SCI)\d*$`)
+	addressRe   = regexp.MustCompile(`^(A|ADDR|ADR)(\d+)$`)
+	dataRe      = regexp.MustCompile(`^(D|DQ|DATA)(\d+)$`)
+
+	nameCharRe = regexp.MustCompile(`[^A-Za-z0-9_+-]+`)
+)
+
+// busRole is the bus and signal a port name token stands for.
+type busRole struct {
+	bus  string
+	role string
+}
+
+var busRoles = map[string]busRole{
+	"SCK": {"SPI", "SCK"}, "SCLK": {"SPI", "SCK"}, "SPCK": {"SPI", "SCK"},
+	"MOSI": {"SPI", "MOSI"}, "SIMO": {"SPI", "MOSI"}, "COPI": {"SPI", "MOSI"},
+	"SI": {"SPI", "MOSI"}, "DI": {"SPI", "MOSI"}, "SDI": {"SPI", "MOSI"},
+	"MISO": {"SPI", "MISO"}, "SOMI": {"SPI", "MISO"}, "CIPO": {"SPI", "MISO"},
+	"SO": {"SPI", "MISO"}, "DO": {"SPI", "MISO"}, "SDO": {"SPI", "MISO"},
+	"CS": {"SPI", "CS"}, "NCS": {"SPI", "CS"}, "CSN": {"SPI", "CS"},
+	"SS": {"SPI", "CS"}, "NSS": {"SPI", "CS"}, "SSN": {"SPI", "CS"},
+	"SDA": {"I2C", "SDA"}, "SCL": {"I2C", "SCL"},
+	"TX": {"UART", "TX"}, "TXD": {"UART", "TX"},
+	"RX": {"UART", "RX"}, "RXD": {"UART", "RX"},
+	"RTS": {"UART", "RTS"}, "CTS": {"UART", "CTS"},
+}
+
+// Name scores: a bus role with an explicit bus beats one without, which
+// beats any other descriptive port name.
+const (
+	nameScoreNone = iota
+	nameScorePlain
+	nameScoreBus
+	nameScorePrefixed
+)
+
+// suggestNetName derives a net name from port names in pin order. It
+// returns "" when every port is unnamed or generic.
+func suggestNetName(ports []string) string {
+	best, bestScore := "", nameScoreNone
+	for _, port := range ports {
+		name, score := portNetName(port)
+		if score > bestScore {
+			best, bestScore = name, score
+		}
+	}
+	return best
+}
+
+// portNetName derives a net name from one port name and scores it.
+func portNetName(port string) (string, int) {
+	// Vector ports come as A(5); the index is part of the name
+	port = strings.ToUpper(strings.TrimSpace(port))
+	port = strings.NewReplacer("(", "", ")", "", "[", "", "]", "").Replace(port)
+	if port == "" || genericPortRe.MatchString(port) {
+		return "", nameScoreNone
+	}
+
+	tokens := strings.FieldsFunc(port, func(r rune) bool {
+		return r == '_' || r == '-' || r == '.' || r == '/' || r == ' '
+	})
+	// Active-low markers: CS_N, CS#, NRESET_B
+	if n := len(tokens); n > 1 && (tokens[n-1] == "N" || tokens[n-1] == "B") {
+		tokens = tokens[:n-1]
+	}
+	for i, tok := range tokens {
+		tokens[i] = strings.TrimSuffix(tok, "#")
+	}
+
+	prefix := ""
+	for _, tok := range tokens {
+		if busPrefixRe.MatchString(tok) {
+			prefix = tok
+			break
+		}
+	}
+	for i := len(tokens) - 1; i >= 0; i-- {
+		tok := tokens[i]
+		if m := addressRe.FindStringSubmatch(tok); m != nil {
+			return "ADDR" + trimIndex(m[2]), nameScoreBus
+		}
+		if m := dataRe.FindStringSubmatch(tok); m != nil {
+			return "DATA" + trimIndex(m[2]), nameScoreBus
+		}
+		role, ok := busRoles[tok]
+		if !ok && tok == "CLK" && strings.Contains(prefix, "SPI") {
+			role, ok = busRole{"SPI", "SCK"}, true
+		}
+		if !ok {
+			continue
+		}
+		if prefix != "" {
+			return prefix + "_" + role.role, nameScorePrefixed
+		}
+		return role.bus + "_" + role.role, nameScoreBus
+	}
+
+	return nameCharRe.ReplaceAllString(port, "_"), nameScorePlain
+}
+
+// trimIndex drops leading zeros from a bus index: A05 is ADDR5.
+func trimIndex(s string) string {
+	if t := strings.TrimLeft(s, "0"); t != "" {
+		return t
+	}
+	return "0"
+}
+
+// NameNets names every net of two or more pins that has not been renamed,
+// from the BSDL port names of its pins (see SetPortName). When several pins
+// suggest a name, bus roles win over other descriptive names, and the first
+// pin in net order breaks ties. Nets with only GPIO-style port names are
+// left unnamed and exported under their KiCad name, see NetName. Names are
+// made unique with _2, _3, ... suffixes in net order.
+//
+// Finalize calls NameNets; call it again after changing port names or
+// editing Nets directly.
+func (nl *Netlist) NameNets() {
+	used := make(map[string]bool)
+	for _, net := range nl.Nets {
+		if net.Renamed && net.Name != "" {
+			used[net.Name] = true
+		}
+	}
+	for _, net := range nl.Nets {
+		if net.Renamed && net.Name != "" {
+			continue
+		}
+		net.Renamed = false
+		net.Name = ""
+		if len(net.Pins) < 2 {
+			continue
+		}
+		ports := make([]string, len(net.Pins))
+		for i, pin := range net.Pins {
+			ports[i] = nl.ports[pinKey(pin)]
+		}
+		name := suggestNetName(ports)
+		if len(net.DiffPairs) > 0 {
+			// Exports add _P and _N for the two legs
+			name = strings.TrimSuffix(name, "_P")
+		}
+		if name == "" {
+			continue
+		}
+		unique := name
+		for n := 2; used[unique]; n++ {
+			unique = fmt.Sprintf("%s_%d", name, n)
+		}
+		used[unique] = true
+		net.Name = unique
+	}
+}
+
+// RenameNet names the net with the given ID. Renamed nets keep their name
+// through NameNets and Finalize, and in JSON exports; an empty name hands
+// the net back to NameNets.
+func (nl *Netlist) RenameNet(id int, name string) error {
+	name = strings.TrimSpace(name)
+	for _, net := range nl.Nets {
+		if net.ID != id {
+			continue
+		}
+		if name != "" {
+			for _, other := range nl.Nets {
+				if other != net && other.Name == name && other.Renamed {
+					return fmt.Errorf("reveng: net %d is already named %s", other.ID, name)
+				}
+			}
+		}
+		net.Name = name
+		net.Renamed = name != ""
+		nl.NameNets()
+		return nil
+	}
+	return fmt.Errorf("reveng: no net %d", id)
+}
+
+// NetName returns the net's name, or when it has none its KiCad name after
+// the first pin, e.g. Net-(U1-PA5).
+func (nl *Netlist) NetName(net *Net) string {
+	if net.Name != "" {
+		return net.Name
+	}
+	if len(net.Pins) == 0 {
+		return fmt.Sprintf("Net-%d", net.ID)
+	}
+	return "Net-(" + nl.pinLabel(net.Pins[0]) + ")"
+}
+
+// keepUserEdits carries the names of renamed nets and the notes of nets in
+// old over to the current nets: each goes to the first net holding one of
+// its pins. Notes are tracked per old net, so equal notes on two nets both
+// survive.
+func (nl *Netlist) keepUserEdits(old []*Net) {
+	names := make(map[string]string)
+	notes := make(map[string]*Net)
+	for _, net := range old {
+		if net == nil {
+			continue
+		}
+		for _, pin := range net.Pins {
+			if net.Renamed && net.Name != "" {
+				names[pinKey(pin)] = net.Name
+			}
+			if net.Note != "" {
+				notes[pinKey(pin)] = net
+			}
+		}
+	}
+	if len(names) == 0 && len(notes) == 0 {
+		return
+	}
+	taken := make(map[string]bool)
+	noted := make(map[*Net]bool)
+	for _, net := range nl.Nets {
+		for _, pin := range net.Pins {
+			if name, ok := names[pinKey(pin)]; ok && !taken[name] && !net.Renamed {
+				net.Name, net.Renamed = name, true
+				taken[name] = true
+			}
+			if from, ok := notes[pinKey(pin)]; ok && !noted[from] && net.Note == "" {
+				net.Note = from.Note
+				noted[from] = true
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package reveng
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
+)
+
+func TestSuggestNetName(t *testing.T) {
+	tests := []struct {
+		ports []string
+		want  string
+	}{
+		{[]string{"PA5", "SCK"}, "SPI_SCK"},
+		{[]string{"PB3", "SPI2_MISO"}, "SPI2_MISO"},
+		{[]string{"SO", "SPI1_MISO"}, "SPI1_MISO"}, // Explicit bus wins
+		{[]string{"P0_12", "CS#"}, "SPI_CS"},
+		{[]string{"GPIO4", "NSS"}, "SPI_CS"},
+		{[]string{"I2C1_SDA", "SDA"}, "I2C1_SDA"},
+		{[]string{"SCL", "PC9"}, "I2C_SCL"},
+		{[]string{"USART3_TX", "RXD"}, "USART3_TX"},
+		{[]string{"TXD", "RXD"}, "UART_TX"}, // First pin breaks ties
+		{[]string{"IO_B7", "A(12)"}, "ADDR12"},
+		{[]string{"FMC_A05", "ADDR5"}, "ADDR5"},
+		{[]string{"DQ3", "PD14"}, "DATA3"},
+		{[]string{"D(0)", "DATA0"}, "DATA0"},
+		{[]string{"PA1", "nRESET"}, "NRESET"},
+		{[]string{"LED RED", "PB0"}, "LED_RED"},
+		{[]string{"PA1", "PB2", ""}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := suggestNetName(tt.ports); got != tt.want {
+			t.Errorf("suggestNetName(%q) = %q, want %q", tt.ports, got, tt.want)
+		}
+	}
+}
+
+func TestNameNets(t *testing.T) {
+	mcu := func(pin string) bsr.PinRef { return bsr.PinRef{ChainIndex: 0, DeviceName: "MCU", PinName: pin} }
+	flash := func(pin string) bsr.PinRef { return bsr.PinRef{ChainIndex: 1, DeviceName: "FLASH", PinName: pin} }
+	spare := func(pin string) bsr.PinRef { return bsr.PinRef{ChainIndex: 2, DeviceName: "FLASH", PinName: pin} }
+
+	pins := []bsr.PinRef{mcu("1"), mcu("2"), mcu("3"), mcu("4"), flash("6"), flash("5"), spare("6"), mcu("9")}
+	nl := NewNetlist(pins)
+	for pin, port := range map[bsr.PinRef]string{
+		mcu("1"): "PA5", mcu("2"): "PA6", mcu("3"): "PA7", mcu("4"): "PA8", mcu("9"): "PB1",
+		flash("6"): "SCK", flash("5"): "SI", spare("6"): "SCK",
+	} {
+		nl.SetPortName(pin, port)
+	}
+	nl.Connect(mcu("1"), flash("6"))
+	nl.Connect(mcu("2"), flash("5"))
+	nl.Connect(mcu("3"), spare("6"))
+	nl.Connect(mcu("4"), mcu("9"))
+	nl.Finalize()
+
+	names := func() string {
+		var out []string
+		for _, net := range nl.Nets {
+			out = append(out, nl.NetName(net))
+		}
+		return strings.Join(out, " ")
+	}
+	if got, want := names(), "SPI_SCK SPI_MOSI SPI_SCK_2 Net-(U1-PA8)"; got != want {
+		t.Fatalf("net names = %s, want %s", got, want)
+	}
+
+	// A rename sticks through naming, re-finalizing and merges
+	if err := nl.RenameNet(nl.Nets[0].ID, "FLASH_CLK"); err != nil {
+		t.Fatalf("RenameNet failed: %v", err)
+	}
+	if err := nl.RenameNet(nl.Nets[1].ID, "FLASH_CLK"); err == nil {
+		t.Errorf("RenameNet accepted a duplicate name")
+	}
+	nl.Connect(mcu("2"), mcu("1"))
+	nl.Finalize()
+	if got, want := names(), "FLASH_CLK SPI_SCK Net-(U1-PA8)"; got != want {
+		t.Errorf("net names after merge = %s, want %s", got, want)
+	}
+
+	data, err := nl.ExportJSON()
+	if err != nil {
+		t.Fatalf("ExportJSON failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"name": "Net-(U1-PA8)"`) {
+		t.Errorf("JSON export lacks the KiCad name of an unnamed net:\n%s", data)
+	}
+	got, err := ImportJSON(data)
+	if err != nil {
+		t.Fatalf("ImportJSON failed: %v", err)
+	}
+	if !got.Nets[0].Renamed || got.Nets[0].Name != "FLASH_CLK" {
+		t.Errorf("imported net 0 = %q (renamed %v), want renamed FLASH_CLK", got.Nets[0].Name, got.Nets[0].Renamed)
+	}
+	if got.Nets[2].Renamed || got.Nets[2].Name != "" {
+		t.Errorf("imported net 2 = %q (renamed %v), want unnamed", got.Nets[2].Name, got.Nets[2].Renamed)
+	}
+
+	// KiCad files keep hand-edited names but not the generated ones
+	kicad, err := nl.ExportKiCad()
+	if err != nil {
+		t.Fatalf("ExportKiCad failed: %v", err)
+	}
+	got, err = ImportKiCad([]byte(kicad))
+	if err != nil {
+		t.Fatalf("ImportKiCad failed: %v", err)
+	}
+	var renamed []string
+	for _, net := range got.Nets {
+		if net.Renamed {
+			renamed = append(renamed, net.Name)
+		}
+	}
+	if strings.Join(renamed, " ") != "FLASH_CLK" {
+		t.Errorf("KiCad import renamed %v, want [FLASH_CLK]", renamed)
+	}
+
+	// Clearing the name hands the net back to the heuristics
+	if err := nl.RenameNet(nl.Nets[0].ID, ""); err != nil {
+		t.Fatalf("RenameNet failed: %v", err)
+	}
+	if got, want := names(), "SPI_MOSI SPI_SCK Net-(U1-PA8)"; got != want {
+		t.Errorf("net names after reset = %s, want %s", got, want)
+	}
+
+	// Two nets with the same note both keep it through re-finalizing
+	nl.Nets[0].Note, nl.Nets[2].Note = "to J1", "to J1"
+	nl.Finalize()
+	var notes []string
+	for _, net := range nl.Nets {
+		notes = append(notes, net.Note)
+	}
+	if got, want := strings.Join(notes, "|"), "to J1||to J1"; got != want {
+		t.Errorf("notes after Finalize = %q, want %q", got, want)
+	}
+}
@@ -9,9 +9,41 @@ import (
 )
 
 // Net represents a connected set of pins that share the same electrical net.
+// For differential pairs, Pins holds the positive legs and DiffPairs records
+// the matching negative legs, which form the complementary net.
+//
+// Name is derived from the pins' port names by NameNets, or set with
+// RenameNet, in which case Renamed is true and the name is kept. Note is
+// free text for the user, see Editor.Annotate.
 type Net struct {
-	ID   int          `json:"id"`
-	Pins []bsr.PinRef `json:"pins"`
+	ID        int           `json:"id"`
+	Name      string        `json:"name,omitempty"`
+	Renamed   bool          `json:"renamed,omitempty"`
+	Note      string        `json:"note,omitempty"`
+	Pins      []bsr.PinRef  `json:"pins"`
+	DiffPairs []DiffPairLeg `json:"diff_pairs,omitempty"`
+
+	// Edges holds the observed driver→receiver connections that formed the
+	// net; Confidence is the lowest edge confidence among them.
+	Edges      []Edge  `json:"edges,omitempty"`
+	Confidence float64 `json:"confidence,omitempty"`
+}
+
+// Edge is one observed connection: Receiver followed Driver in Votes of
+// Trials toggle repeats.
+type Edge struct {
+	Driver     bsr.PinRef `json:"driver"`
+	Receiver   bsr.PinRef `json:"receiver"`
+	Votes      int        `json:"votes"`
+	Trials     int        `json:"trials"`
+	Confidence float64    `json:"confidence"` // Votes / Trials
+}
+
+// DiffPairLeg annotates a net pin that is the positive leg of a differential pair.
+type DiffPairLeg struct {
+	Pin      bsr.PinRef `json:"pin"`
+	Negative string     `json:"negative"` // Package pin name of the negative leg
+	Kind     string     `json:"kind"`     // DIFFERENTIAL_VOLTAGE or DIFFERENTIAL_CURRENT
 }
 
 // Netlist manages the discovered connectivity between pins using a union-find
@@ -24,9 +56,33 @@ type Netlist struct {
 	// Final nets after calling Finalize()
 	Nets []*Net
 
+	// Classified pins after calling Finalize(), sorted like net pins
+	Pins []PinAttr
+
+	// Disagreements with Config.Seed found by DiscoverNetlist
+	Contradictions []Contradiction
+
+	// Edits made through an Editor, oldest first
+	Changes []Change
+
 	// All pins in the netlist
 	allPins []bsr.PinRef
 	pinKeys map[string]bsr.PinRef // Maps pin key back to PinRef
+
+	// Differential pair annotations keyed by the positive leg's pin key
+	pairs map[string]DiffPairLeg
+
+	// Observed connections in the order they were recorded
+	edges []Edge
+
+	// Pin classifications keyed by pin key, as measured, and the pins the
+	// last Finalize found on nets with weak connections
+	attrs map[string]PinAttr
+	weak  map[string]bool
+
+	// Board parts by chain index and BSDL port names by pin key, for exports
+	components map[partID]Component
+	ports      map[string]string
 }
 
 // NewNetlist creates a new netlist from a list of pins.
@@ -37,6 +93,12 @@ func NewNetlist(pins []bsr.PinRef) *Netlist {
 		rank:    make(map[string]int),
 		allPins: make([]bsr.PinRef, len(pins)),
 		pinKeys: make(map[string]bsr.PinRef),
+		pairs:   make(map[string]DiffPairLeg),
+		attrs:   make(map[string]PinAttr),
+		weak:    make(map[string]bool),
+
+		components: make(map[partID]Component),
+		ports:      make(map[string]string),
 	}
 
 	copy(nl.allPins, pins)
@@ -76,6 +138,56 @@ func (nl *Netlist) Connect(a, b bsr.PinRef) {
 	}
 }
 
+// ConnectVotes connects driver and receiver like Connect and records the
+// observation as an Edge with its vote count, replacing an earlier one for
+// the same pair.
+func (nl *Netlist) ConnectVotes(driver, receiver bsr.PinRef, votes, trials int) {
+	nl.Connect(driver, receiver)
+	edge := Edge{Driver: driver, Receiver: receiver, Votes: votes, Trials: trials}
+	if trials > 0 {
+		edge.Confidence = float64(votes) / float64(trials)
+	}
+	for i, e := range nl.edges {
+		if e.Driver == driver && e.Receiver == receiver {
+			nl.edges[i] = edge
+			return
+		}
+	}
+	nl.edges = append(nl.edges, edge)
+}
+
+// MarkDiffPair records that pin is the positive leg of a differential pair.
+// The annotation is attached to the pin's net by Finalize.
+func (nl *Netlist) MarkDiffPair(pin bsr.PinRef, pair *bsr.DiffPair) {
+	if pair == nil {
+		return
+	}
+	nl.pairs[pinKey(pin)] = DiffPairLeg{
+		Pin:      pin,
+		Negative: pair.Negative,
+		Kind:     pair.Kind,
+	}
+}
+
+// SetPinAttr records the classification of a pin.
+func (nl *Netlist) SetPinAttr(attr PinAttr) {
+	if attr.Measured != "" {
+		attr.Class, attr.Measured = attr.Measured, ""
+	}
+	nl.attrs[pinKey(attr.Pin)] = attr
+}
+
+// PinAttr returns the classification recorded for pin, if any. Pins that
+// the last Finalize found on a net with weak connections report
+// PinWeakDriver, with the recorded class in Measured.
+func (nl *Netlist) PinAttr(pin bsr.PinRef) (PinAttr, bool) {
+	attr, ok := nl.attrs[pinKey(pin)]
+	if ok && nl.weak[pinKey(pin)] {
+		attr.Measured, attr.Class = attr.Class, PinWeakDriver
+	}
+	return attr, ok
+}
+
 // Find returns the root (representative) pin for the net containing the given pin.
 // Uses path compression for O(α(n)) amortized time complexity.
 func (nl *Netlist) Find(pin bsr.PinRef) bsr.PinRef {
@@ -101,7 +213,11 @@ func (nl *Netlist) Find(pin bsr.PinRef) bsr.PinRef {
 // Finalize builds the final net list from the union-find structure.
 // This should be called after all Connect() operations are complete.
 // Only nets with 2+ pins are included; isolated single-pin "nets" are skipped.
+// Renamed nets keep their names and notes, and the others are named by
+// NameNets.
 func (nl *Netlist) Finalize() {
+	old := nl.Nets
+
 	// Group pins by their root
 	netMap := make(map[string][]bsr.PinRef)
 	for _, pin := range nl.allPins {
@@ -109,37 +225,88 @@ func (nl *Netlist) Finalize() {
 		rootKey := pinKey(root)
 		netMap[rootKey] = append(netMap[rootKey], pin)
 	}
+	edgeMap := make(map[string][]Edge)
+	for _, edge := range nl.edges {
+		rootKey := pinKey(nl.Find(edge.Driver))
+		edgeMap[rootKey] = append(edgeMap[rootKey], edge)
+	}
 
-	// Convert to Net objects (only nets with 2+ pins)
-	nl.Nets = make([]*Net, 0, len(netMap))
-	netID := 0
-	for _, pins := range netMap {
+	// Convert to Net objects (only nets with 2+ pins), numbered in pin
+	// order so IDs stay the same for the same connectivity
+	roots := make([]string, 0, len(netMap))
+	for rootKey, pins := range netMap {
 		// Skip single-pin "nets" - they're not actually nets
 		if len(pins) < 2 {
 			continue
 		}
-		
+
 		// Sort pins for consistent ordering
 		sort.Slice(pins, func(i, j int) bool {
-			if pins[i].ChainIndex != pins[j].ChainIndex {
-				return pins[i].ChainIndex < pins[j].ChainIndex
+			return pinLess(pins[i], pins[j])
+		})
+		roots = append(roots, rootKey)
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return pinLess(netMap[roots[i]][0], netMap[roots[j]][0])
+	})
+
+	nl.weak = make(map[string]bool)
+	nl.Nets = make([]*Net, 0, len(roots))
+	for netID, rootKey := range roots {
+		pins := netMap[rootKey]
+
+		var legs []DiffPairLeg
+		for _, pin := range pins {
+			if leg, ok := nl.pairs[pinKey(pin)]; ok {
+				legs = append(legs, leg)
 			}
-			if pins[i].DeviceName != pins[j].DeviceName {
-				return pins[i].DeviceName < pins[j].DeviceName
+		}
+
+		edges := edgeMap[rootKey]
+		sort.Slice(edges, func(i, j int) bool {
+			if a, b := pinKey(edges[i].Driver), pinKey(edges[j].Driver); a != b {
+				return a < b
 			}
-			return pins[i].PinName < pins[j].PinName
+			return pinKey(edges[i].Receiver) < pinKey(edges[j].Receiver)
 		})
+		confidence := 0.0
+		for i, edge := range edges {
+			if i == 0 || edge.Confidence < confidence {
+				confidence = edge.Confidence
+			}
+		}
+
+		// A driver that moves the net only some of the time is weak or
+		// fighting a pull; a stuck reading says more than that, so keep it.
+		if confidence > 0 && confidence < 1 {
+			for _, pin := range pins {
+				attr, ok := nl.attrs[pinKey(pin)]
+				if !ok || attr.Class == PinStuckLow || attr.Class == PinStuckHigh {
+					continue
+				}
+				nl.weak[pinKey(pin)] = true
+			}
+		}
 
 		nl.Nets = append(nl.Nets, &Net{
-			ID:   netID,
-			Pins: pins,
+			ID:         netID,
+			Pins:       pins,
+			DiffPairs:  legs,
+			Edges:      edges,
+			Confidence: confidence,
 		})
-		netID++
 	}
 
-	// Sort nets by ID for consistent output
-	sort.Slice(nl.Nets, func(i, j int) bool {
-		return nl.Nets[i].ID < nl.Nets[j].ID
+	nl.keepUserEdits(old)
+	nl.NameNets()
+
+	nl.Pins = make([]PinAttr, 0, len(nl.attrs))
+	for _, attr := range nl.attrs {
+		attr, _ = nl.PinAttr(attr.Pin)
+		nl.Pins = append(nl.Pins, attr)
+	}
+	sort.Slice(nl.Pins, func(i, j int) bool {
+		return pinLess(nl.Pins[i].Pin, nl.Pins[j].Pin)
 	})
 }
 
@@ -168,7 +335,13 @@ func (nl *Netlist) Clone() *Netlist {
 		rank:    make(map[string]int),
 		allPins: make([]bsr.PinRef, len(nl.allPins)),
 		pinKeys: make(map[string]bsr.PinRef),
+		pairs:   make(map[string]DiffPairLeg),
+		attrs:   make(map[string]PinAttr),
+		weak:    make(map[string]bool),
 		Nets:    make([]*Net, len(nl.Nets)),
+
+		components: make(map[partID]Component),
+		ports:      make(map[string]string),
 	}
 	
 	// Copy maps
@@ -181,94 +354,184 @@ func (nl *Netlist) Clone() *Netlist {
 	for k, v := range nl.pinKeys {
 		clone.pinKeys[k] = v
 	}
+	for k, v := range nl.pairs {
+		clone.pairs[k] = v
+	}
+	for k, v := range nl.attrs {
+		clone.attrs[k] = v
+	}
+	for k, v := range nl.weak {
+		clone.weak[k] = v
+	}
+	for k, v := range nl.components {
+		clone.components[k] = v
+	}
+	for k, v := range nl.ports {
+		clone.ports[k] = v
+	}
+	if nl.Pins != nil {
+		clone.Pins = append([]PinAttr(nil), nl.Pins...)
+	}
+	if nl.Contradictions != nil {
+		clone.Contradictions = append([]Contradiction(nil), nl.Contradictions...)
+	}
+	if nl.Changes != nil {
+		clone.Changes = append([]Change(nil), nl.Changes...)
+	}
 	
-	// Copy allPins
+	// Copy allPins and edges
 	copy(clone.allPins, nl.allPins)
+	clone.edges = append([]Edge(nil), nl.edges...)
 	
 	// Deep copy nets
 	for i, net := range nl.Nets {
-		clonedNet := &Net{
-			ID:   net.ID,
-			Pins: make([]bsr.PinRef, len(net.Pins)),
+		clonedNet := *net
+		clonedNet.Pins = append([]bsr.PinRef{}, net.Pins...)
+		if net.DiffPairs != nil {
+			clonedNet.DiffPairs = append([]DiffPairLeg(nil), net.DiffPairs...)
+		}
+		if net.Edges != nil {
+			clonedNet.Edges = append([]Edge(nil), net.Edges...)
 		}
-		copy(clonedNet.Pins, net.Pins)
-		clone.Nets[i] = clonedNet
+		clone.Nets[i] = &clonedNet
 	}
 	
 	return clone
 }
 
+// netlistFile is the layout written by ExportJSON and read by ImportJSON.
+type netlistFile struct {
+	Version        string          `json:"version"`
+	NetCount       int             `json:"net_count"`
+	MultiNets      int             `json:"multi_pin_nets"`
+	Nets           []*Net          `json:"nets"`
+	Pins           []PinAttr       `json:"pins,omitempty"`
+	Contradictions []Contradiction `json:"contradictions,omitempty"`
+	Changes        []Change        `json:"changes,omitempty"`
+	Components     []Component     `json:"components,omitempty"`
+	PinNames       []PinName       `json:"pin_names,omitempty"`
+	GeneratedBy    string          `json:"generated_by"`
+}
+
+// PinName pairs a package pin with its BSDL port name.
+type PinName struct {
+	Pin  bsr.PinRef `json:"pin"`
+	Name string     `json:"name"`
+}
+
 // ExportJSON exports the netlist to JSON format.
 func (nl *Netlist) ExportJSON() ([]byte, error) {
 	if nl.Nets == nil {
 		return nil, fmt.Errorf("reveng: netlist not finalized")
 	}
 
-	output := struct {
-		Version    string `json:"version"`
-		NetCount   int    `json:"net_count"`
-		MultiNets  int    `json:"multi_pin_nets"`
-		Nets       []*Net `json:"nets"`
-		GeneratedBy string `json:"generated_by"`
-	}{
-		Version:    "1.0",
-		NetCount:   nl.NetCount(),
-		MultiNets:  nl.MultiPinNetCount(),
-		Nets:       nl.Nets,
-		GeneratedBy: "jtag boundary-scan reverse engineering",
+	output := netlistFile{
+		Version:        "1.0",
+		NetCount:       nl.NetCount(),
+		MultiNets:      nl.MultiPinNetCount(),
+		Nets:           make([]*Net, 0, len(nl.Nets)),
+		Pins:           nl.Pins,
+		Contradictions: nl.Contradictions,
+		Changes:        nl.Changes,
+		Components:     nl.Components(),
+		GeneratedBy:    "jtag boundary-scan reverse engineering",
+	}
+	for _, net := range nl.Nets {
+		named := *net
+		named.Name = nl.NetName(net)
+		output.Nets = append(output.Nets, &named)
+		for _, pin := range net.Pins {
+			if name, ok := nl.ports[pinKey(pin)]; ok {
+				output.PinNames = append(output.PinNames, PinName{Pin: pin, Name: name})
+			}
+		}
 	}
 
 	return json.MarshalIndent(output, "", "  ")
 }
 
-// ExportKiCad exports the netlist to KiCad netlist format.
-// This is a simplified format for basic connectivity.
-func (nl *Netlist) ExportKiCad() (string, error) {
-	if nl.Nets == nil {
-		return "", fmt.Errorf("reveng: netlist not finalized")
+// ImportJSON reads a netlist written by ExportJSON. The result is finalized
+// and holds the pins of every net and classified pin in the file.
+func ImportJSON(data []byte) (*Netlist, error) {
+	var file netlistFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("reveng: failed to parse netlist: %w", err)
 	}
 
-	var output string
-	output += "(export (version D)\n"
-	output += "  (design\n"
-	output += "    (source \"JTAG Boundary Scan Reverse Engineering\")\n"
-	output += "    (date \"" + "auto-generated" + "\")\n"
-	output += "  )\n"
-	output += "  (components\n"
-
-	// Group pins by device to create components
-	devicePins := make(map[string][]bsr.PinRef)
-	for _, net := range nl.Nets {
+	var pins []bsr.PinRef
+	seen := make(map[string]bool)
+	addPin := func(pin bsr.PinRef) {
+		if !seen[pinKey(pin)] {
+			seen[pinKey(pin)] = true
+			pins = append(pins, pin)
+		}
+	}
+	for _, net := range file.Nets {
+		if net == nil {
+			continue
+		}
 		for _, pin := range net.Pins {
-			key := fmt.Sprintf("%s_%d", pin.DeviceName, pin.ChainIndex)
-			devicePins[key] = append(devicePins[key], pin)
+			addPin(pin)
 		}
 	}
-
-	for deviceKey := range devicePins {
-		output += fmt.Sprintf("    (comp (ref %s))\n", deviceKey)
+	for _, attr := range file.Pins {
+		addPin(attr.Pin)
 	}
-	output += "  )\n"
 
-	output += "  (nets\n"
-	for _, net := range nl.Nets {
-		if len(net.Pins) < 2 {
-			continue // Skip single-pin nets
+	nl := NewNetlist(pins)
+	for _, net := range file.Nets {
+		if net == nil {
+			continue
 		}
-		output += fmt.Sprintf("    (net (code %d) (name Net-%d)\n", net.ID, net.ID)
-		for _, pin := range net.Pins {
-			compRef := fmt.Sprintf("%s_%d", pin.DeviceName, pin.ChainIndex)
-			output += fmt.Sprintf("      (node (ref %s) (pin %s))\n", compRef, pin.PinName)
+		for i := 1; i < len(net.Pins); i++ {
+			nl.Connect(net.Pins[0], net.Pins[i])
 		}
-		output += "    )\n"
+		for _, leg := range net.DiffPairs {
+			if !seen[pinKey(leg.Pin)] {
+				return nil, fmt.Errorf("reveng: net %d pairs pin %s.%s it does not hold",
+					net.ID, leg.Pin.DeviceName, leg.Pin.PinName)
+			}
+			nl.pairs[pinKey(leg.Pin)] = leg
+		}
+		for _, edge := range net.Edges {
+			nl.edges = append(nl.edges, edge)
+		}
+	}
+	for _, attr := range file.Pins {
+		nl.SetPinAttr(attr)
+	}
+	for _, comp := range file.Components {
+		nl.SetComponent(comp)
+	}
+	for _, pn := range file.PinNames {
+		nl.SetPortName(pn.Pin, pn.Name)
 	}
-	output += "  )\n"
-	output += ")\n"
+	nl.Contradictions = file.Contradictions
+	nl.Changes = file.Changes
+	nl.Nets = file.Nets // Finalize carries names and notes over
+	nl.Finalize()
+	return nl, nil
+}
 
-	return output, nil
+// pinLess orders pins by chain, chain index, device and pin name.
+func pinLess(a, b bsr.PinRef) bool {
+	if a.Chain != b.Chain {
+		return a.Chain < b.Chain
+	}
+	if a.ChainIndex != b.ChainIndex {
+		return a.ChainIndex < b.ChainIndex
+	}
+	if a.DeviceName != b.DeviceName {
+		return a.DeviceName < b.DeviceName
+	}
+	return a.PinName < b.PinName
 }
 
-// pinKey generates a unique string key for a PinRef.
+// pinKey generates a unique string key for a PinRef. Pins on chain 0 keep
+// the single-chain form, so earlier checkpoints still resume.
 func pinKey(pin bsr.PinRef) string {
+	if pin.Chain > 0 {
+		return fmt.Sprintf("%d/%d:%s:%s", pin.Chain, pin.ChainIndex, pin.DeviceName, pin.PinName)
+	}
 	return fmt.Sprintf("%d:%s:%s", pin.ChainIndex, pin.DeviceName, pin.PinName)
 }
@@ -2,6 +2,7 @@ package reveng
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -196,22 +197,116 @@ func TestExportKiCad(t *testing.T) {
 		t.Errorf("KiCad export missing (nets section")
 	}
 
-	// Should contain component references
-	if !strings.Contains(kicad, "U1_0") {
-		t.Errorf("KiCad export missing component U1_0")
+	// Components default to U<index+1> and nets are named after their
+	// first pin
+	for _, line := range []string{
+		`(comp (ref "U1")`,
+		`(comp (ref "U2")`,
+		`(net (code "1") (name "Net-(U1-PA0)")`,
+		`(node (ref "U1") (pin "PA0") (pintype "passive"))`,
+		`(node (ref "U2") (pin "PB0") (pintype "passive"))`,
+	} {
+		if !strings.Contains(kicad, line) {
+			t.Errorf("KiCad export lacks %s:\n%s", line, kicad)
+		}
+	}
+
+	// Recorded parts and port names replace the defaults
+	nl.SetComponent(Component{ChainIndex: 1, Device: "U2", Ref: "IC7", Value: "XC2C64A", Footprint: "Package_QFP:TQFP-44_10x10mm_P0.8mm"})
+	nl.SetPortName(pins[1], "IO_B0")
+	kicad, err = nl.ExportKiCad()
+	if err != nil {
+		t.Fatalf("ExportKiCad failed: %v", err)
+	}
+	for _, line := range []string{
+		`(comp (ref "IC7")`,
+		`(value "XC2C64A")`,
+		`(footprint "Package_QFP:TQFP-44_10x10mm_P0.8mm")`,
+		`(property (name "jtag_chain_index") (value "1"))`,
+		`(node (ref "IC7") (pin "PB0") (pinfunction "IO_B0") (pintype "passive"))`,
+		`(pin (num "PB0") (name "IO_B0") (type "passive"))`,
+	} {
+		if !strings.Contains(kicad, line) {
+			t.Errorf("KiCad export lacks %s:\n%s", line, kicad)
+		}
+	}
+}
+
+func TestPart(t *testing.T) {
+	nl := NewNetlist(nil)
+	nl.SetComponent(Component{ChainIndex: 1, Device: "DEV1", Ref: "IC7"})
+
+	for _, tc := range []struct {
+		chain, index int
+		ref, device  string
+	}{
+		{0, 0, "U1", "DEV0"},
+		{0, 1, "IC7", "DEV1"},
+		{2, 4, "U205", "DEV0"},
+	} {
+		c := nl.Part(tc.chain, tc.index, "DEV0")
+		if c.Ref != tc.ref || c.Device != tc.device || c.Value != tc.device || c.Chain != tc.chain || c.ChainIndex != tc.index {
+			t.Errorf("Part(%d, %d) = %+v, want ref %s device %s", tc.chain, tc.index, c, tc.ref, tc.device)
+		}
+	}
+}
+
+func TestDiffPairAnnotation(t *testing.T) {
+	pins := []bsr.PinRef{
+		{ChainIndex: 0, DeviceName: "U1", PinName: "PB11A"},
+		{ChainIndex: 1, DeviceName: "U2", PinName: "PB4A"},
+		{ChainIndex: 1, DeviceName: "U2", PinName: "PC0"},
+		{ChainIndex: 0, DeviceName: "U1", PinName: "PC1"},
+	}
+
+	nl := NewNetlist(pins)
+	nl.MarkDiffPair(pins[0], &bsr.DiffPair{Kind: "DIFFERENTIAL_CURRENT", Positive: "PB11A", Negative: "PB11B"})
+	nl.MarkDiffPair(pins[1], &bsr.DiffPair{Kind: "DIFFERENTIAL_CURRENT", Positive: "PB4A", Negative: "PB4B"})
+	nl.MarkDiffPair(pins[2], nil)
+	nl.Connect(pins[0], pins[1])
+	nl.Connect(pins[2], pins[3])
+	nl.Finalize()
+
+	var diffNet *Net
+	for _, net := range nl.Nets {
+		if len(net.DiffPairs) > 0 {
+			if diffNet != nil {
+				t.Fatalf("expected exactly one differential net")
+			}
+			diffNet = net
+		}
+	}
+	if diffNet == nil {
+		t.Fatalf("differential net not annotated")
+	}
+	if len(diffNet.DiffPairs) != 2 {
+		t.Fatalf("expected 2 pair legs, got %d", len(diffNet.DiffPairs))
 	}
 
-	if !strings.Contains(kicad, "U2_1") {
-		t.Errorf("KiCad export missing component U2_1")
+	data, err := nl.ExportJSON()
+	if err != nil {
+		t.Fatalf("ExportJSON failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"negative": "PB11B"`) {
+		t.Errorf("JSON export missing negative leg annotation")
 	}
 
-	// Should contain pin references
-	if !strings.Contains(kicad, "PA0") {
-		t.Errorf("KiCad export missing pin PA0")
+	kicad, err := nl.ExportKiCad()
+	if err != nil {
+		t.Fatalf("ExportKiCad failed: %v", err)
+	}
+	if !strings.Contains(kicad, `(name "Net-(U1-PB11A)_P")`) ||
+		!strings.Contains(kicad, `(name "Net-(U1-PB11A)_N")`) {
+		t.Errorf("KiCad export missing _P/_N differential nets:\n%s", kicad)
+	}
+	if !strings.Contains(kicad, `(node (ref "U2") (pin "PB4B") (pintype "passive"))`) {
+		t.Errorf("KiCad export missing negative leg node")
 	}
 
-	if !strings.Contains(kicad, "PB0") {
-		t.Errorf("KiCad export missing pin PB0")
+	clone := nl.Clone()
+	clone.Nets[diffNet.ID].DiffPairs[0].Negative = "changed"
+	if diffNet.DiffPairs[0].Negative == "changed" {
+		t.Errorf("Clone should deep copy pair annotations")
 	}
 }
 
@@ -267,3 +362,113 @@ func TestUnionFindPerformance(t *testing.T) {
 		t.Errorf("expected %d pins in net, got %d", numPins, len(nl.Nets[0].Pins))
 	}
 }
+
+// roundTripNetlist builds a netlist with every kind of annotation the
+// exports carry.
+func roundTripNetlist() *Netlist {
+	pins := []bsr.PinRef{
+		{ChainIndex: 0, DeviceName: "DEV0", PinName: "1"},
+		{ChainIndex: 0, DeviceName: "DEV0", PinName: "2"},
+		{ChainIndex: 0, DeviceName: "DEV0", PinName: "3"},
+		{ChainIndex: 1, DeviceName: "DEV1", PinName: "A4"},
+		{ChainIndex: 1, DeviceName: "DEV1", PinName: "B4"},
+		{ChainIndex: 1, DeviceName: "DEV1", PinName: "C7"},
+	}
+	nl := NewNetlist(pins)
+	nl.MarkDiffPair(pins[0], &bsr.DiffPair{Kind: "DIFFERENTIAL_VOLTAGE", Positive: "1", Negative: "9"})
+	nl.ConnectVotes(pins[0], pins[3], 3, 4)
+	nl.Connect(pins[1], pins[4])
+	nl.SetPinAttr(PinAttr{Pin: pins[2], Class: PinPullUp, IdleHigh: true})
+	nl.SetPinAttr(PinAttr{Pin: pins[5], Class: PinFloating})
+	nl.SetComponent(Component{ChainIndex: 0, Device: "DEV0", Ref: "U4", Value: "MCU", Footprint: "Package_QFP:LQFP-48_7x7mm_P0.5mm"})
+	nl.SetComponent(Component{ChainIndex: 1, Device: "DEV1", Package: "CABGA64"})
+	nl.SetPortName(pins[0], "LVDS0_P")
+	nl.SetPortName(pins[1], "PA1")
+	nl.Contradictions = []Contradiction{{
+		Kind:   ContradictionMissing,
+		Pins:   []bsr.PinRef{pins[1], pins[2]},
+		Detail: "DEV0.3 did not follow DEV0.2",
+	}}
+	nl.Finalize()
+	return nl
+}
+
+func TestImportJSON(t *testing.T) {
+	nl := roundTripNetlist()
+	data, err := nl.ExportJSON()
+	if err != nil {
+		t.Fatalf("ExportJSON failed: %v", err)
+	}
+	got, err := ImportJSON(data)
+	if err != nil {
+		t.Fatalf("ImportJSON failed: %v", err)
+	}
+	again, err := got.ExportJSON()
+	if err != nil {
+		t.Fatalf("ExportJSON of import failed: %v", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("JSON round trip changed the netlist:\n%s\nwant:\n%s", again, data)
+	}
+	if port, ok := got.PortName(nl.Nets[0].Pins[0]); !ok || port != "LVDS0_P" {
+		t.Errorf("port name = %q, %v; want LVDS0_P", port, ok)
+	}
+
+	if _, err := ImportJSON([]byte("{")); err == nil {
+		t.Errorf("ImportJSON accepted broken JSON")
+	}
+}
+
+func TestImportKiCad(t *testing.T) {
+	nl := roundTripNetlist()
+	kicad, err := nl.ExportKiCad()
+	if err != nil {
+		t.Fatalf("ExportKiCad failed: %v", err)
+	}
+	got, err := ImportKiCad([]byte(kicad))
+	if err != nil {
+		t.Fatalf("ImportKiCad failed: %v", err)
+	}
+
+	// The negative leg comes back as a net of its own
+	want := "[DEV0.1,DEV1.A4 DEV0.2,DEV1.B4]"
+	if nets := fmt.Sprint(multiPinNets(got)); nets != want {
+		t.Errorf("nets = %s, want %s", nets, want)
+	}
+	if fmt.Sprint(got.Components()) != fmt.Sprint([]Component{
+		{ChainIndex: 0, Device: "DEV0", Ref: "U4", Value: "MCU", Footprint: "Package_QFP:LQFP-48_7x7mm_P0.5mm"},
+		{ChainIndex: 1, Device: "DEV1", Ref: "U2", Value: "DEV1", Package: "CABGA64"},
+	}) {
+		t.Errorf("components = %+v", got.Components())
+	}
+	if len(got.Pins) != 0 {
+		t.Errorf("pin classes restored from KiCad pin types: %+v", got.Pins)
+	}
+	if port, ok := got.PortName(bsr.PinRef{ChainIndex: 0, DeviceName: "DEV0", PinName: "2"}); !ok || port != "PA1" {
+		t.Errorf("port name = %q, %v; want PA1", port, ok)
+	}
+
+	// Exporting the import gives the same nets again
+	again, err := got.ExportKiCad()
+	if err != nil {
+		t.Fatalf("ExportKiCad of import failed: %v", err)
+	}
+	for _, line := range []string{
+		`(name "LVDS0_P")`,
+		`(node (ref "U2") (pin "B4") (pintype "passive"))`,
+	} {
+		if !strings.Contains(again, line) {
+			t.Errorf("KiCad export of import lacks %s:\n%s", line, again)
+		}
+	}
+
+	for _, bad := range []string{
+		"",
+		"(kicad_pcb)",
+		`(export (components (comp (ref "U1"))) (nets (net (code "1") (name "x") (node (ref "U9") (pin "1")))))`,
+	} {
+		if _, err := ImportKiCad([]byte(bad)); err == nil {
+			t.Errorf("ImportKiCad accepted %q", bad)
+		}
+	}
+}
@@ -0,0 +1,557 @@
+package reveng
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/kicad/schematic"
+)
+
+// KiCad electrical pin types used for schematic pins
+const (
+	PinTypeInput         = "input"
+	PinTypeOutput        = "output"
+	PinTypeBidirectional = "bidirectional"
+	PinTypePower         = "power_in"
+	PinTypePassive       = "passive"
+)
+
+// SchematicPin is one package pin of a SchematicPart.
+type SchematicPin struct {
+	Number string // Package pin, as in bsr.PinRef.PinName
+	Name   string // BSDL port name
+	Type   string // One of the PinType constants
+}
+
+// SchematicPart is a chain device as drawn by ExportSchematic.
+type SchematicPart struct {
+	Component
+	Pins []SchematicPin
+}
+
+// PartFromBSDL lists the pins of a BSDL entity with their port names and
+// directions: in ports become inputs, out and buffer outputs, inout
+// bidirectional, and linkage ports power inputs when named like a supply
+// (passive otherwise). pinMap maps ports to package pins, as returned by
+// chain.Device.PinMap; without one, port names double as pin numbers.
+func PartFromBSDL(c Component, entity *bsdl.Entity, pinMap map[string]string) SchematicPart {
+	part := SchematicPart{Component: c}
+	var ports []*bsdl.Port
+	if entity != nil && entity.Port != nil {
+		ports = entity.Port.Ports
+	}
+
+	modes := make(map[string]string)
+	var signals []string
+	for _, port := range ports {
+		modes[strings.ToUpper(port.Name)] = port.Mode
+		if port.Type != nil && port.Type.Range != nil {
+			lo, hi := port.Type.Range.Start, port.Type.Range.End
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			for i := lo; i <= hi; i++ {
+				signals = append(signals, fmt.Sprintf("%s(%d)", port.Name, i))
+			}
+			continue
+		}
+		signals = append(signals, port.Name)
+	}
+	// Pin maps may list signals the port clause spells differently
+	for signal := range pinMap {
+		signals = append(signals, signal)
+	}
+
+	seen := make(map[string]bool)
+	for _, signal := range signals {
+		number, ok := lookupSignal(pinMap, signal)
+		if !ok {
+			if len(pinMap) > 0 {
+				continue // Not bonded in this package
+			}
+			number = signal
+		}
+		if seen[number] {
+			continue
+		}
+		seen[number] = true
+
+		base := signal
+		if i := strings.IndexByte(base, '('); i >= 0 {
+			base = base[:i]
+		}
+		part.Pins = append(part.Pins, SchematicPin{
+			Number: number,
+			Name:   signal,
+			Type:   portPinType(modes[strings.ToUpper(strings.TrimSpace(base))], signal),
+		})
+	}
+	sort.Slice(part.Pins, func(i, j int) bool { return naturalLess(part.Pins[i].Name, part.Pins[j].Name) })
+	return part
+}
+
+// lookupSignal finds a signal in a pin map, ignoring case and spaces.
+func lookupSignal(pinMap map[string]string, signal string) (string, bool) {
+	if pin, ok := pinMap[signal]; ok {
+		return pin, true
+	}
+	norm := func(s string) string { return strings.ToUpper(strings.ReplaceAll(s, " ", "")) }
+	for name, pin := range pinMap {
+		if norm(name) == norm(signal) {
+			return pin, true
+		}
+	}
+	return "", false
+}
+
+func portPinType(mode, name string) string {
+	switch strings.ToLower(mode) {
+	case "in":
+		return PinTypeInput
+	case "out", "buffer":
+		return PinTypeOutput
+	case "inout":
+		return PinTypeBidirectional
+	}
+	if isPowerPin(name) {
+		return PinTypePower
+	}
+	return PinTypePassive
+}
+
+// ChainParts returns a part for every device of the chain, labelled with the
+// components recorded in nl.
+func (nl *Netlist) ChainParts(ctl *bsr.Controller) []SchematicPart {
+	parts := make([]SchematicPart, 0, len(ctl.Devices))
+	for i, dev := range ctl.Devices {
+		c := nl.Part(ctl.ChainID(), i, dev.ChainDev.Name())
+		var entity *bsdl.Entity
+		if dev.ChainDev.File != nil {
+			entity = dev.ChainDev.File.Entity
+		}
+		parts = append(parts, PartFromBSDL(c, entity, dev.ChainDev.PinMap()))
+	}
+	return parts
+}
+
+// SessionParts returns the ChainParts of every chain in the session.
+func (nl *Netlist) SessionParts(sess *bsr.Session) []SchematicPart {
+	var parts []SchematicPart
+	for _, ctl := range sess.Controllers {
+		parts = append(parts, nl.ChainParts(ctl)...)
+	}
+	return parts
+}
+
+// Schematic layout, in millimeters on KiCad's 2.54mm grid
+const (
+	schPitch     = 2.54 // Pin spacing
+	schPinLength = 2.54
+	schCharWidth = 1.27 // Approximate width of a 1.27mm font character
+	schMargin    = 25.4 // Space around the sheet border
+	schMaxWidth  = 1100 // Wrap parts to a new row past this
+)
+
+// ExportSchematic draws the netlist as a KiCad schematic: one symbol per
+// part, with inputs and bidirectional pins on the left and outputs and
+// linkage/power pins on the right, and a global label named after its net
+// on every pin that is on one. Floating pins outside every net get a
+// no-connect flag. Empty component fields default as in ExportKiCad.
+//
+// The result is a starting point, not a finished drawing: symbols are
+// placed side by side and nets are joined by label only.
+func (nl *Netlist) ExportSchematic(parts []SchematicPart) (*schematic.Schematic, error) {
+	if nl.Nets == nil {
+		return nil, fmt.Errorf("reveng: netlist not finalized")
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("reveng: no parts to draw")
+	}
+
+	labels := nl.pinNetNames()
+	floating := make(map[string]bool)
+	for _, attr := range nl.isolatedPins() {
+		if attr.Class == PinFloating {
+			floating[pinKey(attr.Pin)] = true
+		}
+	}
+
+	sch := &schematic.Schematic{
+		Version:   schematic.DefaultVersion,
+		Generator: "opentracejtag",
+		TitleBlock: schematic.TitleBlock{
+			Title:    "Reverse-engineered connectivity",
+			Date:     time.Now().Format("2006-01-02"),
+			Comment1: "Generated from boundary-scan reverse engineering",
+		},
+		SheetInstances: []schematic.SheetInstance{{Path: "/", Page: "1"}},
+	}
+	var refs []string
+	for _, part := range parts {
+		refs = append(refs, nl.partComponent(part).Ref)
+	}
+	sch.UUID = schematicUUID("sheet", strings.Join(refs, ","))
+
+	libs := make(map[string]string) // Pin signature -> lib symbol name
+	x, y, rowHeight, width := schMargin, schMargin, 0.0, 0.0
+	for _, part := range parts {
+		c := nl.partComponent(part)
+		sym := layoutSymbol(part.Pins)
+
+		// Reserve room for the labels on both sides
+		labelRoom := 0.0
+		for _, pin := range part.Pins {
+			ref := c.PinRef(pin.Number)
+			if name, ok := labels[pinKey(ref)]; ok {
+				labelRoom = math.Max(labelRoom, float64(len(name)+4)*schCharWidth)
+			}
+		}
+		labelRoom = snap(labelRoom)
+		partWidth := 2*(sym.halfWidth+schPinLength+labelRoom) + 2*schPitch
+		partHeight := sym.top - sym.bottom + 4*schPitch
+		if x > schMargin && x+partWidth > schMaxWidth {
+			x, y, rowHeight = schMargin, y+rowHeight, 0
+		}
+		at := schematic.Position{X: snap(x + partWidth/2), Y: snap(y + sym.top + 2*schPitch)}
+		x += partWidth
+		rowHeight = math.Max(rowHeight, partHeight)
+		width = math.Max(width, x)
+
+		// One library symbol per distinct device and pinout
+		signature := c.Device + "\x00" + fmt.Sprint(part.Pins)
+		libName, ok := libs[signature]
+		if !ok {
+			libName = "jtag:" + c.Device
+			for n := 2; libNameTaken(libs, libName); n++ {
+				libName = fmt.Sprintf("jtag:%s_%d", c.Device, n)
+			}
+			libs[signature] = libName
+			sch.LibSymbols = append(sch.LibSymbols, sym.libSymbol(libName, c))
+		}
+
+		inst := schematic.Symbol{
+			LibID:    libName,
+			Position: at,
+			Unit:     1,
+			InBom:    true,
+			OnBoard:  true,
+			UUID:     schematicUUID("symbol", c.Ref),
+			Properties: []schematic.Property{
+				symProperty("Reference", c.Ref, at.X, at.Y-sym.top-2*schPitch, false),
+				symProperty("Value", c.Value, at.X, at.Y-sym.bottom+2*schPitch, false),
+				symProperty("Footprint", c.Footprint, at.X, at.Y, true),
+				symProperty("Datasheet", "~", at.X, at.Y, true),
+				symProperty("jtag_chain_index", fmt.Sprint(c.ChainIndex), at.X, at.Y, true),
+			},
+		}
+		if c.Chain > 0 {
+			inst.Properties = append(inst.Properties, symProperty("jtag_chain", fmt.Sprint(c.Chain), at.X, at.Y, true))
+		}
+		if c.Package != "" {
+			inst.Properties = append(inst.Properties, symProperty("jtag_package", c.Package, at.X, at.Y, true))
+		}
+		for _, pin := range sym.pins {
+			inst.Pins = append(inst.Pins, schematic.PinRef{
+				Number: pin.Number,
+				UUID:   schematicUUID("pin", c.Ref, pin.Number),
+			})
+
+			// Library Y points up, sheet Y down
+			end := schematic.Position{X: at.X + pin.x, Y: at.Y - pin.y}
+			ref := c.PinRef(pin.Number)
+			if name, ok := labels[pinKey(ref)]; ok {
+				label := schematic.GlobalLabel{
+					Text:     name,
+					Shape:    labelShape(pin.Type),
+					Position: end,
+					UUID:     schematicUUID("label", c.Ref, pin.Number),
+				}
+				if pin.left {
+					label.Angle = 180
+					label.Effects.Justify.Horizontal = "right"
+				} else {
+					label.Effects.Justify.Horizontal = "left"
+				}
+				sch.GlobalLabels = append(sch.GlobalLabels, label)
+			} else if floating[pinKey(ref)] {
+				sch.NoConnects = append(sch.NoConnects, schematic.NoConnect{
+					Position: end,
+					UUID:     schematicUUID("nc", c.Ref, pin.Number),
+				})
+			}
+		}
+		sch.Symbols = append(sch.Symbols, inst)
+	}
+	sch.Paper = paperFor(width+schMargin, y+rowHeight+schMargin)
+	return sch, nil
+}
+
+// partComponent fills the empty fields of a part's component from the
+// netlist's record and the defaults.
+func (nl *Netlist) partComponent(part SchematicPart) Component {
+	c := nl.Part(part.Chain, part.ChainIndex, part.Device)
+	if part.Device != "" {
+		c.Device = part.Device
+	}
+	if part.Ref != "" {
+		c.Ref = part.Ref
+	}
+	if part.Value != "" {
+		c.Value = part.Value
+	}
+	if part.Footprint != "" {
+		c.Footprint = part.Footprint
+	}
+	if part.Package != "" {
+		c.Package = part.Package
+	}
+	return c
+}
+
+// pinNetNames maps the pin key of every net member, and of every negative
+// leg, to its net's name.
+func (nl *Netlist) pinNetNames() map[string]string {
+	names := make(map[string]string)
+	for _, net := range nl.Nets {
+		if len(net.Pins) < 2 {
+			continue
+		}
+		name := nl.NetName(net)
+		if len(net.DiffPairs) == 0 {
+			for _, pin := range net.Pins {
+				names[pinKey(pin)] = name
+			}
+			continue
+		}
+		for _, pin := range net.Pins {
+			names[pinKey(pin)] = name + "_P"
+		}
+		for _, leg := range net.DiffPairs {
+			names[pinKey(negativeLeg(leg))] = name + "_N"
+		}
+	}
+	return names
+}
+
+// symbolLayout is the pin placement of one library symbol.
+type symbolLayout struct {
+	pins        []placedPin
+	halfWidth   float64
+	top, bottom float64 // Body edges, library coordinates
+}
+
+type placedPin struct {
+	SchematicPin
+	x, y float64 // Connection point, library coordinates
+	left bool
+}
+
+// layoutSymbol places inputs then bidirectional pins down the left side and
+// outputs then linkage/power pins down the right, one pitch apart with a
+// blank row between groups.
+func layoutSymbol(pins []SchematicPin) symbolLayout {
+	var groups [4][]SchematicPin
+	for _, pin := range pins {
+		switch pin.Type {
+		case PinTypeInput:
+			groups[0] = append(groups[0], pin)
+		case PinTypeBidirectional:
+			groups[1] = append(groups[1], pin)
+		case PinTypeOutput:
+			groups[2] = append(groups[2], pin)
+		default:
+			groups[3] = append(groups[3], pin)
+		}
+	}
+	side := func(a, b []SchematicPin) ([]SchematicPin, int, int) {
+		rows := len(a) + len(b)
+		if len(a) > 0 && len(b) > 0 {
+			rows++ // Gap between groups
+		}
+		width := 0
+		for _, pin := range append(append([]SchematicPin(nil), a...), b...) {
+			if len(pin.Name) > width {
+				width = len(pin.Name)
+			}
+		}
+		return append(append([]SchematicPin(nil), a...), b...), rows, width
+	}
+	left, leftRows, leftWidth := side(groups[0], groups[1])
+	right, rightRows, rightWidth := side(groups[2], groups[3])
+
+	rows := leftRows
+	if rightRows > rows {
+		rows = rightRows
+	}
+	if rows == 0 {
+		rows = 1
+	}
+	l := symbolLayout{
+		halfWidth: math.Max(2*schPitch, snap(float64(leftWidth+rightWidth+4)*schCharWidth/2)),
+	}
+	firstY := math.Ceil(float64(rows-1)/2) * schPitch
+	l.top = firstY + schPitch
+	l.bottom = firstY - float64(rows)*schPitch
+
+	place := func(pins []SchematicPin, gapAfter int, isLeft bool) {
+		x := l.halfWidth + schPinLength
+		if isLeft {
+			x = -x
+		}
+		row := 0
+		for i, pin := range pins {
+			if i == gapAfter && gapAfter > 0 {
+				row++
+			}
+			l.pins = append(l.pins, placedPin{
+				SchematicPin: pin,
+				x:            x,
+				y:            firstY - float64(row)*schPitch,
+				left:         isLeft,
+			})
+			row++
+		}
+	}
+	place(left, len(groups[0]), true)
+	place(right, len(groups[2]), false)
+	return l
+}
+
+// libSymbol draws the layout as a library symbol
+func (l symbolLayout) libSymbol(name string, c Component) schematic.LibSymbol {
+	sym := schematic.LibSymbol{
+		Name:       name,
+		PinNumbers: true,
+		PinNames:   true,
+		InBom:      true,
+		OnBoard:    true,
+		Properties: []schematic.Property{
+			symProperty("Reference", "U", 0, l.top+schPitch/2, false),
+			symProperty("Value", c.Device, 0, l.bottom-schPitch/2, false),
+			symProperty("Footprint", "", 0, 0, true),
+			symProperty("Datasheet", "~", 0, 0, true),
+		},
+		Graphics: []schematic.SymGraphic{{
+			Type:   "rectangle",
+			Start:  schematic.Position{X: -l.halfWidth, Y: l.top},
+			End:    schematic.Position{X: l.halfWidth, Y: l.bottom},
+			Stroke: schematic.Stroke{Width: 0.254, Type: "default"},
+			Fill:   schematic.Fill{Type: "background"},
+		}},
+	}
+	for _, pin := range l.pins {
+		angle := schematic.Angle(0)
+		if !pin.left {
+			angle = 180
+		}
+		sym.Pins = append(sym.Pins, schematic.Pin{
+			Type:     pin.Type,
+			Style:    "line",
+			Position: schematic.Position{X: pin.x, Y: pin.y},
+			Angle:    angle,
+			Length:   schPinLength,
+			Name:     schematic.PinName{Name: pin.Name},
+			Number:   schematic.PinNum{Number: pin.Number},
+		})
+	}
+	return sym
+}
+
+func symProperty(key, value string, x, y float64, hide bool) schematic.Property {
+	return schematic.Property{
+		Key:      key,
+		Value:    value,
+		Position: schematic.PositionAngle{Position: schematic.Position{X: x, Y: y}},
+		Effects:  schematic.Effects{Hide: hide},
+	}
+}
+
+func labelShape(pinType string) string {
+	switch pinType {
+	case PinTypeInput, PinTypeOutput, PinTypeBidirectional:
+		return pinType
+	}
+	return PinTypePassive
+}
+
+func libNameTaken(libs map[string]string, name string) bool {
+	for _, n := range libs {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// paperFor returns the smallest ISO sheet, landscape, that holds w x h mm.
+func paperFor(w, h float64) string {
+	for _, p := range []struct {
+		name string
+		w, h float64
+	}{
+		{"A4", 297, 210},
+		{"A3", 420, 297},
+		{"A2", 594, 420},
+		{"A1", 841, 594},
+	} {
+		if w <= p.w && h <= p.h {
+			return p.name
+		}
+	}
+	return "A0"
+}
+
+// snap rounds up to the 2.54mm grid
+func snap(v float64) float64 {
+	return math.Ceil(v/schPitch-1e-9) * schPitch
+}
+
+// schematicUUID derives a stable UUID from its parts, so regenerating a
+// schematic for the same board gives the same file.
+func schematicUUID(parts ...string) schematic.UUID {
+	sum := sha1.Sum([]byte(strings.Join(parts, "\x00")))
+	sum[6] = sum[6]&0x0f | 0x50 // Version 5
+	sum[8] = sum[8]&0x3f | 0x80 // RFC 4122 variant
+	return schematic.UUID(fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16]))
+}
+
+// naturalLess orders names with embedded numbers numerically, so PA2 sorts
+// before PA10.
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		ad, bd := isDigit(a[0]), isDigit(b[0])
+		if ad && bd {
+			i, j := 0, 0
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			na, nb := strings.TrimLeft(a[:i], "0"), strings.TrimLeft(b[:j], "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[i:], b[j:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
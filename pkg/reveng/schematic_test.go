@@ -0,0 +1,116 @@
+package reveng
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsdl"
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/kicad/schematic"
+)
+
+func TestPartFromBSDL(t *testing.T) {
+	parser, err := bsdl.NewParser()
+	if err != nil {
+		t.Fatalf("parser init failed: %v", err)
+	}
+	file, err := parser.ParseString(`
+entity PART is
+	port (
+		RST : in bit;
+		LED : out bit;
+		D : inout bit_vector(0 to 1);
+		VCC : linkage bit;
+		NC : linkage bit
+	);
+	constant PKG : PIN_MAP_STRING :=
+		"RST : 1, LED : 2, D : (3, 4), VCC : 5";
+end PART;
+`)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	part := PartFromBSDL(Component{Ref: "U7"}, file.Entity, file.Entity.GetPinMap())
+	var got []string
+	for _, pin := range part.Pins {
+		got = append(got, pin.Number+":"+pin.Name+":"+pin.Type)
+	}
+	want := []string{"3:D(0):bidirectional", "4:D(1):bidirectional", "2:LED:output", "1:RST:input", "5:VCC:power_in"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("pins = %v, want %v", got, want)
+	}
+
+	// Without a pin map every port is drawn, named by itself
+	part = PartFromBSDL(Component{}, file.Entity, nil)
+	if len(part.Pins) != 6 || part.Pins[0].Number != "D(0)" || part.Pins[3].Type != PinTypePassive {
+		t.Errorf("unmapped pins = %+v", part.Pins)
+	}
+}
+
+func TestExportSchematic(t *testing.T) {
+	board := &codedBoard{
+		nets: [][]string{
+			{"DEV0.A1", "DEV1.A3", "DEV2.A3"},
+			{"DEV0.A2", "DEV1.A1"},
+		},
+	}
+	ctl := newCodedBoardController(t, board)
+	cfg := DefaultConfig()
+	cfg.SkipKnownJTAGPins = false
+	cfg.SkipPowerPins = false
+	nl, err := DiscoverNetlist(context.Background(), ctl, cfg, nil)
+	if err != nil {
+		t.Fatalf("DiscoverNetlist failed: %v", err)
+	}
+	nl.SetComponent(Component{ChainIndex: 1, Device: "DEV1", Ref: "IC5"})
+
+	sch, err := nl.ExportSchematic(nl.ChainParts(ctl))
+	if err != nil {
+		t.Fatalf("ExportSchematic failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := schematic.Write(&buf, sch); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	got, err := schematic.Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse of written schematic failed: %v\n%s", err, buf.String())
+	}
+
+	// The three devices share one pinout but are distinct parts
+	if len(got.LibSymbols) != 3 || len(got.Symbols) != 3 {
+		t.Fatalf("got %d lib symbols, %d symbols, want 3 each", len(got.LibSymbols), len(got.Symbols))
+	}
+	var pins []string
+	for _, pin := range got.LibSymbols[0].Pins {
+		pins = append(pins, pin.Number.Number+"="+pin.Name.Name)
+	}
+	if strings.Join(pins, ",") != "A1=PA1,A2=PA2,A3=PA3" {
+		t.Errorf("lib pins = %v", pins)
+	}
+	refs := make(map[string]bool)
+	for _, sym := range got.Symbols {
+		for _, prop := range sym.Properties {
+			if prop.Key == "Reference" {
+				refs[prop.Value] = true
+			}
+		}
+	}
+	for _, ref := range []string{"U1", "IC5", "U3"} {
+		if !refs[ref] {
+			t.Errorf("no symbol with reference %s (have %v)", ref, refs)
+		}
+	}
+
+	labels := make(map[string]int)
+	for _, label := range got.GlobalLabels {
+		labels[label.Text]++
+	}
+	want := map[string]int{"Net-(U1-PA1)": 3, "Net-(U1-PA2)": 2}
+	if fmt.Sprint(labels) != fmt.Sprint(want) {
+		t.Errorf("global labels = %v, want %v", labels, want)
+	}
+}
@@ -0,0 +1,140 @@
+package reveng
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
+)
+
+// ContradictionKind says how a scan disagreed with a seeded net.
+type ContradictionKind string
+
+const (
+	// ContradictionMissing: a seeded member that can be read did not follow
+	// the net's representative.
+	ContradictionMissing ContradictionKind = "missing"
+	// ContradictionMerged: two seeded nets turned out to be one.
+	ContradictionMerged ContradictionKind = "merged"
+)
+
+// Contradiction is a place where the scan disagrees with Config.Seed. The
+// scan wins: the netlist holds what was measured.
+type Contradiction struct {
+	Kind   ContradictionKind `json:"kind"`
+	Pins   []bsr.PinRef      `json:"pins"` // Representative first, then the pin in question
+	Detail string            `json:"detail"`
+}
+
+// seedPlan is Config.Seed restricted to the run's candidates.
+type seedPlan struct {
+	nets   [][]bsr.PinRef
+	reps   []*bsr.PinRef // Driven member per net; nil if none can drive
+	member map[string]int
+}
+
+// newSeedPlan picks a representative for every seeded net with at least two
+// candidates. It returns nil without a seed.
+func newSeedPlan(sess *bsr.Session, seed *Netlist, candidates []bsr.PinRef) *seedPlan {
+	if seed == nil {
+		return nil
+	}
+	byKey := make(map[string]bsr.PinRef, len(candidates))
+	for _, ref := range candidates {
+		byKey[pinKey(ref)] = ref
+	}
+
+	groups := make(map[string][]bsr.PinRef)
+	for _, pin := range seed.allPins {
+		if ref, ok := byKey[pinKey(pin)]; ok {
+			root := pinKey(seed.Find(pin))
+			groups[root] = append(groups[root], ref)
+		}
+	}
+	plan := &seedPlan{member: make(map[string]int)}
+	for _, pins := range groups {
+		if len(pins) < 2 {
+			continue
+		}
+		sort.Slice(pins, func(i, j int) bool { return pinLess(pins[i], pins[j]) })
+		plan.nets = append(plan.nets, pins)
+	}
+	sort.Slice(plan.nets, func(i, j int) bool { return pinLess(plan.nets[i][0], plan.nets[j][0]) })
+
+	for i, pins := range plan.nets {
+		var rep *bsr.PinRef
+		for j, pin := range pins {
+			plan.member[pinKey(pin)] = i
+			if rep == nil && sess.CanDrive(pin) {
+				rep = &pins[j]
+			}
+		}
+		plan.reps = append(plan.reps, rep)
+	}
+	return plan
+}
+
+// redundant reports whether ref belongs to a seeded net driven through
+// another pin.
+func (p *seedPlan) redundant(ref bsr.PinRef) bool {
+	if p == nil {
+		return false
+	}
+	i, ok := p.member[pinKey(ref)]
+	return ok && (p.reps[i] == nil || *p.reps[i] != ref)
+}
+
+// apply checks the scanned netlist against the seed. Members that cannot be
+// read, and nets with no drivable member, cannot be checked and are
+// connected as seeded; everything else is left as measured and reported
+// when it disagrees.
+func (p *seedPlan) apply(sess *bsr.Session, nl *Netlist) []Contradiction {
+	if p == nil {
+		return nil
+	}
+	var out []Contradiction
+	owner := make(map[bsr.PinRef]int)
+	for i, rep := range p.reps {
+		if rep == nil {
+			continue
+		}
+		root := nl.Find(*rep)
+		j, ok := owner[root]
+		if !ok {
+			owner[root] = i
+			continue
+		}
+		other := *p.reps[j]
+		out = append(out, Contradiction{
+			Kind: ContradictionMerged,
+			Pins: []bsr.PinRef{other, *rep},
+			Detail: fmt.Sprintf("seeded nets of %s.%s and %s.%s are connected",
+				other.DeviceName, other.PinName, rep.DeviceName, rep.PinName),
+		})
+	}
+
+	for i, pins := range p.nets {
+		rep := p.reps[i]
+		if rep == nil {
+			for _, pin := range pins[1:] {
+				nl.Connect(pins[0], pin)
+			}
+			continue
+		}
+		for _, pin := range pins {
+			switch {
+			case pin == *rep:
+			case !sess.CanRead(pin):
+				nl.Connect(*rep, pin)
+			case nl.Find(pin) != nl.Find(*rep):
+				out = append(out, Contradiction{
+					Kind: ContradictionMissing,
+					Pins: []bsr.PinRef{*rep, pin},
+					Detail: fmt.Sprintf("%s.%s did not follow %s.%s",
+						pin.DeviceName, pin.PinName, rep.DeviceName, rep.PinName),
+				})
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,128 @@
+package reveng
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/OpenTraceLab/OpenTraceJTAG/pkg/bsr"
+)
+
+func seedNetlist(groups ...[]string) *Netlist {
+	var pins []bsr.PinRef
+	var refs [][]bsr.PinRef
+	for _, group := range groups {
+		var g []bsr.PinRef
+		for _, name := range group {
+			var dev int
+			fmt.Sscanf(name, "DEV%d.", &dev)
+			devName, pinName, _ := strings.Cut(name, ".")
+			ref := bsr.PinRef{ChainIndex: dev, DeviceName: devName, PinName: pinName}
+			g = append(g, ref)
+			pins = append(pins, ref)
+		}
+		refs = append(refs, g)
+	}
+	nl := NewNetlist(pins)
+	for _, g := range refs {
+		for _, ref := range g[1:] {
+			nl.Connect(g[0], ref)
+		}
+	}
+	return nl
+}
+
+func TestDiscoverNetlistSeeded(t *testing.T) {
+	nets := [][]string{
+		{"DEV0.A1", "DEV1.A3"},
+		{"DEV0.A2", "DEV1.A1"},
+		{"DEV2.A2", "DEV0.A3", "DEV1.A2", "DEV2.A3"},
+	}
+	want := "[DEV0.A1,DEV1.A3 DEV0.A2,DEV1.A1 DEV0.A3,DEV1.A2,DEV2.A2,DEV2.A3]"
+	seed := seedNetlist(
+		[]string{"DEV0.A1", "DEV1.A3"},
+		[]string{"DEV0.A2", "DEV1.A1", "DEV2.A1"}, // DEV2.A1 is not on this net
+		[]string{"DEV1.A2", "DEV2.A3"},
+		[]string{"DEV2.A2", "DEV0.A3"}, // Same net as the one above
+	)
+	seed.Finalize()
+	if err := seed.RenameNet(seed.Nets[0].ID, "BOOT"); err != nil {
+		t.Fatalf("RenameNet failed: %v", err)
+	}
+
+	for _, algo := range []Algorithm{AlgorithmSequential, AlgorithmCoded} {
+		t.Run(string(algo), func(t *testing.T) {
+			run := func(seed *Netlist) (*Netlist, int) {
+				board := &codedBoard{nets: nets}
+				cfg := DefaultConfig()
+				cfg.Algorithm = algo
+				cfg.SkipKnownJTAGPins = false
+				cfg.SkipPowerPins = false
+				cfg.Seed = seed
+				nl, err := DiscoverNetlist(context.Background(), newCodedBoardController(t, board), cfg, nil)
+				if err != nil {
+					t.Fatalf("DiscoverNetlist failed: %v", err)
+				}
+				return nl, board.scans
+			}
+
+			_, fullScans := run(nil)
+			nl, seededScans := run(seed)
+			if got := fmt.Sprint(multiPinNets(nl)); got != want {
+				t.Errorf("nets = %s, want %s", got, want)
+			}
+			if name := nl.NetName(nl.Nets[0]); name != "BOOT" {
+				t.Errorf("seeded net 0 named %s, want BOOT", name)
+			}
+			if seededScans >= fullScans {
+				t.Errorf("seeded run took %d scans, unseeded %d", seededScans, fullScans)
+			}
+
+			var got []string
+			for _, c := range nl.Contradictions {
+				got = append(got, fmt.Sprintf("%s %s.%s/%s.%s", c.Kind,
+					c.Pins[0].DeviceName, c.Pins[0].PinName, c.Pins[1].DeviceName, c.Pins[1].PinName))
+			}
+			wantContra := "[merged DEV2.A2/DEV1.A2 missing DEV0.A2/DEV2.A1]"
+			if fmt.Sprint(got) != wantContra {
+				t.Errorf("contradictions = %v, want %s", got, wantContra)
+			}
+		})
+	}
+}
+
+// TestDiscoverNetlistSeededPartial checks that a seeded run that fails
+// still returns its partial netlist with the seed's net names.
+func TestDiscoverNetlistSeededPartial(t *testing.T) {
+	seed := seedNetlist([]string{"DEV0.A1", "DEV1.A3"})
+	seed.Finalize()
+	if err := seed.RenameNet(seed.Nets[0].ID, "BOOT"); err != nil {
+		t.Fatalf("RenameNet failed: %v", err)
+	}
+
+	board := &codedBoard{nets: [][]string{{"DEV0.A1", "DEV1.A3"}, {"DEV1.A2", "DEV2.A3"}}}
+	ctl := newCodedBoardController(t, board)
+	board.fail = func(tdi []bool) error {
+		// DEV2 is first in the chain: A2 output cell 4, control cell 5
+		if tdi[4] && !tdi[5] {
+			return fmt.Errorf("USB transfer lost")
+		}
+		return nil
+	}
+
+	cfg := DefaultConfig()
+	cfg.SkipKnownJTAGPins = false
+	cfg.SkipPowerPins = false
+	cfg.Seed = seed
+	nl, err := DiscoverNetlist(context.Background(), ctl, cfg, nil)
+	if err == nil || nl == nil {
+		t.Fatalf("DiscoverNetlist = %v, %v; want a partial netlist and an error", nl, err)
+	}
+	if got := fmt.Sprint(multiPinNets(nl)); got != "[DEV0.A1,DEV1.A3 DEV1.A2,DEV2.A3]" {
+		t.Fatalf("partial nets = %s", got)
+	}
+	if name := nl.NetName(nl.Nets[0]); name != "BOOT" {
+		t.Errorf("partial net 0 named %s, want BOOT", name)
+	}
+}